@@ -0,0 +1,78 @@
+// Package admission decides whether a runner has enough resources
+// available to accept a new task.
+package admission
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Reasons reported when a task is not admitted
+const (
+	ReasonHostMemory    = "host_memory"
+	ReasonProcessMemory = "process_memory"
+	ReasonCPU           = "cpu"
+)
+
+// Controller decides whether a new task can be accepted. If not,
+// it returns the reason the runner is resource constrained.
+type Controller interface {
+	Admit() (bool, string)
+}
+
+// Resources is a controller which refuses tasks when the resource
+// usage of the host or process is above the configured thresholds.
+// A threshold of zero disables the corresponding check.
+type Resources struct {
+	MaxHostMemoryPercent float64 // percentage of host memory in use
+	MaxProcessMemory     uint64  // resident memory of the process in bytes
+	MaxCPUPercent        float64 // percentage of host CPU in use
+
+	mu       sync.Mutex
+	sampler  *sampler
+	rejected map[string]int64
+}
+
+// Admit samples the resource usage and compares it against the thresholds
+func (r *Resources) Admit() (bool, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sampler == nil {
+		r.sampler = &sampler{}
+	}
+	if r.MaxHostMemoryPercent > 0 {
+		if used, ok := r.sampler.hostMemoryPercent(); ok && used > r.MaxHostMemoryPercent {
+			return r.reject(ReasonHostMemory, fmt.Sprintf("host memory usage %.1f%% is above %.1f%%", used, r.MaxHostMemoryPercent))
+		}
+	}
+	if r.MaxProcessMemory > 0 {
+		if rss, ok := r.sampler.processMemory(); ok && rss > r.MaxProcessMemory {
+			return r.reject(ReasonProcessMemory, fmt.Sprintf("process memory %d bytes is above %d bytes", rss, r.MaxProcessMemory))
+		}
+	}
+	if r.MaxCPUPercent > 0 {
+		if used, ok := r.sampler.cpuPercent(); ok && used > r.MaxCPUPercent {
+			return r.reject(ReasonCPU, fmt.Sprintf("cpu usage %.1f%% is above %.1f%%", used, r.MaxCPUPercent))
+		}
+	}
+	return true, ""
+}
+
+// Rejected returns the number of times tasks were refused, per reason
+func (r *Resources) Rejected() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := map[string]int64{}
+	for k, v := range r.rejected {
+		out[k] = v
+	}
+	return out
+}
+
+func (r *Resources) reject(reason, msg string) (bool, string) {
+	if r.rejected == nil {
+		r.rejected = map[string]int64{}
+	}
+	r.rejected[reason]++
+	return false, reason + ": " + msg
+}
@@ -0,0 +1,109 @@
+package admission
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minCPUSampleInterval is the minimum time between two CPU samples. Samples
+// taken closer together are too noisy, the last value is reused instead.
+const minCPUSampleInterval = time.Second
+
+// sampler reads resource usage from procfs
+type sampler struct {
+	lastSample time.Time
+	lastIdle   uint64
+	lastTotal  uint64
+	lastCPU    float64
+}
+
+// hostMemoryPercent returns the percentage of host memory which is not available
+func (s *sampler) hostMemoryPercent() (float64, bool) {
+	fields, err := readKV("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	total, avail := fields["MemTotal"], fields["MemAvailable"]
+	if total == 0 {
+		return 0, false
+	}
+	return float64(total-avail) / float64(total) * 100, true
+}
+
+// processMemory returns the resident set size of the process in bytes
+func (s *sampler) processMemory() (uint64, bool) {
+	fields, err := readKV("/proc/self/status")
+	if err != nil {
+		return 0, false
+	}
+	rss, ok := fields["VmRSS"]
+	return rss, ok
+}
+
+// cpuPercent returns the host CPU usage since the previous sample
+func (s *sampler) cpuPercent() (float64, bool) {
+	if time.Since(s.lastSample) < minCPUSampleInterval {
+		return s.lastCPU, !s.lastSample.IsZero()
+	}
+	b, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, false
+	}
+	line, _, _ := bytes.Cut(b, []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, false
+	}
+	var idle, total uint64
+	for i, f := range fields[1:] {
+		v, _ := strconv.ParseUint(f, 10, 64)
+		total += v
+		if i == 3 || i == 4 { // idle and iowait
+			idle += v
+		}
+	}
+	first := s.lastSample.IsZero()
+	dIdle, dTotal := idle-s.lastIdle, total-s.lastTotal
+	s.lastSample, s.lastIdle, s.lastTotal = time.Now(), idle, total
+	if first || dTotal == 0 {
+		// a single sample only holds the usage since boot
+		s.lastCPU = float64(total-idle) / float64(total) * 100
+		return s.lastCPU, true
+	}
+	s.lastCPU = float64(dTotal-dIdle) / float64(dTotal) * 100
+	return s.lastCPU, true
+}
+
+// readKV reads a procfs file with "Key: value kB" lines. Values are returned in bytes.
+func readKV(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		out[k] = n
+	}
+	return out, scanner.Err()
+}
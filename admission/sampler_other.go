@@ -0,0 +1,22 @@
+//go:build !linux
+
+package admission
+
+import "runtime"
+
+// sampler only supports the process memory on platforms without procfs
+type sampler struct{}
+
+func (s *sampler) hostMemoryPercent() (float64, bool) {
+	return 0, false
+}
+
+func (s *sampler) processMemory() (uint64, bool) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys, true
+}
+
+func (s *sampler) cpuPercent() (float64, bool) {
+	return 0, false
+}
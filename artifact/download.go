@@ -0,0 +1,141 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaxDownloadSize bounds the size of a download
+const defaultMaxDownloadSize = 256 << 20
+
+// ErrTooLarge is returned when a download exceeds the maximum size
+var ErrTooLarge = errors.New("download exceeds the maximum size")
+
+// ChecksumError is returned when the checksum of a download does not match
+type ChecksumError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected sha256 %s, got %s", e.Expected, e.Actual)
+}
+
+// Downloader downloads files, e.g. task inputs at pre-signed URLs, with
+// retries on network errors and server errors
+type Downloader struct {
+	Client *http.Client
+	// MaxElapsedTime bounds the total time spent retrying a download
+	MaxElapsedTime time.Duration
+	// MaxSize bounds the size of a download, defaults to 256MB
+	MaxSize int64
+}
+
+// NewDownloader returns a downloader using the default http client
+func NewDownloader() *Downloader {
+	return &Downloader{
+		Client:         http.DefaultClient,
+		MaxElapsedTime: defaultMaxElapsedTime,
+		MaxSize:        defaultMaxDownloadSize,
+	}
+}
+
+// Get downloads the URL into memory. The size and the hex encoded SHA-256
+// checksum are verified unless they are empty.
+func (d *Downloader) Get(ctx context.Context, rawURL string, size int64, checksum string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported download URL scheme: %s", u.Scheme)
+	}
+	limit := d.maxSize()
+	if size > limit {
+		return nil, ErrTooLarge
+	}
+	var data []byte
+	err = d.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		data, err = d.fetch(req, limit)
+		if err != nil {
+			return err
+		}
+		if size > 0 && int64(len(data)) != size {
+			return fmt.Errorf("download is %d bytes, expected %d", len(data), size)
+		}
+		if checksum != "" {
+			sum := sha256.Sum256(data)
+			if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, checksum) {
+				return backoff.Permanent(&ChecksumError{Expected: checksum, Actual: actual})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fetch sends the request and reads at most limit bytes of the response
+func (d *Downloader) fetch(req *http.Request, limit int64) ([]byte, error) {
+	c := d.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode >= 500, res.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("download failed: %s", res.Status)
+	case res.StatusCode > 299:
+		return nil, backoff.Permanent(fmt.Errorf("download failed: %s", res.Status))
+	case res.ContentLength > limit:
+		return nil, backoff.Permanent(ErrTooLarge)
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(res.Body, limit+1)); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) > limit {
+		return nil, backoff.Permanent(ErrTooLarge)
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *Downloader) maxSize() int64 {
+	if d.MaxSize > 0 {
+		return d.MaxSize
+	}
+	return defaultMaxDownloadSize
+}
+
+func (d *Downloader) retry(ctx context.Context, fn func() error) error {
+	exp := backoff.NewExponentialBackOff()
+	exp.MaxElapsedTime = d.MaxElapsedTime
+	if exp.MaxElapsedTime == 0 {
+		exp.MaxElapsedTime = defaultMaxElapsedTime
+	}
+	return backoff.RetryNotify(fn, backoff.WithContext(exp, ctx), func(err error, d time.Duration) {
+		logrus.WithError(err).Warnf("download failed, retrying in %s", d)
+	})
+}
@@ -0,0 +1,175 @@
+// Package artifact helps task handlers upload output files, either to a
+// pre-signed URL provided in the task payload or to the manager, and
+// downloads task inputs stored outside of the task.
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
+)
+
+var defaultMaxElapsedTime = 5 * time.Minute
+
+// Result describes an uploaded file
+type Result struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Uploader uploads files with retries on network errors and server errors
+type Uploader struct {
+	Client *http.Client
+	// Authorize is called on every request sent to the manager, e.g. to add the
+	// delegate token. It is not called for pre-signed URLs.
+	Authorize func(*http.Request) error
+	// MaxElapsedTime bounds the total time spent retrying an upload
+	MaxElapsedTime time.Duration
+}
+
+// New returns an uploader using the default http client
+func New() *Uploader {
+	return &Uploader{
+		Client:         http.DefaultClient,
+		MaxElapsedTime: defaultMaxElapsedTime,
+	}
+}
+
+// Put streams the file at path to a pre-signed URL with a PUT request
+func (u *Uploader) Put(ctx context.Context, url, path string) (*Result, error) {
+	var res *Result
+	err := u.retry(ctx, func() error {
+		f, err := os.Open(path)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		h := sha256.New()
+		req, err := http.NewRequestWithContext(ctx, "PUT", url, io.TeeReader(f, h))
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		req.ContentLength = info.Size()
+		if err := u.send(req); err != nil {
+			return err
+		}
+		res = &Result{Name: filepath.Base(path), Size: info.Size(), SHA256: hex.EncodeToString(h.Sum(nil))}
+		return nil
+	})
+	return res, err
+}
+
+// Post streams the files at paths to the manager as a multipart form. Each file is
+// sent in a "file" part followed by a "sha256" field holding its checksum.
+func (u *Uploader) Post(ctx context.Context, url string, paths ...string) ([]*Result, error) {
+	var results []*Result
+	err := u.retry(ctx, func() error {
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		out := make(chan []*Result, 1)
+		go func() {
+			r, err := writeParts(mw, paths)
+			if err == nil {
+				err = mw.Close()
+			}
+			out <- r
+			pw.CloseWithError(err)
+		}()
+		req, err := http.NewRequestWithContext(ctx, "POST", url, pr)
+		if err != nil {
+			pr.Close()
+			return backoff.Permanent(err)
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		if u.Authorize != nil {
+			if err := u.Authorize(req); err != nil {
+				pr.Close()
+				return backoff.Permanent(err)
+			}
+		}
+		err = u.send(req)
+		pr.Close()
+		r := <-out
+		if err != nil {
+			return err
+		}
+		results = r
+		return nil
+	})
+	return results, err
+}
+
+// writeParts writes the files and their checksums to the multipart writer
+func writeParts(mw *multipart.Writer, paths []string) ([]*Result, error) {
+	var results []*Result
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		part, err := mw.CreateFormFile("file", filepath.Base(path))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(part, h), f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		sum := hex.EncodeToString(h.Sum(nil))
+		if err := mw.WriteField("sha256", sum); err != nil {
+			return nil, err
+		}
+		results = append(results, &Result{Name: filepath.Base(path), Size: n, SHA256: sum})
+	}
+	return results, nil
+}
+
+// send sends the request and classifies the response. Server errors are retried.
+func (u *Uploader) send(req *http.Request) error {
+	c := u.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	switch {
+	case res.StatusCode >= 500:
+		return fmt.Errorf("upload failed: %s: %s", res.Status, body)
+	case res.StatusCode > 299:
+		return backoff.Permanent(fmt.Errorf("upload failed: %s: %s", res.Status, body))
+	}
+	return nil
+}
+
+func (u *Uploader) retry(ctx context.Context, fn func() error) error {
+	exp := backoff.NewExponentialBackOff()
+	exp.MaxElapsedTime = u.MaxElapsedTime
+	if exp.MaxElapsedTime == 0 {
+		exp.MaxElapsedTime = defaultMaxElapsedTime
+	}
+	return backoff.RetryNotify(fn, backoff.WithContext(exp, ctx), func(err error, d time.Duration) {
+		logrus.WithError(err).Warnf("artifact upload failed, retrying in %s", d)
+	})
+}
@@ -0,0 +1,91 @@
+// Package audit records every task executed by a runner in an append-only
+// log, e.g. to satisfy compliance requirements.
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Statuses recorded for tasks which did not complete with a task status code
+const (
+	StatusRejected = "REJECTED"
+	StatusError    = "ERROR" // the task could not be executed or its status not sent
+)
+
+// Record is the audit record of a task
+type Record struct {
+	TaskID     string    `json:"task_id"`
+	TaskType   string    `json:"task_type"`
+	AccountID  string    `json:"account_id"`
+	DelegateID string    `json:"delegate_id"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// A Sink stores audit records
+type Sink interface {
+	Write(r *Record) error
+}
+
+// SinkFunc is an adapter to use a function as a sink
+type SinkFunc func(r *Record) error
+
+// Write calls f(r)
+func (f SinkFunc) Write(r *Record) error {
+	return f(r)
+}
+
+// Multi writes the records to all the sinks and returns the first error
+func Multi(sinks ...Sink) Sink {
+	return SinkFunc(func(r *Record) error {
+		var first error
+		for _, s := range sinks {
+			if err := s.Write(r); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	})
+}
+
+// File appends the records to a file as JSON lines. Every record is
+// synced to disk before Write returns.
+type File struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFile opens the audit file at path for appending, creating it if needed
+func NewFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f: f}, nil
+}
+
+// Write appends the record to the file
+func (f *File) Write(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return f.f.Sync()
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Close()
+}
@@ -0,0 +1,170 @@
+// Package capability answers the capability check tasks of the manager, which
+// asks whether the runner can execute tasks with given requirements, e.g.
+// reaching a host or running a binary. Results are cached for a while.
+package capability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/httphelper"
+	"github.com/wings-software/dlite/task"
+)
+
+// TaskType is the type of the capability check tasks
+const TaskType = "CAPABILITY_CHECK"
+
+var (
+	defaultTTL          = 5 * time.Minute
+	defaultCheckTimeout = 10 * time.Second
+)
+
+// Check is a capability the manager asks about
+type Check struct {
+	Type  string `json:"type"`  // name of the checker, e.g. http or binary
+	Value string `json:"value"` // what to check, e.g. a URL or a binary name
+}
+
+// Request is the payload of a capability check task
+type Request struct {
+	Checks []Check `json:"checks"`
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Type      string    `json:"type"`
+	Value     string    `json:"value"`
+	Capable   bool      `json:"capable"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Response is the task response of a capability check task
+type Response struct {
+	Results []*Result `json:"results"`
+}
+
+// A Checker returns an error if the runner lacks the capability
+type Checker interface {
+	Check(ctx context.Context, value string) error
+}
+
+// CheckerFunc is an adapter to use a function as a checker
+type CheckerFunc func(ctx context.Context, value string) error
+
+// Check calls f(ctx, value)
+func (f CheckerFunc) Check(ctx context.Context, value string) error {
+	return f(ctx, value)
+}
+
+// Handler handles capability check tasks with the registered checkers
+type Handler struct {
+	TTL          time.Duration // how long results are cached
+	CheckTimeout time.Duration // bounds every check
+
+	mu       sync.Mutex
+	checkers map[string]Checker
+	cache    map[Check]*Result
+}
+
+// New returns a handler with the built-in http, dns, binary and env checkers
+func New() *Handler {
+	h := &Handler{
+		TTL:          defaultTTL,
+		CheckTimeout: defaultCheckTimeout,
+		checkers:     map[string]Checker{},
+		cache:        map[Check]*Result{},
+	}
+	h.Register("http", CheckerFunc(HTTP))
+	h.Register("dns", CheckerFunc(DNS))
+	h.Register("binary", CheckerFunc(Binary))
+	h.Register("env", CheckerFunc(Env))
+	return h
+}
+
+// Register registers a checker for a type of check, replacing the existing one
+func (h *Handler) Register(typ string, c Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checkers[typ] = c
+	for k := range h.cache {
+		if k.Type == typ {
+			delete(h.cache, k)
+		}
+	}
+}
+
+// Types returns the registered types of checks
+func (h *Handler) Types() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var types []string
+	for t := range h.checkers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ServeHTTP runs the checks of the task and writes their results
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t := &client.Task{}
+	req := &Request{}
+	if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+		task.WriteError(w, task.NewError("INVALID_TASK", client.CategoryUser, "could not decode the task", false, err))
+		return
+	}
+	if err := json.Unmarshal(t.Data, req); err != nil {
+		task.WriteError(w, task.NewError("INVALID_TASK", client.CategoryUser, "could not decode the capability checks", false, err))
+		return
+	}
+	resp := &Response{Results: make([]*Result, len(req.Checks))}
+	var wg sync.WaitGroup
+	for i, c := range req.Checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			resp.Results[i] = h.Check(r.Context(), c)
+		}(i, c)
+	}
+	wg.Wait()
+	httphelper.WriteJSON(w, resp, http.StatusOK)
+}
+
+// Check runs the check, or returns its cached result
+func (h *Handler) Check(ctx context.Context, c Check) *Result {
+	h.mu.Lock()
+	if res, ok := h.cache[c]; ok && time.Since(res.CheckedAt) < h.TTL {
+		h.mu.Unlock()
+		return res
+	}
+	checker, ok := h.checkers[c.Type]
+	h.mu.Unlock()
+
+	res := &Result{Type: c.Type, Value: c.Value, CheckedAt: time.Now()}
+	if !ok {
+		res.Error = fmt.Sprintf("unknown capability type: %s", c.Type)
+		return res
+	}
+	if h.CheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.CheckTimeout)
+		defer cancel()
+	}
+	if err := checker.Check(ctx, c.Value); err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Capable = true
+	}
+
+	h.mu.Lock()
+	h.cache[c] = res
+	h.mu.Unlock()
+	return res
+}
@@ -0,0 +1,50 @@
+package capability
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+)
+
+// HTTP checks that the URL can be reached. Any HTTP response counts,
+// including error statuses.
+func HTTP(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// DNS checks that the host name resolves
+func DNS(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("no addresses found for %s", host)
+	}
+	return nil
+}
+
+// Binary checks that the binary is in the PATH
+func Binary(_ context.Context, name string) error {
+	_, err := exec.LookPath(name)
+	return err
+}
+
+// Env checks that the environment variable is set
+func Env(_ context.Context, name string) error {
+	if _, ok := os.LookupEnv(name); !ok {
+		return fmt.Errorf("environment variable %s is not set", name)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+// Package chaos injects failures into the calls to the task server, so that
+// the resilience of the runner can be validated without a flaky manager.
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+)
+
+var _ client.Client = (*Client)(nil)
+
+// Faults are the probabilities, between 0 and 1, of the faults injected into
+// every call. At most one of timeout, server error and corrupt response is
+// injected per call; a slow response can precede any of them.
+type Faults struct {
+	Timeout     float64 // the call blocks until its context is done, at most a minute
+	ServerError float64 // the call fails with a 5xx ServerError
+	Corrupt     float64 // the call fails to decode a corrupted response
+	Slow        float64 // the call is delayed by up to Latency
+
+	// Latency is the maximum delay of slow calls, defaults to 5 seconds
+	Latency time.Duration
+	// Methods restricts the faults to the client methods, e.g. Acquire. All
+	// methods are affected if it is empty.
+	Methods []string
+}
+
+// ServerError is the error of a call failed with an injected server error
+type ServerError struct {
+	Method     string
+	StatusCode int
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("chaos: %s failed with status %d", e.Method, e.StatusCode)
+}
+
+// maxTimeout bounds the time a timed out call blocks
+var maxTimeout = time.Minute
+
+// serverErrors are the status codes of injected server errors
+var serverErrors = []int{500, 502, 503, 504}
+
+// Client injects faults into the calls to the wrapped client
+type Client struct {
+	Client client.Client
+	Faults Faults
+
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	methods map[string]bool
+}
+
+// New returns a client injecting the faults into the calls to c. Faults
+// are reproducible for a given seed.
+func New(c client.Client, f Faults, seed int64) *Client {
+	methods := map[string]bool{}
+	for _, m := range f.Methods {
+		methods[m] = true
+	}
+	return &Client{Client: c, Faults: f, rnd: rand.New(rand.NewSource(seed)), methods: methods} //nolint:gosec
+}
+
+// inject injects the faults into the call of the method and returns the
+// error the call fails with, nil if it is forwarded
+func (c *Client) inject(ctx context.Context, method string) error {
+	if len(c.methods) > 0 && !c.methods[method] {
+		return nil
+	}
+	c.mu.Lock()
+	slow, delay := c.rnd.Float64() < c.Faults.Slow, c.rnd.Float64()
+	p := c.rnd.Float64()
+	status := serverErrors[c.rnd.Intn(len(serverErrors))]
+	c.mu.Unlock()
+
+	if slow {
+		latency := c.Faults.Latency
+		if latency <= 0 {
+			latency = 5 * time.Second
+		}
+		d := time.Duration(delay * float64(latency))
+		logrus.WithField("method", method).WithField("delay", d).Debugln("chaos: delaying call")
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	switch {
+	case p < c.Faults.Timeout:
+		logrus.WithField("method", method).Debugln("chaos: timing out call")
+		t := time.NewTimer(maxTimeout)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			return context.DeadlineExceeded
+		}
+	case p < c.Faults.Timeout+c.Faults.ServerError:
+		logrus.WithField("method", method).WithField("status", status).Debugln("chaos: failing call with a server error")
+		return &ServerError{Method: method, StatusCode: status}
+	case p < c.Faults.Timeout+c.Faults.ServerError+c.Faults.Corrupt:
+		logrus.WithField("method", method).Debugln("chaos: corrupting response")
+		var v interface{}
+		return json.Unmarshal([]byte(`{"tasks":[{"id":"`), &v)
+	}
+	return nil
+}
+
+func (c *Client) Register(ctx context.Context, r *client.RegisterRequest) (*client.RegisterResponse, error) {
+	if err := c.inject(ctx, "Register"); err != nil {
+		return nil, err
+	}
+	return c.Client.Register(ctx, r)
+}
+
+func (c *Client) Heartbeat(ctx context.Context, r *client.RegisterRequest) error {
+	if err := c.inject(ctx, "Heartbeat"); err != nil {
+		return err
+	}
+	return c.Client.Heartbeat(ctx, r)
+}
+
+func (c *Client) GetTaskEvents(ctx context.Context, delegateID string) (*client.TaskEventsResponse, error) {
+	if err := c.inject(ctx, "GetTaskEvents"); err != nil {
+		return nil, err
+	}
+	return c.Client.GetTaskEvents(ctx, delegateID)
+}
+
+func (c *Client) GetTaskEventsPage(ctx context.Context, delegateID, pageToken string, limit int) (*client.TaskEventsResponse, error) {
+	if err := c.inject(ctx, "GetTaskEventsPage"); err != nil {
+		return nil, err
+	}
+	return c.Client.GetTaskEventsPage(ctx, delegateID, pageToken, limit)
+}
+
+func (c *Client) Acquire(ctx context.Context, delegateID, taskID string) (*client.Task, error) {
+	if err := c.inject(ctx, "Acquire"); err != nil {
+		return nil, err
+	}
+	return c.Client.Acquire(ctx, delegateID, taskID)
+}
+
+func (c *Client) AcquireBatch(ctx context.Context, delegateID string, taskIDs []string) ([]*client.Task, error) {
+	if err := c.inject(ctx, "AcquireBatch"); err != nil {
+		return nil, err
+	}
+	return c.Client.AcquireBatch(ctx, delegateID, taskIDs)
+}
+
+func (c *Client) CheckUpgrade(ctx context.Context, delegateID, version string) (*client.UpgradeResponse, error) {
+	if err := c.inject(ctx, "CheckUpgrade"); err != nil {
+		return nil, err
+	}
+	return c.Client.CheckUpgrade(ctx, delegateID, version)
+}
+
+func (c *Client) Reject(ctx context.Context, delegateID, taskID string, r *client.RejectRequest) error {
+	if err := c.inject(ctx, "Reject"); err != nil {
+		return err
+	}
+	return c.Client.Reject(ctx, delegateID, taskID, r)
+}
+
+func (c *Client) RenewLease(ctx context.Context, delegateID, taskID string) error {
+	if err := c.inject(ctx, "RenewLease"); err != nil {
+		return err
+	}
+	return c.Client.RenewLease(ctx, delegateID, taskID)
+}
+
+func (c *Client) SendStatus(ctx context.Context, delegateID, taskID string, r *client.TaskResponse) error {
+	if err := c.inject(ctx, "SendStatus"); err != nil {
+		return err
+	}
+	return c.Client.SendStatus(ctx, delegateID, taskID, r)
+}
+
+func (c *Client) SendStatusBatch(ctx context.Context, delegateID string, responses []*client.TaskResponse) error {
+	if err := c.inject(ctx, "SendStatusBatch"); err != nil {
+		return err
+	}
+	return c.Client.SendStatusBatch(ctx, delegateID, responses)
+}
+
+func (c *Client) AckEvents(ctx context.Context, delegateID string, acks []client.EventAck) error {
+	if err := c.inject(ctx, "AckEvents"); err != nil {
+		return err
+	}
+	return c.Client.AckEvents(ctx, delegateID, acks)
+}
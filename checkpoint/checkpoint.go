@@ -0,0 +1,119 @@
+// Package checkpoint lets the handlers of multi-stage tasks save the progress
+// of a task after each stage and resume from the last checkpoint when the task
+// is executed again, e.g. after the runner restarted.
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wings-software/dlite/store"
+)
+
+// ErrUnavailable is returned when checkpoints are saved but the runner has
+// no store which keeps them
+var ErrUnavailable = errors.New("checkpoint: the runner does not keep checkpoints")
+
+type key struct{}
+
+// Checkpoints are the checkpoints of a task
+type Checkpoints struct {
+	store  store.Checkpointer
+	taskID string
+
+	mu   sync.Mutex
+	last *store.Checkpoint
+}
+
+// New returns the checkpoints of the task kept in the store. The checkpoint
+// saved by a previous execution of the task is loaded.
+func New(ctx context.Context, s store.Checkpointer, taskID string) (*Checkpoints, error) {
+	c := &Checkpoints{store: s, taskID: taskID}
+	last, err := s.GetCheckpoint(ctx, taskID)
+	switch {
+	case err == store.ErrNotFound:
+	case err != nil:
+		return c, err
+	default:
+		c.last = last
+	}
+	return c, nil
+}
+
+// Save saves the stage and its data, encoded as JSON, as the checkpoint of the task
+func (c *Checkpoints) Save(ctx context.Context, stage string, data interface{}) error {
+	if c == nil {
+		return ErrUnavailable
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp := &store.Checkpoint{TaskID: c.taskID, Stage: stage, Data: b, Sequence: 1, SavedAt: time.Now()}
+	if c.last != nil {
+		cp.Sequence = c.last.Sequence + 1
+	}
+	if err := c.store.PutCheckpoint(ctx, cp); err != nil {
+		return err
+	}
+	c.last = cp
+	return nil
+}
+
+// Last returns the last checkpoint of the task
+func (c *Checkpoints) Last() (*store.Checkpoint, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last, c.last != nil
+}
+
+// Clear removes the checkpoint, e.g. once the task completed
+func (c *Checkpoints) Clear(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = nil
+	return c.store.DeleteCheckpoint(ctx, c.taskID)
+}
+
+// NewContext returns a copy of the context which carries the checkpoints
+func NewContext(ctx context.Context, c *Checkpoints) context.Context {
+	return context.WithValue(ctx, key{}, c)
+}
+
+// FromContext returns the checkpoints carried by the context, nil if there are none
+func FromContext(ctx context.Context) *Checkpoints {
+	c, _ := ctx.Value(key{}).(*Checkpoints)
+	return c
+}
+
+// Save saves the checkpoint of the task carried by the context
+func Save(ctx context.Context, stage string, data interface{}) error {
+	return FromContext(ctx).Save(ctx, stage, data)
+}
+
+// Resume returns the checkpoint the task carried by the context resumes from
+// and decodes its data into v, which can be nil. It returns false if the task
+// starts from the beginning.
+func Resume(ctx context.Context, v interface{}) (*store.Checkpoint, bool, error) {
+	cp, ok := FromContext(ctx).Last()
+	if !ok {
+		return nil, false, nil
+	}
+	if v != nil && len(cp.Data) > 0 {
+		if err := json.Unmarshal(cp.Data, v); err != nil {
+			return cp, true, err
+		}
+	}
+	return cp, true, nil
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"time"
 )
 
 // TODO: Make the structs more generic and remove Harness specific stuff
@@ -23,6 +24,42 @@ type (
 		IP                 string   `json:"ip,omitempty"`
 		SupportedTaskTypes []string `json:"supportedTaskTypes,omitempty"`
 		Tags               []string `json:"tags,omitempty"`
+		DelegateGroupName  string   `json:"delegateGroupName,omitempty"`
+		OrgIdentifier      string   `json:"orgIdentifier,omitempty"`
+		ProjectIdentifier  string   `json:"projectIdentifier,omitempty"`
+		Immutable          bool     `json:"immutable,omitempty"`
+
+		// Host describes the runner host, see delegate.WithAutoFingerprint
+		Host *HostInfo `json:"hostInfo,omitempty"`
+		// Platform is the platform tasks are routed on
+		Platform *Platform `json:"platform,omitempty"`
+	}
+
+	// Platform is the platform of a runner or the platform a task requires.
+	// Requirements which are not set match any runner.
+	Platform struct {
+		OS        string `json:"os,omitempty"`   // GOOS, e.g. linux or windows
+		Arch      string `json:"arch,omitempty"` // GOARCH, e.g. amd64 or arm64
+		Container bool   `json:"container,omitempty"`
+	}
+
+	// HostInfo is the fingerprint of the runner host
+	HostInfo struct {
+		OS               string            `json:"os,omitempty"`
+		Arch             string            `json:"arch,omitempty"`
+		Kernel           string            `json:"kernel,omitempty"`
+		ContainerRuntime string            `json:"containerRuntime,omitempty"`
+		Tools            map[string]string `json:"tools,omitempty"` // tool versions by name
+		Cloud            *CloudInfo        `json:"cloud,omitempty"`
+	}
+
+	// CloudInfo describes the cloud instance the runner is running on
+	CloudInfo struct {
+		Provider     string `json:"provider"`
+		Region       string `json:"region,omitempty"`
+		Zone         string `json:"zone,omitempty"`
+		InstanceType string `json:"instanceType,omitempty"`
+		InstanceID   string `json:"instanceId,omitempty"`
 	}
 
 	// Used in the java codebase :'(
@@ -34,14 +71,52 @@ type (
 		DelegateID string `json:"delegateId"`
 	}
 
+	// TokenExchangeRequest exchanges the delegate token, which authorizes the
+	// request, for a session token of a gateway in front of the manager
+	TokenExchangeRequest struct {
+		AccountID string `json:"accountId"`
+	}
+
+	TokenExchangeResponse struct {
+		Token     string `json:"token"`
+		ExpiresIn int64  `json:"expiresIn,omitempty"` // lifetime of the token in seconds
+	}
+
+	UpgradeResponse struct {
+		Resource UpgradeData `json:"resource"`
+	}
+
+	UpgradeData struct {
+		Upgrade bool   `json:"doUpgrade"`
+		Version string `json:"version,omitempty"` // version the runner should upgrade to
+	}
+
 	TaskEventsResponse struct {
-		TaskEvents []TaskEvent `json:"delegateTaskEvents"`
+		TaskEvents    []TaskEvent `json:"delegateTaskEvents"`
+		NextPageToken string      `json:"nextPageToken,omitempty"` // set if more events are available
 	}
 
 	TaskEvent struct {
 		AccountID string `json:"accountId"`
 		TaskID    string `json:"delegateTaskId"`
+		TaskType  string `json:"taskType,omitempty"` // sent by managers which support fair acquisition
 		Sync      bool   `json:"sync"`
+		Abort     bool   `json:"abort,omitempty"`
+		// NotBefore is the unix time in milliseconds before which the task must not run
+		NotBefore int64 `json:"notBefore,omitempty"`
+		// Expiry is the unix time in milliseconds at which the task expires
+		Expiry int64 `json:"expiry,omitempty"`
+		// Control is set on control messages, which carry no task
+		Control *ControlMessage `json:"control,omitempty"`
+	}
+
+	// ControlMessage carries configuration changes pushed by the manager.
+	// Fields which are not set are left unchanged.
+	ControlMessage struct {
+		Pause        *bool    `json:"pause,omitempty"`
+		Parallelism  int      `json:"parallelism,omitempty"`
+		PollInterval int64    `json:"pollIntervalMs,omitempty"`
+		Tags         []string `json:"tags,omitempty"` // selectors of the runner
 	}
 
 	Task struct {
@@ -49,10 +124,44 @@ type (
 		Type         string          `json:"type"`
 		Data         json.RawMessage `json:"data"`
 		Async        bool            `json:"async"`
-		Timeout      int             `json:"timeout"`
+		Timeout      int             `json:"timeout"` // in milliseconds, not limited if zero
 		Logging      LogInfo         `json:"logging"`
 		DelegateInfo DelegateInfo    `json:"delegate"`
 		Capabilities json.RawMessage `json:"capabilities"`
+		Secrets      []Secret        `json:"secrets,omitempty"`
+		// CorrelationID identifies the task across the manager and runner logs
+		CorrelationID string `json:"correlationId,omitempty"`
+		// SchemaVersion is the version of the task schema, see TaskSchemaVersion
+		SchemaVersion int `json:"schemaVersion,omitempty"`
+		// Platform is the platform the task requires, any if nil
+		Platform *Platform `json:"platform,omitempty"`
+		// Payload is set instead of Data if the task was too large to be kept
+		// in memory and was streamed to a temporary file.
+		Payload *Payload `json:"-"`
+		// DataRef is set instead of Data for large task inputs, which are
+		// downloaded before the task reaches its handler
+		DataRef *DataRef `json:"dataRef,omitempty"`
+		// Replayed is set if the manager recognized the acquisition as a retry
+		// of an earlier one which succeeded, and replayed its response
+		Replayed bool `json:"-"`
+	}
+
+	// DataRef refers to task data stored outside of the task, e.g. at a
+	// pre-signed URL. The size and checksum are verified if set.
+	DataRef struct {
+		URL    string `json:"url"`
+		Size   int64  `json:"size,omitempty"`
+		SHA256 string `json:"sha256,omitempty"` // hex encoded
+	}
+
+	// Secret is an encrypted task parameter. It is decrypted by the
+	// secret manager it refers to before the task reaches its handler.
+	Secret struct {
+		Name      string `json:"name"`
+		Manager   string `json:"manager"` // local, vault, kms
+		KeyID     string `json:"keyId,omitempty"`
+		Encrypted string `json:"encryptedValue,omitempty"`
+		Value     string `json:"value,omitempty"`
 	}
 
 	LogInfo struct {
@@ -66,12 +175,101 @@ type (
 		Token      string `json:"token"`
 	}
 
+	AcquireBatchRequest struct {
+		TaskIDs []string `json:"taskIds"`
+	}
+
+	AcquireBatchResponse struct {
+		Tasks []*Task `json:"tasks"`
+	}
+
+	StatusBatchRequest struct {
+		Responses []*TaskResponse `json:"responses"`
+	}
+
+	// EventAck acknowledges a task event which the runner handled, i.e.
+	// acquired or applied, or ignored, so that the server stops delivering it
+	EventAck struct {
+		TaskID  string `json:"taskId"`
+		Handled bool   `json:"handled"`
+		Reason  string `json:"reason,omitempty"` // why an ignored event was not handled
+	}
+
+	AckEventsRequest struct {
+		Acks []EventAck `json:"acks"`
+	}
+
+	RejectRequest struct {
+		Reason string `json:"reason"`
+		Code   string `json:"code,omitempty"` // machine readable reason, e.g. PLATFORM_MISMATCH
+	}
+
 	TaskResponse struct {
-		ID   string          `json:"id"`
-		Data json.RawMessage `json:"data"`
-		Type string          `json:"type"`
-		Code string          `json:"code"` // OK, FAILED, RETRY_ON_OTHER_DELEGATE
+		ID    string          `json:"id"`
+		Data  json.RawMessage `json:"data"`
+		Type  string          `json:"type"`
+		Code  string          `json:"code"` // OK, FAILED, RETRY_ON_OTHER_DELEGATE
+		Error *TaskError      `json:"error,omitempty"`
+		// Resume is set if the task resumed from a checkpoint
+		Resume *ResumeInfo `json:"resume,omitempty"`
+		// Usage is the resources consumed by the task handler, if measured
+		Usage *ResourceUsage `json:"usage,omitempty"`
 	}
+
+	// ResourceUsage is the resources consumed by a task handler. Handlers
+	// share the runner process, so CPU time and memory are measured for the
+	// process, or its cgroup, and include the usage of concurrent tasks if
+	// Shared is set.
+	ResourceUsage struct {
+		WallTimeMs        int64  `json:"wallTimeMs"`
+		CPUTimeMs         int64  `json:"cpuTimeMs,omitempty"`
+		PeakRSSDeltaBytes int64  `json:"peakRssDeltaBytes,omitempty"` // peak resident memory above the start of the task
+		Source            string `json:"source"`                      // process or cgroup
+		Shared            bool   `json:"shared,omitempty"`
+	}
+
+	// ResumeInfo describes the checkpoint a task resumed from after it was
+	// executed again, e.g. after a runner restart
+	ResumeInfo struct {
+		Stage          string    `json:"stage"`
+		Sequence       int       `json:"sequence"`
+		CheckpointedAt time.Time `json:"checkpointedAt"`
+		Attempt        int       `json:"attempt"`
+	}
+
+	// OutputChunk is incremental output of a running task. It is sent as the
+	// data of a RUNNING status.
+	OutputChunk struct {
+		Output string `json:"output"`
+		Offset int64  `json:"offset"` // number of bytes of output sent before
+	}
+
+	// TaskError describes why a task failed
+	TaskError struct {
+		Code      string `json:"code"`      // machine readable error code
+		Category  string `json:"category"`  // see the Category constants
+		Message   string `json:"message"`   // user facing message
+		Retryable bool   `json:"retryable"` // whether the task may succeed on another runner
+	}
+)
+
+// TaskSchemaVersion is the newest version of the task schema supported by the client
+const TaskSchemaVersion = 1
+
+// Task response codes
+const (
+	CodeOK      = "OK"
+	CodeFailed  = "FAILED"
+	CodeRetry   = "RETRY_ON_OTHER_DELEGATE"
+	CodeRunning = "RUNNING"
+)
+
+// Task error categories
+const (
+	CategoryUser           = "USER"           // invalid task input
+	CategoryInfrastructure = "INFRASTRUCTURE" // problems with the runner host or its dependencies
+	CategoryTimeout        = "TIMEOUT"
+	CategoryInternal       = "INTERNAL" // bugs in the task handler
 )
 
 // Client is an interface which defines methods on interacting with a task managing system.
@@ -85,9 +283,34 @@ type Client interface {
 	// GetTaskEvents gets a list of pending tasks that need to be executed for this runner
 	GetTaskEvents(ctx context.Context, delegateID string) (*TaskEventsResponse, error)
 
+	// GetTaskEventsPage gets a page of at most limit pending task events, starting at the page token.
+	// An empty page token returns the first page.
+	GetTaskEventsPage(ctx context.Context, delegateID, pageToken string, limit int) (*TaskEventsResponse, error)
+
 	// Acquire tells the task server that the runner is ready to execute a task ID
 	Acquire(ctx context.Context, delegateID, taskID string) (*Task, error)
 
+	// AcquireBatch tries to acquire multiple task IDs in a single call. It returns the
+	// tasks which could be acquired.
+	AcquireBatch(ctx context.Context, delegateID string, taskIDs []string) ([]*Task, error)
+
+	// CheckUpgrade asks the task server whether the runner needs to be upgraded from its current version
+	CheckUpgrade(ctx context.Context, delegateID, version string) (*UpgradeResponse, error)
+
+	// Reject gives a task which the runner can not execute back to the task server
+	Reject(ctx context.Context, delegateID, taskID string, req *RejectRequest) error
+
+	// RenewLease tells the task server that the runner is still executing a task,
+	// so that the task is not reassigned to another runner
+	RenewLease(ctx context.Context, delegateID, taskID string) error
+
 	// SendStatus sends a response to the task server for a task ID
 	SendStatus(ctx context.Context, delegateID, taskID string, req *TaskResponse) error
+
+	// SendStatusBatch sends the responses of multiple tasks in a single call
+	SendStatusBatch(ctx context.Context, delegateID string, responses []*TaskResponse) error
+
+	// AckEvents acknowledges the task events the runner handled or ignored in
+	// a single call, so that the task server prunes them from its event queue
+	AckEvents(ctx context.Context, delegateID string, acks []EventAck) error
 }
@@ -0,0 +1,303 @@
+// Package clienttest provides an in-memory implementation of client.Client
+// so that pollers and task handlers can be tested without an HTTP server.
+package clienttest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/wings-software/dlite/client"
+)
+
+var _ client.Client = (*Fake)(nil)
+
+// ErrTaskNotFound is returned by Acquire when the task was never added
+var ErrTaskNotFound = errors.New("task not found")
+
+// Call is a recorded call on the fake client
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Fake is an in-memory client. By default tasks added with AddTask are
+// returned as task events, can be acquired once, and statuses are recorded.
+// Any of the methods can be scripted by setting the corresponding Func field.
+type Fake struct {
+	DelegateID string
+
+	RegisterFunc          func(ctx context.Context, r *client.RegisterRequest) (*client.RegisterResponse, error)
+	HeartbeatFunc         func(ctx context.Context, r *client.RegisterRequest) error
+	GetTaskEventsFunc     func(ctx context.Context, delegateID string) (*client.TaskEventsResponse, error)
+	GetTaskEventsPageFunc func(ctx context.Context, delegateID, pageToken string, limit int) (*client.TaskEventsResponse, error)
+	AcquireFunc           func(ctx context.Context, delegateID, taskID string) (*client.Task, error)
+	AcquireBatchFunc      func(ctx context.Context, delegateID string, taskIDs []string) ([]*client.Task, error)
+	RejectFunc            func(ctx context.Context, delegateID, taskID string, r *client.RejectRequest) error
+	CheckUpgradeFunc      func(ctx context.Context, delegateID, version string) (*client.UpgradeResponse, error)
+	RenewLeaseFunc        func(ctx context.Context, delegateID, taskID string) error
+	SendStatusFunc        func(ctx context.Context, delegateID, taskID string, r *client.TaskResponse) error
+	SendStatusBatchFunc   func(ctx context.Context, delegateID string, responses []*client.TaskResponse) error
+	AckEventsFunc         func(ctx context.Context, delegateID string, acks []client.EventAck) error
+
+	mu       sync.Mutex
+	calls    []Call
+	events   []client.TaskEvent
+	tasks    map[string]*client.Task
+	statuses map[string]*client.TaskResponse
+	rejected map[string]*client.RejectRequest
+	waiters  map[string][]chan *client.TaskResponse
+}
+
+// New returns a new fake client
+func New() *Fake {
+	return &Fake{
+		DelegateID: "fake-delegate",
+		tasks:      map[string]*client.Task{},
+		statuses:   map[string]*client.TaskResponse{},
+		rejected:   map[string]*client.RejectRequest{},
+		waiters:    map[string][]chan *client.TaskResponse{},
+	}
+}
+
+// AddTask makes the task available for acquisition and queues a task event for it
+func (f *Fake) AddTask(t *client.Task) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tasks[t.ID] = t
+	f.events = append(f.events, client.TaskEvent{TaskID: t.ID})
+}
+
+// AddEvent queues a task event without making any task available
+func (f *Fake) AddEvent(ev client.TaskEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, ev)
+}
+
+// Calls returns all the calls made to the client
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallCount returns the number of calls made to a method
+func (f *Fake) CallCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// Status returns the last status sent for a task
+func (f *Fake) Status(taskID string) (*client.TaskResponse, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r, ok := f.statuses[taskID]
+	return r, ok
+}
+
+// WaitForStatus blocks until a status has been sent for the task or the context is done
+func (f *Fake) WaitForStatus(ctx context.Context, taskID string) (*client.TaskResponse, error) {
+	f.mu.Lock()
+	if r, ok := f.statuses[taskID]; ok {
+		f.mu.Unlock()
+		return r, nil
+	}
+	ch := make(chan *client.TaskResponse, 1)
+	f.waiters[taskID] = append(f.waiters[taskID], ch)
+	f.mu.Unlock()
+	select {
+	case r := <-ch:
+		return r, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Register records the call and returns the delegate ID of the fake
+func (f *Fake) Register(ctx context.Context, r *client.RegisterRequest) (*client.RegisterResponse, error) {
+	f.record("Register", r)
+	if f.RegisterFunc != nil {
+		return f.RegisterFunc(ctx, r)
+	}
+	return &client.RegisterResponse{Resource: client.RegistrationData{DelegateID: f.DelegateID}}, nil
+}
+
+// Heartbeat records the call
+func (f *Fake) Heartbeat(ctx context.Context, r *client.RegisterRequest) error {
+	f.record("Heartbeat", r)
+	if f.HeartbeatFunc != nil {
+		return f.HeartbeatFunc(ctx, r)
+	}
+	return nil
+}
+
+// GetTaskEvents returns and clears the queued task events
+func (f *Fake) GetTaskEvents(ctx context.Context, delegateID string) (*client.TaskEventsResponse, error) {
+	f.record("GetTaskEvents", delegateID)
+	if f.GetTaskEventsFunc != nil {
+		return f.GetTaskEventsFunc(ctx, delegateID)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	events := f.events
+	f.events = nil
+	return &client.TaskEventsResponse{TaskEvents: events}, nil
+}
+
+// GetTaskEventsPage returns and clears up to limit queued task events. The next
+// page token is set if more events are queued.
+func (f *Fake) GetTaskEventsPage(ctx context.Context, delegateID, pageToken string, limit int) (*client.TaskEventsResponse, error) {
+	f.record("GetTaskEventsPage", delegateID, pageToken, limit)
+	if f.GetTaskEventsPageFunc != nil {
+		return f.GetTaskEventsPageFunc(ctx, delegateID, pageToken, limit)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &client.TaskEventsResponse{}
+	n := len(f.events)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	resp.TaskEvents, f.events = f.events[:n], f.events[n:]
+	if len(f.events) > 0 {
+		resp.NextPageToken = "next"
+	}
+	return resp, nil
+}
+
+// Acquire returns a task added with AddTask. A task can only be acquired once.
+func (f *Fake) Acquire(ctx context.Context, delegateID, taskID string) (*client.Task, error) {
+	f.record("Acquire", delegateID, taskID)
+	if f.AcquireFunc != nil {
+		return f.AcquireFunc(ctx, delegateID, taskID)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.tasks[taskID]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	delete(f.tasks, taskID)
+	return t, nil
+}
+
+// AcquireBatch acquires each of the tasks added with AddTask
+func (f *Fake) AcquireBatch(ctx context.Context, delegateID string, taskIDs []string) ([]*client.Task, error) {
+	f.record("AcquireBatch", delegateID, taskIDs)
+	if f.AcquireBatchFunc != nil {
+		return f.AcquireBatchFunc(ctx, delegateID, taskIDs)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var tasks []*client.Task
+	for _, id := range taskIDs {
+		if t, ok := f.tasks[id]; ok {
+			delete(f.tasks, id)
+			tasks = append(tasks, t)
+		}
+	}
+	if len(tasks) == 0 {
+		return nil, ErrTaskNotFound
+	}
+	return tasks, nil
+}
+
+// Reject records the rejection
+func (f *Fake) Reject(ctx context.Context, delegateID, taskID string, r *client.RejectRequest) error {
+	f.record("Reject", delegateID, taskID, r)
+	if f.RejectFunc != nil {
+		return f.RejectFunc(ctx, delegateID, taskID, r)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rejected[taskID] = r
+	return nil
+}
+
+// Rejection returns the rejection sent for a task
+func (f *Fake) Rejection(taskID string) (*client.RejectRequest, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r, ok := f.rejected[taskID]
+	return r, ok
+}
+
+// CheckUpgrade records the call and reports that no upgrade is required
+func (f *Fake) CheckUpgrade(ctx context.Context, delegateID, version string) (*client.UpgradeResponse, error) {
+	f.record("CheckUpgrade", delegateID, version)
+	if f.CheckUpgradeFunc != nil {
+		return f.CheckUpgradeFunc(ctx, delegateID, version)
+	}
+	return &client.UpgradeResponse{}, nil
+}
+
+// RenewLease records the call
+func (f *Fake) RenewLease(ctx context.Context, delegateID, taskID string) error {
+	f.record("RenewLease", delegateID, taskID)
+	if f.RenewLeaseFunc != nil {
+		return f.RenewLeaseFunc(ctx, delegateID, taskID)
+	}
+	return nil
+}
+
+// SendStatus records the status of the task
+func (f *Fake) SendStatus(ctx context.Context, delegateID, taskID string, r *client.TaskResponse) error {
+	f.record("SendStatus", delegateID, taskID, r)
+	if f.SendStatusFunc != nil {
+		if err := f.SendStatusFunc(ctx, delegateID, taskID, r); err != nil {
+			return err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setStatus(taskID, r)
+	return nil
+}
+
+// SendStatusBatch records the status of each of the tasks
+func (f *Fake) SendStatusBatch(ctx context.Context, delegateID string, responses []*client.TaskResponse) error {
+	f.record("SendStatusBatch", delegateID, responses)
+	if f.SendStatusBatchFunc != nil {
+		if err := f.SendStatusBatchFunc(ctx, delegateID, responses); err != nil {
+			return err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range responses {
+		f.setStatus(r.ID, r)
+	}
+	return nil
+}
+
+// AckEvents records the call
+func (f *Fake) AckEvents(ctx context.Context, delegateID string, acks []client.EventAck) error {
+	f.record("AckEvents", delegateID, acks)
+	if f.AckEventsFunc != nil {
+		return f.AckEventsFunc(ctx, delegateID, acks)
+	}
+	return nil
+}
+
+// setStatus records the status and wakes up the waiters. f.mu must be held.
+func (f *Fake) setStatus(taskID string, r *client.TaskResponse) {
+	f.statuses[taskID] = r
+	for _, ch := range f.waiters[taskID] {
+		ch <- r
+	}
+	delete(f.waiters, taskID)
+}
+
+func (f *Fake) record(method string, args ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+}
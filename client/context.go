@@ -0,0 +1,17 @@
+package client
+
+import "context"
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of the context which carries the correlation ID
+// of the task being processed. Clients send it along with their requests.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by the context, if any.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
@@ -0,0 +1,23 @@
+package client
+
+import (
+	"io"
+	"os"
+)
+
+// Payload is a task which was streamed to a temporary file. The file holds
+// the task as it was sent by the server, including the data.
+type Payload struct {
+	Path string
+	Size int64
+}
+
+// Open opens the file holding the task
+func (p *Payload) Open() (io.ReadCloser, error) {
+	return os.Open(p.Path)
+}
+
+// Remove removes the file holding the task
+func (p *Payload) Remove() error {
+	return os.Remove(p.Path)
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Switch is a client which forwards every call to the current client. The
+// current client can be replaced while calls are in flight, e.g. after the
+// credentials were rotated. Calls in flight complete on the previous client.
+type Switch struct {
+	v atomic.Value
+}
+
+type current struct{ Client }
+
+// NewSwitch returns a switch forwarding calls to c
+func NewSwitch(c Client) *Switch {
+	s := &Switch{}
+	s.Set(c)
+	return s
+}
+
+// Set replaces the current client
+func (s *Switch) Set(c Client) {
+	s.v.Store(current{c})
+}
+
+// Current returns the current client
+func (s *Switch) Current() Client {
+	return s.v.Load().(current).Client
+}
+
+func (s *Switch) Register(ctx context.Context, r *RegisterRequest) (*RegisterResponse, error) {
+	return s.Current().Register(ctx, r)
+}
+
+func (s *Switch) Heartbeat(ctx context.Context, r *RegisterRequest) error {
+	return s.Current().Heartbeat(ctx, r)
+}
+
+func (s *Switch) GetTaskEvents(ctx context.Context, delegateID string) (*TaskEventsResponse, error) {
+	return s.Current().GetTaskEvents(ctx, delegateID)
+}
+
+func (s *Switch) GetTaskEventsPage(ctx context.Context, delegateID, pageToken string, limit int) (*TaskEventsResponse, error) {
+	return s.Current().GetTaskEventsPage(ctx, delegateID, pageToken, limit)
+}
+
+func (s *Switch) Acquire(ctx context.Context, delegateID, taskID string) (*Task, error) {
+	return s.Current().Acquire(ctx, delegateID, taskID)
+}
+
+func (s *Switch) AcquireBatch(ctx context.Context, delegateID string, taskIDs []string) ([]*Task, error) {
+	return s.Current().AcquireBatch(ctx, delegateID, taskIDs)
+}
+
+func (s *Switch) CheckUpgrade(ctx context.Context, delegateID, version string) (*UpgradeResponse, error) {
+	return s.Current().CheckUpgrade(ctx, delegateID, version)
+}
+
+func (s *Switch) Reject(ctx context.Context, delegateID, taskID string, req *RejectRequest) error {
+	return s.Current().Reject(ctx, delegateID, taskID, req)
+}
+
+func (s *Switch) RenewLease(ctx context.Context, delegateID, taskID string) error {
+	return s.Current().RenewLease(ctx, delegateID, taskID)
+}
+
+func (s *Switch) SendStatus(ctx context.Context, delegateID, taskID string, req *TaskResponse) error {
+	return s.Current().SendStatus(ctx, delegateID, taskID, req)
+}
+
+func (s *Switch) SendStatusBatch(ctx context.Context, delegateID string, responses []*TaskResponse) error {
+	return s.Current().SendStatusBatch(ctx, delegateID, responses)
+}
+
+func (s *Switch) AckEvents(ctx context.Context, delegateID string, acks []EventAck) error {
+	return s.Current().AckEvents(ctx, delegateID, acks)
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Limits of the requests checked before they are sent to the manager
+var (
+	MaxNameLength = 256
+	MaxTags       = 256
+	MaxTagLength  = 256
+	// MaxDataSize bounds the size of the data of a task response
+	MaxDataSize = 32 << 20
+	// MaxErrorMessageLength bounds the length of the message of a task error
+	MaxErrorMessageLength = 64 << 10
+)
+
+// ValidationError is returned for requests which are rejected before they
+// are sent to the manager
+type ValidationError struct {
+	Request  string   // name of the request type
+	Problems []string // one per invalid field
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Request, strings.Join(e.Problems, "; "))
+}
+
+type problems []string
+
+func (p *problems) add(format string, args ...interface{}) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+func (p problems) err(request string) error {
+	if len(p) == 0 {
+		return nil
+	}
+	return &ValidationError{Request: request, Problems: p}
+}
+
+// Validate checks the required fields and the size limits of the request
+func (r *RegisterRequest) Validate() error {
+	var p problems
+	if r.AccountID == "" {
+		p.add("accountId is required")
+	}
+	if r.KeepAlivePacket && r.ID == "" {
+		p.add("delegateId is required for keep alive heartbeats")
+	}
+	for _, f := range [][2]string{
+		{"delegateName", r.DelegateName},
+		{"hostName", r.HostName},
+		{"delegateGroupName", r.DelegateGroupName},
+		{"orgIdentifier", r.OrgIdentifier},
+		{"projectIdentifier", r.ProjectIdentifier},
+	} {
+		if len(f[1]) > MaxNameLength {
+			p.add("%s is longer than %d characters", f[0], MaxNameLength)
+		}
+	}
+	if r.ProjectIdentifier != "" && r.OrgIdentifier == "" {
+		p.add("orgIdentifier is required when projectIdentifier is set")
+	}
+	if len(r.Tags) > MaxTags {
+		p.add("more than %d tags", MaxTags)
+	}
+	for _, t := range r.Tags {
+		if t == "" {
+			p.add("tags must not be empty")
+		} else if len(t) > MaxTagLength {
+			p.add("tag %.32q... is longer than %d characters", t, MaxTagLength)
+		}
+	}
+	for _, t := range r.SupportedTaskTypes {
+		if t == "" {
+			p.add("supportedTaskTypes must not be empty")
+		}
+	}
+	return p.err("RegisterRequest")
+}
+
+// Validate checks the required fields, the response code and the size
+// limits of the response
+func (r *TaskResponse) Validate() error {
+	var p problems
+	if r.ID == "" {
+		p.add("id is required")
+	}
+	switch r.Code {
+	case CodeOK, CodeFailed, CodeRetry, CodeRunning:
+	default:
+		p.add("code %q is not one of %s, %s, %s, %s", r.Code, CodeOK, CodeFailed, CodeRetry, CodeRunning)
+	}
+	if len(r.Data) > MaxDataSize {
+		p.add("data is larger than %d bytes", MaxDataSize)
+	} else if len(r.Data) > 0 && !json.Valid(r.Data) {
+		p.add("data is not valid JSON")
+	}
+	if e := r.Error; e != nil {
+		if e.Code == "" {
+			p.add("error code is required")
+		}
+		switch e.Category {
+		case "", CategoryUser, CategoryInfrastructure, CategoryTimeout, CategoryInternal:
+		default:
+			p.add("error category %q is not one of %s, %s, %s, %s", e.Category,
+				CategoryUser, CategoryInfrastructure, CategoryTimeout, CategoryInternal)
+		}
+		if len(e.Message) > MaxErrorMessageLength {
+			p.add("error message is longer than %d characters", MaxErrorMessageLength)
+		}
+	}
+	return p.err("TaskResponse")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wings-software/dlite/config"
+	"github.com/wings-software/dlite/poller"
+	"github.com/wings-software/dlite/support"
+)
+
+func supportBundleCmd(args []string) error {
+	fs := flag.NewFlagSet("support-bundle", flag.ExitOnError)
+	path := fs.String("config", "", "path to the YAML config file")
+	addr := fs.String("addr", "", "stats address of the running runner, defaults to stats_addr of the config")
+	out := fs.String("o", "", "path of the archive, defaults to dlite-support-<time>.tar.gz")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of the download from the runner")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	c, err := config.Load(*path)
+	if err != nil {
+		return err
+	}
+	if *addr == "" {
+		*addr = c.StatsAddr
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("dlite-support-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	}
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// the bundle is downloaded from the running runner, a bundle of the
+	// config is written if it can not be reached
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	var reason string
+	if *addr == "" {
+		reason = "the runner does not serve its stats, stats_addr is not set"
+	} else if c.DebugToken == "" {
+		reason = "the runner does not serve its support bundle, debug_token is not set"
+	} else if reason = download(ctx, *addr, c.DebugToken, f); reason == "" {
+		fmt.Println("support bundle of the runner written to", *out)
+		return f.Close()
+	}
+	fmt.Fprintf(os.Stderr, "dlite: could not download the support bundle: %s\n", reason)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	b := &support.Bundle{Notes: []string{"runner: " + reason}}
+	if b.Config, err = c.Redacted(); err != nil {
+		b.Notes = append(b.Notes, "config.json: "+err.Error())
+	}
+	if err := b.Write(f); err != nil {
+		return err
+	}
+	fmt.Println("support bundle of the config written to", *out)
+	return f.Close()
+}
+
+// download copies the support bundle of the runner serving its stats at
+// addr to w. It returns why the download failed, or an empty string.
+func download(ctx context.Context, addr, token string, w io.Writer) string {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+addr+"/debug/bundle", nil)
+	if err != nil {
+		return err.Error()
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err.Error()
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Sprintf("the runner responded with status %d", res.StatusCode)
+	}
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// supportBundle returns the support bundle of the running runner
+func supportBundle(c *config.Config, p *poller.Poller) *support.Bundle {
+	b := p.SupportBundle()
+	var err error
+	if b.Config, err = c.Redacted(); err != nil {
+		b.Notes = append(b.Notes, "config.json: "+err.Error())
+	}
+	b.Logs = logs
+	b.Traces = traces.Traces()
+	return b
+}
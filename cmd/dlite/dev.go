@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wings-software/dlite/config"
+	"github.com/wings-software/dlite/lifecycle"
+	"github.com/wings-software/dlite/replay"
+)
+
+func devCmd(args []string) error {
+	fs := flag.NewFlagSet("dev", flag.ExitOnError)
+	path := fs.String("config", "", "path to the YAML config file")
+	addr := fs.String("addr", "localhost:3001", "address of the task injection server")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	c, err := config.Load(*path)
+	if err != nil {
+		return err
+	}
+	setupLogging(c)
+
+	lc := lifecycle.New(nil)
+	lc.ShutdownTimeout = c.ShutdownTimeout
+	r, err := buildRouter(c, lc)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: *addr, Handler: replay.Handler(r), ReadHeaderTimeout: 10 * time.Second}
+	report := lc.Run(context.Background(), func(ctx context.Context) error {
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(shutdownCtx)
+		}()
+		logrus.WithField("addr", *addr).WithField("routes", r.Routes()).Infoln("accepting tasks at POST /tasks")
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})
+	if !report.OK() {
+		return errors.New(report.String())
+	}
+	return nil
+}
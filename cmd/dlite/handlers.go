@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+
+	"github.com/wings-software/dlite/capability"
+	"github.com/wings-software/dlite/config"
+	"github.com/wings-software/dlite/httpstep"
+	"github.com/wings-software/dlite/lifecycle"
+	"github.com/wings-software/dlite/platform"
+	"github.com/wings-software/dlite/plugins"
+	"github.com/wings-software/dlite/proxy"
+	"github.com/wings-software/dlite/router"
+	"github.com/wings-software/dlite/sandbox"
+	"github.com/wings-software/dlite/script"
+	"github.com/wings-software/dlite/task"
+)
+
+// buildRouter returns the router of the task handlers of the config. The
+// plugins are stopped by the shutdown hooks of lc.
+func buildRouter(c *config.Config, lc *lifecycle.Lifecycle) (router.Registry, error) {
+	handlers := map[string]task.Handler{
+		capability.TaskType: capability.New(),
+	}
+	for _, pc := range c.Plugins {
+		pl, err := plugins.Load(pc.Path, pc.Args...)
+		if err != nil {
+			return nil, err
+		}
+		lc.OnShutdown("stop plugin "+pc.Path, func(context.Context) error { return pl.Close() })
+		for t, h := range pl.Handlers() {
+			handlers[t] = h
+		}
+	}
+	for _, pc := range c.Proxies {
+		h, err := proxy.New(pc.URL, pc.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		handlers[pc.Type] = h
+	}
+	for _, sc := range c.Sandboxes {
+		handlers[sc.Type] = sandbox.Handler(sandboxExecutor(sc))
+	}
+	for _, sc := range c.Scripts {
+		handlers[sc.Type] = (&script.Runner{
+			Commands:           sc.Commands,
+			Env:                sc.Env,
+			Dir:                sc.Dir,
+			Timeout:            sc.Timeout,
+			MaxOutput:          sc.MaxOutput,
+			SuccessExitCodes:   sc.SuccessExitCodes,
+			RetryableExitCodes: sc.RetryableExitCodes,
+		}).Handler()
+	}
+	for _, hc := range c.HTTPSteps {
+		handlers[hc.Type] = (&httpstep.Runner{
+			Timeout:       hc.Timeout,
+			MaxBody:       hc.MaxBody,
+			AllowedHosts:  hc.AllowedHosts,
+			AllowInsecure: hc.AllowInsecure,
+		}).Handler()
+	}
+	r := router.NewRouter(handlers)
+	if c.FailUnsupportedTasks {
+		r.Fallback(router.Unsupported())
+	}
+	if c.RejectPlatformMismatch {
+		r.Use(router.RequirePlatform(platform.Host()))
+	}
+	return r, nil
+}
+
+// sandboxExecutor returns the executor of the sandboxed task type
+func sandboxExecutor(sc config.Sandbox) sandbox.Executor {
+	limits := sandbox.Limits{CPUs: sc.CPUs, Memory: sc.Memory, PIDs: sc.PIDs}
+	if sc.Runtime == "nsjail" {
+		return &sandbox.Nsjail{Command: sc.Command, Env: sc.Env, Limits: limits}
+	}
+	return &sandbox.Container{Runtime: sc.Runtime, Image: sc.Image, Command: sc.Command, Env: sc.Env, Limits: limits}
+}
@@ -0,0 +1,53 @@
+// Command dlite runs a delegate lite runner. Each command parses its own
+// flags with a flag.FlagSet. The task handlers are built from the config,
+// see buildRouter; new task types are added with plugins, proxies, sandboxes,
+// scripts or HTTP steps rather than by changing the binary.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"run", "register the runner and start polling for tasks", runCmd},
+	{"dev", "serve a local endpoint injecting tasks into the task handlers", devCmd},
+	{"replay", "run recorded tasks through the task handlers without a manager", replayCmd},
+	{"validate-config", "load and validate the runner configuration", validateCmd},
+	{"verify", "check the connectivity to the manager and the credentials", verifyCmd},
+	{"support-bundle", "write an archive of the state of the runner for support tickets", supportBundleCmd},
+	{"version", "print the version and exit", versionCmd},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "dlite:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlite <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", c.name, c.usage)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/config"
+	"github.com/wings-software/dlite/poller"
+)
+
+// configCheckInterval is the interval at which the config file is checked for changes
+var configCheckInterval = 5 * time.Second
+
+// watchConfig reloads the config file when it changes or on SIGHUP and applies
+// the settings which can be changed at runtime: the log level, the poll interval,
+// the parallelism, the tags and the manager connection. Other changes require
+// a restart.
+func watchConfig(ctx context.Context, path string, c *config.Config, p *poller.Poller) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(configCheckInterval)
+	defer ticker.Stop()
+	mod := modTime(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logrus.Infoln("received SIGHUP, reloading config")
+		case <-ticker.C:
+			m := modTime(path)
+			if m.Equal(mod) {
+				continue
+			}
+			mod = m
+			logrus.Infoln("config file changed, reloading config")
+		}
+		next, err := config.Load(path)
+		if err != nil {
+			logrus.WithError(err).Errorln("could not reload config, keeping the current config")
+			continue
+		}
+		applyConfig(ctx, c, next, p)
+		c = next
+	}
+}
+
+// applyConfig applies the settings which changed from c to next
+func applyConfig(ctx context.Context, c, next *config.Config, p *poller.Poller) {
+	if c.Debug != next.Debug || c.Trace != next.Trace {
+		setupLogging(next)
+		logrus.Infof("log level changed to %s", logrus.GetLevel())
+	}
+	if c.PollInterval != next.PollInterval {
+		logrus.Infof("poll interval changed from %s to %s", c.PollInterval, next.PollInterval)
+		p.SetPollInterval(next.PollInterval)
+	}
+	if c.Parallelism != next.Parallelism {
+		p.SetParallelism(next.Parallelism)
+	}
+	if !reflect.DeepEqual(c.Tags, next.Tags) {
+		logrus.Infof("tags changed to %v", next.Tags)
+		p.SetTags(next.Tags)
+	}
+	if connectionChanged(c, next) {
+		cl, err := newClient(next)
+		if err != nil {
+			logrus.WithError(err).Errorln("could not create a client for the new connection settings")
+			return
+		}
+		cl.Metrics = p.Metrics
+		cl.Events = p.Events
+		cl.AccountTokenCache.Events = p.Events
+		if next.APIVersion > 0 {
+			if err := cl.Routes.SetVersion(next.APIVersion); err != nil {
+				logrus.WithError(err).Errorln("could not select the manager API version")
+				return
+			}
+		} else if _, err := cl.NegotiateAPIVersion(ctx); err != nil {
+			logrus.WithError(err).Warnln("could not negotiate the manager API version, using the latest version")
+		}
+		if err := p.Restart(pollerClient(next, cl)); err != nil {
+			logrus.WithError(err).Errorln("could not restart the poller")
+		}
+	}
+}
+
+// connectionChanged reports whether the settings of the manager connection changed
+func connectionChanged(c, next *config.Config) bool {
+	return c.Endpoint != next.Endpoint ||
+		!reflect.DeepEqual(c.FailoverEndpoints, next.FailoverEndpoints) ||
+		// the secret read from a source is checked by the token cache
+		(c.AccountSecret != next.AccountSecret && next.SecretSource == config.SecretSource{}) ||
+		c.SecretSource != next.SecretSource ||
+		c.FallbackAccountSecret != next.FallbackAccountSecret ||
+		!reflect.DeepEqual(c.TLS, next.TLS) ||
+		!reflect.DeepEqual(c.Chaos, next.Chaos) ||
+		c.HTTPProxy != next.HTTPProxy ||
+		c.SOCKS5 != next.SOCKS5 ||
+		!reflect.DeepEqual(c.Headers, next.Headers) ||
+		c.Signing != next.Signing ||
+		c.Gateway != next.Gateway
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/wings-software/dlite/config"
+	"github.com/wings-software/dlite/lifecycle"
+	"github.com/wings-software/dlite/replay"
+)
+
+func replayCmd(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	path := fs.String("config", "", "path to the YAML config file")
+	file := fs.String("file", "", "path to the recorded tasks, one JSON task per line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	c, err := config.Load(*path)
+	if err != nil {
+		return err
+	}
+	setupLogging(c)
+
+	lc := lifecycle.New(nil)
+	lc.ShutdownTimeout = c.ShutdownTimeout
+	rt, err := buildRouter(c, lc)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	enc := json.NewEncoder(os.Stdout)
+	report := lc.Run(context.Background(), func(ctx context.Context) error {
+		return replay.Replay(ctx, f, rt, func(r *replay.Result) {
+			if r.Error != "" || r.Response == nil || r.Response.Error != nil {
+				failed++
+			}
+			_ = enc.Encode(r)
+		})
+	})
+	if !report.OK() {
+		return errors.New(report.String())
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d tasks did not succeed", failed)
+	}
+	return nil
+}
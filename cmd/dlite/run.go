@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/admission"
+	"github.com/wings-software/dlite/artifact"
+	"github.com/wings-software/dlite/audit"
+	"github.com/wings-software/dlite/chaos"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/config"
+	"github.com/wings-software/dlite/contract"
+	"github.com/wings-software/dlite/delegate"
+	"github.com/wings-software/dlite/events"
+	"github.com/wings-software/dlite/exporter"
+	"github.com/wings-software/dlite/httphelper"
+	"github.com/wings-software/dlite/leader"
+	"github.com/wings-software/dlite/lifecycle"
+	"github.com/wings-software/dlite/logger"
+	"github.com/wings-software/dlite/metrics"
+	"github.com/wings-software/dlite/poller"
+	"github.com/wings-software/dlite/queue"
+	"github.com/wings-software/dlite/router"
+	"github.com/wings-software/dlite/sealed"
+	"github.com/wings-software/dlite/secrets"
+	"github.com/wings-software/dlite/support"
+	"github.com/wings-software/dlite/taskcache"
+	"github.com/wings-software/dlite/workspace"
+)
+
+// traces and logs keep the recent requests to the manager and log lines
+// for the support bundles, across the clients created on config reloads
+var (
+	traces = delegate.NewTraceBuffer(0)
+	logs   = support.NewLogBuffer(0)
+)
+
+// recorder records the requests to the manager of all clients if enabled
+var recorder *contract.Recorder
+
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	path := fs.String("config", "", "path to the YAML config file")
+	dryRun := fs.Bool("dry-run", false, "log task events without acquiring or executing tasks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	c, err := config.Load(*path)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		c.DryRun = true
+	}
+	setupLogging(c)
+
+	lc := lifecycle.New(nil)
+	lc.ShutdownTimeout = c.ShutdownTimeout
+
+	if src := secretSource(c); src != nil {
+		// the poller registers with the secret read at startup, tokens are
+		// created with the latest secret of the source.
+		if c.AccountSecret, err = src.Secret(context.Background()); err != nil {
+			return err
+		}
+	}
+	sealer, err := stateSealer(c)
+	if err != nil {
+		return err
+	}
+	if c.RecordRequests != "" {
+		if recorder, err = contract.Create(c.RecordRequests); err != nil {
+			return err
+		}
+		recorder.Operation = delegate.NewRoutes().Op
+		lc.OnShutdown("close the request recording", func(context.Context) error { return recorder.Close() })
+		logrus.Warnf("recording the requests to the manager to %s", c.RecordRequests)
+	}
+	cl, err := newClient(c)
+	if err != nil {
+		return err
+	}
+	r, err := buildRouter(c, lc)
+	if err != nil {
+		return err
+	}
+	p := poller.New(c.AccountID, c.AccountSecret, c.Name, c.Tags, pollerClient(c, cl), r)
+	p.Group = c.Group
+	p.OrgID = c.OrgID
+	p.ProjectID = c.ProjectID
+	p.Immutable = c.Immutable
+	p.MaxPollInterval = c.MaxPollInterval
+	p.AcquireBatchSize = c.AcquireBatchSize
+	if c.FairAcquisition {
+		p.Fairness = poller.NewFairness(c.TaskTypeWeights)
+	}
+	p.UpgradeCheckInterval = c.UpgradeCheckInterval
+	p.DrainOnUpgrade = c.DrainOnUpgrade
+	p.IdleTimeout = c.IdleTimeout
+	p.MaxTasksBeforeRecycle = c.MaxTasksBeforeRecycle
+	p.LeaseRenewalInterval = c.LeaseRenewalInterval
+	p.DryRun = c.DryRun
+	p.FullHeartbeatInterval = c.FullHeartbeatInterval
+	p.DisconnectAfter = c.DisconnectAfter
+	p.StatusBatchWindow = c.StatusBatchWindow
+	p.StatusBatchSize = c.StatusBatchSize
+	p.WatchdogGrace = c.WatchdogGrace
+	p.WatchdogRestart = c.WatchdogRestart
+	p.ResourceAccounting = c.ResourceAccounting
+	p.Jitter = c.Jitter
+	p.MaxStartDelay = c.MaxStartDelay
+	p.MaxResponseDataSize = c.MaxResponseDataSize
+	p.Truncation = c.ResponseTruncation
+	if c.DeadlineAware {
+		p.Estimator = poller.NewMovingAverage()
+	}
+	if c.TraceDecisions {
+		p.Decisions = poller.NewDecisionLog(0)
+	}
+	p.AckEvents = c.AckEvents
+	p.Downloader = artifact.NewDownloader()
+	if p.Downloader.Client, err = downloadClient(c); err != nil {
+		return err
+	}
+	if c.MaxDataRefSize > 0 {
+		p.Downloader.MaxSize = c.MaxDataRefSize
+	}
+	if c.DataRefTimeout > 0 {
+		p.Downloader.MaxElapsedTime = c.DataRefTimeout
+	}
+	p.LogSampler = cl.LogSampler
+	if c.QueueDir != "" {
+		if p.Queue, err = queue.New(c.QueueDir); err != nil {
+			return err
+		}
+		if sealer != nil {
+			p.Queue.Sealer = sealer
+		}
+	}
+	if c.WorkspaceDir != "" {
+		if p.Workspaces, err = workspace.New(c.WorkspaceDir, c.WorkspaceQuota); err != nil {
+			return err
+		}
+		// workspaces left behind by a crash
+		if err := p.Workspaces.Clean(); err != nil {
+			logrus.WithError(err).Warnln("could not remove stale workspaces")
+		}
+	}
+	if c.AuditFile != "" {
+		f, err := audit.NewFile(c.AuditFile)
+		if err != nil {
+			return err
+		}
+		lc.OnShutdown("close audit log", func(context.Context) error { return f.Close() })
+		p.Audit = f
+	}
+	if c.Admission.Enabled() {
+		p.Admission = &admission.Resources{
+			MaxHostMemoryPercent: c.Admission.MaxHostMemoryPercent,
+			MaxProcessMemory:     c.Admission.MaxProcessMemory,
+			MaxCPUPercent:        c.Admission.MaxCPUPercent,
+		}
+	}
+	if c.StatsAddr != "" {
+		logrus.AddHook(logs)
+		serveStats(lc, c, p, support.Handler(func() *support.Bundle {
+			return supportBundle(c, p)
+		}))
+		cl.Metrics = p.Metrics
+	}
+	for _, exp := range eventExporters(c) {
+		if p.Events == nil {
+			p.Events = events.NewBus()
+		}
+		cl.Events = p.Events
+		cl.AccountTokenCache.Events = p.Events
+		exp.Start(p.Events)
+		lc.OnShutdown("stop event exporter", exp.Stop)
+	}
+	if c.PayloadCacheEntries > 0 || c.PayloadCacheSize > 0 {
+		p.PayloadCache = taskcache.New(c.PayloadCacheEntries, c.PayloadCacheSize)
+		p.PayloadCache.Metrics = p.Metrics
+	}
+	if c.Standby {
+		p.Standby()
+	}
+	lc.Drainer = p
+	report := lc.Run(context.Background(), func(ctx context.Context) error {
+		if c.APIVersion > 0 {
+			if err := cl.Routes.SetVersion(c.APIVersion); err != nil {
+				return err
+			}
+		} else if _, err := cl.NegotiateAPIVersion(ctx); err != nil {
+			logrus.WithError(err).Warnln("could not negotiate the manager API version, using the latest version")
+		}
+		if c.LeaderElection.LeaseName != "" {
+			if err := electLeader(ctx, c, p); err != nil {
+				return err
+			}
+		}
+		info, err := p.Register(ctx)
+		if err != nil {
+			return err
+		}
+		lc.Ready()
+		if *path != "" {
+			go watchConfig(ctx, *path, c, p)
+		}
+		return p.Poll(ctx, c.Parallelism, info.ID, c.PollInterval)
+	})
+	logrus.Infoln(report)
+	if c.ShutdownReport != "" {
+		if err := writeShutdownReport(c.ShutdownReport, newShutdownReport(p, report)); err != nil {
+			logrus.WithError(err).Errorln("could not write the shutdown report")
+		}
+	}
+	if !report.OK() {
+		return errors.New(report.String())
+	}
+	return nil
+}
+
+// electLeader keeps the poller in standby and only promotes it while the runner is the leader
+func electLeader(ctx context.Context, c *config.Config, p poller.Interface) error {
+	lock, err := leader.NewInClusterLease(c.LeaderElection.Namespace, c.LeaderElection.LeaseName)
+	if err != nil {
+		return err
+	}
+	identity := c.LeaderElection.Identity
+	if identity == "" {
+		if identity, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+	e := leader.New(lock, identity)
+	e.LeaseDuration = c.LeaderElection.LeaseDuration
+	e.RetryPeriod = c.LeaderElection.RetryPeriod
+	e.OnStartedLeading = p.Promote
+	e.OnStoppedLeading = p.Standby
+	p.Standby()
+	go e.Run(ctx)
+	return nil
+}
+
+// newClient creates a delegate client from the config
+func newClient(c *config.Config) (*delegate.HTTPClient, error) {
+	endpoints := append([]string{c.Endpoint}, c.FailoverEndpoints...)
+	cl := delegate.NewWithEndpoints(endpoints, c.AccountID, c.AccountSecret, c.TLS.SkipVerify)
+	if src := secretSource(c); src != nil {
+		delegate.WithSecretSource(src)(cl)
+	}
+	cl.LongPollTimeout = c.LongPollTimeout
+	cl.Traces = traces
+	cl.ConnectionRecycleInterval = c.ConnectionRecycleInterval
+	cl.LogSampler = logSampler(c)
+	cl.AcquireHedgeDelay = c.AcquireHedgeDelay
+	cl.PayloadStreamThreshold = c.PayloadStreamThreshold
+	cl.PayloadDir = c.PayloadDir
+	cl.MaxPayloadSize = c.MaxPayloadSize
+	cl.AutoFingerprint = c.AutoFingerprint
+	cl.CompressionThreshold = c.CompressionThreshold
+	cl.DedupResponseData = c.DedupResponseData
+	cl.Encoding = delegate.Encoding{
+		DisableHTMLEscape: c.DisableHTMLEscape,
+		OmitEmpty:         c.OmitEmptyFields,
+		MaxPayloadSize:    c.MaxRequestSize,
+	}
+	if c.StrictDecoding {
+		cl.Decoding = delegate.DecodeStrict
+	}
+	cl.FollowRedirects = c.FollowRedirects
+	cl.RedirectHosts = c.RedirectHosts
+	cl.CompensateClockSkew = c.CompensateClockSkew
+	cl.AccountTokenCache.Leeway = c.TokenLeeway
+	cl.AccountTokenCache.MintBackoff = c.TokenMintBackoff
+	cl.AccountTokenCache.MaxMintBackoff = c.MaxTokenMintBackoff
+	if c.FallbackAccountSecret != "" {
+		cl.AccountTokenCache.SetFallbackSecret(c.AccountID, c.FallbackAccountSecret)
+	}
+	if c.RetryBudget > 0 {
+		window := c.RetryBudgetWindow
+		if window <= 0 {
+			window = time.Minute
+		}
+		cl.RetryBudget = delegate.NewRetryBudget(c.RetryBudget, window)
+	}
+	cl.Timeouts = delegate.Timeouts{
+		Register:  c.Timeouts.Register,
+		Heartbeat: c.Timeouts.Heartbeat,
+		Poll:      c.Timeouts.Poll,
+		Acquire:   c.Timeouts.Acquire,
+		Status:    c.Timeouts.Status,
+	}
+	cl.Headers = http.Header{}
+	if host, err := os.Hostname(); err == nil {
+		cl.Headers.Set("X-Dlite-Hostname", host)
+	}
+	for k, v := range c.Headers {
+		cl.Headers.Set(k, v)
+	}
+	if c.AccountIDHeader != "" {
+		cl.HeaderFuncs = append(cl.HeaderFuncs, cl.AccountIDHeader(c.AccountIDHeader))
+	}
+	if c.Signing.Secret != "" {
+		cl.Signer = delegate.NewHMACSigner(c.Signing.KeyID, []byte(c.Signing.Secret))
+	}
+	if c.Gateway.Enabled {
+		cl.Gateway = &delegate.Gateway{Path: c.Gateway.ExchangePath, RefreshBefore: c.Gateway.RefreshBefore}
+	}
+	opts, err := tlsOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	pools := c.ConnectionPools
+	opts.Pool = &delegate.PoolOptions{MaxConns: pools.ControlMaxConns, MaxIdleConns: pools.MaxIdleConns}
+	cl.Client = delegate.NewTLSClient(opts)
+	if pools.Separate {
+		data := *opts
+		data.Pool = &delegate.PoolOptions{MaxConns: pools.DataMaxConns, MaxIdleConns: pools.MaxIdleConns}
+		cl.DataClient = delegate.NewTLSClient(&data)
+	}
+	if recorder != nil {
+		cl.Client = recorder.Client(cl.Client)
+		if cl.DataClient != nil {
+			cl.DataClient = recorder.Client(cl.DataClient)
+		}
+	}
+	return cl, nil
+}
+
+// secretSource returns the configured source of the account secret or nil
+func secretSource(c *config.Config) secrets.Source {
+	switch {
+	case c.SecretSource.Vault.Address != "":
+		v := secrets.NewVaultKV(c.SecretSource.Vault.Address, c.SecretSource.Vault.Token, c.SecretSource.Vault.Path, c.SecretSource.Vault.Field)
+		if c.SecretSource.Vault.Mount != "" {
+			v.Mount = c.SecretSource.Vault.Mount
+		}
+		return v
+	case c.SecretSource.File != "":
+		return secrets.NewFile(c.SecretSource.File)
+	}
+	return nil
+}
+
+// stateSealer returns the sealer encrypting the state files, nil if they are
+// not encrypted
+func stateSealer(c *config.Config) (*sealed.AESGCM, error) {
+	var src secrets.Source
+	switch e := c.Encryption; {
+	case e.KeyFile != "":
+		src = secrets.NewFile(e.KeyFile)
+	case e.VaultPath != "":
+		v := secrets.NewVaultKV(c.SecretSource.Vault.Address, c.SecretSource.Vault.Token, e.VaultPath, e.VaultField)
+		if c.SecretSource.Vault.Mount != "" {
+			v.Mount = c.SecretSource.Vault.Mount
+		}
+		src = v
+	default:
+		return nil, nil
+	}
+	return sealed.FromSource(context.Background(), src)
+}
+
+// downloadClient returns the client downloading the data of the tasks. It
+// uses the TLS and proxy options of the manager connection, but follows
+// redirects, e.g. to the storage serving the data.
+func downloadClient(c *config.Config) (*http.Client, error) {
+	opts, err := tlsOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	hc := delegate.NewTLSClient(opts)
+	hc.CheckRedirect = nil
+	return hc, nil
+}
+
+// tlsOptions returns the TLS options for the manager connection
+func tlsOptions(c *config.Config) (*delegate.TLSOptions, error) {
+	version, err := c.TLS.Version()
+	if err != nil {
+		return nil, err
+	}
+	ciphers, err := c.TLS.Ciphers()
+	if err != nil {
+		return nil, err
+	}
+	opts := &delegate.TLSOptions{
+		SkipVerify:   c.TLS.SkipVerify,
+		MinVersion:   version,
+		CipherSuites: ciphers,
+		FIPS:         c.TLS.FIPS,
+	}
+	if opts.Proxy, err = proxyOptions(c); err != nil {
+		return nil, err
+	}
+	if c.SOCKS5.Addr != "" {
+		var auth *delegate.SOCKS5Auth
+		if c.SOCKS5.Username != "" {
+			auth = &delegate.SOCKS5Auth{Username: c.SOCKS5.Username, Password: c.SOCKS5.Password}
+		}
+		opts.SOCKS5 = delegate.NewSOCKS5Dialer(c.SOCKS5.Addr, auth)
+	}
+	if c.TLS.CAFile == "" {
+		return opts, nil
+	}
+	pem, err := os.ReadFile(c.TLS.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("could not parse CA file")
+	}
+	opts.RootCAs = pool
+	return opts, nil
+}
+
+func setupLogging(c *config.Config) {
+	logrus.SetLevel(logrus.InfoLevel)
+	if c.Debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+	if c.Trace {
+		logrus.SetLevel(logrus.TraceLevel)
+	}
+}
+
+// proxyOptions returns the options of the proxy used to reach the manager
+func proxyOptions(c *config.Config) (*delegate.ProxyOptions, error) {
+	user, password, err := c.HTTPProxy.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	opts := &delegate.ProxyOptions{Username: user, Password: password}
+	if c.HTTPProxy.URL != "" {
+		if opts.URL, err = url.Parse(c.HTTPProxy.URL); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// pollerClient returns the client used by the poller, which injects failures
+// if chaos testing is enabled
+func pollerClient(c *config.Config, cl *delegate.HTTPClient) client.Client {
+	if !c.Chaos.Enabled() {
+		return cl
+	}
+	logrus.WithField("seed", c.Chaos.Seed).Warnln("chaos testing is enabled, failures are injected into the calls to the manager")
+	return chaos.New(cl, chaos.Faults{
+		Timeout:     c.Chaos.Timeout,
+		ServerError: c.Chaos.ServerError,
+		Corrupt:     c.Chaos.Corrupt,
+		Slow:        c.Chaos.Slow,
+		Latency:     c.Chaos.Latency,
+		Methods:     c.Chaos.Methods,
+	}, c.Chaos.Seed)
+}
+
+// eventExporters returns an exporter of the runner events per configured sink
+func eventExporters(c *config.Config) []*exporter.Exporter {
+	ec := c.EventExport
+	var sinks []exporter.Sink
+	if ec.WebhookURL != "" {
+		sinks = append(sinks, &exporter.Webhook{URL: ec.WebhookURL, Secret: ec.WebhookSecret})
+	}
+	if ec.KafkaRESTURL != "" {
+		sinks = append(sinks, &exporter.Kafka{Producer: &exporter.KafkaREST{URL: ec.KafkaRESTURL}, Topic: ec.KafkaTopic})
+	}
+	var types []events.Type
+	for _, t := range ec.Types {
+		types = append(types, events.Type(t))
+	}
+	var exporters []*exporter.Exporter
+	for _, sink := range sinks {
+		exporters = append(exporters, &exporter.Exporter{
+			Sink:          sink,
+			Runner:        c.Name,
+			AccountID:     c.AccountID,
+			Types:         types,
+			BatchSize:     ec.BatchSize,
+			FlushInterval: ec.FlushInterval,
+		})
+	}
+	return exporters
+}
+
+// logSampler returns the sampler of the error logs, nil if sampling is disabled
+func logSampler(c *config.Config) *logger.Sampler {
+	ls := c.LogSampling
+	if ls.First <= 0 && len(ls.Classes) == 0 {
+		return nil
+	}
+	s := logger.NewSampler(ls.First, ls.Thereafter, ls.Period)
+	s.Policies = map[string]logger.Policy{}
+	for class, p := range ls.Classes {
+		s.Policies[class] = logger.Policy{First: p.First, Thereafter: p.Thereafter}
+	}
+	return s
+}
+
+// serveStats serves the poller stats at /stats, the task metrics at /metrics
+// and the routes of the router at /debug/routes until the runner stopped.
+// The promotion of a standby runner is served at /promote and the support
+// bundle at /debug/bundle if their tokens are configured.
+func serveStats(lc *lifecycle.Lifecycle, c *config.Config, p *poller.Poller, bundle http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/stats", p.StatsHandler())
+	if c.DebugToken != "" {
+		mux.Handle("/debug/bundle", httphelper.RequireToken(c.DebugToken, bundle))
+	}
+	if c.PromoteToken != "" {
+		mux.Handle("/promote", p.PromoteHandler(c.PromoteToken))
+	}
+	if p.Decisions != nil {
+		mux.Handle("/debug/decisions", p.Decisions.Handler())
+	}
+	if in, ok := p.Router.(router.Inspector); ok {
+		mux.Handle("/debug/routes", router.InspectHandler(in))
+	}
+	if p.Metrics == nil {
+		p.Metrics = metrics.NewRegistry()
+	}
+	mux.Handle("/metrics", p.Metrics.Handler())
+	srv := &http.Server{Addr: c.StatsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Errorln("could not serve the runner stats")
+		}
+	}()
+	lc.OnShutdown("stop stats server", srv.Shutdown)
+}
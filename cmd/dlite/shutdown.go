@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wings-software/dlite/lifecycle"
+	"github.com/wings-software/dlite/poller"
+)
+
+// shutdownReport is the summary written when the runner exits
+type shutdownReport struct {
+	*poller.ShutdownReport
+	Signal      string   `json:"signal,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	FailedHooks []string `json:"failed_hooks,omitempty"`
+}
+
+// newShutdownReport combines the report of the poller and the lifecycle
+func newShutdownReport(p *poller.Poller, lr *lifecycle.Report) *shutdownReport {
+	r := &shutdownReport{ShutdownReport: p.ShutdownReport(context.Background())}
+	if lr.Signal != nil {
+		r.Signal = lr.Signal.String()
+	}
+	if lr.Err != nil {
+		r.Error = lr.Err.Error()
+	}
+	for _, h := range lr.Hooks {
+		if h.Err != nil {
+			r.FailedHooks = append(r.FailedHooks, h.Name)
+		}
+	}
+	return r
+}
+
+// writeShutdownReport writes the report as JSON to the destination, which is
+// - for stdout, an http(s) URL the report is posted to or a file path
+func writeShutdownReport(dest string, r *shutdownReport) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	switch {
+	case dest == "-":
+		_, err = os.Stdout.Write(b)
+		return err
+	case strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://"):
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "POST", dest, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode > 299 {
+			return fmt.Errorf("shutdown report sink responded with %s", res.Status)
+		}
+		return nil
+	default:
+		return os.WriteFile(dest, b, 0o600)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/wings-software/dlite/config"
+)
+
+func validateCmd(args []string) error {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	path := fs.String("config", "", "path to the YAML config file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := config.Load(*path); err != nil {
+		return err
+	}
+	fmt.Println("config is valid")
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/wings-software/dlite/config"
+)
+
+func verifyCmd(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	path := fs.String("config", "", "path to the YAML config file")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of the checks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	c, err := config.Load(*path)
+	if err != nil {
+		return err
+	}
+	cl, err := newClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	report := cl.Verify(ctx)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("manager %s, account %s\n", report.Endpoint, report.AccountID)
+		for _, check := range report.Checks {
+			fmt.Printf("  %-10s %-8s %s\n", check.Name, check.Status, check.Message)
+		}
+	}
+	if !report.OK() {
+		return errors.New("verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/wings-software/dlite/version"
+)
+
+func versionCmd([]string) error {
+	fmt.Printf("dlite %s (commit %s, %s/%s)\n", version.Version, version.Commit, runtime.GOOS, runtime.GOARCH)
+	return nil
+}
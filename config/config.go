@@ -0,0 +1,810 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	defaultParallelism  = 1
+	defaultPollInterval = 5 * time.Second
+)
+
+// Config holds the options required to run a runner. Values are read
+// from an optional YAML file and can be overridden by environment variables.
+type Config struct {
+	Debug bool `yaml:"debug" envconfig:"DLITE_DEBUG"`
+	Trace bool `yaml:"trace" envconfig:"DLITE_TRACE"`
+
+	Endpoint string `yaml:"endpoint" envconfig:"DLITE_MANAGER_ENDPOINT"`
+	// FailoverEndpoints are used when the manager endpoint keeps failing
+	FailoverEndpoints []string `yaml:"failover_endpoints" envconfig:"DLITE_FAILOVER_ENDPOINTS"`
+	AccountID         string   `yaml:"account_id" envconfig:"DLITE_ACCOUNT_ID"`
+	AccountSecret     string   `yaml:"account_secret" envconfig:"DLITE_ACCOUNT_SECRET"`
+	// SecretSource reads the account secret from a file or a secret manager
+	// instead of the account secret setting
+	SecretSource SecretSource `yaml:"secret_source"`
+	Name         string       `yaml:"name" envconfig:"DLITE_NAME"`
+	Tags         []string     `yaml:"tags" envconfig:"DLITE_TAGS"`
+	Group        string       `yaml:"group" envconfig:"DLITE_GROUP"`
+	OrgID        string       `yaml:"org_id" envconfig:"DLITE_ORG_ID"`
+	ProjectID    string       `yaml:"project_id" envconfig:"DLITE_PROJECT_ID"`
+	Immutable    bool         `yaml:"immutable" envconfig:"DLITE_IMMUTABLE"`
+
+	Parallelism  int           `yaml:"parallelism" envconfig:"DLITE_PARALLELISM"`
+	PollInterval time.Duration `yaml:"poll_interval" envconfig:"DLITE_POLL_INTERVAL"`
+	// MaxPollInterval enables adaptive polling, backing off up to this interval while idle
+	MaxPollInterval time.Duration `yaml:"max_poll_interval" envconfig:"DLITE_MAX_POLL_INTERVAL"`
+
+	// AcquireBatchSize is the maximum number of tasks acquired in a single call
+	AcquireBatchSize int `yaml:"acquire_batch_size" envconfig:"DLITE_ACQUIRE_BATCH_SIZE"`
+
+	// PayloadCacheEntries and PayloadCacheSize bound the in-memory cache of the
+	// acquired task payloads, which is disabled if both are zero
+	PayloadCacheEntries int   `yaml:"payload_cache_entries" envconfig:"DLITE_PAYLOAD_CACHE_ENTRIES"`
+	PayloadCacheSize    int64 `yaml:"payload_cache_size" envconfig:"DLITE_PAYLOAD_CACHE_SIZE"`
+
+	// FairAcquisition acquires the tasks by weighted round-robin over their types,
+	// TaskTypeWeights are the turns of the types and default to 1
+	FairAcquisition bool           `yaml:"fair_acquisition" envconfig:"DLITE_FAIR_ACQUISITION"`
+	TaskTypeWeights map[string]int `yaml:"task_type_weights" envconfig:"DLITE_TASK_TYPE_WEIGHTS"`
+
+	// LongPollTimeout enables long-polling for task events when set
+	LongPollTimeout time.Duration `yaml:"long_poll_timeout" envconfig:"DLITE_LONG_POLL_TIMEOUT"`
+
+	// UpgradeCheckInterval enables periodic upgrade checks when set
+	UpgradeCheckInterval time.Duration `yaml:"upgrade_check_interval" envconfig:"DLITE_UPGRADE_CHECK_INTERVAL"`
+	// DrainOnUpgrade stops the runner once an upgrade is required
+	DrainOnUpgrade bool `yaml:"drain_on_upgrade" envconfig:"DLITE_DRAIN_ON_UPGRADE"`
+
+	// IdleTimeout stops the runner after no task was acquired for the given duration
+	IdleTimeout time.Duration `yaml:"idle_timeout" envconfig:"DLITE_IDLE_TIMEOUT"`
+
+	// MaxTasksBeforeRecycle stops the runner after the given number of tasks were acquired
+	MaxTasksBeforeRecycle int `yaml:"max_tasks_before_recycle" envconfig:"DLITE_MAX_TASKS_BEFORE_RECYCLE"`
+
+	// LeaseRenewalInterval renews the lease on running tasks at the given interval when set
+	LeaseRenewalInterval time.Duration `yaml:"lease_renewal_interval" envconfig:"DLITE_LEASE_RENEWAL_INTERVAL"`
+
+	// Plugins are external binaries serving task handlers
+	Plugins []Plugin `yaml:"plugins" ignored:"true"`
+
+	// StatusBatchWindow batches the statuses of tasks completing within the window when set
+	StatusBatchWindow time.Duration `yaml:"status_batch_window" envconfig:"DLITE_STATUS_BATCH_WINDOW"`
+	StatusBatchSize   int           `yaml:"status_batch_size" envconfig:"DLITE_STATUS_BATCH_SIZE"`
+
+	// FullHeartbeatInterval sends keep-alive heartbeats unless the registration changed
+	// or the interval elapsed since the last full heartbeat
+	FullHeartbeatInterval time.Duration `yaml:"full_heartbeat_interval" envconfig:"DLITE_FULL_HEARTBEAT_INTERVAL"`
+
+	// DisconnectAfter is the time after which a runner whose heartbeats keep failing
+	// is reported as disconnected, defaults to one minute
+	DisconnectAfter time.Duration `yaml:"disconnect_after" envconfig:"DLITE_DISCONNECT_AFTER"`
+
+	// ShutdownTimeout bounds the time spent on cleanup once the runner stopped
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" envconfig:"DLITE_SHUTDOWN_TIMEOUT"`
+
+	// LogSampling throttles repeated error logs
+	LogSampling LogSampling `yaml:"log_sampling"`
+
+	// AcquireHedgeDelay sends a second acquire request if the first one did not
+	// complete within the delay. Disabled if zero.
+	AcquireHedgeDelay time.Duration `yaml:"acquire_hedge_delay" envconfig:"DLITE_ACQUIRE_HEDGE_DELAY"`
+
+	// PayloadStreamThreshold streams acquired tasks larger than the threshold in bytes
+	// to a temporary file in PayloadDir. Disabled if zero.
+	PayloadStreamThreshold int64  `yaml:"payload_stream_threshold" envconfig:"DLITE_PAYLOAD_STREAM_THRESHOLD"`
+	PayloadDir             string `yaml:"payload_dir" envconfig:"DLITE_PAYLOAD_DIR"`
+	// MaxPayloadSize bounds the size of a streamed task, defaults to 1GB
+	MaxPayloadSize int64 `yaml:"max_payload_size" envconfig:"DLITE_MAX_PAYLOAD_SIZE"`
+	// MaxDataRefSize bounds the size of task data downloaded from the URL the
+	// task refers to, defaults to 256MB. DataRefTimeout bounds the time spent
+	// retrying the download, defaults to 5 minutes.
+	MaxDataRefSize int64         `yaml:"max_data_ref_size" envconfig:"DLITE_MAX_DATA_REF_SIZE"`
+	DataRefTimeout time.Duration `yaml:"data_ref_timeout" envconfig:"DLITE_DATA_REF_TIMEOUT"`
+
+	// Standby starts the runner as a warm standby, which registers and sends
+	// heartbeats but does not acquire tasks until it is promoted with a POST to
+	// /promote on the stats server or by winning the leader election.
+	Standby bool `yaml:"standby" envconfig:"DLITE_STANDBY"`
+
+	// StatsAddr is the address of the HTTP server serving the runner stats at /stats
+	// and the task metrics at /metrics. The server is not started if it is empty.
+	StatsAddr string `yaml:"stats_addr" envconfig:"DLITE_STATS_ADDR"`
+
+	// PromoteToken enables the promotion of a standby runner at /promote on the
+	// stats server. The requests must be authorized with the token as a bearer
+	// token. The endpoint is not served if it is empty.
+	PromoteToken string `yaml:"promote_token" envconfig:"DLITE_PROMOTE_TOKEN"`
+
+	// DebugToken enables the support bundle at /debug/bundle on the stats server,
+	// which holds the recent logs and a goroutine dump of the runner. The requests
+	// must be authorized with the token as a bearer token.
+	DebugToken string `yaml:"debug_token" envconfig:"DLITE_DEBUG_TOKEN"`
+
+	// QueueDir is the directory of the durable queue of acquired tasks. Tasks acquired
+	// before a crash are executed again on restart, up to 3 times. Disabled if empty.
+	QueueDir string `yaml:"queue_dir" envconfig:"DLITE_QUEUE_DIR"`
+
+	// WorkspaceDir is the directory below which every task gets an isolated working
+	// directory. Tasks have no workspace if it is empty.
+	WorkspaceDir string `yaml:"workspace_dir" envconfig:"DLITE_WORKSPACE_DIR"`
+	// WorkspaceQuota bounds the disk usage of a workspace in bytes, unlimited if zero
+	WorkspaceQuota int64 `yaml:"workspace_quota" envconfig:"DLITE_WORKSPACE_QUOTA"`
+
+	// Encryption encrypts the state files, e.g. the queued tasks, with AES-GCM
+	Encryption Encryption `yaml:"encryption"`
+
+	// AuditFile is the path of the append-only audit log of the executed tasks
+	AuditFile string `yaml:"audit_file" envconfig:"DLITE_AUDIT_FILE"`
+
+	// WatchdogGrace fails tasks whose handlers did not return within the grace
+	// period after they timed out, WatchdogRestart abandons those handlers
+	WatchdogGrace   time.Duration `yaml:"watchdog_grace" envconfig:"DLITE_WATCHDOG_GRACE"`
+	WatchdogRestart bool          `yaml:"watchdog_restart" envconfig:"DLITE_WATCHDOG_RESTART"`
+
+	// ResourceAccounting attaches the wall time, CPU time and peak memory of every
+	// task handler to the task response. CPU time and memory are read from the
+	// cgroup of the runner if it has one, e.g. in a container.
+	ResourceAccounting bool `yaml:"resource_accounting" envconfig:"DLITE_RESOURCE_ACCOUNTING"`
+
+	// Jitter randomly delays the polls and heartbeats by up to the fraction of
+	// their interval, e.g. 0.2, and MaxStartDelay the registration, so that
+	// runners started together do not load the manager in lockstep
+	Jitter        float64       `yaml:"jitter" envconfig:"DLITE_JITTER"`
+	MaxStartDelay time.Duration `yaml:"max_start_delay" envconfig:"DLITE_MAX_START_DELAY"`
+
+	// MaxResponseDataSize bounds the task response data accepted by the manager.
+	// Larger data fails the task, unless it is truncated with ResponseTruncation,
+	// head_tail or head.
+	MaxResponseDataSize int    `yaml:"max_response_data_size" envconfig:"DLITE_MAX_RESPONSE_DATA_SIZE"`
+	ResponseTruncation  string `yaml:"response_truncation" envconfig:"DLITE_RESPONSE_TRUNCATION"`
+
+	// DeadlineAware leaves the tasks which would expire before the queue wait
+	// and their average execution time elapsed to other runners
+	DeadlineAware bool `yaml:"deadline_aware" envconfig:"DLITE_DEADLINE_AWARE"`
+
+	// ShutdownReport is where the summary of the runner is written to on exit:
+	// - for stdout, an http(s) URL it is posted to or a file path
+	ShutdownReport string `yaml:"shutdown_report" envconfig:"DLITE_SHUTDOWN_REPORT"`
+
+	// DryRun logs the task events without acquiring or executing any task
+	DryRun bool `yaml:"dry_run" envconfig:"DLITE_DRY_RUN"`
+
+	// FailUnsupportedTasks fails tasks of unknown types with an UNSUPPORTED_TASK_TYPE
+	// error instead of giving them back to the manager
+	FailUnsupportedTasks bool `yaml:"fail_unsupported_tasks" envconfig:"DLITE_FAIL_UNSUPPORTED_TASKS"`
+
+	// RejectPlatformMismatch gives tasks whose platform requirements, e.g. OS,
+	// architecture or container capability, are not met back to the manager
+	RejectPlatformMismatch bool `yaml:"reject_platform_mismatch" envconfig:"DLITE_REJECT_PLATFORM_MISMATCH"`
+
+	// Proxies forward tasks of a type to an HTTP service
+	Proxies []Proxy `yaml:"proxies" ignored:"true"`
+
+	// Chaos injects failures into the calls to the manager to test the resilience
+	// of the runner. It must not be enabled in production.
+	Chaos Chaos `yaml:"chaos"`
+
+	// Sandboxes run the tasks of a type in a container or an nsjail
+	Sandboxes []Sandbox `yaml:"sandboxes" ignored:"true"`
+
+	// Scripts run the allowed commands for the tasks of a type
+	Scripts []Script `yaml:"scripts" ignored:"true"`
+
+	// HTTPSteps send the HTTP requests of the tasks of a type and verify the responses
+	HTTPSteps []HTTPStep `yaml:"http_steps" ignored:"true"`
+
+	Admission Admission `yaml:"admission"`
+
+	EventExport EventExport `yaml:"event_export"`
+
+	// ConnectionRecycleInterval is the interval at which the idle connections
+	// to the manager are closed, connections in use are closed at a later one
+	ConnectionRecycleInterval time.Duration `yaml:"connection_recycle_interval" envconfig:"DLITE_CONNECTION_RECYCLE_INTERVAL"`
+
+	// RetryBudget bounds the share of retried requests to the manager within the
+	// window, e.g. 0.2 for 20%. Retries are not bounded if it is zero.
+	RetryBudget       float64       `yaml:"retry_budget" envconfig:"DLITE_RETRY_BUDGET"`
+	RetryBudgetWindow time.Duration `yaml:"retry_budget_window" envconfig:"DLITE_RETRY_BUDGET_WINDOW"`
+
+	// FollowRedirects follows 307 and 308 redirects of the manager to the
+	// manager host and RedirectHosts, e.g. to regional endpoints
+	FollowRedirects bool     `yaml:"follow_redirects" envconfig:"DLITE_FOLLOW_REDIRECTS"`
+	RedirectHosts   []string `yaml:"redirect_hosts" envconfig:"DLITE_REDIRECT_HOSTS"`
+
+	// StrictDecoding fails on unknown fields in the manager responses and
+	// rejects the tasks of newer schema versions instead of logging them
+	StrictDecoding bool `yaml:"strict_decoding" envconfig:"DLITE_STRICT_DECODING"`
+
+	// CompensateClockSkew issues the tokens at the time of the manager clock
+	CompensateClockSkew bool `yaml:"compensate_clock_skew" envconfig:"DLITE_COMPENSATE_CLOCK_SKEW"`
+	// TokenLeeway backdates the issue time of the tokens
+	TokenLeeway time.Duration `yaml:"token_leeway" envconfig:"DLITE_TOKEN_LEEWAY"`
+	// TokenMintBackoff is the time between attempts to mint a token after a
+	// failure, doubling up to MaxTokenMintBackoff. Defaults to 1s and 1m.
+	TokenMintBackoff    time.Duration `yaml:"token_mint_backoff" envconfig:"DLITE_TOKEN_MINT_BACKOFF"`
+	MaxTokenMintBackoff time.Duration `yaml:"max_token_mint_backoff" envconfig:"DLITE_MAX_TOKEN_MINT_BACKOFF"`
+	// FallbackAccountSecret mints the tokens while they can not be minted
+	// with the account secret, e.g. during a secret rotation
+	FallbackAccountSecret string `yaml:"fallback_account_secret" envconfig:"DLITE_FALLBACK_ACCOUNT_SECRET"`
+
+	// ConnectionPools separates the connections of the control traffic, e.g.
+	// heartbeats and polls, from the bulk data traffic, e.g. task statuses
+	ConnectionPools ConnectionPools `yaml:"connection_pools"`
+
+	// CompressionThreshold gzips requests of at least this many bytes, disabled if zero
+	CompressionThreshold int `yaml:"compression_threshold" envconfig:"DLITE_COMPRESSION_THRESHOLD"`
+	// DedupResponseData collapses repeated log lines in the task responses
+	DedupResponseData bool `yaml:"dedup_response_data" envconfig:"DLITE_DEDUP_RESPONSE_DATA"`
+	// DisableHTMLEscape, OmitEmptyFields and MaxRequestSize control the JSON
+	// encoding of the requests, see delegate.Encoding
+	DisableHTMLEscape bool `yaml:"disable_html_escape" envconfig:"DLITE_DISABLE_HTML_ESCAPE"`
+	OmitEmptyFields   bool `yaml:"omit_empty_fields" envconfig:"DLITE_OMIT_EMPTY_FIELDS"`
+	MaxRequestSize    int  `yaml:"max_request_size" envconfig:"DLITE_MAX_REQUEST_SIZE"`
+
+	// RecordRequests records the requests to the manager and their responses,
+	// sanitized, to the file for contract tests, see package contract
+	RecordRequests string `yaml:"record_requests" envconfig:"DLITE_RECORD_REQUESTS"`
+
+	// TraceDecisions logs why task events were acquired, skipped or deduped
+	// as debug records and serves the recent decisions on /debug/decisions
+	TraceDecisions bool `yaml:"trace_decisions" envconfig:"DLITE_TRACE_DECISIONS"`
+	// AckEvents acknowledges the handled and ignored task events in a single
+	// call after every poll cycle, so that the manager prunes its event queue
+	AckEvents bool `yaml:"ack_events" envconfig:"DLITE_ACK_EVENTS"`
+
+	// AutoFingerprint sends the OS, kernel, container runtime, tool versions and
+	// cloud instance of the host with the registration
+	AutoFingerprint bool `yaml:"auto_fingerprint" envconfig:"DLITE_AUTO_FINGERPRINT"`
+
+	Timeouts Timeouts `yaml:"timeouts"`
+
+	// APIVersion pins the manager API version, otherwise it is negotiated with the manager.
+	// The runner does not start with a version which lacks any of the operations, e.g. 1.
+	APIVersion int `yaml:"api_version" envconfig:"DLITE_API_VERSION"`
+
+	// Headers are added to every request sent to the manager
+	Headers map[string]string `yaml:"headers" envconfig:"DLITE_HEADERS"`
+	// AccountIDHeader is set to the account ID of every request sent to the
+	// manager, e.g. X-Account-Id for an API gateway
+	AccountIDHeader string `yaml:"account_id_header" envconfig:"DLITE_ACCOUNT_ID_HEADER"`
+
+	LeaderElection LeaderElection `yaml:"leader_election"`
+
+	TLS TLS `yaml:"tls"`
+
+	Signing Signing `yaml:"signing"`
+
+	Gateway Gateway `yaml:"gateway"`
+
+	HTTPProxy HTTPProxy `yaml:"http_proxy"`
+
+	SOCKS5 SOCKS5 `yaml:"socks5"`
+}
+
+// SecretSource configures where the account secret is read from
+type SecretSource struct {
+	// File is reloaded whenever it changes, e.g. a mounted Kubernetes secret
+	File  string `yaml:"file" envconfig:"DLITE_ACCOUNT_SECRET_FILE"`
+	Vault Vault  `yaml:"vault"`
+}
+
+// Encryption configures the key the state files are encrypted with. The key
+// is read from a file or from the vault of the secret source.
+type Encryption struct {
+	KeyFile    string `yaml:"key_file" envconfig:"DLITE_ENCRYPTION_KEY_FILE"`
+	VaultPath  string `yaml:"vault_path" envconfig:"DLITE_ENCRYPTION_VAULT_PATH"`
+	VaultField string `yaml:"vault_field" envconfig:"DLITE_ENCRYPTION_VAULT_FIELD"`
+}
+
+// Enabled reports whether the state files are encrypted
+func (e Encryption) Enabled() bool {
+	return e.KeyFile != "" || e.VaultPath != ""
+}
+
+// Vault reads the account secret from the KV version 2 secrets engine of HashiCorp Vault
+type Vault struct {
+	Address string `yaml:"address" envconfig:"DLITE_VAULT_ADDR"`
+	Token   string `yaml:"token" envconfig:"DLITE_VAULT_TOKEN"`
+	Mount   string `yaml:"mount" envconfig:"DLITE_VAULT_MOUNT"`
+	Path    string `yaml:"path" envconfig:"DLITE_VAULT_SECRET_PATH"`
+	Field   string `yaml:"field" envconfig:"DLITE_VAULT_SECRET_FIELD"`
+}
+
+// SOCKS5 routes the manager traffic through a SOCKS5 proxy
+type SOCKS5 struct {
+	Addr     string `yaml:"addr" envconfig:"DLITE_SOCKS5_ADDR"`
+	Username string `yaml:"username" envconfig:"DLITE_SOCKS5_USERNAME"`
+	Password string `yaml:"password" envconfig:"DLITE_SOCKS5_PASSWORD"`
+}
+
+// LogSampling logs the first First errors of a class within Period, then every
+// Thereafter-th one. Classes override the policy per error class, e.g.
+// server_error, request_error, task_events, acquire or execute.
+type LogSampling struct {
+	First      int                          `yaml:"first" envconfig:"DLITE_LOG_SAMPLING_FIRST"`
+	Thereafter int                          `yaml:"thereafter" envconfig:"DLITE_LOG_SAMPLING_THEREAFTER"`
+	Period     time.Duration                `yaml:"period" envconfig:"DLITE_LOG_SAMPLING_PERIOD"`
+	Classes    map[string]LogSamplingPolicy `yaml:"classes" ignored:"true"`
+}
+
+// LogSamplingPolicy is the sampling policy of an error class
+type LogSamplingPolicy struct {
+	First      int `yaml:"first"`
+	Thereafter int `yaml:"thereafter"`
+}
+
+// HTTPProxy configures the proxy used to reach the manager. If the URL
+// is not set, the proxy environment variables are used.
+type HTTPProxy struct {
+	URL      string `yaml:"url" envconfig:"DLITE_HTTP_PROXY_URL"`
+	Username string `yaml:"username" envconfig:"DLITE_HTTP_PROXY_USERNAME"`
+	Password string `yaml:"password" envconfig:"DLITE_HTTP_PROXY_PASSWORD"`
+	// PasswordFile is read for the password if Password is not set
+	PasswordFile string `yaml:"password_file" envconfig:"DLITE_HTTP_PROXY_PASSWORD_FILE"`
+}
+
+// Credentials returns the proxy username and password
+func (p *HTTPProxy) Credentials() (string, string, error) {
+	if p.Password != "" || p.PasswordFile == "" {
+		return p.Username, p.Password, nil
+	}
+	b, err := os.ReadFile(p.PasswordFile)
+	if err != nil {
+		return "", "", fmt.Errorf("config: could not read proxy password file: %w", err)
+	}
+	return p.Username, strings.TrimSpace(string(b)), nil
+}
+
+// Plugin is a plugin binary and its arguments
+type Plugin struct {
+	Path string   `yaml:"path"`
+	Args []string `yaml:"args"`
+}
+
+// Proxy forwards the tasks of a type to the URL
+type Proxy struct {
+	Type    string        `yaml:"type"`
+	URL     string        `yaml:"url"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Chaos holds the probabilities, between 0 and 1, of the failures injected
+// into every call to the manager. Failures are only injected into the listed
+// client methods if Methods is set. Failures are reproducible for a seed.
+type Chaos struct {
+	Timeout     float64       `yaml:"timeout" envconfig:"DLITE_CHAOS_TIMEOUT"`
+	ServerError float64       `yaml:"server_error" envconfig:"DLITE_CHAOS_SERVER_ERROR"`
+	Corrupt     float64       `yaml:"corrupt" envconfig:"DLITE_CHAOS_CORRUPT"`
+	Slow        float64       `yaml:"slow" envconfig:"DLITE_CHAOS_SLOW"`
+	Latency     time.Duration `yaml:"latency" envconfig:"DLITE_CHAOS_LATENCY"`
+	Methods     []string      `yaml:"methods" envconfig:"DLITE_CHAOS_METHODS"`
+	Seed        int64         `yaml:"seed" envconfig:"DLITE_CHAOS_SEED"`
+}
+
+// Enabled reports whether any failure is injected
+func (c Chaos) Enabled() bool {
+	return c.Timeout > 0 || c.ServerError > 0 || c.Corrupt > 0 || c.Slow > 0
+}
+
+// EventExport exports the lifecycle and task events of the runner to a webhook
+// or to a Kafka topic through the Kafka REST proxy
+type EventExport struct {
+	WebhookURL    string        `yaml:"webhook_url" envconfig:"DLITE_EVENT_EXPORT_WEBHOOK_URL"`
+	WebhookSecret string        `yaml:"webhook_secret" envconfig:"DLITE_EVENT_EXPORT_WEBHOOK_SECRET"` // signs the requests
+	KafkaRESTURL  string        `yaml:"kafka_rest_url" envconfig:"DLITE_EVENT_EXPORT_KAFKA_REST_URL"`
+	KafkaTopic    string        `yaml:"kafka_topic" envconfig:"DLITE_EVENT_EXPORT_KAFKA_TOPIC"`
+	Types         []string      `yaml:"types" envconfig:"DLITE_EVENT_EXPORT_TYPES"` // all events if empty
+	BatchSize     int           `yaml:"batch_size" envconfig:"DLITE_EVENT_EXPORT_BATCH_SIZE"`
+	FlushInterval time.Duration `yaml:"flush_interval" envconfig:"DLITE_EVENT_EXPORT_FLUSH_INTERVAL"`
+}
+
+// Sandbox runs the tasks of a type isolated from the runner host. The command
+// reads the task from standard input and writes the response to standard output.
+type Sandbox struct {
+	Type    string   `yaml:"type"`
+	Runtime string   `yaml:"runtime"` // docker (default), podman or nsjail
+	Image   string   `yaml:"image"`   // the container image, required unless the runtime is nsjail
+	Command []string `yaml:"command"`
+	Env     []string `yaml:"env"`
+	CPUs    float64  `yaml:"cpus"`
+	Memory  int64    `yaml:"memory"` // bytes
+	PIDs    int64    `yaml:"pids"`
+}
+
+// Script runs the allowed commands for the tasks of a type on the runner host
+type Script struct {
+	Type string `yaml:"type"`
+	// Commands maps the command names of the tasks to absolute paths of executables
+	Commands           map[string]string `yaml:"commands"`
+	Env                []string          `yaml:"env"` // KEY=VALUE, the runner environment is not inherited
+	Dir                string            `yaml:"dir"` // defaults to the task workspace
+	Timeout            time.Duration     `yaml:"timeout"`
+	MaxOutput          int               `yaml:"max_output"` // bytes
+	SuccessExitCodes   []int             `yaml:"success_exit_codes"`
+	RetryableExitCodes []int             `yaml:"retryable_exit_codes"`
+}
+
+// HTTPStep sends the HTTP requests of the tasks of a type
+type HTTPStep struct {
+	Type          string        `yaml:"type"`
+	Timeout       time.Duration `yaml:"timeout"`
+	MaxBody       int64         `yaml:"max_body"`      // bytes
+	AllowedHosts  []string      `yaml:"allowed_hosts"` // e.g. *.example.com, all hosts if empty
+	AllowInsecure bool          `yaml:"allow_insecure"`
+}
+
+// Admission holds the resource thresholds above which the runner stops accepting tasks
+type Admission struct {
+	MaxHostMemoryPercent float64 `yaml:"max_host_memory_percent" envconfig:"DLITE_ADMISSION_MAX_HOST_MEMORY_PERCENT"`
+	MaxProcessMemory     uint64  `yaml:"max_process_memory" envconfig:"DLITE_ADMISSION_MAX_PROCESS_MEMORY"`
+	MaxCPUPercent        float64 `yaml:"max_cpu_percent" envconfig:"DLITE_ADMISSION_MAX_CPU_PERCENT"`
+}
+
+// Enabled returns true if any of the thresholds is set
+func (a *Admission) Enabled() bool {
+	return a.MaxHostMemoryPercent > 0 || a.MaxProcessMemory > 0 || a.MaxCPUPercent > 0
+}
+
+// Timeouts bounds the time spent on the requests to the manager, unset values use the defaults
+type Timeouts struct {
+	Register  time.Duration `yaml:"register" envconfig:"DLITE_TIMEOUT_REGISTER"`
+	Heartbeat time.Duration `yaml:"heartbeat" envconfig:"DLITE_TIMEOUT_HEARTBEAT"`
+	Poll      time.Duration `yaml:"poll" envconfig:"DLITE_TIMEOUT_POLL"`
+	Acquire   time.Duration `yaml:"acquire" envconfig:"DLITE_TIMEOUT_ACQUIRE"`
+	Status    time.Duration `yaml:"status" envconfig:"DLITE_TIMEOUT_STATUS"`
+}
+
+// LeaderElection makes only one of the replicas sharing a Kubernetes Lease acquire tasks.
+// It is enabled when the lease name is set.
+type LeaderElection struct {
+	LeaseName string `yaml:"lease_name" envconfig:"DLITE_LEADER_ELECTION_LEASE_NAME"`
+	Namespace string `yaml:"namespace" envconfig:"DLITE_LEADER_ELECTION_NAMESPACE"` // defaults to the namespace of the pod
+	Identity  string `yaml:"identity" envconfig:"DLITE_LEADER_ELECTION_IDENTITY"`   // defaults to the host name
+
+	// LeaseDuration is rounded up to whole seconds, at least 1s
+	LeaseDuration time.Duration `yaml:"lease_duration" envconfig:"DLITE_LEADER_ELECTION_LEASE_DURATION"`
+	RetryPeriod   time.Duration `yaml:"retry_period" envconfig:"DLITE_LEADER_ELECTION_RETRY_PERIOD"`
+}
+
+// ConnectionPools sizes the connection pools to the manager
+type ConnectionPools struct {
+	// Separate sends the task acquisitions and statuses over a separate pool
+	Separate bool `yaml:"separate" envconfig:"DLITE_CONNECTION_POOLS_SEPARATE"`
+	// ControlMaxConns bounds the connections of the control pool, unbounded if zero
+	ControlMaxConns int `yaml:"control_max_conns" envconfig:"DLITE_CONNECTION_POOLS_CONTROL_MAX_CONNS"`
+	// DataMaxConns bounds the connections of the data pool, unbounded if zero
+	DataMaxConns int `yaml:"data_max_conns" envconfig:"DLITE_CONNECTION_POOLS_DATA_MAX_CONNS"`
+	// MaxIdleConns bounds the idle connections of each pool, defaults to 2
+	MaxIdleConns int `yaml:"max_idle_conns" envconfig:"DLITE_CONNECTION_POOLS_MAX_IDLE_CONNS"`
+}
+
+// TLS holds the TLS settings used when talking to the manager
+type TLS struct {
+	SkipVerify bool   `yaml:"skip_verify" envconfig:"DLITE_TLS_SKIP_VERIFY"`
+	CAFile     string `yaml:"ca_file" envconfig:"DLITE_TLS_CA_FILE"`
+	// MinVersion is the minimum TLS version, one of 1.2 or 1.3. Defaults to 1.2.
+	MinVersion string `yaml:"min_version" envconfig:"DLITE_TLS_MIN_VERSION"`
+	// CipherSuites restricts the TLS 1.2 cipher suites by their IANA names
+	CipherSuites []string `yaml:"cipher_suites" envconfig:"DLITE_TLS_CIPHER_SUITES"`
+	// FIPS restricts the connection to FIPS approved parameters
+	FIPS bool `yaml:"fips" envconfig:"DLITE_TLS_FIPS"`
+}
+
+// Version returns the minimum TLS version, 0 if not set
+func (t *TLS) Version() (uint16, error) {
+	switch t.MinVersion {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("config: unsupported TLS version: %s", t.MinVersion)
+}
+
+// Ciphers returns the IDs of the cipher suites. Insecure cipher suites are not allowed.
+func (t *TLS) Ciphers() ([]uint16, error) {
+	var ids []uint16
+	for _, name := range t.CipherSuites {
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("config: unsupported cipher suite: %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func cipherSuite(name string) (uint16, bool) {
+	for _, s := range tls.CipherSuites() {
+		if s.Name == name {
+			return s.ID, true
+		}
+	}
+	return 0, false
+}
+
+// Signing holds the key used to sign requests with HMAC-SHA256. Signing is
+// disabled if no secret is set.
+type Signing struct {
+	KeyID  string `yaml:"key_id" envconfig:"DLITE_SIGNING_KEY_ID"`
+	Secret string `yaml:"secret" envconfig:"DLITE_SIGNING_SECRET"`
+}
+
+// Gateway enables the exchange of the delegate token for the session tokens
+// of a gateway in front of the manager, which authorize the requests
+type Gateway struct {
+	Enabled bool `yaml:"enabled" envconfig:"DLITE_GATEWAY_ENABLED"`
+	// ExchangePath is the path of the token exchange endpoint, formatted with
+	// the account ID, see delegate.Gateway
+	ExchangePath string `yaml:"exchange_path" envconfig:"DLITE_GATEWAY_EXCHANGE_PATH"`
+	// RefreshBefore refreshes the sessions once they expire within the
+	// duration, defaults to a fifth of their lifetime
+	RefreshBefore time.Duration `yaml:"refresh_before" envconfig:"DLITE_GATEWAY_REFRESH_BEFORE"`
+}
+
+// Load reads the config from the YAML file at path (if path is not empty)
+// and then applies any overrides from the environment. The result is validated.
+func Load(path string) (*Config, error) {
+	c := &Config{
+		Parallelism:  defaultParallelism,
+		PollInterval: defaultPollInterval,
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("could not parse config file: %w", err)
+		}
+	}
+	if err := envconfig.Process("", c); err != nil {
+		return nil, fmt.Errorf("could not read config from environment: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate checks that all required fields are set and hold sane values
+func (c *Config) Validate() error {
+	if c.Endpoint == "" {
+		return errors.New("config: manager endpoint is required")
+	}
+	if u, err := url.Parse(c.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("config: invalid manager endpoint: %s", c.Endpoint)
+	}
+	for _, e := range c.FailoverEndpoints {
+		if u, err := url.Parse(e); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("config: invalid failover endpoint: %s", e)
+		}
+	}
+	if c.HTTPProxy.URL != "" {
+		if u, err := url.Parse(c.HTTPProxy.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("config: invalid proxy URL: %s", c.HTTPProxy.URL)
+		}
+	}
+	if p := c.Gateway.ExchangePath; p != "" && (!strings.HasPrefix(p, "/") || strings.Count(p, "%s") != 1) {
+		return fmt.Errorf("config: gateway exchange path must be a path with one %%s for the account ID, got %s", p)
+	}
+	if c.Gateway.RefreshBefore < 0 {
+		return fmt.Errorf("config: gateway refresh before must not be negative, got %s", c.Gateway.RefreshBefore)
+	}
+	if c.SOCKS5.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.SOCKS5.Addr); err != nil {
+			return fmt.Errorf("config: invalid SOCKS5 proxy address: %s", c.SOCKS5.Addr)
+		}
+	}
+	if c.AccountID == "" {
+		return errors.New("config: account ID is required")
+	}
+	switch {
+	case c.SecretSource.File != "" && c.SecretSource.Vault.Address != "":
+		return errors.New("config: only one account secret source can be set")
+	case c.SecretSource.Vault.Address != "":
+		if c.SecretSource.Vault.Path == "" || c.SecretSource.Vault.Field == "" {
+			return errors.New("config: vault secret path and field are required")
+		}
+	case c.SecretSource.File != "":
+	case c.AccountSecret == "":
+		return errors.New("config: account secret is required")
+	default:
+		if _, err := hex.DecodeString(c.AccountSecret); err != nil {
+			return errors.New("config: account secret must be hex encoded")
+		}
+	}
+	if c.PayloadCacheEntries < 0 || c.PayloadCacheSize < 0 {
+		return errors.New("config: payload cache bounds must not be negative")
+	}
+	for t, w := range c.TaskTypeWeights {
+		if w < 1 {
+			return fmt.Errorf("config: weight of task type %s must be positive, got %d", t, w)
+		}
+	}
+	if c.WatchdogGrace < 0 {
+		return fmt.Errorf("config: watchdog grace must not be negative, got %s", c.WatchdogGrace)
+	}
+	if c.MaxRequestSize < 0 {
+		return fmt.Errorf("config: max request size must not be negative, got %d", c.MaxRequestSize)
+	}
+	if c.TokenMintBackoff < 0 || c.MaxTokenMintBackoff < 0 {
+		return errors.New("config: token mint backoff must not be negative")
+	}
+	if c.FallbackAccountSecret != "" {
+		if _, err := hex.DecodeString(c.FallbackAccountSecret); err != nil {
+			return errors.New("config: fallback account secret must be hex encoded")
+		}
+	}
+	if c.TokenLeeway < 0 {
+		return fmt.Errorf("config: token leeway must not be negative, got %s", c.TokenLeeway)
+	}
+	if p := c.ConnectionPools; p.ControlMaxConns < 0 || p.DataMaxConns < 0 || p.MaxIdleConns < 0 {
+		return errors.New("config: connection pool sizes must not be negative")
+	}
+	if c.RetryBudget < 0 || c.RetryBudget > 1 {
+		return fmt.Errorf("config: retry budget must be between 0 and 1, got %g", c.RetryBudget)
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return fmt.Errorf("config: jitter must be between 0 and 1, got %g", c.Jitter)
+	}
+	if c.MaxStartDelay < 0 {
+		return errors.New("config: max start delay must not be negative")
+	}
+	switch c.ResponseTruncation {
+	case "", "head_tail", "head":
+	default:
+		return fmt.Errorf("config: unsupported response truncation: %s", c.ResponseTruncation)
+	}
+	if c.MaxResponseDataSize < 0 {
+		return errors.New("config: max response data size must not be negative")
+	}
+	switch e := c.Encryption; {
+	case e.KeyFile != "" && e.VaultPath != "":
+		return errors.New("config: only one encryption key source can be set")
+	case e.VaultPath != "" && (e.VaultField == "" || c.SecretSource.Vault.Address == ""):
+		return errors.New("config: encryption vault field and secret source vault address are required")
+	}
+	if c.ProjectID != "" && c.OrgID == "" {
+		return errors.New("config: org ID is required when the project ID is set")
+	}
+	if c.Parallelism < 1 {
+		return fmt.Errorf("config: parallelism must be at least 1, got %d", c.Parallelism)
+	}
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("config: poll interval must be positive, got %s", c.PollInterval)
+	}
+	if c.MaxPollInterval != 0 && c.MaxPollInterval < c.PollInterval {
+		return fmt.Errorf("config: max poll interval %s is less than the poll interval %s", c.MaxPollInterval, c.PollInterval)
+	}
+	if c.APIVersion < 0 {
+		return fmt.Errorf("config: API version must not be negative, got %d", c.APIVersion)
+	}
+	if c.StatusBatchWindow < 0 {
+		return fmt.Errorf("config: status batch window must not be negative, got %s", c.StatusBatchWindow)
+	}
+	if c.LeaseRenewalInterval < 0 {
+		return fmt.Errorf("config: lease renewal interval must not be negative, got %s", c.LeaseRenewalInterval)
+	}
+	if c.LongPollTimeout < 0 {
+		return fmt.Errorf("config: long poll timeout must not be negative, got %s", c.LongPollTimeout)
+	}
+	if _, err := c.TLS.Version(); err != nil {
+		return err
+	}
+	if _, err := c.TLS.Ciphers(); err != nil {
+		return err
+	}
+	for _, p := range c.Plugins {
+		if _, err := os.Stat(p.Path); err != nil {
+			return fmt.Errorf("config: could not find plugin: %w", err)
+		}
+	}
+	for _, p := range c.Proxies {
+		if p.Type == "" {
+			return errors.New("config: proxy task type is required")
+		}
+		if u, err := url.Parse(p.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("config: invalid proxy URL for task type %s: %s", p.Type, p.URL)
+		}
+	}
+	if c.PromoteToken != "" && c.StatsAddr == "" {
+		return errors.New("config: the promote token requires the stats address")
+	}
+	if c.DebugToken != "" && c.StatsAddr == "" {
+		return errors.New("config: the debug token requires the stats address")
+	}
+	if le := c.LeaderElection; le.LeaseDuration != 0 && le.LeaseDuration < time.Second {
+		return errors.New("config: the leader election lease duration must be at least 1s")
+	}
+	if c.Standby && c.PromoteToken == "" && c.LeaderElection.LeaseName == "" {
+		return errors.New("config: a standby runner requires the promote token or leader election to be promoted")
+	}
+	for _, p := range []float64{c.Chaos.Timeout, c.Chaos.ServerError, c.Chaos.Corrupt, c.Chaos.Slow} {
+		if p < 0 || p > 1 {
+			return errors.New("config: chaos probabilities must be between 0 and 1")
+		}
+	}
+	if c.Chaos.Timeout+c.Chaos.ServerError+c.Chaos.Corrupt > 1 {
+		return errors.New("config: the chaos timeout, server error and corrupt probabilities must not exceed 1 in total")
+	}
+	for _, s := range c.Sandboxes {
+		if s.Type == "" {
+			return errors.New("config: sandbox task type is required")
+		}
+		switch s.Runtime {
+		case "", "docker", "podman":
+			if s.Image == "" {
+				return fmt.Errorf("config: sandbox image is required for task type %s", s.Type)
+			}
+		case "nsjail":
+			if len(s.Command) == 0 {
+				return fmt.Errorf("config: sandbox command is required for task type %s", s.Type)
+			}
+		default:
+			return fmt.Errorf("config: unsupported sandbox runtime for task type %s: %s", s.Type, s.Runtime)
+		}
+		if s.CPUs < 0 || s.Memory < 0 || s.PIDs < 0 {
+			return fmt.Errorf("config: sandbox limits of task type %s must not be negative", s.Type)
+		}
+	}
+	for _, raw := range []string{c.EventExport.WebhookURL, c.EventExport.KafkaRESTURL} {
+		if raw == "" {
+			continue
+		}
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("config: invalid event export url: %s", raw)
+		}
+	}
+	if (c.EventExport.KafkaRESTURL == "") != (c.EventExport.KafkaTopic == "") {
+		return errors.New("config: the kafka rest url and topic of the event export must be set together")
+	}
+	if c.EventExport.BatchSize < 0 || c.EventExport.FlushInterval < 0 {
+		return errors.New("config: event export batch size and flush interval must not be negative")
+	}
+	for _, s := range c.Scripts {
+		if s.Type == "" {
+			return errors.New("config: script task type is required")
+		}
+		if len(s.Commands) == 0 {
+			return fmt.Errorf("config: script commands are required for task type %s", s.Type)
+		}
+		for name, path := range s.Commands {
+			if !filepath.IsAbs(path) {
+				return fmt.Errorf("config: script command %s of task type %s must be an absolute path", name, s.Type)
+			}
+		}
+		if s.Timeout < 0 || s.MaxOutput < 0 {
+			return fmt.Errorf("config: script timeout and max output of task type %s must not be negative", s.Type)
+		}
+	}
+	for _, s := range c.HTTPSteps {
+		if s.Type == "" {
+			return errors.New("config: http step task type is required")
+		}
+		if s.Timeout < 0 || s.MaxBody < 0 {
+			return fmt.Errorf("config: http step timeout and max body of task type %s must not be negative", s.Type)
+		}
+	}
+	if c.TLS.CAFile != "" {
+		if _, err := os.Stat(c.TLS.CAFile); err != nil {
+			return fmt.Errorf("config: could not read CA file: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the values of sensitive fields
+const redacted = "[REDACTED]"
+
+// sensitive matches the names of the fields holding credentials, e.g.
+// account_secret or X-Api-Key, but not token_leeway or password_file
+var sensitive = regexp.MustCompile(`(?i)(^|[_-])(secret|token|password|passphrase|key|credentials|authorization)$`)
+
+// Redacted returns the config as a map of its YAML fields, with the values
+// of the fields holding credentials and the passwords of URLs replaced, e.g.
+// to attach it to support tickets.
+func (c *Config) Redacted() (map[string]interface{}, error) {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return redact(m).(map[string]interface{}), nil
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if env, ok := val.([]interface{}); ok && k == "env" {
+				v[k] = redactEnv(env)
+				continue
+			}
+			if sensitive.MatchString(k) {
+				switch val := val.(type) {
+				case string:
+					if val != "" {
+						v[k] = redacted
+					}
+					continue
+				case []interface{}:
+					v[k] = redacted
+					continue
+				}
+			}
+			v[k] = redact(val)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = redact(val)
+		}
+	case string:
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+	}
+	return v
+}
+
+// redactEnv replaces the values of the KEY=VALUE environment variables,
+// which are often credentials whatever their name
+func redactEnv(env []interface{}) []interface{} {
+	for i, e := range env {
+		if s, ok := e.(string); ok {
+			if name, _, ok := strings.Cut(s, "="); ok {
+				env[i] = name + "=" + redacted
+			}
+		}
+	}
+	return env
+}
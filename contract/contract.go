@@ -0,0 +1,256 @@
+// Package contract records the requests to the manager and their responses
+// and replays them, for contract tests which detect drift of the manager API
+// without live credentials. Recordings are sanitized: the credentials, the
+// signatures and the secret values of the bodies are never written.
+package contract
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/wings-software/dlite/delegate"
+)
+
+// Redacted replaces the secret values of the recordings
+const Redacted = "REDACTED"
+
+// Interaction is a recorded request to the manager and its response
+type Interaction struct {
+	// Operation is the operation of the manager API, e.g. acquire, if known
+	Operation string     `json:"operation,omitempty"`
+	Method    string     `json:"method"`
+	Path      string     `json:"path"`
+	Query     url.Values `json:"query,omitempty"`
+	Request   Message    `json:"request"`
+	Response  Message    `json:"response"`
+}
+
+// Message is the sanitized header and body of a request or a response
+type Message struct {
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	// Body is the body if it is JSON, RawBody otherwise
+	Body    json.RawMessage `json:"body,omitempty"`
+	RawBody []byte          `json:"raw_body,omitempty"`
+}
+
+// data returns the body of the message
+func (m *Message) data() []byte {
+	if len(m.Body) > 0 {
+		return m.Body
+	}
+	return m.RawBody
+}
+
+// omittedHeaders are not recorded, they are credentials or differ between
+// every request
+var omittedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	delegate.SignatureHeader,
+	delegate.SignatureKeyHeader,
+	delegate.TimestampHeader,
+	delegate.RequestIDHeader,
+	delegate.CorrelationIDHeader,
+	"Content-Length",
+	"Content-Encoding",
+	"Date",
+}
+
+// secretKeys are the parts of JSON keys and query parameters whose values
+// are redacted
+var secretKeys = []string{"secret", "token", "password", "passphrase", "credential", "authorization", "privatekey"}
+
+// sanitizer redacts the secrets of the recorded messages
+type sanitizer struct {
+	keys []string
+}
+
+func newSanitizer(extra []string) *sanitizer {
+	s := &sanitizer{keys: append([]string{}, secretKeys...)}
+	for _, k := range extra {
+		s.keys = append(s.keys, strings.ToLower(k))
+	}
+	return s
+}
+
+// secret reports whether the values of the key are redacted
+func (s *sanitizer) secret(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range s.keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// message returns the sanitized header and body
+func (s *sanitizer) message(header http.Header, body []byte) Message {
+	var m Message
+	if header.Get("Content-Encoding") == "gzip" {
+		if data, err := gunzip(body); err == nil {
+			body = data
+		}
+	}
+	m.Header = header.Clone()
+	for _, k := range omittedHeaders {
+		m.Header.Del(k)
+	}
+	if len(m.Header) == 0 {
+		m.Header = nil
+	}
+	if len(body) == 0 {
+		return m
+	}
+	if v, ok := decodeJSON(body); ok {
+		if data, err := json.Marshal(s.redact(v, false)); err == nil {
+			m.Body = data
+			return m
+		}
+	}
+	m.RawBody = body
+	return m
+}
+
+// query returns the query with the values of the secret parameters redacted
+func (s *sanitizer) query(q url.Values) url.Values {
+	if len(q) == 0 {
+		return nil
+	}
+	out := url.Values{}
+	for k, values := range q {
+		for _, v := range values {
+			if s.secret(k) {
+				v = Redacted
+			}
+			out.Add(k, v)
+		}
+	}
+	return out
+}
+
+// redact replaces the strings of the secret keys, and all strings below
+// them, with Redacted
+func (s *sanitizer) redact(v interface{}, secret bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = s.redact(e, secret || s.secret(k))
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = s.redact(e, secret)
+		}
+	case string:
+		if secret && v != "" {
+			return Redacted
+		}
+	}
+	return v
+}
+
+// Read reads the interactions recorded as JSON lines
+func Read(r io.Reader) ([]Interaction, error) {
+	var interactions []Interaction
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var i Interaction
+		if err := dec.Decode(&i); err == io.EOF {
+			return interactions, nil
+		} else if err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, i)
+	}
+}
+
+// ReadFile reads the interactions recorded in the file
+func ReadFile(path string) ([]Interaction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// decodeJSON decodes the JSON body keeping the precision of the numbers
+func decodeJSON(data []byte) (interface{}, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil, false
+	}
+	return v, true
+}
+
+// fields returns the paths of the fields of a JSON body, e.g. task.id, with
+// [] for the elements of arrays
+func fields(data []byte) []string {
+	v, ok := decodeJSON(data)
+	if !ok {
+		return nil
+	}
+	seen := map[string]bool{}
+	collectFields(v, "", seen)
+	out := make([]string, 0, len(seen))
+	for f := range seen {
+		out = append(out, f)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func collectFields(v interface{}, prefix string, seen map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			seen[path] = true
+			collectFields(e, path, seen)
+		}
+	case []interface{}:
+		for _, e := range v {
+			collectFields(e, prefix+"[]", seen)
+		}
+	}
+}
+
+// difference returns the elements of a which are not in b
+func difference(a, b []string) []string {
+	in := map[string]bool{}
+	for _, s := range b {
+		in[s] = true
+	}
+	var out []string
+	for _, s := range a {
+		if !in[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
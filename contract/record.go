@@ -0,0 +1,146 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Recorder writes the interactions of the round trippers it wraps as JSON
+// lines, e.g. to a file. Failing recordings do not fail the requests, the
+// first error is returned by Close.
+type Recorder struct {
+	// Operation names the operation of a request path, e.g. Routes.Op
+	Operation func(path string) string
+	// Redact are parts of JSON keys and query parameters whose values are
+	// redacted in addition to the credentials
+	Redact []string
+
+	mu        sync.Mutex
+	w         io.Writer
+	closer    io.Closer
+	err       error
+	sanitizer *sanitizer
+}
+
+// NewRecorder returns a recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Create returns a recorder writing to the file, which is truncated
+func Create(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(f)
+	r.closer = f
+	return r, nil
+}
+
+// Transport returns a round tripper recording the interactions of next,
+// http.DefaultTransport if nil
+func (r *Recorder) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recording{recorder: r, next: next}
+}
+
+// Client returns a copy of the client recording its interactions
+func (r *Recorder) Client(c *http.Client) *http.Client {
+	rc := *c
+	rc.Transport = r.Transport(c.Transport)
+	return &rc
+}
+
+// Close stops recording and closes the file of the recorder. It returns the
+// first error of the recording.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.err
+	if r.closer != nil {
+		if cerr := r.closer.Close(); err == nil {
+			err = cerr
+		}
+		r.closer = nil
+	}
+	r.w = io.Discard
+	return err
+}
+
+func (r *Recorder) record(req *http.Request, reqBody []byte, res *http.Response, resBody []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if r.sanitizer == nil {
+		r.sanitizer = newSanitizer(r.Redact)
+	}
+	i := Interaction{
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Query:    r.sanitizer.query(req.URL.Query()),
+		Request:  r.sanitizer.message(req.Header, reqBody),
+		Response: r.sanitizer.message(res.Header, resBody),
+	}
+	i.Response.Status = res.StatusCode
+	if r.Operation != nil {
+		i.Operation = r.Operation(req.URL.Path)
+	}
+	data, err := json.Marshal(i)
+	if err != nil {
+		r.err = err
+		return
+	}
+	_, r.err = r.w.Write(append(data, '\n'))
+}
+
+// recording is a round tripper recording the interactions of the next one
+type recording struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+func (t *recording) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = data
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+	t.recorder.record(req, reqBody, res, resBody)
+	return res, nil
+}
+
+// CloseIdleConnections closes the idle connections of the next round
+// tripper, e.g. when the client recycles its connections
+func (t *recording) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,263 @@
+package contract
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Mismatch is a difference between the fields of a request or response and
+// the fields of its recording
+type Mismatch struct {
+	Operation string `json:"operation,omitempty"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	// In is request or response
+	In string `json:"in"`
+	// Missing are the recorded fields which were not sent
+	Missing []string `json:"missing,omitempty"`
+	// Unexpected are the fields which were sent but not recorded
+	Unexpected []string `json:"unexpected,omitempty"`
+}
+
+func (m Mismatch) String() string {
+	name := m.Path
+	if name == "" {
+		name = m.Operation
+	}
+	return fmt.Sprintf("%s %s: %s fields missing %v, unexpected %v", m.Method, name, m.In, m.Missing, m.Unexpected)
+}
+
+// Replayer is a round tripper serving the recorded responses. Requests are
+// matched to the recorded interactions of the same method and path in the
+// recorded order, then to those of the same operation, the last matching
+// interaction is served again once all of them were served. The fields of
+// the requests are compared to the recorded requests to detect drift of the
+// client.
+type Replayer struct {
+	// Operation names the operation of a request path, e.g. Routes.Op. It
+	// matches requests whose path differs from the recording, e.g. by an ID.
+	Operation func(path string) string
+
+	mu           sync.Mutex
+	interactions []Interaction
+	served       []int
+	mismatches   []Mismatch
+}
+
+// NewReplayer returns a replayer of the interactions
+func NewReplayer(interactions []Interaction) *Replayer {
+	return &Replayer{
+		interactions: interactions,
+		served:       make([]int, len(interactions)),
+	}
+}
+
+// Load returns a replayer of the interactions recorded in the file
+func Load(path string) (*Replayer, error) {
+	interactions, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(interactions), nil
+}
+
+// Client returns an http.Client served by the replayer
+func (r *Replayer) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip serves the recorded response of the request
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		if data, err := gunzip(body); err == nil {
+			body = data
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx := r.match(req)
+	if idx < 0 {
+		return nil, fmt.Errorf("contract: no recorded interaction for %s %s", req.Method, req.URL.Path)
+	}
+	r.served[idx]++
+	i := &r.interactions[idx]
+	r.compare(i, req, body)
+
+	data := i.Response.data()
+	header := i.Response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.Response.Status, http.StatusText(i.Response.Status)),
+		StatusCode:    i.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+// match returns the index of the interaction to serve for the request, -1
+// if none matches
+func (r *Replayer) match(req *http.Request) int {
+	if idx := r.next(func(i *Interaction) bool { return i.Path == req.URL.Path }, req.Method); idx >= 0 {
+		return idx
+	}
+	if r.Operation == nil {
+		return -1
+	}
+	op := r.Operation(req.URL.Path)
+	return r.next(func(i *Interaction) bool { return i.Operation == op }, req.Method)
+}
+
+// next returns the first unserved interaction of the method matching fn,
+// or the last served one
+func (r *Replayer) next(fn func(*Interaction) bool, method string) int {
+	last := -1
+	for idx := range r.interactions {
+		i := &r.interactions[idx]
+		if i.Method != method || !fn(i) {
+			continue
+		}
+		if r.served[idx] == 0 {
+			return idx
+		}
+		last = idx
+	}
+	return last
+}
+
+// compare records the differences between the fields of the request and
+// its recording
+func (r *Replayer) compare(i *Interaction, req *http.Request, body []byte) {
+	var want, got []string
+	for k := range i.Query {
+		want = append(want, "?"+k)
+	}
+	for k := range req.URL.Query() {
+		got = append(got, "?"+k)
+	}
+	want = append(want, fields(i.Request.data())...)
+	got = append(got, fields(body)...)
+	sort.Strings(want)
+	sort.Strings(got)
+	m := Mismatch{
+		Operation:  i.Operation,
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		In:         "request",
+		Missing:    difference(want, got),
+		Unexpected: difference(got, want),
+	}
+	if len(m.Missing) > 0 || len(m.Unexpected) > 0 {
+		r.mismatches = append(r.mismatches, m)
+	}
+}
+
+// Mismatches returns the requests whose fields differ from their recording
+func (r *Replayer) Mismatches() []Mismatch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Mismatch{}, r.mismatches...)
+}
+
+// Unserved returns the recorded interactions which were never requested,
+// e.g. of an operation the client no longer calls
+func (r *Replayer) Unserved() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Interaction
+	for idx, n := range r.served {
+		if n == 0 {
+			out = append(out, r.interactions[idx])
+		}
+	}
+	return out
+}
+
+// Compare returns the differences between the fields of the requests and
+// responses of two recordings per operation, e.g. of a recording checked in
+// with the contract tests and a recent recording against the manager, to
+// detect drift of the manager API. Interactions without an operation are
+// compared per method and path.
+func Compare(want, got []Interaction) []Mismatch {
+	type key struct{ op, method, path string }
+	type shape struct{ request, response map[string]bool }
+	shapes := func(interactions []Interaction) (map[key]*shape, []key) {
+		out := map[key]*shape{}
+		var keys []key
+		for _, i := range interactions {
+			k := key{op: i.Operation, method: i.Method}
+			if k.op == "" {
+				k.path = i.Path
+			}
+			s := out[k]
+			if s == nil {
+				s = &shape{request: map[string]bool{}, response: map[string]bool{}}
+				out[k] = s
+				keys = append(keys, k)
+			}
+			for _, f := range fields(i.Request.data()) {
+				s.request[f] = true
+			}
+			for _, f := range fields(i.Response.data()) {
+				s.response[f] = true
+			}
+		}
+		return out, keys
+	}
+	sorted := func(set map[string]bool) []string {
+		out := make([]string, 0, len(set))
+		for f := range set {
+			out = append(out, f)
+		}
+		sort.Strings(out)
+		return out
+	}
+	wantShapes, keys := shapes(want)
+	gotShapes, _ := shapes(got)
+	var mismatches []Mismatch
+	for _, k := range keys {
+		g := gotShapes[k]
+		if g == nil {
+			// the operation was not called in the recent recording
+			continue
+		}
+		w := wantShapes[k]
+		for _, in := range []string{"request", "response"} {
+			wf, gf := sorted(w.request), sorted(g.request)
+			if in == "response" {
+				wf, gf = sorted(w.response), sorted(g.response)
+			}
+			m := Mismatch{
+				Operation:  k.op,
+				Method:     k.method,
+				Path:       k.path,
+				In:         in,
+				Missing:    difference(wf, gf),
+				Unexpected: difference(gf, wf),
+			}
+			if len(m.Missing) > 0 || len(m.Unexpected) > 0 {
+				mismatches = append(mismatches, m)
+			}
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,172 @@
+// Package daemon supports long-running tasks which represent persistent
+// services (port-forwarders, watchers) that outlive a single poll cycle.
+//
+// A task handler turns its task into a daemon task by calling Start with the
+// function that runs the service. The response written by the handler is sent
+// to the manager as the first status update, after which the manager is kept
+// informed that the daemon is alive until it exits or the task is aborted.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+)
+
+// ErrNotSupported is returned by Start when the handler is not
+// being executed by a runner which supports daemon tasks.
+var ErrNotSupported = errors.New("daemon tasks are not supported")
+
+// Func runs a daemon. It should run until ctx is canceled.
+type Func func(ctx context.Context) error
+
+type key struct{}
+
+type slot struct {
+	fn Func
+}
+
+// Start marks the task being handled as a daemon task. fn is run in the
+// background once the handler returns.
+func Start(ctx context.Context, fn Func) error {
+	s, ok := ctx.Value(key{}).(*slot)
+	if !ok {
+		return ErrNotSupported
+	}
+	s.fn = fn
+	return nil
+}
+
+// Attach returns a context which allows a handler to call Start, and a function
+// which returns the daemon registered by the handler (if any).
+func Attach(ctx context.Context) (context.Context, func() Func) {
+	s := &slot{}
+	return context.WithValue(ctx, key{}, s), func() Func { return s.fn }
+}
+
+// Manager tracks the running daemons and renews their status with the manager
+type Manager struct {
+	Client   client.Client
+	Interval time.Duration // interval at which the lease of a daemon is renewed
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+// NewManager returns a daemon manager which renews leases every interval
+func NewManager(c client.Client, interval time.Duration) *Manager {
+	return &Manager{
+		Client:   c,
+		Interval: interval,
+		running:  map[string]context.CancelFunc{},
+	}
+}
+
+// Run starts the daemon for the task in the background. data is the initial
+// response written by the handler.
+func (m *Manager) Run(ctx context.Context, delegateID string, t *client.Task, fn Func, data []byte) {
+	ctx, cancel := context.WithCancel(ctx)
+	m.mu.Lock()
+	m.running[t.ID] = cancel
+	m.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				logrus.WithField("task_id", t.ID).WithField("stack", string(debug.Stack())).Errorln("daemon task panicked")
+				done <- fmt.Errorf("daemon panicked: %v", v)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+	go func() {
+		defer func() {
+			cancel()
+			m.mu.Lock()
+			delete(m.running, t.ID)
+			m.mu.Unlock()
+		}()
+		m.renew(ctx, delegateID, t, data)
+		ticker := time.NewTicker(m.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.renew(ctx, delegateID, t, data)
+			case err := <-done:
+				m.finish(delegateID, t, err)
+				return
+			}
+		}
+	}()
+}
+
+// Abort stops the daemon for the task. It returns false if no daemon
+// is running for the task.
+func (m *Manager) Abort(taskID string) bool {
+	m.mu.Lock()
+	cancel, ok := m.running[taskID]
+	m.mu.Unlock()
+	if ok {
+		logrus.WithField("task_id", taskID).Infoln("aborting daemon task")
+		cancel()
+	}
+	return ok
+}
+
+// Running returns the IDs of the tasks whose daemons are running
+func (m *Manager) Running() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for id := range m.running {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// renew lets the manager know that the daemon is still alive
+func (m *Manager) renew(ctx context.Context, delegateID string, t *client.Task, data []byte) {
+	err := m.Client.SendStatus(ctx, delegateID, t.ID, &client.TaskResponse{
+		ID:   t.ID,
+		Data: data,
+		Code: client.CodeRunning,
+		Type: t.Type,
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("task_id", t.ID).Errorln("could not renew daemon task lease")
+	}
+}
+
+// finish sends the final status of the daemon once it exits
+func (m *Manager) finish(delegateID string, t *client.Task, err error) {
+	resp := &client.TaskResponse{
+		ID:   t.ID,
+		Data: json.RawMessage("{}"),
+		Code: client.CodeOK,
+		Type: t.Type,
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		resp.Code = client.CodeFailed
+		resp.Error = &client.TaskError{
+			Code:     "DAEMON_FAILED",
+			Category: client.CategoryInternal,
+			Message:  err.Error(),
+		}
+	}
+	// the daemon context is canceled at this point, use a fresh one
+	// so the final status still reaches the manager.
+	if err := m.Client.SendStatus(context.Background(), delegateID, t.ID, resp); err != nil {
+		logrus.WithError(err).WithField("task_id", t.ID).Errorln("could not send daemon task status")
+		return
+	}
+	logrus.WithField("task_id", t.ID).Infoln("daemon task exited")
+}
@@ -0,0 +1,124 @@
+// Package dedup shrinks repetitive task output, e.g. repeated log lines or
+// stack traces, by collapsing consecutive repetitions of lines and blocks of
+// lines into a marker, like syslog does with repeated messages.
+package dedup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MaxBlock is the maximum number of lines of a repeated block
+var MaxBlock = 16
+
+// MinRepeats is the minimum number of consecutive repetitions of a single
+// line which are collapsed. Blocks of multiple lines are collapsed once
+// they repeat.
+var MinRepeats = 3
+
+// Lines collapses consecutive repetitions of lines and blocks of lines. The
+// first occurrence is kept and followed by a line noting the repetitions.
+func Lines(s string) string {
+	if strings.Count(s, "\n") < 2 {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); {
+		size, reps := longestRun(lines, i)
+		if reps == 0 {
+			out = append(out, lines[i])
+			i++
+			continue
+		}
+		out = append(out, lines[i:i+size]...)
+		if size == 1 {
+			out = append(out, fmt.Sprintf("[previous line repeated %d more times]", reps))
+		} else {
+			out = append(out, fmt.Sprintf("[previous %d lines repeated %d more times]", size, reps))
+		}
+		i += size * (reps + 1)
+	}
+	return strings.Join(out, "\n")
+}
+
+// longestRun returns the block size whose repetitions starting at i cover
+// the most lines and the number of repetitions after the first occurrence.
+// It returns zero repetitions if there is no run worth collapsing.
+func longestRun(lines []string, i int) (size, reps int) {
+	best := 0
+	for k := 1; k <= MaxBlock && i+2*k <= len(lines); k++ {
+		n := 0
+		for j := i + k; j+k <= len(lines) && equal(lines[i:i+k], lines[j:j+k]); j += k {
+			n++
+		}
+		least := 1
+		if k == 1 {
+			least = MinRepeats - 1
+		}
+		if n >= least && n*k > best {
+			best, size, reps = n*k, k, n
+		}
+	}
+	return size, reps
+}
+
+func equal(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// JSON collapses repetitions in the string values of the JSON document. The
+// document is returned unchanged if no string was collapsed.
+func JSON(data json.RawMessage) (json.RawMessage, error) {
+	if len(data) == 0 || !bytes.Contains(data, []byte(`\n`)) {
+		return data, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	v, changed := walk(v)
+	if !changed {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func walk(v interface{}) (interface{}, bool) {
+	changed := false
+	switch t := v.(type) {
+	case string:
+		s := Lines(t)
+		return s, len(s) != len(t)
+	case map[string]interface{}:
+		for k, e := range t {
+			var c bool
+			if t[k], c = walk(e); c {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for i, e := range t {
+			var c bool
+			if t[i], c = walk(e); c {
+				changed = true
+			}
+		}
+	}
+	return v, changed
+}
@@ -0,0 +1,108 @@
+package delegate
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// number of buckets the window of a retry budget is divided into
+const budgetBuckets = 10
+
+// RetryBudgetExhaustedError is returned instead of retrying a failed request
+// once the retry budget is exhausted
+type RetryBudgetExhaustedError struct {
+	Err error // error of the last attempt
+}
+
+func (e *RetryBudgetExhaustedError) Error() string {
+	return fmt.Sprintf("retry budget exhausted: %s", e.Err)
+}
+
+// Unwrap returns the error of the last attempt
+func (e *RetryBudgetExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// RetryBudget bounds the share of retries among the requests sent within a
+// sliding window, so that retries do not amplify the load on a manager which
+// is partially down. A budget can be shared by clients of several endpoints.
+type RetryBudget struct {
+	// Ratio is the maximum share of retries, e.g. 0.2 for 20% of the requests
+	Ratio float64
+	// Window is the duration of the sliding window
+	Window time.Duration
+	// MinRetries are allowed within the window regardless of the ratio, so
+	// that clients sending few requests can retry
+	MinRetries int
+
+	mu      sync.Mutex
+	buckets [budgetBuckets]budgetBucket
+}
+
+type budgetBucket struct {
+	start    int64 // index of the bucket since the epoch
+	requests int
+	retries  int
+}
+
+// NewRetryBudget returns a budget allowing the ratio of retries within the window
+func NewRetryBudget(ratio float64, window time.Duration) *RetryBudget {
+	return &RetryBudget{Ratio: ratio, Window: window, MinRetries: 10}
+}
+
+// request records an attempt of a request, including retries
+func (b *RetryBudget) request() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bucket(time.Now()).requests++
+}
+
+// withdraw records a retry and reports whether it is within the budget
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	requests, retries := b.sum(now)
+	if float64(retries) >= float64(b.MinRetries)+b.Ratio*float64(requests-retries) {
+		return false
+	}
+	b.bucket(now).retries++
+	return true
+}
+
+// bucket returns the current bucket, resetting it if it expired
+func (b *RetryBudget) bucket(now time.Time) *budgetBucket {
+	i := b.index(now)
+	bucket := &b.buckets[i%budgetBuckets]
+	if bucket.start != i {
+		*bucket = budgetBucket{start: i}
+	}
+	return bucket
+}
+
+// sum returns the requests and retries within the window
+func (b *RetryBudget) sum(now time.Time) (requests, retries int) {
+	i := b.index(now)
+	for _, bucket := range b.buckets {
+		if i-bucket.start < budgetBuckets {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	return requests, retries
+}
+
+func (b *RetryBudget) index(now time.Time) int64 {
+	size := b.Window / budgetBuckets
+	if size <= 0 {
+		size = time.Millisecond
+	}
+	return now.UnixNano() / int64(size)
+}
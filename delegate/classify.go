@@ -0,0 +1,56 @@
+package delegate
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// retryable reports whether a failed request is worth retrying. Transient
+// failures like connection resets, DNS failures, timeouts or 502/503/504
+// responses are retried. Permanent failures like rejected requests, bad
+// credentials or invalid certificates are not, as retrying them only burns
+// the backoff budget.
+func retryable(res *http.Response, err error) bool {
+	if res != nil {
+		return retryableStatus(res.StatusCode)
+	}
+	return err != nil && !permanent(err)
+}
+
+// retryableStatus reports whether a response with the status code is transient
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return code > 501
+}
+
+// permanent reports whether a request error can not be fixed by a retry
+func permanent(err error) bool {
+	var (
+		tooLarge  *ResponseTooLargeError
+		tooBig    *RequestTooLargeError
+		unknownCA x509.UnknownAuthorityError
+		hostname  x509.HostnameError
+		invalid   x509.CertificateInvalidError
+		urlErr    *url.Error
+	)
+	switch {
+	case errors.As(err, &tooLarge),
+		errors.As(err, &tooBig),
+		errors.As(err, &unknownCA),
+		errors.As(err, &hostname),
+		errors.As(err, &invalid):
+		return true
+	case errors.As(err, &urlErr):
+		// the request could not be built, e.g. the endpoint is not a valid URL
+		return urlErr.Op == "parse" || strings.Contains(urlErr.Err.Error(), "unsupported protocol scheme")
+	}
+	return false
+}
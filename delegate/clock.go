@@ -0,0 +1,59 @@
+package delegate
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// clockSkewThreshold is the skew with the manager clock above which it is
+// reported and compensated. The Date header has a resolution of a second and
+// includes the latency of the response.
+var clockSkewThreshold = 5 * time.Second
+
+// dateSkew returns the difference between the Date header of the response and
+// the local time. The header has a resolution of a second.
+func dateSkew(res *http.Response) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+	date, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+	return date.Sub(time.Now()).Truncate(time.Second), true
+}
+
+// ClockSkew returns the last observed offset of the manager clock from the
+// local clock, zero if it is below the threshold.
+func (p *HTTPClient) ClockSkew() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.clockSkew))
+}
+
+// observeClock detects the skew of the local clock from the Date header of a
+// response. A warning is logged when the skew changes, and the offset is
+// applied to the tokens if CompensateClockSkew is set.
+func (p *HTTPClient) observeClock(res *http.Response) {
+	skew, ok := dateSkew(res)
+	if !ok {
+		return
+	}
+	if skew < clockSkewThreshold && skew > -clockSkewThreshold {
+		skew = 0
+	}
+	prev := time.Duration(atomic.SwapInt64(&p.clockSkew, int64(skew)))
+	if d := skew - prev; d < clockSkewThreshold && d > -clockSkewThreshold {
+		return
+	}
+	switch {
+	case skew == 0:
+		p.logger().Infof("the local clock is in sync with the manager clock")
+	case skew > 0:
+		p.logger().Warnf("the local clock is %s behind the manager clock, tokens may be rejected", skew)
+	default:
+		p.logger().Warnf("the local clock is %s ahead of the manager clock, tokens may be rejected", -skew)
+	}
+	if p.CompensateClockSkew {
+		p.AccountTokenCache.SetClockOffset(skew)
+	}
+}
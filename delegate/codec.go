@@ -0,0 +1,74 @@
+package delegate
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// A Codec encodes and decodes the payloads exchanged with the manager,
+// e.g. with protobuf.
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSON is the default codec
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return "application/json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// accept returns the Accept header listing the codecs in order of
+// preference, JSON last.
+func (p *HTTPClient) accept() string {
+	types := make([]string, 0, len(p.Codecs)+1)
+	for _, c := range p.Codecs {
+		types = append(types, c.ContentType())
+	}
+	return strings.Join(append(types, JSON.ContentType()+";q=0.5"), ", ")
+}
+
+// requestCodec returns the codec used to encode requests. It is JSON until
+// the manager responded with the content type of one of the codecs.
+func (p *HTTPClient) requestCodec() Codec {
+	if c, ok := p.negotiated.Load().(Codec); ok {
+		return c
+	}
+	return JSON
+}
+
+// responseCodec returns the codec of the response content type and records
+// it as negotiated. It returns nil for JSON or unknown content types.
+func (p *HTTPClient) responseCodec(res *http.Response) Codec {
+	mt, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	for _, c := range p.Codecs {
+		if c.ContentType() == mt {
+			p.negotiated.Store(c)
+			return c
+		}
+	}
+	return nil
+}
+
+// decode decodes the response body with the codec of its content type
+func (p *HTTPClient) decode(res *http.Response, body io.Reader, out interface{}) error {
+	c := p.responseCodec(res)
+	if c == nil {
+		return p.decodeJSON(body, out)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(b, out)
+}
@@ -0,0 +1,59 @@
+package delegate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/dedup"
+)
+
+// compress gzips the request body if it is larger than the compression
+// threshold and the server did not reject compressed requests before. It
+// reports whether the body was compressed.
+func (p *HTTPClient) compress(buf *bytes.Buffer) bool {
+	if p.CompressionThreshold <= 0 || buf.Len() < p.CompressionThreshold ||
+		atomic.LoadInt32(&p.compressionUnsupported) == 1 {
+		return false
+	}
+	var z bytes.Buffer
+	zw := gzip.NewWriter(&z)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return false
+	}
+	if err := zw.Close(); err != nil {
+		return false
+	}
+	*buf = z
+	return true
+}
+
+// compressionRejected reports whether the server rejected a compressed
+// request, in which case requests are no longer compressed.
+func (p *HTTPClient) compressionRejected(res *http.Response) bool {
+	if res == nil || res.StatusCode != http.StatusUnsupportedMediaType ||
+		res.Request == nil || res.Request.Header.Get("Content-Encoding") != "gzip" {
+		return false
+	}
+	p.logger().Infof("compressed requests are not supported by the server, sending them uncompressed")
+	atomic.StoreInt32(&p.compressionUnsupported, 1)
+	return true
+}
+
+// compact collapses repeated lines and blocks of lines in the data of the
+// task response. The response is returned unchanged if DedupResponseData is
+// not set or the data can not be compacted.
+func (p *HTTPClient) compact(r *client.TaskResponse) *client.TaskResponse {
+	if !p.DedupResponseData {
+		return r
+	}
+	data, err := dedup.JSON(r.Data)
+	if err != nil || len(data) == len(r.Data) {
+		return r
+	}
+	compacted := *r
+	compacted.Data = data
+	return &compacted
+}
@@ -0,0 +1,47 @@
+package delegate
+
+import (
+	"context"
+	"net/http"
+)
+
+// PoolOptions sizes the connection pool of a transport.
+type PoolOptions struct {
+	// MaxConns bounds the connections per host, unbounded if zero
+	MaxConns int
+	// MaxIdleConns bounds the idle connections per host, defaults to 2
+	MaxIdleConns int
+}
+
+// apply configures the connection pool of the transport
+func (o *PoolOptions) apply(t *http.Transport) {
+	t.MaxConnsPerHost = o.MaxConns
+	if o.MaxIdleConns > 0 {
+		t.MaxIdleConnsPerHost = o.MaxIdleConns
+	}
+}
+
+type dataPlaneKey struct{}
+
+// withDataPlane marks the requests sent with the context as bulk data
+// traffic, e.g. task payloads and statuses
+func withDataPlane(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dataPlaneKey{}, true)
+}
+
+// httpClient returns the client for the request context: DataClient for
+// data traffic if it is set, otherwise Client.
+func (p *HTTPClient) httpClient(ctx context.Context) *http.Client {
+	if p.DataClient != nil && ctx.Value(dataPlaneKey{}) != nil {
+		return p.DataClient
+	}
+	return p.Client
+}
+
+// closeIdleConnections closes the idle connections of both clients
+func (p *HTTPClient) closeIdleConnections() {
+	p.Client.CloseIdleConnections()
+	if p.DataClient != nil && p.DataClient != p.Client {
+		p.DataClient.CloseIdleConnections()
+	}
+}
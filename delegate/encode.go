@@ -0,0 +1,143 @@
+package delegate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Encoding controls the JSON encoding of the request payloads
+type Encoding struct {
+	// DisableHTMLEscape keeps <, > and & in strings instead of escaping them,
+	// which bloats payloads carrying logs or markup
+	DisableHTMLEscape bool
+	// OmitEmpty drops the fields of the request envelope which are null or
+	// empty strings, arrays or objects. Zero numbers and false are kept, as
+	// they are meaningful, e.g. an exit code. The task payloads, e.g. the
+	// data of a response, are sent as they are.
+	OmitEmpty bool
+	// MaxPayloadSize fails the requests whose encoded payload is larger with
+	// a RequestTooLargeError before they are sent. Not limited if zero.
+	MaxPayloadSize int
+}
+
+// RequestTooLargeError is returned when an encoded request payload exceeds
+// the maximum payload size configured on the client.
+type RequestTooLargeError struct {
+	Size  int
+	Limit int
+}
+
+func (e *RequestTooLargeError) Error() string {
+	return fmt.Sprintf("request payload of %d bytes exceeds the limit of %d bytes", e.Size, e.Limit)
+}
+
+// marshal encodes the request payload with the codec
+func (p *HTTPClient) marshal(codec Codec, in interface{}) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if codec == JSON {
+		b, err = p.Encoding.marshalJSON(in)
+	} else {
+		b, err = codec.Marshal(in)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if limit := p.Encoding.MaxPayloadSize; limit > 0 && len(b) > limit {
+		return nil, &RequestTooLargeError{Size: len(b), Limit: limit}
+	}
+	return b, nil
+}
+
+// marshalJSON encodes v as JSON with the options
+func (e Encoding) marshalJSON(v interface{}) ([]byte, error) {
+	if !e.DisableHTMLEscape && !e.OmitEmpty {
+		return json.Marshal(v)
+	}
+	b, err := e.encode(v)
+	if err != nil || !e.OmitEmpty {
+		return b, err
+	}
+	return e.omitEmpty(b)
+}
+
+// encode encodes v without the trailing newline of the encoder
+func (e Encoding) encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(!e.DisableHTMLEscape)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// payloadFields are the fields carrying task payloads as raw JSON. They are
+// sent as they are, only dropped if null.
+var payloadFields = map[string]bool{"data": true, "capabilities": true}
+
+// omitEmpty drops the empty fields of the objects of the request envelope in
+// b. The values are kept as they were encoded, e.g. the numbers keep their
+// precision.
+func (e Encoding) omitEmpty(b json.RawMessage) (json.RawMessage, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return b, nil
+	}
+	switch b[0] {
+	case '{':
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return nil, err
+		}
+		for k, v := range obj {
+			if payloadFields[k] {
+				if isNull(v) {
+					delete(obj, k)
+				}
+				continue
+			}
+			v, err := e.omitEmpty(v)
+			if err != nil {
+				return nil, err
+			}
+			if empty(v) {
+				delete(obj, k)
+				continue
+			}
+			obj[k] = v
+		}
+		return e.encode(obj)
+	case '[':
+		var arr []json.RawMessage
+		if err := json.Unmarshal(b, &arr); err != nil {
+			return nil, err
+		}
+		for i, v := range arr {
+			v, err := e.omitEmpty(v)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = v
+		}
+		return e.encode(arr)
+	}
+	return b, nil
+}
+
+func isNull(v json.RawMessage) bool {
+	return string(bytes.TrimSpace(v)) == "null"
+}
+
+// empty reports if the encoded value is null or an empty string, array or
+// object. The objects and arrays are compacted by omitEmpty.
+func empty(v json.RawMessage) bool {
+	switch string(v) {
+	case "null", `""`, "[]", "{}":
+		return true
+	}
+	return false
+}
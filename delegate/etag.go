@@ -0,0 +1,78 @@
+package delegate
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// maxCachedEventPaths bounds the number of task event requests whose last
+// response is cached, e.g. one per page token.
+const maxCachedEventPaths = 64
+
+// cachedEvents is the last task events response of a request
+type cachedEvents struct {
+	etag         string
+	lastModified string
+	events       *client.TaskEventsResponse
+}
+
+// eventsCache holds the last task events responses which carried an
+// ETag or Last-Modified header.
+type eventsCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedEvents
+}
+
+func (c *eventsCache) get(path string) *cachedEvents {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[path]
+}
+
+func (c *eventsCache) put(path string, e *cachedEvents) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) >= maxCachedEventPaths {
+		c.entries = map[string]*cachedEvents{}
+	}
+	c.entries[path] = e
+}
+
+// getTaskEvents fetches the task events with a conditional request if the last
+// response carried an ETag or Last-Modified header. If the server responds that the
+// events did not change, the cached response is returned without decoding a body.
+func (p *HTTPClient) getTaskEvents(ctx context.Context, path string) (*client.TaskEventsResponse, error) {
+	header := http.Header{}
+	cached := p.events.get(path)
+	if cached != nil {
+		if cached.etag != "" {
+			header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	events := &client.TaskEventsResponse{}
+	res, err := p.doHeader(ctx, path, "GET", header, nil, events)
+	if err != nil || res == nil {
+		return events, err
+	}
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		return copyEvents(cached.events), nil
+	}
+	etag, modified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+	if etag != "" || modified != "" {
+		p.events.put(path, &cachedEvents{etag: etag, lastModified: modified, events: copyEvents(events)})
+	}
+	return events, nil
+}
+
+func copyEvents(r *client.TaskEventsResponse) *client.TaskEventsResponse {
+	return &client.TaskEventsResponse{
+		TaskEvents:    append([]client.TaskEvent(nil), r.TaskEvents...),
+		NextPageToken: r.NextPageToken,
+	}
+}
@@ -0,0 +1,118 @@
+package delegate
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wings-software/dlite/events"
+)
+
+var (
+	defaultFailoverThreshold = 3
+	defaultFailbackInterval  = 5 * time.Minute
+)
+
+// failover tracks which of the manager endpoints is in use. After a number of
+// consecutive failures the next endpoint is used. While a secondary endpoint is
+// in use, the primary endpoint is periodically probed with a live request and
+// used again once it succeeds.
+type failover struct {
+	mu       sync.Mutex
+	active   int
+	failures int
+	switched time.Time
+	probing  bool
+}
+
+// endpoint returns the endpoint the next request should be sent to, and
+// whether the request probes the primary endpoint. The caller must call
+// endProbe once a probe is done, whether or not its outcome was reported.
+func (p *HTTPClient) endpoint() (string, bool) {
+	urls := p.endpoints()
+	if len(urls) == 1 {
+		return urls[0], false
+	}
+	f := &p.failover
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.active >= len(urls) {
+		f.active = 0
+	}
+	if f.active != 0 && !f.probing && time.Since(f.switched) > p.failbackInterval() {
+		f.probing = true
+		return urls[0], true
+	}
+	return urls[f.active], false
+}
+
+// endProbe clears the probe of the primary endpoint if its outcome was not
+// reported, e.g. because the caller gave up, so that the next request probes
+// the primary endpoint again
+func (p *HTTPClient) endProbe() {
+	f := &p.failover
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.probing = false
+}
+
+// report records the outcome of a request to an endpoint
+func (p *HTTPClient) report(endpoint string, ok bool) {
+	urls := p.endpoints()
+	if len(urls) == 1 {
+		return
+	}
+	f := &p.failover
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.probing && endpoint == urls[0] {
+		f.probing = false
+		if ok {
+			p.logger().Infof("manager endpoint %s is healthy again, failing back", endpoint)
+			p.closeIdleConnections()
+			p.Events.Publish(events.Event{Type: events.EndpointFailedOver, Endpoint: endpoint})
+			f.active, f.failures = 0, 0
+		} else {
+			f.switched = time.Now()
+		}
+		return
+	}
+	if f.active >= len(urls) || endpoint != urls[f.active] {
+		return
+	}
+	if ok {
+		f.failures = 0
+		return
+	}
+	f.failures++
+	if f.failures < p.failoverThreshold() {
+		return
+	}
+	f.active = (f.active + 1) % len(urls)
+	f.failures = 0
+	f.switched = time.Now()
+	p.logger().Warnf("failing over from manager endpoint %s to %s", endpoint, urls[f.active])
+	p.closeIdleConnections()
+	p.Events.Publish(events.Event{Type: events.EndpointFailedOver, Endpoint: urls[f.active]})
+}
+
+// endpoints returns the list of manager endpoints, primary first
+func (p *HTTPClient) endpoints() []string {
+	if len(p.Endpoints) > 0 {
+		return p.Endpoints
+	}
+	return []string{p.Endpoint}
+}
+
+func (p *HTTPClient) failoverThreshold() int {
+	if p.FailoverThreshold <= 0 {
+		return defaultFailoverThreshold
+	}
+	return p.FailoverThreshold
+}
+
+func (p *HTTPClient) failbackInterval() time.Duration {
+	if p.FailbackInterval <= 0 {
+		return defaultFailbackInterval
+	}
+	return p.FailbackInterval
+}
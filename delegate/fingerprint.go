@@ -0,0 +1,17 @@
+package delegate
+
+import (
+	"context"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/fingerprint"
+)
+
+// hostInfo returns the fingerprint of the host. It is collected once, the
+// host facts do not change while the runner is running.
+func (p *HTTPClient) hostInfo(ctx context.Context) *client.HostInfo {
+	p.fingerprint.once.Do(func() {
+		p.fingerprint.host = fingerprint.Collect(ctx)
+	})
+	return p.fingerprint.host
+}
@@ -0,0 +1,137 @@
+package delegate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+)
+
+const (
+	// defaultGatewayExchangePath is the token exchange endpoint of the gateway
+	defaultGatewayExchangePath = "/gateway/api/agent/delegates/token-exchange?accountId=%s"
+	// defaultGatewaySessionTTL is the lifetime of session tokens whose
+	// exchange response does not tell it
+	defaultGatewaySessionTTL = 5 * time.Minute
+)
+
+// Gateway exchanges the delegate tokens for the short-lived session tokens
+// of a gateway in front of the manager, which authorize all the other
+// requests. The sessions are exchanged on the first request of an account
+// and refreshed before they expire. A session which could not be refreshed
+// is used until it expires.
+type Gateway struct {
+	// Path is the path of the token exchange endpoint, formatted with the
+	// account ID, defaults to /gateway/api/agent/delegates/token-exchange?accountId=%s
+	Path string
+	// RefreshBefore refreshes the sessions once they expire within the
+	// duration, defaults to a fifth of their lifetime
+	RefreshBefore time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*gatewaySession
+}
+
+// gatewaySession is a session token and the time it expires at
+type gatewaySession struct {
+	token   string
+	expiry  time.Time
+	refresh time.Time // the session is refreshed from then on
+}
+
+// NewGateway returns a gateway using the default token exchange endpoint
+func NewGateway() *Gateway {
+	return &Gateway{}
+}
+
+// gatewayExchangeKey marks the context of a token exchange, which is
+// authorized with the delegate token
+type gatewayExchangeKey struct{}
+
+func exchanging(ctx context.Context) bool {
+	return ctx.Value(gatewayExchangeKey{}) != nil
+}
+
+// Expiry returns the time the session of the account expires at, zero if
+// there is none
+func (g *Gateway) Expiry(account string) time.Time {
+	if g == nil {
+		return time.Time{}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if s := g.sessions[account]; s != nil {
+		return s.expiry
+	}
+	return time.Time{}
+}
+
+// invalidate removes the session of the account, e.g. once the gateway
+// rejected it, so that the next request exchanges a new one
+func (g *Gateway) invalidate(account string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.sessions, account)
+}
+
+// token returns the session token of the account, exchanging the delegate
+// token for a new session if there is none or it needs to be refreshed.
+// Concurrent requests wait for the exchange in flight.
+func (g *Gateway) token(ctx context.Context, p *HTTPClient, account string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	s := g.sessions[account]
+	if s != nil && now.Before(s.refresh) {
+		return s.token, nil
+	}
+	next, err := g.exchange(ctx, p, account)
+	if err != nil {
+		// the current session stays valid for the request
+		if s != nil && now.Add(tokenMargin).Before(s.expiry) {
+			p.logger().Warnf("could not refresh the gateway session of account %s, using it until it expires at %s: %s",
+				account, s.expiry.Format(time.RFC3339), err)
+			return s.token, nil
+		}
+		return "", err
+	}
+	if g.sessions == nil {
+		g.sessions = map[string]*gatewaySession{}
+	}
+	g.sessions[account] = next
+	return next.token, nil
+}
+
+// exchange exchanges the delegate token of the account for a session token
+func (g *Gateway) exchange(ctx context.Context, p *HTTPClient, account string) (*gatewaySession, error) {
+	path := g.Path
+	if path == "" {
+		path = defaultGatewayExchangePath
+	}
+	resp := &client.TokenExchangeResponse{}
+	issued := time.Now()
+	ctx = context.WithValue(ctx, gatewayExchangeKey{}, true)
+	if _, err := p.do(ctx, fmt.Sprintf(path, account), "POST", &client.TokenExchangeRequest{AccountID: account}, resp); err != nil {
+		return nil, fmt.Errorf("gateway token exchange: %w", err)
+	}
+	if resp.Token == "" {
+		return nil, errors.New("gateway token exchange: no session token in the response")
+	}
+	ttl := time.Duration(resp.ExpiresIn) * time.Second
+	if ttl <= 0 {
+		ttl = defaultGatewaySessionTTL
+	}
+	refresh := g.RefreshBefore
+	if refresh <= 0 || refresh >= ttl {
+		refresh = ttl / 5
+	}
+	s := &gatewaySession{token: resp.Token, expiry: issued.Add(ttl), refresh: issued.Add(ttl - refresh)}
+	p.logger().Infof("exchanged the delegate token of account %s for a gateway session valid until %s", account, s.expiry.Format(time.RFC3339))
+	return s, nil
+}
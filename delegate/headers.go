@@ -0,0 +1,30 @@
+package delegate
+
+import "net/http"
+
+// HeaderFunc returns headers which are set on a request just before it is
+// authorized and sent, e.g. the metadata required by an API gateway. The
+// request must not be modified.
+type HeaderFunc func(req *http.Request) http.Header
+
+// AccountIDHeader returns a HeaderFunc which sets the header to the account
+// of the request, falling back to the account of the client
+func (p *HTTPClient) AccountIDHeader(name string) HeaderFunc {
+	return func(req *http.Request) http.Header {
+		id := req.URL.Query().Get("accountId")
+		if id == "" {
+			id = p.AccountID
+		}
+		return http.Header{http.CanonicalHeaderKey(name): {id}}
+	}
+}
+
+// addDynamicHeaders sets the headers returned by the header funcs, which
+// override the static headers
+func (p *HTTPClient) addDynamicHeaders(req *http.Request) {
+	for _, fn := range p.HeaderFuncs {
+		for k, v := range fn(req) {
+			req.Header[k] = append([]string(nil), v...)
+		}
+	}
+}
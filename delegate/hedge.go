@@ -0,0 +1,65 @@
+package delegate
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// hedgedAcquire acquires the task and sends a second, identical request if the
+// first one did not complete within the hedge delay. The first successful
+// response wins and the other request is canceled. Both requests carry the same
+// request ID and idempotency key so that the manager can recognize the duplicate,
+// and both are sent on behalf of the same delegate, so the task is never handed
+// to two runners.
+func (p *HTTPClient) hedgedAcquire(ctx context.Context, path, key string, delay time.Duration) (*client.Task, *http.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // cancels the slower request
+
+	id := newRequestID()
+	results := make(chan acquireResult, 2)
+	attempt := func() {
+		out := p.acquireOut()
+		res, err := p.send(ctx, id, path, "PUT", idempotent(key), nil, out)
+		if err != nil {
+			err = &RequestError{RequestID: id, Err: err}
+		}
+		results <- acquireResult{task: out.task, res: res, err: err}
+	}
+	go attempt()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	inflight := 1
+	for {
+		select {
+		case <-timer.C:
+			p.logger().Debugf("acquire request %s is slow, sending a hedged request", id)
+			inflight++
+			go attempt()
+		case r := <-results:
+			inflight--
+			// a failure is not hedged, but a hedged request still in flight may succeed
+			if r.err == nil || inflight == 0 {
+				go discardAcquired(results, inflight)
+				return r.task, r.res, r.err
+			}
+		}
+	}
+}
+
+type acquireResult struct {
+	task *client.Task
+	res  *http.Response
+	err  error
+}
+
+// discardAcquired removes the streamed payloads of the n requests which lost
+func discardAcquired(results <-chan acquireResult, n int) {
+	for ; n > 0; n-- {
+		if r := <-results; r.err == nil && r.task.Payload != nil {
+			r.task.Payload.Remove()
+		}
+	}
+}
@@ -3,33 +3,33 @@ package delegate
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
-	"github.com/sirupsen/logrus"
 	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/events"
 
 	"github.com/wings-software/dlite/logger"
+	"github.com/wings-software/dlite/metrics"
+	"github.com/wings-software/dlite/version"
 )
 
+// Build metadata headers sent with every request
 const (
-	registerEndpoint    = "/api/agent/delegates/register?accountId=%s"
-	heartbeatEndpoint   = "/api/agent/delegates/heartbeat-with-polling?accountId=%s"
-	taskPollEndpoint    = "/api/agent/delegates/%s/task-events?accountId=%s"
-	taskAcquireEndpoint = "/api/agent/v2/delegates/%s/tasks/%s/acquire?accountId=%s&delegateInstanceId=%s"
-	taskStatusEndpoint  = "/api/agent/v2/tasks/%s/delegates/%s?accountId=%s"
+	VersionHeader = "X-Dlite-Version"
+	CommitHeader  = "X-Dlite-Commit"
 )
 
-var (
-	registerTimeout   = 30 * time.Second
-	taskEventsTimeout = 60 * time.Second
-)
+// longPollGrace is the additional time the client waits for a long-poll
+// response after the server side timeout elapsed.
+var longPollGrace = 10 * time.Second
 
 // defaultClient is the default http.Client.
 var defaultClient = &http.Client{
@@ -40,30 +40,13 @@ var defaultClient = &http.Client{
 
 // New returns a new client.
 func New(endpoint, id, secret string, skipverify bool) *HTTPClient {
-	log := logrus.New()
-	cache := NewTokenCache(id, secret)
-	c := &HTTPClient{
-		Logger:            log,
-		Endpoint:          endpoint,
-		SkipVerify:        skipverify,
-		AccountID:         id,
-		Client:            defaultClient,
-		AccountTokenCache: cache,
-	}
-	if skipverify {
-		c.Client = &http.Client{
-			CheckRedirect: func(*http.Request, []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: skipverify, //nolint:gosec
-				},
-			},
-		}
-	}
-	return c
+	return NewWithOptions(endpoint, id, secret, WithSkipVerify(skipverify))
+}
+
+// NewWithEndpoints returns a new client which fails over between the manager endpoints.
+// The first endpoint is the primary one.
+func NewWithEndpoints(endpoints []string, id, secret string, skipverify bool) *HTTPClient {
+	return NewWithOptions(endpoints[0], id, secret, WithSkipVerify(skipverify), WithEndpoints(endpoints...))
 }
 
 // An HTTPClient manages communication with the runner API.
@@ -74,99 +57,534 @@ type HTTPClient struct {
 	AccountID         string
 	AccountTokenCache *TokenCache
 	SkipVerify        bool
+	MaxResponseSize   int64 // maximum size of a response body, defaults to 10MB
+	// PayloadStreamThreshold streams acquired tasks larger than the threshold to a
+	// temporary file in PayloadDir instead of decoding them into memory. Tasks
+	// acquired in batches are not streamed. Disabled if zero.
+	PayloadStreamThreshold int64
+	PayloadDir             string
+	MaxPayloadSize         int64 // maximum size of a streamed task, defaults to 1GB
+	DrainLimit             int64 // maximum number of bytes drained from a response body, defaults to 4096
+	// LongPollTimeout enables long-polling for task events. The server holds the request
+	// until events are available or the timeout elapses.
+	LongPollTimeout time.Duration
+
+	// Endpoints is the list of manager endpoints to fail over between. If it is
+	// empty, Endpoint is used.
+	Endpoints []string
+	// FailoverThreshold is the number of consecutive failures after which the
+	// next endpoint is used, defaults to 3.
+	FailoverThreshold int
+	// FailbackInterval is the interval at which the primary endpoint is probed
+	// while failed over, defaults to 5 minutes.
+	FailbackInterval time.Duration
+
+	// UserAgent is sent with every request, defaults to dlite/<version> (<os>/<arch>).
+	UserAgent string
+	// Headers are added to every request, e.g. the host name of the runner.
+	Headers http.Header
+	// HeaderFuncs add headers computed for every request, which override Headers.
+	HeaderFuncs []HeaderFunc
+
+	// OnRetry is called for every retried attempt of a request and with the
+	// outcome of retried requests. Metrics optionally counts the retries.
+	OnRetry func(RetryEvent)
+	Metrics *metrics.Registry
+
+	// Signer optionally signs every request after it was authorized.
+	Signer Signer
+
+	// Gateway optionally exchanges the delegate tokens for the session tokens
+	// of a gateway in front of the manager, which authorize the requests
+	Gateway *Gateway
+
+	// Timeouts bounds the time spent on the requests, defaults to DefaultTimeouts.
+	Timeouts Timeouts
+
+	// Routes maps the API operations to paths, defaults to NewRoutes().
+	Routes     *Routes
+	routesOnce sync.Once
+
+	// LogSampler throttles the repeated error logs of the retry loop, e.g. while
+	// the manager is down. Every error is logged if it is nil.
+	LogSampler *logger.Sampler
+
+	// CompressionThreshold gzips request bodies of at least this many bytes,
+	// e.g. large task statuses. Disabled if zero.
+	CompressionThreshold int
+	// Encoding controls the JSON encoding of the request payloads
+	Encoding Encoding
+	// DedupResponseData collapses repeated lines and blocks of lines, e.g.
+	// stack traces, in the strings of task response data before it is sent
+	DedupResponseData bool
+
+	// Events optionally publishes endpoint failovers
+	Events *events.Bus
+
+	// RetryBudget optionally bounds the share of retried requests, failing fast
+	// with a RetryBudgetExhaustedError once it is exhausted
+	RetryBudget *RetryBudget
+
+	// Traces optionally keeps the traces of the recent requests
+	Traces *TraceBuffer
+
+	// AcquireHedgeDelay enables hedged acquire requests: a second request is sent if
+	// the first one did not complete within the delay. Disabled if zero.
+	AcquireHedgeDelay time.Duration
+
+	// Codecs are offered to the manager in order of preference, in addition to JSON.
+	// Requests are encoded with the codec the manager responded with, JSON until then.
+	Codecs     []Codec
+	negotiated atomic.Value
+
+	// ConnectionRecycleInterval is the interval at which the idle pooled
+	// connections are closed, so that changes of the manager IPs are picked
+	// up. Connections in use at that time are kept until a later interval.
+	// Connections are also recycled after network errors and on failover.
+	ConnectionRecycleInterval time.Duration
+
+	// Decoding controls the handling of unknown fields in the manager
+	// responses and of tasks of newer schema versions, defaults to DecodeLenient
+	Decoding DecodeMode
+
+	// DataClient optionally sends the bulk data traffic, i.e. task acquisitions
+	// and statuses, so that large uploads do not starve the heartbeats and polls
+	// sent with Client. Client sends all the traffic if it is nil.
+	DataClient *http.Client
+
+	// FollowRedirects follows 307 and 308 redirects of the manager, e.g. by a
+	// gateway to a regional endpoint, to the manager host and RedirectHosts.
+	// The requests are authorized again for the new location.
+	FollowRedirects bool
+	// RedirectHosts are the other hosts redirects are followed to, host
+	// names may start with a *. wildcard
+	RedirectHosts []string
+
+	// CompensateClockSkew issues the tokens at the time of the manager clock,
+	// as seen in the Date header of its responses, so that they are not
+	// rejected if the local clock is skewed. The skew is logged either way.
+	CompensateClockSkew bool
+	clockSkew           int64
+
+	// AutoFingerprint adds the fingerprint of the host to the registration,
+	// see WithAutoFingerprint
+	AutoFingerprint bool
+	fingerprint     struct {
+		once sync.Once
+		host *client.HostInfo
+	}
+
+	failover failover
+	recycled int64 // unix time in nanoseconds at which the connections were last recycled
+
+	// events caches the last task events response per request for conditional requests
+	events eventsCache
+
+	// batchUnsupported is set once the server responds that it
+	// does not support batch acquisition.
+	batchUnsupported int32
+	// statusBatchUnsupported is set once the server responds that it
+	// does not support batched status updates.
+	statusBatchUnsupported int32
+	// compressionUnsupported is set once the server rejected a compressed request
+	compressionUnsupported int32
+	// ackUnsupported is set once the server responds that it does not
+	// support event acknowledgments.
+	ackUnsupported int32
 }
 
 // Register registers the runner with the manager
 func (p *HTTPClient) Register(ctx context.Context, r *client.RegisterRequest) (*client.RegisterResponse, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
 	req := r
+	if p.AutoFingerprint && r.Host == nil {
+		withHost := *r
+		withHost.Host = p.hostInfo(ctx)
+		req = &withHost
+	}
 	resp := &client.RegisterResponse{}
-	path := fmt.Sprintf(registerEndpoint, p.AccountID)
-	_, err := p.retry(ctx, path, "POST", req, resp, createBackoff(ctx, registerTimeout))
+	path := p.path(OpRegister, p.AccountID)
+	_, err := p.retry(ctx, path, "POST", req, resp, createBackoff(ctx, p.timeouts().Register))
 	return resp, err
 }
 
 // Heartbeat sends a periodic heartbeat to the server
 func (p *HTTPClient) Heartbeat(ctx context.Context, r *client.RegisterRequest) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
 	req := r
-	path := fmt.Sprintf(heartbeatEndpoint, p.AccountID)
+	path := p.path(OpHeartbeat, p.AccountID)
+	ctx, cancel := context.WithTimeout(ctx, p.timeouts().Heartbeat)
+	defer cancel()
 	_, err := p.do(ctx, path, "POST", req, nil)
 	return err
 }
 
 // GetTaskEvents gets a list of events which can be executed on this runner
 func (p *HTTPClient) GetTaskEvents(ctx context.Context, id string) (*client.TaskEventsResponse, error) {
-	path := fmt.Sprintf(taskPollEndpoint, id, p.AccountID)
-	events := &client.TaskEventsResponse{}
-	_, err := p.do(ctx, path, "GET", nil, events)
+	return p.GetTaskEventsPage(ctx, id, "", 0)
+}
+
+// GetTaskEventsPage gets a page of events which can be executed on this runner
+func (p *HTTPClient) GetTaskEventsPage(ctx context.Context, id, pageToken string, limit int) (*client.TaskEventsResponse, error) {
+	path := p.path(OpTaskEvents, id, p.AccountID)
+	if limit > 0 {
+		path += fmt.Sprintf("&limit=%d", limit)
+	}
+	if pageToken != "" {
+		path += "&pageToken=" + url.QueryEscape(pageToken)
+	}
+	if p.LongPollTimeout <= 0 {
+		ctx, cancel := context.WithTimeout(ctx, p.timeouts().Poll)
+		defer cancel()
+		return p.getTaskEvents(ctx, path)
+	}
+	path += fmt.Sprintf("&longPoll=true&timeoutSeconds=%d", int(p.LongPollTimeout.Seconds()))
+	pollCtx, cancel := context.WithTimeout(ctx, p.LongPollTimeout+longPollGrace)
+	defer cancel()
+	events, err := p.getTaskEvents(pollCtx, path)
+	// a long-poll which times out on the client side without
+	// the parent context being done simply means no events.
+	if err != nil && ctx.Err() == nil && errors.Is(pollCtx.Err(), context.DeadlineExceeded) {
+		return events, nil
+	}
 	return events, err
 }
 
 // Acquire tries to acquire a specific task
 func (p *HTTPClient) Acquire(ctx context.Context, delegateID, taskID string) (*client.Task, error) {
-	path := fmt.Sprintf(taskAcquireEndpoint, delegateID, taskID, p.AccountID, delegateID)
-	task := &client.Task{}
-	_, err := p.do(ctx, path, "PUT", nil, task)
+	path := p.path(OpAcquire, delegateID, taskID, p.AccountID, delegateID)
+	parent := ctx
+	ctx, cancel := context.WithTimeout(withDataPlane(ctx), p.timeouts().Acquire)
+	defer cancel()
+	var (
+		task *client.Task
+		err  error
+	)
+	// retries carry the same idempotency key, so that the manager does not
+	// assign the task again if an earlier attempt succeeded. The nonce keeps
+	// a later acquisition of the task, e.g. once it was rejected and assigned
+	// to the runner again, from replaying the response of this one.
+	key := idempotencyKey(OpAcquire, delegateID, taskID, newRequestID())
+	var res *http.Response
+	if p.AcquireHedgeDelay > 0 {
+		task, res, err = p.hedgedAcquire(ctx, path, key, p.AcquireHedgeDelay)
+	} else {
+		out := p.acquireOut()
+		res, err = p.retryHeader(ctx, path, "PUT", idempotent(key), nil, out, createBackoff(ctx, p.timeouts().Acquire))
+		task = out.task
+	}
+	if err == nil {
+		if serr := p.checkSchema(task); serr != nil {
+			// the rejection does not count against the acquire timeout
+			p.rejectSchema(parent, delegateID, serr)
+			err = serr
+		}
+	}
+	if err == nil && replayed(res) {
+		task.Replayed = true
+		p.observeReplay(OpAcquire, taskID)
+	}
 	return task, err
 }
 
+// acquireOut returns the receiver of an acquired task
+func (p *HTTPClient) acquireOut() *taskStream {
+	if p.PayloadStreamThreshold > 0 {
+		return p.newTaskStream()
+	}
+	return &taskStream{task: &client.Task{}}
+}
+
+// AcquireBatch tries to acquire multiple tasks in a single request. If the server does
+// not support batch acquisition, the tasks are acquired one at a time.
+func (p *HTTPClient) AcquireBatch(ctx context.Context, delegateID string, taskIDs []string) ([]*client.Task, error) {
+	if atomic.LoadInt32(&p.batchUnsupported) == 0 {
+		path := p.path(OpAcquireBatch, delegateID, p.AccountID, delegateID)
+		req := &client.AcquireBatchRequest{TaskIDs: taskIDs}
+		resp := &client.AcquireBatchResponse{}
+		actx, cancel := context.WithTimeout(withDataPlane(ctx), p.timeouts().Acquire)
+		res, err := p.do(actx, path, "PUT", req, resp)
+		cancel()
+		if res == nil || (res.StatusCode != http.StatusNotFound && res.StatusCode != http.StatusMethodNotAllowed) {
+			return p.supportedTasks(ctx, delegateID, resp.Tasks), err
+		}
+		p.logger().Infof("batch acquire is not supported by the server, acquiring tasks one at a time")
+		atomic.StoreInt32(&p.batchUnsupported, 1)
+	}
+	var (
+		tasks   []*client.Task
+		lastErr error
+	)
+	for _, id := range taskIDs {
+		task, err := p.Acquire(ctx, delegateID, id)
+		if err != nil {
+			p.logger().Errorf("could not acquire task %s: %s", id, err)
+			lastErr = err
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	if len(tasks) == 0 {
+		return nil, lastErr
+	}
+	return tasks, nil
+}
+
+// Reject releases a task so that it can be assigned to another runner
+func (p *HTTPClient) Reject(ctx context.Context, delegateID, taskID string, r *client.RejectRequest) error {
+	path := p.path(OpReject, taskID, delegateID, p.AccountID)
+	_, err := p.retry(ctx, path, "POST", r, nil, createBackoff(ctx, p.timeouts().Status))
+	return err
+}
+
+// CheckUpgrade checks whether the runner needs to be upgraded
+func (p *HTTPClient) CheckUpgrade(ctx context.Context, delegateID, version string) (*client.UpgradeResponse, error) {
+	path := p.path(OpUpgrade, delegateID, p.AccountID, url.QueryEscape(version))
+	resp := &client.UpgradeResponse{}
+	_, err := p.do(ctx, path, "GET", nil, resp)
+	return resp, err
+}
+
+// RenewLease renews the lease of the runner on a task which is being executed
+func (p *HTTPClient) RenewLease(ctx context.Context, delegateID, taskID string) error {
+	path := p.path(OpRenewLease, taskID, delegateID, p.AccountID)
+	_, err := p.do(ctx, path, "PUT", nil, nil)
+	return err
+}
+
 // SendStatus updates the status of a task
 func (p *HTTPClient) SendStatus(ctx context.Context, delegateID, taskID string, r *client.TaskResponse) error {
-	path := fmt.Sprintf(taskStatusEndpoint, taskID, delegateID, p.AccountID)
-	req := r
-	_, err := p.retry(ctx, path, "POST", req, nil, createBackoff(ctx, taskEventsTimeout))
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	path := p.path(OpStatus, taskID, delegateID, p.AccountID)
+	req := p.compact(r)
+	ctx = withDataPlane(ctx)
+	key := statusKey(delegateID, taskID, req)
+	res, err := p.retryHeader(ctx, path, "POST", idempotent(key), req, nil, createBackoff(ctx, p.timeouts().Status))
+	if err == nil && replayed(res) {
+		p.observeReplay(OpStatus, taskID)
+	}
+	return err
+}
+
+// Do sends a request to a manager endpoint which is not covered by the client, e.g. a
+// newer or an account specific endpoint. The path is relative to the manager endpoint
+// and the accountId query parameter is added if missing. The request is authorized,
+// signed and retried on server errors like the requests of the client. The input is
+// encoded as json and the response is decoded into out, which can be nil.
+func (p *HTTPClient) Do(ctx context.Context, method, path string, in, out interface{}) (*http.Response, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	if q := u.Query(); q.Get("accountId") == "" {
+		q.Set("accountId", p.AccountID)
+		u.RawQuery = q.Encode()
+	}
+	return p.retry(ctx, u.String(), method, in, out, createBackoff(ctx, p.timeouts().Status))
+}
+
+// SendStatusBatch updates the status of multiple tasks in a single request. If the server
+// does not support batched status updates, the statuses are sent one at a time.
+func (p *HTTPClient) SendStatusBatch(ctx context.Context, delegateID string, responses []*client.TaskResponse) error {
+	for _, r := range responses {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	if atomic.LoadInt32(&p.statusBatchUnsupported) == 0 {
+		path := p.path(OpStatusBatch, delegateID, p.AccountID)
+		compacted := make([]*client.TaskResponse, len(responses))
+		for i, r := range responses {
+			compacted[i] = p.compact(r)
+		}
+		req := &client.StatusBatchRequest{Responses: compacted}
+		ctx := withDataPlane(ctx)
+		key := statusKey(delegateID, "", req)
+		res, err := p.retryHeader(ctx, path, "POST", idempotent(key), req, nil, createBackoff(ctx, p.timeouts().Status))
+		if err == nil && replayed(res) {
+			for _, r := range responses {
+				p.observeReplay(OpStatusBatch, r.ID)
+			}
+		}
+		if res == nil || (res.StatusCode != http.StatusNotFound && res.StatusCode != http.StatusMethodNotAllowed) {
+			return err
+		}
+		p.logger().Infof("batched status updates are not supported by the server, sending statuses one at a time")
+		atomic.StoreInt32(&p.statusBatchUnsupported, 1)
+	}
+	var lastErr error
+	for _, r := range responses {
+		if err := p.SendStatus(ctx, delegateID, r.ID, r); err != nil {
+			p.logger().Errorf("could not send status of task %s: %s", r.ID, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// AckEvents acknowledges the handled and ignored task events in a single request.
+// The acknowledgments are dropped if the server does not support them, as the
+// server delivers the events again until they expire.
+func (p *HTTPClient) AckEvents(ctx context.Context, delegateID string, acks []client.EventAck) error {
+	if len(acks) == 0 || atomic.LoadInt32(&p.ackUnsupported) == 1 {
+		return nil
+	}
+	path := p.path(OpAckEvents, delegateID, p.AccountID)
+	res, err := p.do(ctx, path, "POST", &client.AckEventsRequest{Acks: acks}, nil)
+	if res != nil && (res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusMethodNotAllowed) {
+		p.logger().Infof("task event acknowledgments are not supported by the server, no longer sending them")
+		atomic.StoreInt32(&p.ackUnsupported, 1)
+		return nil
+	}
 	return err
 }
 
 func (p *HTTPClient) retry(ctx context.Context, path, method string, in, out interface{}, b backoff.BackOffContext) (*http.Response, error) {
-	for {
-		res, err := p.do(ctx, path, method, in, out)
+	return p.retryHeader(ctx, path, method, nil, in, out, b)
+}
+
+// retryHeader is like retry but adds the header to every attempt
+func (p *HTTPClient) retryHeader(ctx context.Context, path, method string, header http.Header, in, out interface{}, b backoff.BackOffContext) (*http.Response, error) {
+	var last RetryEvent
+	for attempt := 1; ; attempt++ {
+		res, err := p.doHeader(ctx, path, method, header, in, out)
 		// do not retry on Canceled or DeadlineExceeded
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			p.logger().Errorf("http: context canceled")
+			if attempt > 1 {
+				last.Attempt, last.Wait, last.Outcome = attempt, 0, RetryCanceled
+				p.observeRetry(last)
+			}
 			return res, ctxErr
 		}
 
-		duration := b.NextBackOff()
-
-		if res != nil {
-			// Check the response code. We retry on 500-range
-			// responses to allow the server time to recover, as
-			// 500's are typically not permanent errors and may
-			// relate to outages on the server side.
-			if res.StatusCode > 501 {
-				p.logger().Errorf("http: server error: re-connect and re-try: %s", err)
-				if duration == backoff.Stop {
-					return nil, err
-				}
-				time.Sleep(duration)
-				continue
+		// permanent failures are returned immediately, transient ones
+		// are retried until the backoff gives up.
+		if !retryable(res, err) {
+			if res == nil && err != nil {
+				p.logger().Errorf("http: permanent request error, not retrying: %s", err)
 			}
-		} else if err != nil {
-			p.logger().Errorf("http: request error: %s", err)
-			if duration == backoff.Stop {
-				return nil, err
+			if attempt > 1 {
+				last.Attempt, last.Wait, last.Outcome = attempt, 0, RetryRecovered
+				if err != nil {
+					last.Cause, last.Err, last.Outcome = retryCause(res, err), err, RetryFailed
+				}
+				p.observeRetry(last)
 			}
-			time.Sleep(duration)
-			continue
+			return res, err
 		}
-		return res, err
+		// retry on server errors to allow the server time to recover,
+		// as they typically relate to outages on the server side.
+		duration := b.NextBackOff()
+		last = RetryEvent{
+			Endpoint: p.routes().Op(path),
+			Method:   method,
+			Attempt:  attempt,
+			Wait:     duration,
+			Cause:    retryCause(res, err),
+			Err:      err,
+			Outcome:  RetryScheduled,
+		}
+		if duration == backoff.Stop {
+			last.Wait, last.Outcome = 0, RetryExhausted
+			p.observeRetry(last)
+			return nil, err
+		}
+		if !p.RetryBudget.withdraw() {
+			last.Wait, last.Outcome = 0, RetryBudgetExhausted
+			p.observeRetry(last)
+			return nil, &RetryBudgetExhaustedError{Err: err}
+		}
+		p.observeRetry(last)
+		// the wait is interrupted when the context is done, so that
+		// shutdown is not delayed by the backoff
+		if err := wait(ctx, duration); err != nil {
+			p.logger().Errorf("http: context canceled while waiting to retry")
+			last.Attempt, last.Wait, last.Outcome = attempt+1, 0, RetryCanceled
+			p.observeRetry(last)
+			return nil, err
+		}
+	}
+}
+
+// wait blocks for the duration or until the context is done
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
 	}
 }
 
 // do is a helper function that posts a signed http request with
 // the input encoded and response decoded from json.
 func (p *HTTPClient) do(ctx context.Context, path, method string, in, out interface{}) (*http.Response, error) {
+	return p.doHeader(ctx, path, method, nil, in, out)
+}
+
+// doHeader is like do but adds the header to the request.
+func (p *HTTPClient) doHeader(ctx context.Context, path, method string, header http.Header, in, out interface{}) (*http.Response, error) {
+	id := newRequestID()
+	start := time.Now()
+	p.RetryBudget.request()
+	res, err := p.send(ctx, id, path, method, header, in, out)
+	if p.compressionRejected(res) {
+		res, err = p.send(ctx, id, path, method, header, in, out)
+	}
+	// the token may have expired in flight or been revoked, retry once with a new one
+	if res != nil && res.StatusCode == http.StatusUnauthorized && ctx.Err() == nil {
+		if u, perr := url.Parse(path); perr == nil {
+			p.logger().Infof("request %s was not authorized, retrying with a new token", id)
+			p.AccountTokenCache.Evict(p.tokenAccount(u))
+			if !exchanging(ctx) {
+				p.Gateway.invalidate(p.tokenAccount(u))
+			}
+			p.RetryBudget.request()
+			res, err = p.send(ctx, id, path, method, header, in, out)
+		}
+	}
+	p.trace(id, path, method, start, res, err)
+	if err != nil {
+		return res, &RequestError{RequestID: id, Err: err}
+	}
+	return res, nil
+}
+
+// send sends the request with the request ID and decodes the response.
+func (p *HTTPClient) send(ctx context.Context, id, path, method string, header http.Header, in, out interface{}) (*http.Response, error) {
 	var buf bytes.Buffer
 
-	// marshal the input payload into json format and copy
-	// to an io.ReadCloser.
+	// marshal the input payload with the negotiated codec
+	// and copy to an io.ReadCloser.
+	codec := p.requestCodec()
 	if in != nil {
-		if err := json.NewEncoder(&buf).Encode(in); err != nil {
-			p.logger().Errorf("could not encode input payload: %s", err)
+		b, err := p.marshal(codec, in)
+		var tooLarge *RequestTooLargeError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			p.logger().Errorf("could not encode input payload of request %s: %s", id, err)
 		}
+		buf.Write(b)
 	}
+	compressed := p.compress(&buf)
 
-	endpoint := p.Endpoint + path
+	p.maybeRecycle()
+	base, probe := p.endpoint()
+	if probe {
+		defer p.endProbe()
+	}
+	endpoint := base + path
 	req, err := http.NewRequest(method, endpoint, &buf)
 	if err != nil {
 		return nil, err
@@ -175,20 +593,49 @@ func (p *HTTPClient) do(ctx context.Context, path, method string, in, out interf
 
 	// the request should include the secret shared between
 	// the agent and server for authorization.
-	token, err := p.AccountTokenCache.Get()
-	if err != nil {
-		p.logger().Errorf("could not generate account token: %s", err)
+	if err := p.Authorize(req); err != nil {
 		return nil, err
 	}
-	req.Header.Add("Authorization", "Delegate "+token)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := p.Client.Do(req)
+	req.Header.Add("Content-Type", codec.ContentType())
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if len(p.Codecs) > 0 {
+		req.Header.Set("Accept", p.accept())
+	}
+	req.Header.Set(RequestIDHeader, id)
+	if cid := client.CorrelationID(ctx); cid != "" {
+		req.Header.Set(CorrelationIDHeader, cid)
+	}
+	p.addHeaders(req)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if p.Signer != nil {
+		if err := p.Signer.Sign(req, buf.Bytes()); err != nil {
+			p.logger().Errorf("could not sign request %s: %s", id, err)
+			return nil, err
+		}
+	}
+	res, err := p.httpClient(ctx).Do(req)
+	if err == nil {
+		res, err = p.followRedirects(ctx, id, req, res)
+	}
+	p.observeClock(res)
+	// only report failures of the endpoint itself, not of the caller giving up.
+	if ctx.Err() == nil {
+		p.report(base, err == nil && res.StatusCode < 500)
+		// pooled connections may point to hosts which are gone
+		if err != nil {
+			p.RecycleConnections()
+		}
+	}
 	if res != nil {
 		defer func() {
 			// drain the response body so we can reuse
 			// this connection.
-			if _, err = io.Copy(io.Discard, io.LimitReader(res.Body, 4096)); err != nil {
-				p.logger().Errorf("could not drain response body: %s", err)
+			if _, err = io.Copy(io.Discard, io.LimitReader(res.Body, p.drainLimit())); err != nil {
+				p.logger().Errorf("could not drain response body of request %s: %s", id, err)
 			}
 			res.Body.Close()
 		}()
@@ -197,25 +644,26 @@ func (p *HTTPClient) do(ctx context.Context, path, method string, in, out interf
 		return res, err
 	}
 
-	// if the response body return no content we exit
-	// immediately. We do not read or unmarshal the response
-	// and we do not return an error.
-	if res.StatusCode == 204 {
+	// if the response body return no content or the resource was
+	// not modified we exit immediately. We do not read or unmarshal
+	// the response and we do not return an error.
+	if res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified {
 		return res, nil
 	}
 
-	// else read the response body into a byte slice.
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return res, err
-	}
-
+	body := limitReader(res.Body, p.maxResponseSize())
 	if res.StatusCode > 299 {
+		// read the error message into a byte slice.
+		msg, err := io.ReadAll(body)
+		if err != nil {
+			return res, err
+		}
+
 		// if the response body includes an error message
 		// we should return the error string.
-		if len(body) != 0 {
+		if len(msg) != 0 {
 			return res, errors.New(
-				string(body),
+				string(msg),
 			)
 		}
 		// if the response body is empty we should return
@@ -227,7 +675,59 @@ func (p *HTTPClient) do(ctx context.Context, path, method string, in, out interf
 	if out == nil {
 		return res, nil
 	}
-	return res, json.Unmarshal(body, out)
+	if s, ok := out.(*taskStream); ok {
+		if s.threshold > 0 {
+			return res, s.read(p, res)
+		}
+		out = s.task
+	}
+	// else decode the response body as it is streamed.
+	return res, p.decode(res, body, out)
+}
+
+// Authorize adds the delegate token to a request. It can be used to authorize
+// requests to the manager which are not sent through the client, e.g. uploads.
+// The token stays valid until the deadline of the request context.
+func (p *HTTPClient) Authorize(req *http.Request) error {
+	account := p.tokenAccount(req.URL)
+	var me *MintError
+	if p.Gateway != nil && !exchanging(req.Context()) {
+		token, err := p.Gateway.token(req.Context(), p, account)
+		if err != nil {
+			if !errors.As(err, &me) {
+				p.logger().Errorf("could not get a gateway session token: %s", err)
+			}
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	token, err := p.AccountTokenCache.GetValidFor(account, p.tokenValidity(req.Context(), account))
+	if err != nil {
+		// the cache reports once that the tokens can not be minted
+		if !errors.As(err, &me) {
+			p.logger().Errorf("could not generate account token: %s", err)
+		}
+		return err
+	}
+	req.Header.Set("Authorization", "Delegate "+token)
+	return nil
+}
+
+// addHeaders adds the User-Agent, build metadata and static and dynamic custom
+// headers to the request.
+func (p *HTTPClient) addHeaders(req *http.Request) {
+	ua := p.UserAgent
+	if ua == "" {
+		ua = version.UserAgent()
+	}
+	req.Header.Set("User-Agent", ua)
+	req.Header.Set(VersionHeader, version.Version)
+	req.Header.Set(CommitHeader, version.Commit)
+	for k, v := range p.Headers {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	p.addDynamicHeaders(req)
 }
 
 // logger is a helper function that returns the default logger
@@ -239,6 +739,30 @@ func (p *HTTPClient) logger() logger.Logger {
 	return p.Logger
 }
 
+// logSampled logs the error unless the sampler suppresses it
+func (p *HTTPClient) logSampled(class, format string, args ...interface{}) {
+	p.LogSampler.Do(class, func(suppressed int) {
+		if suppressed > 0 {
+			format += fmt.Sprintf(" (%d similar messages suppressed)", suppressed)
+		}
+		p.logger().Errorf(format, args...)
+	})
+}
+
+func (p *HTTPClient) maxResponseSize() int64 {
+	if p.MaxResponseSize <= 0 {
+		return defaultMaxResponseSize
+	}
+	return p.MaxResponseSize
+}
+
+func (p *HTTPClient) drainLimit() int64 {
+	if p.DrainLimit <= 0 {
+		return defaultDrainLimit
+	}
+	return p.DrainLimit
+}
+
 func createBackoff(ctx context.Context, maxElapsedTime time.Duration) backoff.BackOffContext {
 	exp := backoff.NewExponentialBackOff()
 	exp.MaxElapsedTime = maxElapsedTime
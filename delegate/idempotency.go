@@ -0,0 +1,54 @@
+package delegate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/wings-software/dlite/events"
+	"github.com/wings-software/dlite/metrics"
+)
+
+// Idempotency headers of the acquire and status requests. The manager
+// recognizes a retried request by its key and replays the response of the
+// first attempt, flagging it with the replayed header.
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	ReplayedHeader       = "Idempotent-Replayed"
+)
+
+// idempotencyKey returns a key derived from the parts, so that the retries of
+// a request and its redelivery after a restart carry the same key
+func idempotencyKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// statusKey returns the idempotency key of a status update
+func statusKey(delegateID, taskID string, r interface{}) string {
+	b, _ := json.Marshal(r)
+	sum := sha256.Sum256(b)
+	return idempotencyKey(OpStatus, delegateID, taskID, hex.EncodeToString(sum[:]))
+}
+
+// idempotent returns the header carrying the idempotency key
+func idempotent(key string) http.Header {
+	return http.Header{IdempotencyKeyHeader: []string{key}}
+}
+
+// replayed returns true if the manager recognized the request as a duplicate
+func replayed(res *http.Response) bool {
+	return res != nil && strings.EqualFold(res.Header.Get(ReplayedHeader), "true")
+}
+
+// observeReplay reports a request which the manager recognized as a duplicate
+func (p *HTTPClient) observeReplay(op, taskID string) {
+	p.logger().Infof("http: %s request of task %s was a duplicate, the manager replayed the first response", op, taskID)
+	if m := p.Metrics; m != nil {
+		m.Counter("dlite_client_replayed_requests_total", "Number of requests the manager recognized as duplicates by their idempotency key",
+			metrics.Labels{"endpoint": op}).Inc()
+	}
+	p.Events.Publish(events.Event{Type: events.RequestReplayed, TaskID: taskID, Status: op})
+}
@@ -0,0 +1,55 @@
+package delegate
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// defaultMaxResponseSize is the default maximum size of a response body
+	defaultMaxResponseSize = 10 << 20
+	// defaultDrainLimit is the default number of bytes read from an unread
+	// response body so the connection can be reused.
+	defaultDrainLimit = 4096
+)
+
+// ResponseTooLargeError is returned when a response body exceeds
+// the maximum response size configured on the client.
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds the limit of %d bytes", e.Limit)
+}
+
+// limitReader returns a reader which fails with a ResponseTooLargeError
+// once more than limit bytes are read from r.
+func limitReader(r io.Reader, limit int64) io.Reader {
+	return &limitedReader{r: r, n: limit, limit: limit}
+}
+
+type limitedReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// probe the underlying reader to find out whether
+		// there is more data than allowed.
+		var b [1]byte
+		n, err := l.r.Read(b[:])
+		if n > 0 {
+			return 0, &ResponseTooLargeError{Limit: l.limit}
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
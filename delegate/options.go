@@ -0,0 +1,272 @@
+package delegate
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/events"
+	"github.com/wings-software/dlite/logger"
+)
+
+// Option configures an HTTPClient
+type Option func(*HTTPClient)
+
+// NewWithOptions returns a new client for the manager endpoint configured by the options.
+func NewWithOptions(endpoint, id, secret string, opts ...Option) *HTTPClient {
+	c := &HTTPClient{
+		Logger:            logrus.New(),
+		Endpoint:          endpoint,
+		AccountID:         id,
+		Client:            defaultClient,
+		AccountTokenCache: NewTokenCache(id, secret),
+		Routes:            NewRoutes(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithLogger sets the logger
+func WithLogger(l logger.Logger) Option {
+	return func(c *HTTPClient) {
+		c.Logger = l
+	}
+}
+
+// WithHTTPClient sets the http.Client used to send the requests
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *HTTPClient) {
+		c.Client = hc
+	}
+}
+
+// WithDataClient sets the http.Client used to send the bulk data traffic,
+// separately from the heartbeats and polls
+func WithDataClient(hc *http.Client) Option {
+	return func(c *HTTPClient) {
+		c.DataClient = hc
+	}
+}
+
+// WithRedirects follows the 307 and 308 redirects of the manager to the
+// manager host and the other hosts
+func WithRedirects(hosts ...string) Option {
+	return func(c *HTTPClient) {
+		c.FollowRedirects = true
+		c.RedirectHosts = hosts
+	}
+}
+
+// WithClockSkewCompensation issues the tokens at the time of the manager clock.
+// The issue time is backdated by the leeway.
+func WithClockSkewCompensation(leeway time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.CompensateClockSkew = true
+		c.AccountTokenCache.Leeway = leeway
+	}
+}
+
+// WithStrictDecoding fails on unknown fields in the manager responses and
+// rejects the tasks of newer schema versions
+func WithStrictDecoding() Option {
+	return func(c *HTTPClient) {
+		c.Decoding = DecodeStrict
+	}
+}
+
+// WithEncoding sets the options of the JSON encoding of the request payloads
+func WithEncoding(e Encoding) Option {
+	return func(c *HTTPClient) {
+		c.Encoding = e
+	}
+}
+
+// WithSkipVerify disables the verification of the manager certificate
+func WithSkipVerify(skip bool) Option {
+	return func(c *HTTPClient) {
+		c.SkipVerify = skip
+		if skip {
+			c.Client = NewTLSClient(&TLSOptions{SkipVerify: skip})
+		}
+	}
+}
+
+// WithTLS sets an http.Client using the TLS and proxy options
+func WithTLS(o *TLSOptions) Option {
+	return func(c *HTTPClient) {
+		c.SkipVerify = o.SkipVerify
+		c.Client = NewTLSClient(o)
+	}
+}
+
+// WithSOCKS5 routes all the manager traffic through a SOCKS5 proxy. The
+// proxy dialer is set on the transports of the clients set before, which
+// keep their TLS and pool settings.
+func WithSOCKS5(addr string, auth *SOCKS5Auth) Option {
+	return func(c *HTTPClient) {
+		d := NewSOCKS5Dialer(addr, auth)
+		c.Client = d.client(c.Client, c.SkipVerify)
+		if c.DataClient != nil {
+			c.DataClient = d.client(c.DataClient, c.SkipVerify)
+		}
+	}
+}
+
+// WithTokenTTL sets the lifetime of the account tokens
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.AccountTokenCache = NewTokenCacheFromSource(c.AccountTokenCache.id, c.AccountTokenCache.source, ttl)
+	}
+}
+
+// WithSecretSource reads the account secret from the source whenever a token is created
+func WithSecretSource(src SecretSource) Option {
+	return func(c *HTTPClient) {
+		c.AccountTokenCache = NewTokenCacheFromSource(c.AccountTokenCache.id, src, c.AccountTokenCache.expiry)
+	}
+}
+
+// WithEndpoints sets the endpoints to fail over between, the first one is the primary one
+func WithEndpoints(endpoints ...string) Option {
+	return func(c *HTTPClient) {
+		c.Endpoints = endpoints
+		if len(endpoints) > 0 {
+			c.Endpoint = endpoints[0]
+		}
+	}
+}
+
+// WithLongPoll enables long-polling for task events
+func WithLongPoll(timeout time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.LongPollTimeout = timeout
+	}
+}
+
+// WithTimeouts sets the request timeouts
+func WithTimeouts(t Timeouts) Option {
+	return func(c *HTTPClient) {
+		c.Timeouts = t
+	}
+}
+
+// WithUserAgent sets the user agent
+func WithUserAgent(ua string) Option {
+	return func(c *HTTPClient) {
+		c.UserAgent = ua
+	}
+}
+
+// WithHeader adds a header to every request
+func WithHeader(key, value string) Option {
+	return func(c *HTTPClient) {
+		if c.Headers == nil {
+			c.Headers = http.Header{}
+		}
+		c.Headers.Add(key, value)
+	}
+}
+
+// WithHeaderFunc adds headers computed for every request
+func WithHeaderFunc(fn HeaderFunc) Option {
+	return func(c *HTTPClient) {
+		c.HeaderFuncs = append(c.HeaderFuncs, fn)
+	}
+}
+
+// WithSigner signs every request
+func WithSigner(s Signer) Option {
+	return func(c *HTTPClient) {
+		c.Signer = s
+	}
+}
+
+// WithGateway authorizes the requests with the session tokens of a gateway
+// in front of the manager, which are exchanged for the delegate tokens
+func WithGateway(g *Gateway) Option {
+	return func(c *HTTPClient) {
+		c.Gateway = g
+	}
+}
+
+// WithRoutes sets the paths of the API operations
+func WithRoutes(r *Routes) Option {
+	return func(c *HTTPClient) {
+		c.Routes = r
+	}
+}
+
+// WithConnectionRecycleInterval bounds the time pooled connections are reused
+func WithConnectionRecycleInterval(d time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.ConnectionRecycleInterval = d
+	}
+}
+
+// WithMaxResponseSize bounds the size of the response bodies
+func WithMaxResponseSize(n int64) Option {
+	return func(c *HTTPClient) {
+		c.MaxResponseSize = n
+	}
+}
+
+// WithCodecs offers the codecs to the manager in order of preference, in addition to JSON
+func WithCodecs(codecs ...Codec) Option {
+	return func(c *HTTPClient) {
+		c.Codecs = codecs
+	}
+}
+
+// WithAcquireHedging sends a second acquire request if the first one did not complete within delay
+func WithAcquireHedging(delay time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.AcquireHedgeDelay = delay
+	}
+}
+
+// WithPayloadStreaming streams acquired tasks larger than threshold to a temporary file in dir
+func WithPayloadStreaming(threshold int64, dir string) Option {
+	return func(c *HTTPClient) {
+		c.PayloadStreamThreshold = threshold
+		c.PayloadDir = dir
+	}
+}
+
+// WithAutoFingerprint adds the OS, architecture, kernel, container runtime,
+// tool versions and cloud instance of the host to the registration
+func WithAutoFingerprint() Option {
+	return func(c *HTTPClient) {
+		c.AutoFingerprint = true
+	}
+}
+
+// WithRetryBudget bounds the share of retried requests. The budget can be
+// shared with other clients.
+func WithRetryBudget(b *RetryBudget) Option {
+	return func(c *HTTPClient) {
+		c.RetryBudget = b
+	}
+}
+
+// WithEvents publishes the events of the client, e.g. endpoint failovers, to the bus
+func WithEvents(b *events.Bus) Option {
+	return func(c *HTTPClient) {
+		c.Events = b
+	}
+}
+
+// WithCompression gzips request bodies of at least threshold bytes
+func WithCompression(threshold int) Option {
+	return func(c *HTTPClient) {
+		c.CompressionThreshold = threshold
+	}
+}
+
+// WithResponseDedup collapses repeated lines in the task response data
+func WithResponseDedup() Option {
+	return func(c *HTTPClient) {
+		c.DedupResponseData = true
+	}
+}
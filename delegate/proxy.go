@@ -0,0 +1,46 @@
+package delegate
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ProxyOptions configures the HTTP proxy used to reach the manager.
+type ProxyOptions struct {
+	// URL of the proxy, defaults to the HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+	// environment variables.
+	URL *url.URL
+	// Username and Password authenticate with the proxy using basic auth. They
+	// override the credentials of the proxy URL.
+	Username string
+	Password string
+	// ConnectHeader returns additional headers for the CONNECT request sent to
+	// the proxy for a target, e.g. to authenticate with other schemes.
+	ConnectHeader func(ctx context.Context, proxy *url.URL, target string) (http.Header, error)
+}
+
+// proxy returns the proxy for a request
+func (o *ProxyOptions) proxy(r *http.Request) (*url.URL, error) {
+	u := o.URL
+	if u == nil {
+		var err error
+		if u, err = http.ProxyFromEnvironment(r); err != nil || u == nil {
+			return u, err
+		}
+	}
+	if o.Username != "" {
+		c := *u
+		c.User = url.UserPassword(o.Username, o.Password)
+		u = &c
+	}
+	return u, nil
+}
+
+// apply configures the transport to use the proxy
+func (o *ProxyOptions) apply(t *http.Transport) {
+	t.Proxy = o.proxy
+	if o.ConnectHeader != nil {
+		t.GetProxyConnectHeader = o.ConnectHeader
+	}
+}
@@ -0,0 +1,37 @@
+package delegate
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RecycleConnections closes the idle pooled connections, so that the next
+// requests open new connections and re-resolve the manager host name.
+// Connections which are in use are not closed, they return to the pool once
+// their request completed and are closed by a later recycling finding
+// them idle.
+func (p *HTTPClient) RecycleConnections() {
+	atomic.StoreInt64(&p.recycled, time.Now().UnixNano())
+	p.closeIdleConnections()
+}
+
+// maybeRecycle recycles the connections if ConnectionRecycleInterval
+// elapsed since they were last recycled.
+func (p *HTTPClient) maybeRecycle() {
+	if p.ConnectionRecycleInterval <= 0 {
+		return
+	}
+	last := atomic.LoadInt64(&p.recycled)
+	now := time.Now().UnixNano()
+	if last == 0 {
+		atomic.CompareAndSwapInt64(&p.recycled, 0, now)
+		return
+	}
+	if time.Duration(now-last) < p.ConnectionRecycleInterval {
+		return
+	}
+	if atomic.CompareAndSwapInt64(&p.recycled, last, now) {
+		p.logger().Debugf("recycling manager connections")
+		p.closeIdleConnections()
+	}
+}
@@ -0,0 +1,95 @@
+package delegate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxRedirects bounds the number of redirects followed by a request
+const maxRedirects = 5
+
+// followRedirects follows the 307 and 308 redirects of the response to the
+// manager host and the RedirectHosts if FollowRedirects is set. The method
+// and body are preserved and the request is authorized and signed again for
+// the new location. Other redirects are returned to the caller.
+func (p *HTTPClient) followRedirects(ctx context.Context, id string, req *http.Request, res *http.Response) (*http.Response, error) {
+	for hops := 0; p.FollowRedirects; hops++ {
+		if res.StatusCode != http.StatusTemporaryRedirect && res.StatusCode != http.StatusPermanentRedirect {
+			return res, nil
+		}
+		loc, err := res.Location()
+		if err != nil {
+			return res, nil
+		}
+		if hops == maxRedirects {
+			return res, fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if !p.redirectAllowed(req.URL, loc) {
+			p.logger().Warnf("not following redirect of request %s to %s", id, loc.Redacted())
+			return res, nil
+		}
+		p.logger().Debugf("following redirect of request %s to %s", id, loc.Redacted())
+		if req, err = p.redirectRequest(ctx, req, loc); err != nil {
+			return res, err
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, p.drainLimit()))
+		res.Body.Close()
+		if res, err = p.httpClient(ctx).Do(req); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// redirectRequest returns a copy of the request to the location with a new
+// authorization and signature
+func (p *HTTPClient) redirectRequest(ctx context.Context, req *http.Request, loc *url.URL) (*http.Request, error) {
+	next := req.Clone(ctx)
+	next.URL = loc
+	next.Host = ""
+	next.Header.Del("Authorization")
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		if body, err = io.ReadAll(rc); err != nil {
+			return nil, err
+		}
+		next.Body, _ = req.GetBody()
+	}
+	if err := p.Authorize(next); err != nil {
+		return nil, err
+	}
+	if p.Signer != nil {
+		if err := p.Signer.Sign(next, body); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// redirectAllowed reports whether a redirect from the URL to the location may
+// be followed: the location must be the same host or one of RedirectHosts,
+// which may start with a *. wildcard, and https must not be downgraded.
+func (p *HTTPClient) redirectAllowed(from, to *url.URL) bool {
+	if from.Scheme == "https" && to.Scheme != "https" {
+		return false
+	}
+	if strings.EqualFold(from.Host, to.Host) {
+		return true
+	}
+	host := strings.ToLower(to.Hostname())
+	for _, h := range p.RedirectHosts {
+		h = strings.ToLower(h)
+		if h == host || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package delegate
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Tracing headers sent with every request
+const (
+	RequestIDHeader     = "X-Request-Id"
+	CorrelationIDHeader = "X-Correlation-Id"
+)
+
+// RequestError is returned when a request to the manager fails. It carries
+// the ID of the request so that it can be found in the manager logs.
+type RequestError struct {
+	RequestID string
+	Err       error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s (request id: %s)", e.Err, e.RequestID)
+}
+
+// Unwrap returns the underlying error
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// newRequestID returns a unique ID for an outbound request
+func newRequestID() string {
+	return uuid.New().String()
+}
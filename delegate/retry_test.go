@@ -0,0 +1,100 @@
+package delegate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/mockmanager"
+)
+
+const testSecret = "00112233445566778899aabbccddeeff"
+
+// retryOutcomes returns a client of the mock manager and a function
+// returning the outcomes of the retry events of the client
+func retryOutcomes(m *mockmanager.Server) (*HTTPClient, func() []string) {
+	var (
+		mu       sync.Mutex
+		outcomes []string
+	)
+	c := New(m.URL, "account", testSecret, true)
+	c.OnRetry = func(ev RetryEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		outcomes = append(outcomes, ev.Outcome)
+	}
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, outcomes...)
+	}
+}
+
+func TestRetryCanceledWhileWaiting(t *testing.T) {
+	m := mockmanager.New()
+	defer m.Close()
+	m.InjectError(mockmanager.Register, http.StatusServiceUnavailable, 0)
+	c, outcomes := retryOutcomes(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	// the next attempt is not due before the test times out
+	b := backoff.WithContext(backoff.NewConstantBackOff(time.Minute), ctx)
+	start := time.Now()
+	_, err := c.retry(ctx, c.path(OpRegister, "account"), "POST", &client.RegisterRequest{}, nil, b)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the retry to be canceled, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("the retry stopped %s after the request, not when the context was canceled", d)
+	}
+	got := outcomes()
+	if len(got) != 2 || got[0] != RetryScheduled || got[1] != RetryCanceled {
+		t.Errorf("expected a scheduled and a canceled retry, got %v", got)
+	}
+}
+
+func TestRetryDeadlineExceeded(t *testing.T) {
+	m := mockmanager.New()
+	defer m.Close()
+	m.InjectError(mockmanager.Register, http.StatusServiceUnavailable, 0)
+	c, outcomes := retryOutcomes(m)
+	c.Timeouts.Register = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.Register(ctx, &client.RegisterRequest{AccountID: "account"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("the retry stopped %s after the request, not at the deadline", d)
+	}
+	if got := outcomes(); len(got) == 0 || got[len(got)-1] != RetryCanceled {
+		t.Errorf("expected the last retry to be canceled, got %v", got)
+	}
+}
+
+func TestRetryNotAttemptedWhenCanceled(t *testing.T) {
+	m := mockmanager.New()
+	defer m.Close()
+	m.InjectError(mockmanager.Register, http.StatusServiceUnavailable, 0)
+	c, outcomes := retryOutcomes(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b := backoff.WithContext(backoff.NewConstantBackOff(time.Minute), ctx)
+	_, err := c.retry(ctx, c.path(OpRegister, "account"), "POST", &client.RegisterRequest{}, nil, b)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the request to be canceled, got %v", err)
+	}
+	if got := outcomes(); len(got) != 0 {
+		t.Errorf("expected no retries, got %v", got)
+	}
+}
@@ -0,0 +1,93 @@
+package delegate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wings-software/dlite/metrics"
+)
+
+// Outcomes of retried requests
+const (
+	RetryScheduled       = "retrying"         // the request is retried after the wait
+	RetryRecovered       = "recovered"        // a retried request succeeded
+	RetryFailed          = "failed"           // a retried request failed permanently
+	RetryExhausted       = "exhausted"        // the backoff gave up
+	RetryBudgetExhausted = "budget_exhausted" // the retry budget did not allow another attempt
+	RetryCanceled        = "canceled"         // the context of a retried request was done
+)
+
+// RetryEvent describes a failed attempt of a request or the outcome of a
+// retried request
+type RetryEvent struct {
+	Endpoint string        // the operation, e.g. acquire, or other
+	Method   string        // the HTTP method
+	Attempt  int           // the number of the attempt, starting at 1
+	Wait     time.Duration // the time until the next attempt
+	Cause    string        // the cause of the last failure, e.g. status_503 or timeout
+	Err      error         // the error of the last failure
+	Outcome  string
+}
+
+// retryCause classifies the failure of an attempt
+func retryCause(res *http.Response, err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case res != nil:
+		return fmt.Sprintf("status_%d", res.StatusCode)
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection_reset"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "eof"
+	}
+	return "request_error"
+}
+
+// observeRetry reports the retry event to the logger, the metrics and OnRetry
+func (p *HTTPClient) observeRetry(ev RetryEvent) {
+	fields := fmt.Sprintf("endpoint=%s method=%s attempt=%d cause=%s", ev.Endpoint, ev.Method, ev.Attempt, ev.Cause)
+	switch ev.Outcome {
+	case RetryScheduled:
+		class := "request_error"
+		if strings.HasPrefix(ev.Cause, "status_") {
+			class = "server_error"
+		}
+		p.logSampled(class, "http: retrying request in %s: %s: %s", ev.Wait, fields, ev.Err)
+	case RetryRecovered:
+		p.logger().Infof("http: request recovered after %d attempts: %s", ev.Attempt, fields)
+	case RetryBudgetExhausted:
+		p.logSampled("retry_budget", "http: retry budget exhausted, not retrying: %s: %s", fields, ev.Err)
+	default:
+		p.logSampled("retry_"+ev.Outcome, "http: retried request %s: %s: %s", ev.Outcome, fields, ev.Err)
+	}
+	if m := p.Metrics; m != nil {
+		if ev.Outcome == RetryScheduled {
+			m.Counter("dlite_client_retries_total", "Number of retried requests to the manager",
+				metrics.Labels{"endpoint": ev.Endpoint, "cause": ev.Cause}).Inc()
+			m.Counter("dlite_client_retry_wait_seconds_total", "Time spent waiting to retry requests to the manager",
+				metrics.Labels{"endpoint": ev.Endpoint}).Add(ev.Wait.Seconds())
+		} else {
+			m.Counter("dlite_client_retry_outcomes_total", "Number of retried requests to the manager by outcome",
+				metrics.Labels{"endpoint": ev.Endpoint, "outcome": ev.Outcome}).Inc()
+		}
+	}
+	if p.OnRetry != nil {
+		p.OnRetry(ev)
+	}
+}
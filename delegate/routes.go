@@ -0,0 +1,233 @@
+package delegate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Operations of the manager API. The paths of an operation take the same
+// format arguments in every API version.
+const (
+	OpRegister     = "register"      // account ID
+	OpHeartbeat    = "heartbeat"     // account ID
+	OpTaskEvents   = "task-events"   // delegate ID, account ID
+	OpAcquire      = "acquire"       // delegate ID, task ID, account ID, delegate ID
+	OpAcquireBatch = "acquire-batch" // delegate ID, account ID, delegate ID
+	OpStatus       = "status"        // task ID, delegate ID, account ID
+	OpStatusBatch  = "status-batch"  // delegate ID, account ID
+	OpReject       = "reject"        // task ID, delegate ID, account ID
+	OpUpgrade      = "upgrade"       // delegate ID, account ID, version
+	OpRenewLease   = "renew-lease"   // task ID, delegate ID, account ID
+	OpAckEvents    = "ack-events"    // delegate ID, account ID
+)
+
+// apiVersionsEndpoint lists the API versions supported by the manager
+const apiVersionsEndpoint = "/api/agent/delegates/api-versions?accountId=%s"
+
+// Routes maps the operations of the manager API to path templates per API
+// version. Paths are resolved against the highest registered version which
+// is not newer than the selected API version.
+type Routes struct {
+	mu      sync.RWMutex
+	paths   map[string]map[int]string
+	version int
+}
+
+// NewRoutes returns the routes of the API versions known to the client.
+func NewRoutes() *Routes {
+	r := &Routes{paths: map[string]map[int]string{}}
+	r.Register(OpRegister, 1, "/api/agent/delegates/register?accountId=%s")
+	r.Register(OpHeartbeat, 1, "/api/agent/delegates/heartbeat-with-polling?accountId=%s")
+	r.Register(OpTaskEvents, 1, "/api/agent/delegates/%s/task-events?accountId=%s")
+	r.Register(OpUpgrade, 1, "/api/agent/delegates/%s/upgrade?accountId=%s&delegateVersion=%s")
+	r.Register(OpAcquire, 2, "/api/agent/v2/delegates/%s/tasks/%s/acquire?accountId=%s&delegateInstanceId=%s")
+	r.Register(OpAcquireBatch, 2, "/api/agent/v2/delegates/%s/tasks/acquire?accountId=%s&delegateInstanceId=%s")
+	r.Register(OpStatus, 2, "/api/agent/v2/tasks/%s/delegates/%s?accountId=%s")
+	r.Register(OpStatusBatch, 2, "/api/agent/v2/delegates/%s/tasks/status?accountId=%s")
+	r.Register(OpReject, 2, "/api/agent/v2/tasks/%s/delegates/%s/reject?accountId=%s")
+	r.Register(OpRenewLease, 2, "/api/agent/v2/tasks/%s/delegates/%s/lease?accountId=%s")
+	r.Register(OpAckEvents, 2, "/api/agent/v2/delegates/%s/task-events/ack?accountId=%s")
+	return r
+}
+
+// Register adds the path template of an operation for an API version.
+func (r *Routes) Register(op string, version int, template string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paths[op] == nil {
+		r.paths[op] = map[int]string{}
+	}
+	r.paths[op][version] = template
+}
+
+// SetVersion selects the API version, 0 selects the latest registered version.
+// A version which does not have a path for every operation is refused.
+func (r *Routes) SetVersion(version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if version != 0 {
+		if missing := r.missing(version); len(missing) > 0 {
+			return fmt.Errorf("API version %d does not support the operations %s", version, strings.Join(missing, ", "))
+		}
+	}
+	r.version = version
+	return nil
+}
+
+// Supports reports whether the version has a path for every operation
+func (r *Routes) Supports(version int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.missing(version)) == 0
+}
+
+// missing returns the operations without a path in the version, sorted.
+// r.mu must be held.
+func (r *Routes) missing(version int) []string {
+	var ops []string
+	for op, paths := range r.paths {
+		ok := false
+		for v := range paths {
+			ok = ok || v <= version
+		}
+		if !ok {
+			ops = append(ops, op)
+		}
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// Version returns the selected API version, 0 if the latest version is used.
+func (r *Routes) Version() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+// Versions returns the registered API versions in ascending order.
+func (r *Routes) Versions() []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := map[int]bool{}
+	var versions []int
+	for _, paths := range r.paths {
+		for v := range paths {
+			if !seen[v] {
+				seen[v] = true
+				versions = append(versions, v)
+			}
+		}
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Path returns the path of the operation formatted with the arguments. The
+// lowest registered version is used if the operation has no path in the
+// selected version. It panics if no path is registered for the operation.
+func (r *Routes) Path(op string, args ...interface{}) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	best, lowest := 0, 0
+	for v := range r.paths[op] {
+		if v > best && (r.version == 0 || v <= r.version) {
+			best = v
+		}
+		if lowest == 0 || v < lowest {
+			lowest = v
+		}
+	}
+	if best == 0 {
+		best = lowest
+	}
+	if best == 0 {
+		panic(fmt.Sprintf("delegate: no path registered for operation %s", op))
+	}
+	return fmt.Sprintf(r.paths[op][best], args...)
+}
+
+// Op returns the operation whose path template matches the path, other if
+// none does. It is used to label requests without their IDs.
+func (r *Routes) Op(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	segments := strings.Split(path, "/")
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for op, paths := range r.paths {
+		for _, template := range paths {
+			template, _, _ = strings.Cut(template, "?")
+			if matchSegments(strings.Split(template, "/"), segments) {
+				return op
+			}
+		}
+	}
+	return "other"
+}
+
+// matchSegments reports whether the path segments match the template
+// segments, where %s matches any segment
+func matchSegments(template, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+	for i, t := range template {
+		if t != "%s" && t != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// apiVersionsResponse is the response of the API versions endpoint
+type apiVersionsResponse struct {
+	Resource struct {
+		Versions []int `json:"versions"`
+	} `json:"resource"`
+}
+
+// NegotiateAPIVersion selects the highest API version supported by both the
+// manager and the client, in which the client has a path for every
+// operation. If the manager does not list its API versions the selected
+// version is left unchanged. It returns the selected version.
+func (p *HTTPClient) NegotiateAPIVersion(ctx context.Context) (int, error) {
+	routes := p.routes()
+	resp := &apiVersionsResponse{}
+	res, err := p.do(ctx, fmt.Sprintf(apiVersionsEndpoint, p.AccountID), "GET", nil, resp)
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		return routes.Version(), nil
+	}
+	if err != nil {
+		return routes.Version(), err
+	}
+	supported := map[int]bool{}
+	for _, v := range resp.Resource.Versions {
+		supported[v] = true
+	}
+	known := routes.Versions()
+	for i := len(known) - 1; i >= 0; i-- {
+		if supported[known[i]] && routes.SetVersion(known[i]) == nil {
+			p.logger().Infof("using manager API version %d", known[i])
+			return known[i], nil
+		}
+	}
+	return routes.Version(), fmt.Errorf("no common API version, manager supports %v, client supports %v", resp.Resource.Versions, known)
+}
+
+// path returns the path of the operation
+func (p *HTTPClient) path(op string, args ...interface{}) string {
+	return p.routes().Path(op, args...)
+}
+
+func (p *HTTPClient) routes() *Routes {
+	p.routesOnce.Do(func() {
+		if p.Routes == nil {
+			p.Routes = NewRoutes()
+		}
+	})
+	return p.Routes
+}
@@ -0,0 +1,94 @@
+package delegate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// DecodeMode controls how the client handles manager responses which do not
+// match the API types, e.g. because the manager API evolved
+type DecodeMode int
+
+// Decoding modes
+const (
+	// DecodeLenient ignores unknown fields, logging them at debug level, and
+	// warns about tasks of newer schema versions
+	DecodeLenient DecodeMode = iota
+	// DecodeStrict fails on unknown fields and rejects the tasks of newer
+	// schema versions
+	DecodeStrict
+)
+
+// SchemaVersionError is returned in strict mode for tasks of a schema version
+// newer than the client supports
+type SchemaVersionError struct {
+	TaskID  string
+	Version int
+}
+
+func (e *SchemaVersionError) Error() string {
+	return fmt.Sprintf("task %s has schema version %d, the client supports up to %d", e.TaskID, e.Version, client.TaskSchemaVersion)
+}
+
+// decodeJSON decodes the JSON body according to the decode mode
+func (p *HTTPClient) decodeJSON(body io.Reader, out interface{}) error {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(out)
+	if err == nil || !strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return err
+	}
+	if p.Decoding == DecodeStrict {
+		return err
+	}
+	p.logger().Debugf("ignoring %s of a %T manager response", strings.TrimPrefix(err.Error(), "json: "), out)
+	return json.NewDecoder(bytes.NewReader(b)).Decode(out)
+}
+
+// checkSchema checks the schema version of an acquired task. It returns the
+// error of the tasks which are not supported in the decode mode.
+func (p *HTTPClient) checkSchema(t *client.Task) *SchemaVersionError {
+	if t == nil || t.SchemaVersion <= client.TaskSchemaVersion {
+		return nil
+	}
+	err := &SchemaVersionError{TaskID: t.ID, Version: t.SchemaVersion}
+	if p.Decoding == DecodeStrict {
+		return err
+	}
+	p.logger().Warnf("%s, fields it depends on may be ignored", err)
+	return nil
+}
+
+// rejectSchema rejects an acquired task which failed the schema check, so
+// that the manager can assign it to a runner supporting its schema version
+func (p *HTTPClient) rejectSchema(ctx context.Context, delegateID string, err *SchemaVersionError) {
+	r := &client.RejectRequest{Reason: err.Error(), Code: "SCHEMA_MISMATCH"}
+	if rerr := p.Reject(ctx, delegateID, err.TaskID, r); rerr != nil {
+		p.logger().Errorf("could not reject task %s: %s", err.TaskID, rerr)
+	}
+}
+
+// supportedTasks returns the tasks of a batch whose schema version passes the
+// check, the others are rejected
+func (p *HTTPClient) supportedTasks(ctx context.Context, delegateID string, tasks []*client.Task) []*client.Task {
+	supported := tasks[:0]
+	for _, t := range tasks {
+		if err := p.checkSchema(t); err != nil {
+			p.logger().Errorf("rejecting acquired task: %s", err)
+			p.rejectSchema(ctx, delegateID, err)
+			continue
+		}
+		supported = append(supported, t)
+	}
+	return supported
+}
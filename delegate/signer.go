@@ -0,0 +1,69 @@
+package delegate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set by the HMAC signer
+const (
+	SignatureHeader     = "X-Dlite-Signature"
+	SignatureKeyHeader  = "X-Dlite-Signature-Key"
+	TimestampHeader     = "X-Dlite-Timestamp"
+	ContentSHA256Header = "X-Dlite-Content-Sha256"
+)
+
+// A Signer signs outbound requests before they are sent. The body
+// is passed separately since the request body can only be read once.
+type Signer interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// SignerFunc adapts a function to the Signer interface.
+type SignerFunc func(req *http.Request, body []byte) error
+
+// Sign calls f(req, body).
+func (f SignerFunc) Sign(req *http.Request, body []byte) error {
+	return f(req, body)
+}
+
+// HMACSigner signs requests with HMAC-SHA256 over the method, the path
+// including the query, the hex encoded SHA256 of the body and the unix
+// timestamp, separated by newlines.
+type HMACSigner struct {
+	KeyID  string // optional, sent in the X-Dlite-Signature-Key header
+	Secret []byte
+}
+
+// NewHMACSigner returns a new HMAC-SHA256 signer.
+func NewHMACSigner(keyID string, secret []byte) *HMACSigner {
+	return &HMACSigner{KeyID: keyID, Secret: secret}
+}
+
+// Sign adds the timestamp, body hash and signature headers to the request.
+func (s *HMACSigner) Sign(req *http.Request, body []byte) error {
+	sum := sha256.Sum256(body)
+	digest := hex.EncodeToString(sum[:])
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(strings.Join([]string{
+		req.Method,
+		req.URL.RequestURI(),
+		digest,
+		timestamp,
+	}, "\n")))
+
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(ContentSHA256Header, digest)
+	req.Header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	if s.KeyID != "" {
+		req.Header.Set(SignatureKeyHeader, s.KeyID)
+	}
+	return nil
+}
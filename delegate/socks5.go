@@ -0,0 +1,199 @@
+package delegate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SOCKS5Auth holds the credentials for a SOCKS5 proxy
+type SOCKS5Auth struct {
+	Username string
+	Password string
+}
+
+// SOCKS5Dialer dials connections through a SOCKS5 proxy (RFC 1928). Host names
+// are resolved by the proxy.
+type SOCKS5Dialer struct {
+	Addr   string      // address of the proxy
+	Auth   *SOCKS5Auth // optional, username/password authentication (RFC 1929)
+	Dialer net.Dialer  // dials the proxy
+}
+
+// NewSOCKS5Dialer returns a dialer for the proxy at addr
+func NewSOCKS5Dialer(addr string, auth *SOCKS5Auth) *SOCKS5Dialer {
+	return &SOCKS5Dialer{Addr: addr, Auth: auth}
+}
+
+const (
+	socks5Version      = 5
+	socks5NoAuth       = 0
+	socks5UserPassword = 2
+	socks5NoAcceptable = 0xff
+	socks5Connect      = 1
+	socks5IPv4         = 1
+	socks5Domain       = 3
+	socks5IPv6         = 4
+)
+
+// client returns a copy of hc whose transport dials through the proxy. A
+// client whose transport is not an *http.Transport can not be configured,
+// it is replaced by a client with the default TLS options.
+func (d *SOCKS5Dialer) client(hc *http.Client, skipVerify bool) *http.Client {
+	var t *http.Transport
+	switch rt := hc.Transport.(type) {
+	case nil:
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		t = rt.Clone()
+	default:
+		return NewTLSClient(&TLSOptions{SkipVerify: skipVerify, SOCKS5: d})
+	}
+	t.Proxy = nil
+	t.DialContext = d.DialContext
+	out := *hc
+	out.Transport = t
+	return &out
+}
+
+// DialContext connects to the address through the proxy
+func (d *SOCKS5Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("socks5: unsupported network %s", network)
+	}
+	conn, err := d.Dialer.DialContext(ctx, "tcp", d.Addr)
+	if err != nil {
+		return nil, err
+	}
+	// abort the handshake once the context is done
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline) //nolint:errcheck
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+	if err := d.handshake(conn, addr); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{}) //nolint:errcheck
+	return conn, nil
+}
+
+func (d *SOCKS5Dialer) handshake(conn net.Conn, addr string) error {
+	method := byte(socks5NoAuth)
+	if d.Auth != nil {
+		method = socks5UserPassword
+	}
+	if _, err := conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected protocol version %d", reply[0])
+	}
+	if reply[1] == socks5NoAcceptable || reply[1] != method {
+		return errors.New("socks5: no acceptable authentication method")
+	}
+	if method == socks5UserPassword {
+		if err := d.authenticate(conn); err != nil {
+			return err
+		}
+	}
+	return connect(conn, addr)
+}
+
+// authenticate performs the username/password authentication
+func (d *SOCKS5Dialer) authenticate(conn net.Conn) error {
+	u, p := d.Auth.Username, d.Auth.Password
+	if len(u) == 0 || len(u) > 255 || len(p) > 255 {
+		return errors.New("socks5: invalid username or password length")
+	}
+	b := []byte{1, byte(len(u))}
+	b = append(b, u...)
+	b = append(b, byte(len(p)))
+	b = append(b, p...)
+	if _, err := conn.Write(b); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return errors.New("socks5: authentication failed")
+	}
+	return nil
+}
+
+// connect asks the proxy to connect to the address
+func connect(conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("socks5: invalid port %s", portStr)
+	}
+	b := []byte{socks5Version, socks5Connect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("socks5: host name too long")
+		}
+		b = append(b, socks5Domain, byte(len(host)))
+		b = append(b, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		b = append(b, socks5IPv4)
+		b = append(b, ip4...)
+	} else {
+		b = append(b, socks5IPv6)
+		b = append(b, ip...)
+	}
+	b = append(b, byte(port>>8), byte(port))
+	if _, err := conn.Write(b); err != nil {
+		return err
+	}
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("socks5: connect to %s failed with code %d", addr, head[1])
+	}
+	// skip the bound address
+	var n int
+	switch head[3] {
+	case socks5IPv4:
+		n = net.IPv4len
+	case socks5IPv6:
+		n = net.IPv6len
+	case socks5Domain:
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return err
+		}
+		n = int(l[0])
+	default:
+		return fmt.Errorf("socks5: unknown address type %d", head[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, n+2))
+	return err
+}
@@ -0,0 +1,124 @@
+package delegate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// defaultMaxPayloadSize is the default maximum size of a streamed task
+const defaultMaxPayloadSize = 1 << 30
+
+// taskStream receives an acquired task. Tasks larger than the threshold are
+// streamed to a temporary file instead of being decoded into memory.
+type taskStream struct {
+	task      *client.Task
+	threshold int64
+	limit     int64
+	dir       string
+}
+
+// newTaskStream returns the receiver of an acquired task
+func (p *HTTPClient) newTaskStream() *taskStream {
+	limit := p.MaxPayloadSize
+	if limit <= 0 {
+		limit = defaultMaxPayloadSize
+	}
+	return &taskStream{
+		task:      &client.Task{},
+		threshold: p.PayloadStreamThreshold,
+		limit:     limit,
+		dir:       p.PayloadDir,
+	}
+}
+
+// read reads the task from the response body
+func (s *taskStream) read(p *HTTPClient, res *http.Response) error {
+	head, err := io.ReadAll(io.LimitReader(res.Body, s.threshold+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(head)) <= s.threshold || p.responseCodec(res) != nil {
+		body := io.MultiReader(bytes.NewReader(head), res.Body)
+		return p.decode(res, limitReader(body, p.maxResponseSize()), s.task)
+	}
+	f, err := os.CreateTemp(s.dir, "dlite-task-*.json")
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, limitReader(io.MultiReader(bytes.NewReader(head), res.Body), s.limit))
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = decodeTaskHeader(f, s.task)
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	s.task.Payload = &client.Payload{Path: f.Name(), Size: n}
+	p.logger().Debugf("streamed task %s of %d bytes to %s", s.task.ID, n, f.Name())
+	return nil
+}
+
+// decodeTaskHeader decodes the fields of the task except for the data,
+// which is skipped token by token so that it is never held in memory.
+func decodeTaskHeader(r io.Reader, t *client.Task) error {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("expected a task object, got %v", tok)
+	}
+	fields := map[string]json.RawMessage{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		if key == "data" {
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+			continue
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		fields[key] = v
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, t)
+}
+
+// skipValue reads the next value from the decoder without keeping it
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
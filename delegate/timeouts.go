@@ -0,0 +1,47 @@
+package delegate
+
+import "time"
+
+// Timeouts bounds the time spent on the requests to the manager. Zero
+// values use the corresponding DefaultTimeouts value.
+type Timeouts struct {
+	Register  time.Duration // total time spent retrying the registration
+	Heartbeat time.Duration // time a heartbeat request may take
+	Poll      time.Duration // time a task events request may take, unless long-polling
+	Acquire   time.Duration // time an acquire request may take
+	Status    time.Duration // total time spent retrying a status update, rejection or Do call
+}
+
+// DefaultTimeouts are the timeouts used if none are configured
+var DefaultTimeouts = Timeouts{
+	Register:  30 * time.Second,
+	Heartbeat: 30 * time.Second,
+	Poll:      60 * time.Second,
+	Acquire:   30 * time.Second,
+	Status:    60 * time.Second,
+}
+
+// withDefaults returns the timeouts with the unset values replaced by the defaults
+func (t Timeouts) withDefaults() Timeouts {
+	if t.Register <= 0 {
+		t.Register = DefaultTimeouts.Register
+	}
+	if t.Heartbeat <= 0 {
+		t.Heartbeat = DefaultTimeouts.Heartbeat
+	}
+	if t.Poll <= 0 {
+		t.Poll = DefaultTimeouts.Poll
+	}
+	if t.Acquire <= 0 {
+		t.Acquire = DefaultTimeouts.Acquire
+	}
+	if t.Status <= 0 {
+		t.Status = DefaultTimeouts.Status
+	}
+	return t
+}
+
+// timeouts returns the effective timeouts of the client
+func (p *HTTPClient) timeouts() Timeouts {
+	return p.Timeouts.withDefaults()
+}
@@ -0,0 +1,80 @@
+package delegate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+)
+
+// fipsCipherSuites are the TLS 1.2 cipher suites approved for FIPS 140-2.
+// The TLS 1.3 cipher suites are not configurable in Go.
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// TLSOptions restricts the TLS parameters negotiated with the manager.
+type TLSOptions struct {
+	SkipVerify bool
+	RootCAs    *x509.CertPool // defaults to the system pool
+	MinVersion uint16         // defaults to TLS 1.2
+	// CipherSuites restricts the TLS 1.2 cipher suites, defaults to the Go defaults.
+	CipherSuites []uint16
+	// FIPS restricts the connection to TLS 1.2 or later with FIPS approved
+	// cipher suites and curves. It overrides CipherSuites.
+	FIPS bool
+	// Proxy configures the proxy, defaults to the proxy environment variables
+	Proxy *ProxyOptions
+	// SOCKS5 routes all the connections through a SOCKS5 proxy, it overrides Proxy
+	SOCKS5 *SOCKS5Dialer
+	// Pool sizes the connection pool, defaults to the Go defaults
+	Pool *PoolOptions
+}
+
+// Config returns the tls.Config for the options.
+func (o *TLSOptions) Config() *tls.Config {
+	c := &tls.Config{
+		RootCAs:            o.RootCAs,
+		MinVersion:         o.MinVersion,
+		CipherSuites:       o.CipherSuites,
+		InsecureSkipVerify: o.SkipVerify, //nolint:gosec
+	}
+	if c.MinVersion == 0 {
+		c.MinVersion = tls.VersionTLS12
+	}
+	if o.FIPS {
+		if c.MinVersion < tls.VersionTLS12 {
+			c.MinVersion = tls.VersionTLS12
+		}
+		c.CipherSuites = fipsCipherSuites
+		c.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+	}
+	return c
+}
+
+// NewTLSClient returns an http.Client which uses the TLS and proxy
+// options and does not follow redirects.
+func NewTLSClient(o *TLSOptions) *http.Client {
+	t := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: o.Config(),
+	}
+	if o.Proxy != nil {
+		o.Proxy.apply(t)
+	}
+	if o.SOCKS5 != nil {
+		t.Proxy = nil
+		t.DialContext = o.SOCKS5.DialContext
+	}
+	if o.Pool != nil {
+		o.Pool.apply(t)
+	}
+	return &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Transport: t,
+	}
+}
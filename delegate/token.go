@@ -1,42 +1,23 @@
 package delegate
 
 import (
-	"encoding/hex"
 	"time"
 
-	"github.com/google/uuid"
-	"gopkg.in/square/go-jose.v2"
-	"gopkg.in/square/go-jose.v2/jwt"
+	"github.com/wings-software/dlite/tokens"
 )
 
 // Token generates a token with the given expiry to interact with the Harness manager
 func Token(audience, issuer, subject, secret string, expiry time.Duration) (string, error) {
-	bytes, err := hex.DecodeString(secret)
-	if err != nil {
-		return "", err
-	}
-
-	enc, err := jose.NewEncrypter(
-		jose.A128GCM,
-		jose.Recipient{Algorithm: jose.DIRECT, Key: bytes},
-		(&jose.EncrypterOptions{}).WithType("JWT"),
-	)
-	if err != nil {
-		return "", err
-	}
+	return TokenAt(audience, issuer, subject, secret, time.Now(), expiry)
+}
 
-	cl := jwt.Claims{
-		Subject:  subject,
+// TokenAt is like Token but the token is issued at the given time, e.g. the
+// time of the manager clock
+func TokenAt(audience, issuer, subject, secret string, issuedAt time.Time, expiry time.Duration) (string, error) {
+	return tokens.Mint(subject, secret, tokens.Options{
+		Audience: audience,
 		Issuer:   issuer,
-		Audience: []string{audience},
-		Expiry:   jwt.NewNumericDate(time.Now().Add(expiry)),
-		IssuedAt: jwt.NewNumericDate(time.Now()),
-		ID:       uuid.New().String(),
-	}
-	raw, err := jwt.Encrypted(enc).Claims(cl).CompactSerialize()
-	if err != nil {
-		return "", err
-	}
-
-	return raw, nil
+		TTL:      expiry,
+		IssuedAt: issuedAt,
+	})
 }
@@ -1,10 +1,16 @@
 package delegate
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/events"
 )
 
 var (
@@ -13,38 +19,282 @@ var (
 	expirationTime = 10 * time.Minute // token gets refreshed every 10 minutes
 )
 
+// SecretSource provides the account secret, e.g. from a secret manager.
+// It is consulted every time a token is created.
+type SecretSource interface {
+	Secret(ctx context.Context) (string, error)
+}
+
+type staticSecret string
+
+func (s staticSecret) Secret(context.Context) (string, error) { return string(s), nil }
+
+// TokenCache caches the tokens of one or more accounts. Every account has
+// its own secret source and TTL.
 type TokenCache struct {
-	id     string
-	secret string
+	id     string // the default account
+	source SecretSource
 	expiry time.Duration
 	c      *cache.Cache
+
+	// OnMintFailure is called when a token of the account could not be created
+	OnMintFailure func(accountID string, err error)
+
+	// MintBackoff is the time between attempts to mint a token of an account
+	// after a failure, doubling up to MaxMintBackoff. Requests fail fast with
+	// a MintError in between. Defaults to one second and one minute.
+	MintBackoff    time.Duration
+	MaxMintBackoff time.Duration
+	// OnStateChange is called once the tokens of an account can not be
+	// minted, are minted with the fallback credential, or recover. Events
+	// optionally publishes the changes.
+	OnStateChange func(accountID, from, to string, err error)
+	Events        *events.Bus
+
+	// Leeway backdates the issue time of the tokens without shortening their
+	// lifetime, so that they are accepted by a manager whose clock is behind
+	Leeway time.Duration
+
+	mu       sync.Mutex
+	accounts map[string]*tokenAccount
+	offset   time.Duration // manager clock minus local clock
+}
+
+// tokenAccount is an account whose tokens are cached
+type tokenAccount struct {
+	source    SecretSource
+	fallback  SecretSource // optional secondary credential
+	ttl       time.Duration
+	minted    int64
+	failures  int64
+	lastError string
+
+	tokenState  string
+	consecutive int       // number of consecutive failures
+	retryAt     time.Time // no token is minted with the source before
+}
+
+// cachedToken is a token and the time it expires at
+type cachedToken struct {
+	token  string
+	expiry time.Time
+}
+
+// TokenStats reports the tokens created for an account
+type TokenStats struct {
+	AccountID string
+	Minted    int64 // number of tokens created
+	Failures  int64 // number of tokens which could not be created
+	LastError string
+	State     string    // healthy, degraded or fallback
+	RetryAt   time.Time // the next attempt to mint a token while degraded
 }
 
 // NewTokenCache creates a token cache which creates a new token
 // after the expiry time is over
 func NewTokenCache(id, secret string) *TokenCache {
-	c := cache.New(cache.DefaultExpiration, expirationTime)
-	return &TokenCache{
-		id:     id,
-		secret: secret,
-		expiry: expirationTime,
-		c:      c,
+	return NewTokenCacheWithTTL(id, secret, expirationTime)
+}
+
+// NewTokenCacheWithTTL creates a token cache whose tokens expire after ttl
+func NewTokenCacheWithTTL(id, secret string, ttl time.Duration) *TokenCache {
+	return NewTokenCacheFromSource(id, staticSecret(secret), ttl)
+}
+
+// NewTokenCacheFromSource creates a token cache which reads the account
+// secret from the source whenever a token is created.
+func NewTokenCacheFromSource(id string, source SecretSource, ttl time.Duration) *TokenCache {
+	c := cache.New(cache.DefaultExpiration, ttl)
+	t := &TokenCache{
+		id:       id,
+		source:   source,
+		expiry:   ttl,
+		c:        c,
+		accounts: map[string]*tokenAccount{},
 	}
+	t.AddAccount(id, source, ttl)
+	return t
+}
+
+// AddAccount adds an account whose tokens are created from the secret of
+// the source and expire after ttl. A cached token of the account is evicted.
+func (t *TokenCache) AddAccount(id string, source SecretSource, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = expirationTime
+	}
+	t.mu.Lock()
+	t.accounts[id] = &tokenAccount{source: source, ttl: ttl}
+	t.mu.Unlock()
+	t.c.Delete(id)
+}
+
+// RemoveAccount removes the account and evicts its cached token
+func (t *TokenCache) RemoveAccount(id string) {
+	t.mu.Lock()
+	delete(t.accounts, id)
+	t.mu.Unlock()
+	t.c.Delete(id)
+}
+
+// Evict removes the cached token of the account, so that the next
+// call creates a new token.
+func (t *TokenCache) Evict(id string) {
+	t.c.Delete(id)
+}
+
+// HasAccount reports whether the cache creates tokens for the account
+func (t *TokenCache) HasAccount(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.accounts[id]
+	return ok
+}
+
+// Accounts returns the accounts of the cache in sorted order
+func (t *TokenCache) Accounts() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]string, 0, len(t.accounts))
+	for id := range t.accounts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Stats returns the token statistics of the accounts sorted by account ID
+func (t *TokenCache) Stats() []TokenStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make([]TokenStats, 0, len(t.accounts))
+	for id, a := range t.accounts {
+		stats = append(stats, TokenStats{AccountID: id, Minted: a.minted, Failures: a.failures, LastError: a.lastError, State: a.state(), RetryAt: a.retryAt})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].AccountID < stats[j].AccountID })
+	return stats
 }
 
 // Get returns the value of the account token.
 // If the token is cached, it returns from there. Otherwise
 // it creates a new token with a new expiration time.
 func (t *TokenCache) Get() (string, error) {
-	tv, found := t.c.Get(t.id)
-	if found {
-		return tv.(string), nil
+	return t.GetFor(t.id)
+}
+
+// GetFor returns the token of the account, creating a new one if there
+// is no cached token.
+func (t *TokenCache) GetFor(id string) (string, error) {
+	return t.GetValidFor(id, 0)
+}
+
+// GetValidFor returns a token of the account which stays valid for at least
+// d, e.g. the expected duration of a request. A new token is created if the
+// cached one expires earlier.
+func (t *TokenCache) GetValidFor(id string, d time.Duration) (string, error) {
+	if tv, found := t.c.Get(id); found {
+		if ct := tv.(cachedToken); time.Until(ct.expiry) >= d {
+			return ct.token, nil
+		}
 	}
-	logrus.WithField("id", t.id).Infoln("refreshing token")
-	token, err := Token(audience, issuer, t.id, t.secret, t.expiry)
-	if err != nil {
+	t.mu.Lock()
+	a, ok := t.accounts[id]
+	var err error
+	var fallback SecretSource
+	if ok {
+		fallback = a.fallback
+		// fail fast while the attempts back off
+		if time.Now().Before(a.retryAt) {
+			err = &MintError{AccountID: id, RetryAt: a.retryAt, Err: errors.New(a.lastError)}
+		}
+	}
+	t.mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("no secret for account %s", id)
+	}
+	var token string
+	if err == nil {
+		logrus.WithField("id", id).Infoln("refreshing token")
+		token, err = t.mint(id, a.source, a.ttl)
+		t.mu.Lock()
+		if err != nil {
+			a.failures++
+			a.consecutive++
+			a.lastError = err.Error()
+			a.retryAt = time.Now().Add(t.mintBackoff(a.consecutive))
+			err = &MintError{AccountID: id, RetryAt: a.retryAt, Err: err}
+		} else {
+			a.minted++
+			a.consecutive = 0
+			a.retryAt = time.Time{}
+		}
+		t.mu.Unlock()
+		if err != nil && t.OnMintFailure != nil {
+			t.OnMintFailure(id, err)
+		}
+	}
+	if err == nil {
+		t.setState(id, a, TokenHealthy, nil)
+		t.c.Set(id, cachedToken{token: token, expiry: time.Now().Add(a.ttl)}, a.ttl)
+		return token, nil
+	}
+	if fallback == nil {
+		t.setState(id, a, TokenDegraded, err)
 		return "", err
 	}
-	t.c.Set(t.id, token, t.expiry)
+	token, ferr := t.mint(id, fallback, a.ttl)
+	if ferr != nil {
+		t.setState(id, a, TokenDegraded, err)
+		return "", fmt.Errorf("%w, the fallback credential failed too: %s", err, ferr)
+	}
+	t.setState(id, a, TokenFallback, err)
+	// the token is cached until the secret of the account is tried again
+	var me *MintError
+	ttl := a.ttl
+	if errors.As(err, &me) && time.Until(me.RetryAt) < ttl {
+		ttl = time.Until(me.RetryAt)
+	}
+	if ttl > 0 && ttl >= d {
+		t.c.Set(id, cachedToken{token: token, expiry: time.Now().Add(ttl)}, ttl)
+	}
 	return token, nil
 }
+
+// mint creates a new token of the account with the secret of the source
+func (t *TokenCache) mint(id string, src SecretSource, ttl time.Duration) (string, error) {
+	secret, err := src.Secret(context.Background())
+	if err != nil {
+		return "", err
+	}
+	issuedAt := time.Now().Add(t.clockOffset()).Add(-t.Leeway)
+	return TokenAt(audience, issuer, id, secret, issuedAt, ttl+t.Leeway)
+}
+
+// SetClockOffset sets the offset of the manager clock from the local clock,
+// which is added to the issue and expiry times of new tokens. Cached tokens
+// are evicted if the offset changed.
+func (t *TokenCache) SetClockOffset(d time.Duration) {
+	t.mu.Lock()
+	changed := t.offset != d
+	t.offset = d
+	t.mu.Unlock()
+	if changed {
+		t.c.Flush()
+	}
+}
+
+// clockOffset returns the offset of the manager clock
+func (t *TokenCache) clockOffset() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.offset
+}
+
+// ttl returns the TTL of the tokens of the account
+func (t *TokenCache) ttl(id string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if a, ok := t.accounts[id]; ok {
+		return a.ttl
+	}
+	return t.expiry
+}
@@ -0,0 +1,36 @@
+package delegate
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// tokenMargin is added to the expected duration of a request, so that the
+// token does not expire while the response is processed or because of a
+// small clock skew with the manager
+var tokenMargin = 30 * time.Second
+
+// tokenAccount returns the account whose token authorizes the request to the
+// URL. Requests on behalf of another account of the token cache carry its token.
+func (p *HTTPClient) tokenAccount(u *url.URL) string {
+	if id := u.Query().Get("accountId"); id != "" && p.AccountTokenCache.HasAccount(id) {
+		return id
+	}
+	return p.AccountTokenCache.id
+}
+
+// tokenValidity returns the time the token of a request must stay valid,
+// which is the time until the deadline of the request plus a margin. It is
+// bounded by half the token TTL, so that long requests do not create a new
+// token every time.
+func (p *HTTPClient) tokenValidity(ctx context.Context, account string) time.Duration {
+	d := tokenMargin
+	if deadline, ok := ctx.Deadline(); ok {
+		d += time.Until(deadline)
+	}
+	if limit := p.AccountTokenCache.ttl(account) / 2; d > limit {
+		d = limit
+	}
+	return d
+}
@@ -0,0 +1,122 @@
+package delegate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/events"
+)
+
+const (
+	// defaultMintBackoff is the time between attempts to mint a token after
+	// the first failure
+	defaultMintBackoff = time.Second
+	// defaultMaxMintBackoff bounds the time between attempts to mint a token
+	defaultMaxMintBackoff = time.Minute
+)
+
+// States of the tokens of an account
+const (
+	// TokenHealthy accounts mint their tokens with their secret
+	TokenHealthy = "healthy"
+	// TokenDegraded accounts can not mint tokens, the attempts back off
+	TokenDegraded = "degraded"
+	// TokenFallback accounts can not mint tokens with their secret and
+	// mint them with the fallback credential
+	TokenFallback = "fallback"
+)
+
+// MintError is returned while the tokens of an account can not be minted.
+// No token is minted before RetryAt, requests fail fast with the last error.
+type MintError struct {
+	AccountID string
+	RetryAt   time.Time
+	Err       error
+}
+
+func (e *MintError) Error() string {
+	return fmt.Sprintf("could not mint a token of account %s, retrying at %s: %s",
+		e.AccountID, e.RetryAt.Format(time.RFC3339), e.Err)
+}
+
+func (e *MintError) Unwrap() error {
+	return e.Err
+}
+
+// SetFallback sets a secondary credential of the account, which mints its
+// tokens while they can not be minted with the secret of the account
+func (t *TokenCache) SetFallback(id string, src SecretSource) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if a, ok := t.accounts[id]; ok {
+		a.fallback = src
+	}
+}
+
+// SetFallbackSecret is like SetFallback with a static secret
+func (t *TokenCache) SetFallbackSecret(id, secret string) {
+	t.SetFallback(id, staticSecret(secret))
+}
+
+// State returns the state of the tokens of the account
+func (t *TokenCache) State(id string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if a, ok := t.accounts[id]; ok {
+		return a.state()
+	}
+	return ""
+}
+
+// state returns the state of the tokens of the account
+func (a *tokenAccount) state() string {
+	if a.tokenState == "" {
+		return TokenHealthy
+	}
+	return a.tokenState
+}
+
+// mintBackoff returns the time until the next attempt to mint a token after
+// the consecutive failures, doubling up to MaxMintBackoff
+func (t *TokenCache) mintBackoff(failures int) time.Duration {
+	d, limit := t.MintBackoff, t.MaxMintBackoff
+	if d <= 0 {
+		d = defaultMintBackoff
+	}
+	if limit <= 0 {
+		limit = defaultMaxMintBackoff
+	}
+	for i := 1; i < failures && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	return d
+}
+
+// setState moves the tokens of the account to the state, logging and
+// reporting the change once
+func (t *TokenCache) setState(id string, a *tokenAccount, to string, err error) {
+	t.mu.Lock()
+	from := a.state()
+	a.tokenState = to
+	t.mu.Unlock()
+	if from == to {
+		return
+	}
+	entry := logrus.WithField("id", id).WithField("from", from).WithField("to", to)
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+	if to == TokenHealthy {
+		entry.Infoln("account tokens recovered")
+	} else {
+		entry.Warnln("account tokens can not be minted with the account secret")
+	}
+	t.Events.Publish(events.Event{Type: events.TokenStateChanged, Status: to, Err: err})
+	if t.OnStateChange != nil {
+		t.OnStateChange(id, from, to, err)
+	}
+}
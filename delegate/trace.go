@@ -0,0 +1,84 @@
+package delegate
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultTraceSize is the number of requests kept by a TraceBuffer
+const defaultTraceSize = 200
+
+// Trace describes a request to the manager
+type Trace struct {
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"request_id"`
+	Endpoint  string        `json:"endpoint"` // the operation, e.g. acquire, or other
+	Method    string        `json:"method"`
+	Status    int           `json:"status,omitempty"` // zero if no response was received
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// TraceBuffer keeps the traces of the most recent requests, e.g. for
+// support bundles
+type TraceBuffer struct {
+	mu     sync.Mutex
+	traces []Trace
+	next   int
+	size   int
+}
+
+// NewTraceBuffer returns a buffer of the last size requests, 200 if size
+// is not positive
+func NewTraceBuffer(size int) *TraceBuffer {
+	if size <= 0 {
+		size = defaultTraceSize
+	}
+	return &TraceBuffer{size: size}
+}
+
+func (b *TraceBuffer) add(t Trace) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.traces) < b.size {
+		b.traces = append(b.traces, t)
+		return
+	}
+	b.traces[b.next] = t
+	b.next = (b.next + 1) % b.size
+}
+
+// Traces returns the traces of the most recent requests, oldest first
+func (b *TraceBuffer) Traces() []Trace {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append(append([]Trace{}, b.traces[b.next:]...), b.traces[:b.next]...)
+}
+
+// trace records the request in the trace buffer
+func (p *HTTPClient) trace(id, path, method string, start time.Time, res *http.Response, err error) {
+	if p.Traces == nil {
+		return
+	}
+	t := Trace{
+		Time:      start,
+		RequestID: id,
+		Endpoint:  p.routes().Op(path),
+		Method:    method,
+		Duration:  time.Since(start),
+	}
+	if res != nil {
+		t.Status = res.StatusCode
+	}
+	if err != nil {
+		t.Error = err.Error()
+	}
+	p.Traces.add(t)
+}
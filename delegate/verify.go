@@ -0,0 +1,171 @@
+package delegate
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Verification check results
+const (
+	CheckOK      = "ok"
+	CheckWarning = "warning"
+	CheckFailed  = "failed"
+	CheckSkipped = "skipped" // a check it depends on failed
+)
+
+// verifyDelegateID is the runner ID of the requests of Verify which need one
+const verifyDelegateID = "dlite-verify"
+
+// MaxClockSkew is the clock skew with the manager above which Verify warns,
+// as tokens may be rejected as not yet valid or expired
+var MaxClockSkew = 30 * time.Second
+
+// Check is the result of a single verification check
+type Check struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// VerifyReport is the result of Verify
+type VerifyReport struct {
+	Endpoint  string        `json:"endpoint"`
+	AccountID string        `json:"accountId"`
+	Time      time.Time     `json:"time"`
+	ClockSkew time.Duration `json:"clockSkew"` // manager clock minus local clock
+	Checks    []Check       `json:"checks"`
+}
+
+// OK reports whether no check failed
+func (r *VerifyReport) OK() bool {
+	for _, c := range r.Checks {
+		if c.Status == CheckFailed || c.Status == CheckSkipped {
+			return false
+		}
+	}
+	return true
+}
+
+// verification runs the checks of a report in order
+type verification struct {
+	report *VerifyReport
+	failed bool
+}
+
+// run runs the check unless a previous check failed. The check returns the
+// status and a message.
+func (v *verification) run(name string, check func() (string, string)) {
+	c := Check{Name: name, Status: CheckSkipped}
+	if !v.failed {
+		start := time.Now()
+		c.Status, c.Message = check()
+		c.Duration = time.Since(start)
+	}
+	if c.Status == CheckFailed {
+		v.failed = true
+	}
+	v.report.Checks = append(v.report.Checks, c)
+}
+
+// Verify checks the connectivity to the manager and the credentials: the
+// resolution of the manager host name, the TLS handshake, the clock skew with
+// the manager, the creation of an account token and a read-only request with
+// the token.
+// Checks are skipped once a check failed.
+func (p *HTTPClient) Verify(ctx context.Context) *VerifyReport {
+	base, probe := p.endpoint()
+	if probe {
+		defer p.endProbe()
+	}
+	v := &verification{report: &VerifyReport{Endpoint: base, AccountID: p.AccountID, Time: time.Now()}}
+	u, err := url.Parse(base)
+	if err != nil {
+		v.run("endpoint", func() (string, string) { return CheckFailed, err.Error() })
+		return v.report
+	}
+	var res *http.Response
+	v.run("dns", func() (string, string) {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+		if err != nil {
+			return CheckFailed, err.Error()
+		}
+		return CheckOK, fmt.Sprintf("%s resolves to %v", u.Hostname(), addrs)
+	})
+	v.run("connect", func() (string, string) {
+		req, err := http.NewRequestWithContext(ctx, "GET", base, nil)
+		if err != nil {
+			return CheckFailed, err.Error()
+		}
+		p.addHeaders(req)
+		if res, err = p.Client.Do(req); err != nil {
+			return CheckFailed, err.Error()
+		}
+		res.Body.Close()
+		if res.TLS == nil {
+			return CheckWarning, "the connection is not encrypted"
+		}
+		return CheckOK, fmt.Sprintf("%s, %s", tlsVersion(res.TLS.Version), tls.CipherSuiteName(res.TLS.CipherSuite))
+	})
+	v.run("clock", func() (string, string) {
+		skew, ok := dateSkew(res)
+		if !ok {
+			return CheckWarning, "the manager did not send its time"
+		}
+		v.report.ClockSkew = skew
+		status := CheckOK
+		if skew > MaxClockSkew || skew < -MaxClockSkew {
+			status = CheckWarning
+		}
+		if skew < 0 {
+			return status, fmt.Sprintf("the local clock is %s ahead of the manager", -skew)
+		}
+		return status, fmt.Sprintf("the local clock is %s behind the manager", skew)
+	})
+	v.run("token", func() (string, string) {
+		if _, err := p.AccountTokenCache.Get(); err != nil {
+			return CheckFailed, err.Error()
+		}
+		return CheckOK, ""
+	})
+	v.run("credentials", func() (string, string) {
+		// only read-only requests are sent, verifying must not register a runner
+		res, err := p.do(ctx, fmt.Sprintf(apiVersionsEndpoint, p.AccountID), "GET", nil, nil)
+		if res != nil && res.StatusCode == http.StatusNotFound {
+			// the manager does not list its API versions, the task events of an
+			// unknown runner are not found once the credentials are accepted
+			res, err = p.do(ctx, p.path(OpTaskEvents, verifyDelegateID, p.AccountID), "GET", nil, nil)
+			if res != nil && res.StatusCode == http.StatusNotFound {
+				return CheckOK, ""
+			}
+		}
+		if res != nil && (res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden) {
+			return CheckFailed, "the manager rejected the account credentials"
+		}
+		if err != nil {
+			return CheckFailed, err.Error()
+		}
+		return CheckOK, ""
+	})
+	return v.report
+}
+
+// tlsVersion returns the name of the TLS version
+func tlsVersion(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("TLS %#04x", v)
+}
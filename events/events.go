@@ -0,0 +1,133 @@
+// Package events implements an in-process bus publishing the events of the
+// runner, e.g. acquired and finished tasks or heartbeats, to any number of
+// independent subscribers.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type is the type of an event
+type Type string
+
+// Event types
+const (
+	TaskAcquired  Type = "task_acquired"
+	TaskFinished  Type = "task_finished"
+	HeartbeatSent Type = "heartbeat_sent"
+	// HealthChanged is published when the runner health changes, e.g. when the
+	// runner is disconnected from the manager after failed heartbeats
+	HealthChanged Type = "health_changed"
+	// EndpointFailedOver is published when the client stops using a failing
+	// manager endpoint, or fails back to the primary one
+	EndpointFailedOver Type = "endpoint_failed_over"
+	// RunnerRegistered, RunnerDraining and RunnerStopped are published
+	// during the lifecycle of the runner
+	RunnerRegistered Type = "runner_registered"
+	RunnerDraining   Type = "runner_draining"
+	RunnerStopped    Type = "runner_stopped"
+	// RequestReplayed is published when the manager recognized a retried
+	// acquire or status request as a duplicate, the Status is the operation
+	RequestReplayed Type = "request_replayed"
+	// TokenStateChanged is published when the account tokens can not be
+	// minted, are minted with the fallback credential, or recover. The
+	// Status is the state of the tokens.
+	TokenStateChanged Type = "token_state_changed"
+)
+
+// Event is an event of the runner. Fields which do not apply to the type
+// are empty.
+type Event struct {
+	Type     Type
+	Time     time.Time
+	TaskID   string
+	TaskType string
+	// Status is the status of a finished task or the health state
+	Status   string
+	Duration time.Duration // execution time of a finished task
+	Endpoint string        // manager endpoint which is used after a failover
+	Err      error
+}
+
+// Bus publishes events to its subscribers. Publishing never blocks: events
+// are dropped for subscribers which do not keep up.
+type Bus struct {
+	mu      sync.RWMutex
+	subs    map[*subscription]struct{}
+	dropped int64
+}
+
+type subscription struct {
+	ch    chan Event
+	types map[Type]bool // all types if empty
+}
+
+// NewBus returns a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subs: map[*subscription]struct{}{}}
+}
+
+// Subscribe returns a channel receiving the events of the types, or all
+// events if no type is given. Up to buffer events are queued for the
+// subscriber. The returned function cancels the subscription and closes
+// the channel.
+func (b *Bus) Subscribe(buffer int, types ...Type) (<-chan Event, func()) {
+	s := &subscription{ch: make(chan Event, buffer), types: map[Type]bool{}}
+	for _, t := range types {
+		s.types[t] = true
+	}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, s)
+			b.mu.Unlock()
+			close(s.ch)
+		})
+	}
+}
+
+// SubscribeFunc calls fn with the events of the types in a separate
+// goroutine until the returned function is called.
+func (b *Bus) SubscribeFunc(fn func(Event), types ...Type) func() {
+	ch, cancel := b.Subscribe(100, types...)
+	go func() {
+		for e := range ch {
+			fn(e)
+		}
+	}()
+	return cancel
+}
+
+// Publish sends the event to the subscribers of its type. The time of the
+// event is set if it is zero. Publishing to a nil bus does nothing.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if len(s.types) > 0 && !s.types[e.Type] {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			atomic.AddInt64(&b.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of events dropped for slow subscribers
+func (b *Bus) Dropped() int64 {
+	return atomic.LoadInt64(&b.dropped)
+}
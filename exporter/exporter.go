@@ -0,0 +1,205 @@
+// Package exporter exports the events of the runner, e.g. its lifecycle and
+// the execution of tasks, to external sinks such as a webhook or a Kafka
+// topic, so that the activity of runners can be fed into data pipelines.
+package exporter
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/events"
+)
+
+// SchemaVersion is the version of the schema of exported records
+const SchemaVersion = 1
+
+var (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Second
+	defaultBuffer        = 1000
+	// sendTimeout bounds the time to send a batch, including retries
+	sendTimeout = 30 * time.Second
+	// sendAttempts is the number of attempts to send a batch
+	sendAttempts = 3
+)
+
+// Record is an exported event. Its JSON encoding is the schema of exported
+// events, fields which do not apply to the type of the event are omitted:
+//
+//	{
+//	  "schema_version": 1,
+//	  "id": "0b5e8d4c-...",         // unique, to deduplicate redelivered records
+//	  "type": "task_finished",      // see the types of the events package
+//	  "time": "2024-05-01T10:00:00.123Z",
+//	  "runner": "runner-1",
+//	  "account_id": "...",
+//	  "task_id": "...",
+//	  "task_type": "...",
+//	  "status": "SUCCESS",          // status of a finished task or the health state
+//	  "duration_ms": 1200,          // execution time of a finished task
+//	  "endpoint": "https://...",    // manager endpoint used after a failover
+//	  "error": "..."
+//	}
+type Record struct {
+	SchemaVersion int         `json:"schema_version"`
+	ID            string      `json:"id"`
+	Type          events.Type `json:"type"`
+	Time          time.Time   `json:"time"`
+	Runner        string      `json:"runner,omitempty"`
+	AccountID     string      `json:"account_id,omitempty"`
+	TaskID        string      `json:"task_id,omitempty"`
+	TaskType      string      `json:"task_type,omitempty"`
+	Status        string      `json:"status,omitempty"`
+	DurationMs    int64       `json:"duration_ms,omitempty"`
+	Endpoint      string      `json:"endpoint,omitempty"`
+	Error         string      `json:"error,omitempty"`
+}
+
+// Sink receives the exported records in batches
+type Sink interface {
+	Send(ctx context.Context, records []*Record) error
+}
+
+// Exporter exports the events published to a bus to a sink in batches.
+// Batches which could not be sent after a few attempts are dropped.
+type Exporter struct {
+	Sink      Sink
+	Runner    string
+	AccountID string
+	// Types restricts the exported events, all events are exported if empty
+	Types []events.Type
+	// BatchSize is the maximum number of records sent at once, defaults to 100
+	BatchSize int
+	// FlushInterval is the maximum time a record is buffered, defaults to 5 seconds
+	FlushInterval time.Duration
+
+	stop     chan context.Context
+	done     chan struct{}
+	exported int64
+	dropped  int64
+}
+
+// Start exports the events published to the bus until Stop is called
+func (e *Exporter) Start(b *events.Bus) {
+	ch, cancel := b.Subscribe(defaultBuffer, e.Types...)
+	e.stop = make(chan context.Context)
+	e.done = make(chan struct{})
+	go e.run(ch, cancel)
+}
+
+// Stop stops exporting events and sends the buffered records until the
+// context is done
+func (e *Exporter) Stop(ctx context.Context) error {
+	select {
+	case e.stop <- ctx:
+	case <-e.done:
+		return nil
+	}
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Exported returns the number of exported records
+func (e *Exporter) Exported() int64 {
+	return atomic.LoadInt64(&e.exported)
+}
+
+// Dropped returns the number of records which could not be sent
+func (e *Exporter) Dropped() int64 {
+	return atomic.LoadInt64(&e.dropped)
+}
+
+func (e *Exporter) run(ch <-chan events.Event, cancel func()) {
+	defer close(e.done)
+	size := e.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	interval := e.FlushInterval
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var batch []*Record
+	flush := func(ctx context.Context) {
+		if len(batch) > 0 {
+			e.send(ctx, batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case ev := <-ch:
+			batch = append(batch, e.record(ev))
+			if len(batch) >= size {
+				ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+				flush(ctx)
+				cancel()
+			}
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			flush(ctx)
+			cancel()
+		case ctx := <-e.stop:
+			// the channel is closed once the subscription is canceled
+			cancel()
+			for ev := range ch {
+				batch = append(batch, e.record(ev))
+			}
+			flush(ctx)
+			return
+		}
+	}
+}
+
+// send sends the batch to the sink, retrying failures
+func (e *Exporter) send(ctx context.Context, batch []*Record) {
+	var err error
+	for attempt := 1; attempt <= sendAttempts; attempt++ {
+		if err = e.Sink.Send(ctx, batch); err == nil {
+			atomic.AddInt64(&e.exported, int64(len(batch)))
+			return
+		}
+		if attempt == sendAttempts {
+			break
+		}
+		t := time.NewTimer(time.Duration(attempt) * time.Second)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			attempt = sendAttempts
+		case <-t.C:
+		}
+	}
+	atomic.AddInt64(&e.dropped, int64(len(batch)))
+	logrus.WithError(err).WithField("records", len(batch)).Errorln("could not export runner events, dropping them")
+}
+
+// record returns the exported record of the event
+func (e *Exporter) record(ev events.Event) *Record {
+	r := &Record{
+		SchemaVersion: SchemaVersion,
+		ID:            uuid.New().String(),
+		Type:          ev.Type,
+		Time:          ev.Time.UTC(),
+		Runner:        e.Runner,
+		AccountID:     e.AccountID,
+		TaskID:        ev.TaskID,
+		TaskType:      ev.TaskType,
+		Status:        ev.Status,
+		DurationMs:    ev.Duration.Milliseconds(),
+		Endpoint:      ev.Endpoint,
+	}
+	if ev.Err != nil {
+		r.Error = ev.Err.Error()
+	}
+	return r
+}
@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Message is a Kafka message
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// Producer produces messages to a Kafka topic. It is implemented by KafkaREST
+// and can be implemented with any Kafka client library.
+type Producer interface {
+	Produce(ctx context.Context, topic string, messages []Message) error
+}
+
+// Kafka produces every record as a JSON message to the topic. Messages are
+// keyed by the task ID, or the runner for events which do not concern a
+// task, so that the events of a task stay in order.
+type Kafka struct {
+	Producer Producer
+	Topic    string
+}
+
+func (k *Kafka) Send(ctx context.Context, records []*Record) error {
+	messages := make([]Message, 0, len(records))
+	for _, r := range records {
+		value, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		key := r.TaskID
+		if key == "" {
+			key = r.Runner
+		}
+		messages = append(messages, Message{Key: []byte(key), Value: value})
+	}
+	return k.Producer.Produce(ctx, k.Topic, messages)
+}
+
+// KafkaREST produces messages through the REST proxy of Kafka, using the
+// JSON embedded format of the v2 API
+type KafkaREST struct {
+	URL     string // e.g. http://kafka-rest:8082
+	Headers map[string]string
+	Client  *http.Client
+}
+
+type restRecord struct {
+	Key   string          `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (k *KafkaREST) Produce(ctx context.Context, topic string, messages []Message) error {
+	records := make([]restRecord, len(messages))
+	for i, m := range messages {
+		records[i] = restRecord{Key: string(m.Key), Value: m.Value}
+	}
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimSuffix(k.URL, "/") + "/topics/" + url.PathEscape(topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	for name, value := range k.Headers {
+		req.Header.Set(name, value)
+	}
+	c := k.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return statusError(req, res)
+	}
+	// the proxy reports the failures of individual messages in the offsets
+	out := &struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return nil
+	}
+	for _, o := range out.Offsets {
+		if o.ErrorCode != nil || o.Error != "" {
+			return fmt.Errorf("exporter: kafka rest proxy could not produce a message to %s: %s", topic, o.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SignatureHeader carries the HMAC-SHA256 signature of the body of a webhook
+// request, e.g. sha256=5257a869...
+const SignatureHeader = "X-Dlite-Signature"
+
+// Webhook sends the records to a URL in a POST request with the JSON body
+// {"records": [...]}. Any status other than 2xx fails the batch.
+type Webhook struct {
+	URL string
+	// Secret optionally signs the body in the SignatureHeader
+	Secret  string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+func (w *Webhook) Send(ctx context.Context, records []*Record) error {
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return do(w.Client, req)
+}
+
+// do sends the request and fails on any status other than 2xx
+func do(c *http.Client, req *http.Request) error {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return statusError(req, res)
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
+
+// statusError returns the error of a request which failed with a status
+func statusError(req *http.Request, res *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("exporter: %s responded with status %d: %s", req.URL.Redacted(), res.StatusCode, bytes.TrimSpace(msg))
+}
@@ -0,0 +1,163 @@
+package fingerprint
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// metadataTimeout bounds the requests to the instance metadata services,
+// which are not reachable outside of the cloud
+var metadataTimeout = time.Second
+
+// metadataClient does not use the proxy, the metadata services are link-local
+var metadataClient = &http.Client{Transport: &http.Transport{}}
+
+// Metadata service endpoints, variables to point them at test servers
+var (
+	awsEndpoint   = "http://169.254.169.254"
+	gcpEndpoint   = "http://metadata.google.internal"
+	azureEndpoint = "http://169.254.169.254"
+)
+
+// cloud returns the cloud instance the runner is running on, nil if it is
+// not running on a known cloud
+func cloud(ctx context.Context) *client.CloudInfo {
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	results := make(chan *client.CloudInfo, 3)
+	for _, fn := range []func(context.Context) *client.CloudInfo{aws, gcp, azure} {
+		go func(fn func(context.Context) *client.CloudInfo) {
+			results <- fn(ctx)
+		}(fn)
+	}
+	var found *client.CloudInfo
+	for i := 0; i < 3; i++ {
+		if r := <-results; r != nil && found == nil {
+			found = r
+		}
+	}
+	return found
+}
+
+// aws reads the instance identity document using IMDSv2
+func aws(ctx context.Context) *client.CloudInfo {
+	token, err := fetch(ctx, "PUT", awsEndpoint+"/latest/api/token", map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": "60",
+	})
+	if err != nil {
+		return nil
+	}
+	doc, err := fetch(ctx, "GET", awsEndpoint+"/latest/dynamic/instance-identity/document", map[string]string{
+		"X-aws-ec2-metadata-token": token,
+	})
+	if err != nil {
+		return nil
+	}
+	var identity struct {
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+	}
+	if err := json.Unmarshal([]byte(doc), &identity); err != nil || identity.InstanceID == "" {
+		return nil
+	}
+	return &client.CloudInfo{
+		Provider:     "aws",
+		Region:       identity.Region,
+		Zone:         identity.AvailabilityZone,
+		InstanceType: identity.InstanceType,
+		InstanceID:   identity.InstanceID,
+	}
+}
+
+// gcp reads the instance attributes from the metadata server
+func gcp(ctx context.Context) *client.CloudInfo {
+	header := map[string]string{"Metadata-Flavor": "Google"}
+	get := func(path string) string {
+		v, _ := fetch(ctx, "GET", gcpEndpoint+"/computeMetadata/v1/instance/"+path, header)
+		return v
+	}
+	id := get("id")
+	if id == "" {
+		return nil
+	}
+	// zone and machine type are returned as projects/<n>/zones/<zone>
+	zone := last(get("zone"))
+	region := zone
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		region = zone[:i]
+	}
+	return &client.CloudInfo{
+		Provider:     "gcp",
+		Region:       region,
+		Zone:         zone,
+		InstanceType: last(get("machine-type")),
+		InstanceID:   id,
+	}
+}
+
+// azure reads the compute metadata of the instance
+func azure(ctx context.Context) *client.CloudInfo {
+	doc, err := fetch(ctx, "GET", azureEndpoint+"/metadata/instance/compute?api-version=2021-02-01", map[string]string{
+		"Metadata": "true",
+	})
+	if err != nil {
+		return nil
+	}
+	var compute struct {
+		VMID     string `json:"vmId"`
+		VMSize   string `json:"vmSize"`
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+	}
+	if err := json.Unmarshal([]byte(doc), &compute); err != nil || compute.VMID == "" {
+		return nil
+	}
+	return &client.CloudInfo{
+		Provider:     "azure",
+		Region:       compute.Location,
+		Zone:         compute.Zone,
+		InstanceType: compute.VMSize,
+		InstanceID:   compute.VMID,
+	}
+}
+
+// fetch returns the body of a successful metadata request
+func fetch(ctx context.Context, method, url string, header map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &statusError{resp.StatusCode}
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return strings.TrimSpace(string(b)), err
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return "metadata service responded with " + http.StatusText(e.code)
+}
+
+func last(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
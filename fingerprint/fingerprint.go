@@ -0,0 +1,113 @@
+// Package fingerprint collects facts about the runner host, e.g. its kernel,
+// container runtime, installed tools and cloud instance, which are sent with
+// the registration so that the manager can route tasks based on them.
+package fingerprint
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// defaultTimeout bounds the time spent on collecting the fingerprint
+var defaultTimeout = 5 * time.Second
+
+// Tools are the tools whose versions are collected, mapped to the command
+// printing the version
+var Tools = map[string][]string{
+	"docker": {"docker", "version", "--format", "{{.Client.Version}}"},
+	"git":    {"git", "--version"},
+}
+
+// Collect returns the fingerprint of the host. Facts which can not be
+// determined are left empty.
+func Collect(ctx context.Context) *client.HostInfo {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	info := &client.HostInfo{
+		OS:               runtime.GOOS,
+		Arch:             runtime.GOARCH,
+		Kernel:           kernel(ctx),
+		ContainerRuntime: containerRuntime(),
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		info.Tools = tools(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		info.Cloud = cloud(ctx)
+	}()
+	wg.Wait()
+	return info
+}
+
+// kernel returns the kernel version
+func kernel(ctx context.Context) string {
+	if b, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		return strings.TrimSpace(string(b))
+	}
+	if runtime.GOOS == "windows" {
+		return command(ctx, "cmd", "/c", "ver")
+	}
+	return command(ctx, "uname", "-r")
+}
+
+// containerRuntime returns the container runtime the runner is running in,
+// empty if it is not running in a container
+func containerRuntime() string {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes"
+	}
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker"
+	}
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return "podman"
+	}
+	b, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return ""
+	}
+	cgroup := string(b)
+	for _, name := range []string{"kubepods", "docker", "containerd", "lxc"} {
+		if strings.Contains(cgroup, name) {
+			if name == "kubepods" {
+				return "kubernetes"
+			}
+			return name
+		}
+	}
+	return ""
+}
+
+// tools returns the versions of the installed tools
+func tools(ctx context.Context) map[string]string {
+	versions := map[string]string{}
+	for name, args := range Tools {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		if v := command(ctx, args[0], args[1:]...); v != "" {
+			versions[name] = v
+		}
+	}
+	return versions
+}
+
+// command returns the trimmed output of the command, empty if it failed
+func command(ctx context.Context, name string, args ...string) string {
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
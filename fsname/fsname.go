@@ -0,0 +1,41 @@
+// Package fsname encodes IDs, e.g. task IDs, as file names. Distinct IDs
+// have distinct names, also on case-insensitive file systems.
+package fsname
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Encode returns the file name of the id. Lower case letters, digits and
+// dashes are kept, all the other bytes are escaped as an underscore and
+// their two hex digits, e.g. a.B is encoded as a_2e_42.
+func Encode(id string) string {
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if c == '-' || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "_%02x", c)
+	}
+	return b.String()
+}
+
+// Migrate renames the file of the id in dir, which is named by an earlier
+// encoding, to its encoded name with the extension. The file is removed if
+// a file with the encoded name was written since.
+func Migrate(dir, name, id, ext string) error {
+	want := filepath.Join(dir, Encode(id)+ext)
+	path := filepath.Join(dir, name)
+	if path == want {
+		return nil
+	}
+	if _, err := os.Stat(want); err == nil {
+		return os.Remove(path)
+	}
+	return os.Rename(path, want)
+}
@@ -10,8 +10,9 @@ require (
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.4.2
+	golang.org/x/sys v0.0.0-20220727055044-e65921a090b8
 	gopkg.in/square/go-jose.v2 v2.6.0
-	k8s.io/utils v0.0.0-20220210201930-3a6ce19ff2f9
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -19,6 +20,4 @@ require (
 	github.com/google/go-cmp v0.3.0 // indirect
 	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
 	golang.org/x/crypto v0.0.0-20190621222207-cc06ce4a13d4 // indirect
-	golang.org/x/sys v0.0.0-20220727055044-e65921a090b8 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,254 @@
+// Package heartbeat reports the presence of a runner to the manager. It is
+// used by the poller, and can be used on its own by embedders which only
+// need presence reporting without executing tasks.
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/events"
+	"github.com/wings-software/dlite/scheduler"
+)
+
+const (
+	// defaultInterval is the time between heartbeats
+	defaultInterval = 10 * time.Second
+	// defaultMaxBackoff bounds the interval between failing heartbeats
+	defaultMaxBackoff = time.Minute
+)
+
+// ErrRunning is returned by Start if the heartbeat is already running
+var ErrRunning = errors.New("heartbeat: already running")
+
+// Sender sends heartbeats, e.g. the delegate client
+type Sender interface {
+	Heartbeat(ctx context.Context, r *client.RegisterRequest) error
+}
+
+// PayloadFunc builds the request of the next heartbeat
+type PayloadFunc func(ctx context.Context) (*client.RegisterRequest, error)
+
+// Static returns a PayloadFunc which sends the same request every time
+func Static(r *client.RegisterRequest) PayloadFunc {
+	return func(context.Context) (*client.RegisterRequest, error) {
+		return r, nil
+	}
+}
+
+// Heartbeat periodically sends heartbeats until it is stopped. Failing
+// heartbeats back off exponentially up to MaxBackoff.
+type Heartbeat struct {
+	Client  Sender
+	Payload PayloadFunc
+	// Jitter randomly delays every heartbeat by up to the fraction of the interval
+	Jitter float64
+	// MaxBackoff bounds the interval between failing heartbeats, defaults to
+	// one minute. Failing heartbeats do not back off if it is negative.
+	MaxBackoff time.Duration
+
+	// OnSuccess is called after every heartbeat which was sent
+	OnSuccess func(r *client.RegisterRequest)
+	// OnFailure is called after every heartbeat which failed, with the
+	// number of consecutive failures
+	OnFailure func(err error, failures int)
+	// Events optionally publishes a HeartbeatSent event for every heartbeat
+	Events *events.Bus
+
+	mu          sync.Mutex
+	interval    time.Duration
+	reset       chan struct{}
+	cancel      context.CancelFunc
+	done        chan struct{}
+	running     bool
+	runs        int
+	failures    int
+	consecutive int
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// New returns a heartbeat sending the payload to the client every interval
+func New(c Sender, payload PayloadFunc, interval time.Duration) *Heartbeat {
+	return &Heartbeat{
+		Client:   c,
+		Payload:  payload,
+		interval: interval,
+		reset:    make(chan struct{}, 1),
+	}
+}
+
+// Start sends heartbeats in the background until Stop is called or the
+// context is done. The first heartbeat is sent after one interval.
+func (h *Heartbeat) Start(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.running {
+		return ErrRunning
+	}
+	if h.reset == nil {
+		h.reset = make(chan struct{}, 1)
+	}
+	ctx, h.cancel = context.WithCancel(ctx)
+	h.done = make(chan struct{})
+	h.running = true
+	go h.loop(ctx, h.done)
+	return nil
+}
+
+// Stop stops sending heartbeats and waits for the heartbeat in flight.
+// The heartbeat can be started again.
+func (h *Heartbeat) Stop() {
+	h.mu.Lock()
+	cancel, done := h.cancel, h.done
+	h.cancel, h.done = nil, nil
+	h.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Running returns true if the heartbeat was started and was neither stopped
+// nor its context done
+func (h *Heartbeat) Running() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.running
+}
+
+// SetInterval changes the time between heartbeats, the next heartbeat is
+// sent one new interval from now
+func (h *Heartbeat) SetInterval(d time.Duration) {
+	h.mu.Lock()
+	h.interval = d
+	reset := h.reset
+	h.mu.Unlock()
+	if reset != nil {
+		select {
+		case reset <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Interval returns the time between heartbeats
+func (h *Heartbeat) Interval() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.interval <= 0 {
+		return defaultInterval
+	}
+	return h.interval
+}
+
+// Beat sends a heartbeat now, e.g. to report a change of the runner
+// without waiting for the next interval
+func (h *Heartbeat) Beat(ctx context.Context) error {
+	r, err := h.Payload(ctx)
+	if err == nil {
+		err = h.Client.Heartbeat(ctx, r)
+	}
+	h.mu.Lock()
+	h.runs++
+	h.lastRun = time.Now()
+	h.lastErr = err
+	if err != nil {
+		h.failures++
+		h.consecutive++
+	} else {
+		h.consecutive = 0
+		h.lastSuccess = h.lastRun
+	}
+	consecutive := h.consecutive
+	h.mu.Unlock()
+	h.Events.Publish(events.Event{Type: events.HeartbeatSent, Err: err})
+	if err != nil {
+		if h.OnFailure != nil {
+			h.OnFailure(err, consecutive)
+		}
+		return err
+	}
+	if h.OnSuccess != nil {
+		h.OnSuccess(r)
+	}
+	return nil
+}
+
+// LastSuccess returns the time of the last heartbeat which was sent
+func (h *Heartbeat) LastSuccess() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastSuccess
+}
+
+// Failures returns the number of consecutive failed heartbeats
+func (h *Heartbeat) Failures() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.consecutive
+}
+
+// Status reports the heartbeats like a scheduled job
+func (h *Heartbeat) Status() scheduler.Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := scheduler.Status{
+		Name:     "heartbeat",
+		Runs:     h.runs,
+		Failures: h.failures,
+		LastRun:  h.lastRun,
+		Stopped:  !h.running,
+	}
+	if h.lastErr != nil {
+		st.LastError = h.lastErr.Error()
+	}
+	return st
+}
+
+func (h *Heartbeat) loop(ctx context.Context, done chan struct{}) {
+	defer func() {
+		h.mu.Lock()
+		h.running = false
+		h.mu.Unlock()
+		close(done)
+	}()
+	timer := time.NewTimer(h.delay())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.reset:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(h.delay())
+			continue
+		case <-timer.C:
+		}
+		h.Beat(ctx) //nolint:errcheck
+		timer.Reset(h.delay())
+	}
+}
+
+// delay returns the time until the next heartbeat, doubling the interval
+// after every consecutive failure up to MaxBackoff
+func (h *Heartbeat) delay() time.Duration {
+	d := h.Interval()
+	limit := h.MaxBackoff
+	if limit == 0 {
+		limit = defaultMaxBackoff
+	}
+	for i := 0; i < h.Failures() && d < limit; i++ {
+		d *= 2
+		if d > limit {
+			d = limit
+		}
+	}
+	return scheduler.Jitter(d, h.Jitter)
+}
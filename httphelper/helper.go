@@ -1,8 +1,10 @@
 package httphelper
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -61,3 +63,17 @@ func writeError(w http.ResponseWriter, err error, status int) {
 	}{err.Error(), status}
 	WriteJSON(w, &out, status)
 }
+
+// RequireToken returns a handler which serves the requests authorized with
+// the bearer token and rejects all the others. All the requests are
+// rejected if the token is empty.
+func RequireToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
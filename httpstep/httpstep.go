@@ -0,0 +1,333 @@
+// Package httpstep implements a handler of tasks which send an HTTP request
+// and verify the response, e.g. to check the connectivity of the runner to
+// a service. The URL, the headers and the body of the request can refer to
+// the secrets of the task as ${secrets.NAME}.
+package httpstep
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/task"
+)
+
+const (
+	// defaultTimeout bounds the time of a request
+	defaultTimeout = 30 * time.Second
+	// defaultMaxBody bounds the captured response body
+	defaultMaxBody = 1 << 20
+	// mask replaces the values of secrets in the result
+	mask = "******"
+)
+
+// secretRef matches the references to secrets, e.g. ${secrets.token}
+var secretRef = regexp.MustCompile(`\$\{secrets\.([A-Za-z0-9_.-]+)\}`)
+
+// Payload is the data of an HTTP step task
+type Payload struct {
+	Method  string            `json:"method,omitempty"` // defaults to GET
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	TLS     *TLS              `json:"tls,omitempty"`
+	// TimeoutSeconds bounds the request below the timeout of the runner
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+
+	// ExpectStatus are the expected status codes, any 2xx status if empty
+	ExpectStatus []int `json:"expect_status,omitempty"`
+	// ExpectBody is a regular expression the response body must match
+	ExpectBody string `json:"expect_body,omitempty"`
+}
+
+// TLS configures the TLS connection of the request. Certificates and keys
+// are PEM encoded and can refer to secrets.
+type TLS struct {
+	CACert             string `json:"ca_cert,omitempty"`
+	ClientCert         string `json:"client_cert,omitempty"`
+	ClientKey          string `json:"client_key,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"` // only if the runner allows it
+}
+
+// Validate validates the payload
+func (p *Payload) Validate() error {
+	if p.URL == "" {
+		return errors.New("url is required")
+	}
+	if p.TimeoutSeconds < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if p.ExpectBody != "" {
+		if _, err := regexp.Compile(p.ExpectBody); err != nil {
+			return fmt.Errorf("invalid expect_body: %w", err)
+		}
+	}
+	if p.TLS != nil && (p.TLS.ClientCert == "") != (p.TLS.ClientKey == "") {
+		return errors.New("tls client_cert and client_key must be set together")
+	}
+	return nil
+}
+
+// Result is the response of an HTTP step task
+type Result struct {
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+	Truncated  bool              `json:"truncated,omitempty"` // the body exceeded the maximum
+	DurationMs int64             `json:"duration_ms"`
+}
+
+// Runner sends the requests of HTTP step tasks
+type Runner struct {
+	// Timeout bounds the time of a request, defaults to 30 seconds
+	Timeout time.Duration
+	// MaxBody bounds the captured response body, defaults to 1MB
+	MaxBody int64
+	// AllowedHosts restricts the hosts of the requests, e.g. api.example.com
+	// or *.example.com. All hosts are allowed if it is empty.
+	AllowedHosts []string
+	// AllowInsecure allows tasks to skip the verification of certificates
+	AllowInsecure bool
+}
+
+// Handler returns a task handler which sends the requests of HTTP step tasks
+func (r *Runner) Handler() task.Handler {
+	return task.Typed(r.Run)
+}
+
+// Run sends the request of the task and checks the response. Responses which
+// do not match the expectations fail the task with an ASSERTION_FAILED error.
+func (r *Runner) Run(ctx context.Context, t *client.Task, p *Payload) (interface{}, error) {
+	s := newSecrets(t.Secrets)
+	req, err := r.request(ctx, s, p)
+	if err != nil {
+		return nil, task.NewError("INVALID_PAYLOAD", client.CategoryUser, s.mask(err.Error()), false, nil)
+	}
+	tr, err := r.transport(s, p.TLS)
+	if err != nil {
+		return nil, task.NewError("INVALID_PAYLOAD", client.CategoryUser, s.mask(err.Error()), false, nil)
+	}
+	defer tr.CloseIdleConnections()
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if d := time.Duration(p.TimeoutSeconds) * time.Second; d > 0 && d < timeout {
+		timeout = d
+	}
+	hc := &http.Client{
+		Transport: tr,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !r.allowed(req.URL.Hostname()) {
+				return fmt.Errorf("redirect to host %s is not allowed", req.URL.Hostname())
+			}
+			return nil
+		},
+	}
+
+	start := time.Now()
+	res, err := hc.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// the error of a failed request includes its URL
+		return nil, task.NewError("REQUEST_FAILED", client.CategoryInfrastructure, s.mask(err.Error()), true, nil)
+	}
+	defer res.Body.Close()
+	limit := r.MaxBody
+	if limit <= 0 {
+		limit = defaultMaxBody
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		return nil, task.NewError("REQUEST_FAILED", client.CategoryInfrastructure,
+			s.mask("could not read the response body: "+err.Error()), true, nil)
+	}
+	result := &Result{
+		StatusCode: res.StatusCode,
+		Headers:    map[string]string{},
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if int64(len(body)) > limit {
+		body, result.Truncated = body[:limit], true
+	}
+	result.Body = s.mask(string(body))
+	for k := range res.Header {
+		result.Headers[k] = s.mask(res.Header.Get(k))
+	}
+	if err := check(p, res.StatusCode, body); err != nil {
+		return nil, task.NewError("ASSERTION_FAILED", client.CategoryUser, s.mask(err.Error()), false, nil)
+	}
+	return result, nil
+}
+
+// request returns the request of the task with the secrets interpolated
+func (r *Runner) request(ctx context.Context, s secrets, p *Payload) (*http.Request, error) {
+	raw, err := s.interpolate(p.URL)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	if !r.allowed(u.Hostname()) {
+		return nil, fmt.Errorf("host %s is not allowed", u.Hostname())
+	}
+	body, err := s.interpolate(p.Body)
+	if err != nil {
+		return nil, err
+	}
+	method := strings.ToUpper(p.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range p.Headers {
+		if v, err = s.interpolate(v); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// transport returns the transport of the request with the TLS options
+func (r *Runner) transport(s secrets, o *TLS) (*http.Transport, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if o == nil {
+		return tr, nil
+	}
+	if o.InsecureSkipVerify && !r.AllowInsecure {
+		return nil, errors.New("skipping the certificate verification is not allowed")
+	}
+	tr.TLSClientConfig.InsecureSkipVerify = o.InsecureSkipVerify //nolint:gosec
+	tr.TLSClientConfig.ServerName = o.ServerName
+	if o.CACert != "" {
+		ca, err := s.interpolate(o.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(ca)) {
+			return nil, errors.New("tls ca_cert does not contain a PEM encoded certificate")
+		}
+		tr.TLSClientConfig.RootCAs = pool
+	}
+	if o.ClientCert != "" {
+		cert, err := s.interpolate(o.ClientCert)
+		if err != nil {
+			return nil, err
+		}
+		key, err := s.interpolate(o.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		pair, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls client certificate: %w", err)
+		}
+		tr.TLSClientConfig.Certificates = []tls.Certificate{pair}
+	}
+	return tr, nil
+}
+
+// allowed returns true if requests to the host are allowed
+func (r *Runner) allowed(host string) bool {
+	if len(r.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, h := range r.AllowedHosts {
+		h = strings.ToLower(h)
+		if h == host || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// check checks the response against the expectations of the task
+func check(p *Payload, status int, body []byte) error {
+	if len(p.ExpectStatus) == 0 {
+		if status < 200 || status > 299 {
+			return fmt.Errorf("unexpected status %d", status)
+		}
+	} else if !contains(p.ExpectStatus, status) {
+		return fmt.Errorf("unexpected status %d, expected one of %v", status, p.ExpectStatus)
+	}
+	if p.ExpectBody != "" && !regexp.MustCompile(p.ExpectBody).Match(body) {
+		return fmt.Errorf("response body does not match %q", p.ExpectBody)
+	}
+	return nil
+}
+
+func contains(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// secrets are the decrypted secrets of a task by name
+type secrets map[string]string
+
+func newSecrets(list []client.Secret) secrets {
+	s := secrets{}
+	for _, secret := range list {
+		s[secret.Name] = secret.Value
+	}
+	return s
+}
+
+// interpolate replaces the references to secrets in v with their values
+func (s secrets) interpolate(v string) (string, error) {
+	var err error
+	out := secretRef.ReplaceAllStringFunc(v, func(ref string) string {
+		name := secretRef.FindStringSubmatch(ref)[1]
+		value, ok := s[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("unknown secret %s", name)
+		}
+		return value
+	})
+	return out, err
+}
+
+// mask replaces the values of the secrets in v
+func (s secrets) mask(v string) string {
+	for _, value := range s {
+		if value != "" {
+			v = strings.ReplaceAll(v, value, mask)
+		}
+	}
+	return v
+}
@@ -0,0 +1,221 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	leasePath         = "/apis/coordination.k8s.io/v1/namespaces/%s/leases"
+	microTime         = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// KubeLease is a lock backed by a Kubernetes coordination.k8s.io/v1 Lease. Updates
+// use the resource version of the lease, so concurrent acquisitions fail.
+type KubeLease struct {
+	Client    *http.Client
+	Host      string // e.g. https://10.0.0.1:443
+	Token     string
+	Namespace string
+	Name      string
+}
+
+// NewInClusterLease returns a lease lock which talks to the API server
+// using the service account of the pod. If namespace is empty the namespace
+// of the pod is used.
+func NewInClusterLease(namespace, name string) (*KubeLease, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a kubernetes cluster")
+	}
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("could not parse the cluster CA")
+	}
+	if namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	return &KubeLease{
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			},
+		},
+		Host:      "https://" + net.JoinHostPort(host, port),
+		Token:     strings.TrimSpace(string(token)),
+		Namespace: namespace,
+		Name:      name,
+	}, nil
+}
+
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions"`
+}
+
+// expired returns true if the holder did not renew the lease in time
+func (s *leaseSpec) expired(now time.Time) bool {
+	renewed, err := time.Parse(microTime, s.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(s.LeaseDurationSeconds) * time.Second))
+}
+
+// leaseSeconds returns the ttl in whole seconds, rounded up so that a lease
+// is never shorter than the ttl
+func leaseSeconds(ttl time.Duration) int {
+	return int((ttl + time.Second - 1) / time.Second)
+}
+
+// TryAcquire acquires or renews the lease
+func (k *KubeLease) TryAcquire(ctx context.Context, identity string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	l, err := k.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	if l == nil {
+		l = &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   leaseMetadata{Name: k.Name, Namespace: k.Namespace},
+			Spec: leaseSpec{
+				HolderIdentity:       identity,
+				LeaseDurationSeconds: leaseSeconds(ttl),
+				AcquireTime:          now.UTC().Format(microTime),
+				RenewTime:            now.UTC().Format(microTime),
+			},
+		}
+		return k.write(ctx, "POST", fmt.Sprintf(leasePath, k.Namespace), l)
+	}
+	holder := l.Spec.HolderIdentity
+	if holder != identity && holder != "" && !l.Spec.expired(now) {
+		return false, nil
+	}
+	if holder != identity {
+		l.Spec.HolderIdentity = identity
+		l.Spec.AcquireTime = now.UTC().Format(microTime)
+		l.Spec.LeaseTransitions++
+	}
+	l.Spec.LeaseDurationSeconds = leaseSeconds(ttl)
+	l.Spec.RenewTime = now.UTC().Format(microTime)
+	return k.write(ctx, "PUT", k.path(), l)
+}
+
+// Release gives up the lease if it is held by the identity
+func (k *KubeLease) Release(ctx context.Context, identity string) error {
+	l, err := k.get(ctx)
+	if err != nil || l == nil || l.Spec.HolderIdentity != identity {
+		return err
+	}
+	l.Spec.HolderIdentity = ""
+	l.Spec.LeaseDurationSeconds = 1
+	_, err = k.write(ctx, "PUT", k.path(), l)
+	return err
+}
+
+func (k *KubeLease) path() string {
+	return fmt.Sprintf(leasePath, k.Namespace) + "/" + k.Name
+}
+
+// get returns the lease, nil if it does not exist
+func (k *KubeLease) get(ctx context.Context) (*lease, error) {
+	res, err := k.do(ctx, "GET", k.path(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(res)
+	}
+	l := &lease{}
+	return l, json.NewDecoder(res.Body).Decode(l)
+}
+
+// write creates or updates the lease. It returns false if the lease
+// was modified concurrently.
+func (k *KubeLease) write(ctx context.Context, method, path string, l *lease) (bool, error) {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return false, err
+	}
+	res, err := k.do(ctx, method, path, b)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	}
+	return false, statusError(res)
+}
+
+func (k *KubeLease) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, k.Host+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.Token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c := k.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return c.Do(req)
+}
+
+func statusError(res *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("kubernetes: %s: %s", res.Status, bytes.TrimSpace(msg))
+}
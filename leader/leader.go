@@ -0,0 +1,117 @@
+// Package leader elects a single leader among runner replicas. Replicas
+// which are not the leader stay registered and warm but do not acquire tasks.
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	defaultLeaseDuration = 15 * time.Second
+	defaultRetryPeriod   = 2 * time.Second
+	releaseTimeout       = 5 * time.Second
+)
+
+// A Lock is a lease which is held by at most one identity at a time.
+type Lock interface {
+	// TryAcquire acquires the lock for the identity or renews it if the identity
+	// already holds it. It returns false if the lock is held by another identity.
+	TryAcquire(ctx context.Context, identity string, ttl time.Duration) (bool, error)
+	// Release releases the lock if it is held by the identity.
+	Release(ctx context.Context, identity string) error
+}
+
+// Elector periodically tries to acquire the lock and calls the callbacks
+// when it starts or stops leading.
+type Elector struct {
+	Lock     Lock
+	Identity string
+	// LeaseDuration is the time other replicas wait before taking over a lock which
+	// is not renewed, defaults to 15 seconds. The leader steps down if it could not
+	// renew the lock for two thirds of the lease duration.
+	LeaseDuration time.Duration
+	// RetryPeriod is the interval between attempts to acquire or renew the lock,
+	// defaults to 2 seconds.
+	RetryPeriod time.Duration
+
+	OnStartedLeading func()
+	OnStoppedLeading func()
+
+	leading int32
+}
+
+// New returns a new elector.
+func New(lock Lock, identity string) *Elector {
+	return &Elector{Lock: lock, Identity: identity}
+}
+
+// IsLeader returns true if the elector currently holds the lock
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leading) == 1
+}
+
+// Run takes part in the election until the context is canceled. The
+// lock is released on return if it is held.
+func (e *Elector) Run(ctx context.Context) {
+	lease := e.LeaseDuration
+	if lease <= 0 {
+		lease = defaultLeaseDuration
+	}
+	retry := e.RetryPeriod
+	if retry <= 0 {
+		retry = defaultRetryPeriod
+	}
+	var renewed time.Time
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+	for {
+		ok, err := e.Lock.TryAcquire(ctx, e.Identity, lease)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logrus.WithError(err).WithField("identity", e.Identity).Warnln("could not acquire leader lock")
+			if e.IsLeader() && time.Since(renewed) > lease*2/3 {
+				e.stop()
+			}
+		case ok:
+			renewed = time.Now()
+			e.start()
+		default:
+			e.stop()
+		}
+		select {
+		case <-ctx.Done():
+			if e.IsLeader() {
+				rctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+				if err := e.Lock.Release(rctx, e.Identity); err != nil {
+					logrus.WithError(err).Warnln("could not release leader lock")
+				}
+				cancel()
+				e.stop()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) start() {
+	if atomic.CompareAndSwapInt32(&e.leading, 0, 1) {
+		logrus.WithField("identity", e.Identity).Infoln("started leading")
+		if e.OnStartedLeading != nil {
+			e.OnStartedLeading()
+		}
+	}
+}
+
+func (e *Elector) stop() {
+	if atomic.CompareAndSwapInt32(&e.leading, 1, 0) {
+		logrus.WithField("identity", e.Identity).Infoln("stopped leading")
+		if e.OnStoppedLeading != nil {
+			e.OnStoppedLeading()
+		}
+	}
+}
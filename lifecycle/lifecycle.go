@@ -0,0 +1,228 @@
+// Package lifecycle runs a runner until it is stopped by a signal. The first
+// SIGINT or SIGTERM drains the poller so that running tasks complete, a second
+// one cancels them. Registered shutdown hooks run in order once the runner stopped.
+//
+// When started by systemd the lifecycle reports readiness and pings the
+// watchdog through sd_notify, on Windows it reports to the Service Control
+// Manager and handles its stop requests.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var defaultShutdownTimeout = 30 * time.Second
+
+// A Drainer stops acquiring new work and lets the running work complete,
+// e.g. a poller.
+type Drainer interface {
+	Drain()
+}
+
+// Hook is a shutdown hook
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	fn   Hook
+}
+
+// Lifecycle handles the signals and shutdown hooks of a runner.
+type Lifecycle struct {
+	Drainer Drainer // drained on the first signal, optional
+	// ShutdownTimeout is the deadline for all shutdown hooks, defaults to 30 seconds
+	ShutdownTimeout time.Duration
+	// Signals stop the runner, defaults to SIGINT and SIGTERM
+	Signals []os.Signal
+	// ServiceName is the name of the Windows service, defaults to dlite
+	ServiceName string
+
+	mu    sync.Mutex
+	hooks []namedHook
+	ready chan struct{}
+	once  sync.Once
+}
+
+// New returns a lifecycle which drains d on the first signal.
+func New(d Drainer) *Lifecycle {
+	return &Lifecycle{Drainer: d}
+}
+
+// OnShutdown registers a hook which runs once the runner stopped. Hooks
+// run in the order they are registered.
+func (l *Lifecycle) OnShutdown(name string, fn Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, namedHook{name: name, fn: fn})
+}
+
+// Ready marks the runner as started, e.g. once it registered with the
+// manager. It notifies systemd and the Windows Service Control Manager.
+func (l *Lifecycle) Ready() {
+	l.once.Do(func() {
+		close(l.readyChan())
+		if _, err := Notify("READY=1"); err != nil {
+			logrus.WithError(err).Warnln("could not notify systemd")
+		}
+	})
+}
+
+func (l *Lifecycle) readyChan() chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ready == nil {
+		l.ready = make(chan struct{})
+	}
+	return l.ready
+}
+
+func (l *Lifecycle) serviceName() string {
+	if l.ServiceName == "" {
+		return "dlite"
+	}
+	return l.ServiceName
+}
+
+// HookResult is the outcome of a shutdown hook
+type HookResult struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+}
+
+// Report is the final status of a runner
+type Report struct {
+	Signal   os.Signal // the first signal received, nil if the runner stopped on its own
+	Err      error     // returned by the run function
+	Hooks    []HookResult
+	Duration time.Duration
+}
+
+// OK returns true if the runner and all the hooks completed without error
+func (r *Report) OK() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, h := range r.Hooks {
+		if h.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "stopped after %s", r.Duration.Round(time.Millisecond))
+	if r.Signal != nil {
+		fmt.Fprintf(&b, " on %s", r.Signal)
+	}
+	if r.Err != nil {
+		fmt.Fprintf(&b, ", error: %s", r.Err)
+	}
+	for _, h := range r.Hooks {
+		if h.Err != nil {
+			fmt.Fprintf(&b, ", hook %s failed: %s", h.Name, h.Err)
+		}
+	}
+	return b.String()
+}
+
+// Run calls fn and handles the signals until it returns, then runs the
+// shutdown hooks. The context passed to fn is canceled on the second signal
+// or when ctx is done.
+func (l *Lifecycle) Run(ctx context.Context, fn func(ctx context.Context) error) *Report {
+	start := time.Now()
+	report := &Report{}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	signals := l.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+
+	var mu sync.Mutex
+	done := make(chan struct{})
+	serviceDone := make(chan struct{})
+	waitService, err := l.runService(ch, serviceDone)
+	if err != nil {
+		logrus.WithError(err).Warnln("could not connect to the service manager")
+	}
+	go watchdog(done)
+	go func() {
+		received := 0
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				received++
+				mu.Lock()
+				if report.Signal == nil {
+					report.Signal = sig
+				}
+				mu.Unlock()
+				if received == 1 && l.Drainer != nil {
+					logrus.WithField("signal", sig).Infoln("draining, send the signal again to stop immediately")
+					l.Drainer.Drain()
+					continue
+				}
+				logrus.WithField("signal", sig).Infoln("stopping")
+				cancel()
+			}
+		}
+	}()
+
+	err = fn(ctx)
+	close(done)
+	Notify("STOPPING=1") //nolint:errcheck
+
+	mu.Lock()
+	report.Err = err
+	mu.Unlock()
+	report.Hooks = l.shutdown()
+	report.Duration = time.Since(start)
+	close(serviceDone)
+	waitService()
+	return report
+}
+
+// shutdown runs the hooks in order within the shutdown timeout
+func (l *Lifecycle) shutdown() []HookResult {
+	timeout := l.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	l.mu.Lock()
+	hooks := append([]namedHook(nil), l.hooks...)
+	l.mu.Unlock()
+	results := make([]HookResult, 0, len(hooks))
+	for _, h := range hooks {
+		start := time.Now()
+		err := ctx.Err()
+		if err == nil {
+			err = h.fn(ctx)
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("hook", h.name).Errorln("shutdown hook failed")
+		}
+		results = append(results, HookResult{Name: h.name, Err: err, Duration: time.Since(start)})
+	}
+	return results
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package lifecycle
+
+import "os"
+
+// runService is a no-op outside of Windows
+func (l *Lifecycle) runService(stop chan<- os.Signal, done <-chan struct{}) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,60 @@
+//go:build windows
+// +build windows
+
+package lifecycle
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// runService reports the runner status to the Windows Service Control
+// Manager if the process runs as a service. Stop and shutdown requests are
+// delivered like signals. The returned function waits for the SCM handler
+// to exit after done is closed.
+func (l *Lifecycle) runService(stop chan<- os.Signal, done <-chan struct{}) (func(), error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return func() {}, err
+	}
+	exited := make(chan struct{})
+	h := &serviceHandler{ready: l.readyChan(), stop: stop, done: done}
+	go func() {
+		defer close(exited)
+		svc.Run(l.serviceName(), h) //nolint:errcheck
+	}()
+	return func() { <-exited }, nil
+}
+
+type serviceHandler struct {
+	ready <-chan struct{}
+	stop  chan<- os.Signal
+	done  <-chan struct{}
+}
+
+func (h *serviceHandler) Execute(_ []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+	s <- svc.Status{State: svc.StartPending}
+	ready := h.ready
+	for {
+		select {
+		case <-ready:
+			ready = nil
+			s <- svc.Status{State: svc.Running, Accepts: accepts}
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				s <- svc.Status{State: svc.StopPending}
+				select {
+				case h.stop <- os.Interrupt:
+				default:
+				}
+			}
+		case <-h.done:
+			return false, 0
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package limiter bounds the number of tasks executed concurrently on a host
+// by the pollers of several accounts running in one process. Every poller
+// draws a slot per task from the shared limiter. Accounts can be guaranteed
+// a minimum number of slots, which the other accounts can not take.
+package limiter
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Limiter is a pool of task slots shared by pollers
+type Limiter struct {
+	mu         sync.Mutex
+	capacity   int
+	guaranteed map[string]int
+	used       map[string]int
+	inUse      int
+}
+
+// New returns a limiter of capacity concurrent tasks
+func New(capacity int) *Limiter {
+	return &Limiter{
+		capacity:   capacity,
+		guaranteed: map[string]int{},
+		used:       map[string]int{},
+	}
+}
+
+// Guarantee reserves slots for the account. The guarantees of all the
+// accounts must not exceed the capacity.
+func (l *Limiter) Guarantee(account string, slots int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	total := slots
+	for a, n := range l.guaranteed {
+		if a != account {
+			total += n
+		}
+	}
+	if total > l.capacity {
+		return fmt.Errorf("limiter: guarantees of %d slots exceed the capacity of %d", total, l.capacity)
+	}
+	l.guaranteed[account] = slots
+	return nil
+}
+
+// TryAcquire takes up to n slots for the account and returns the number of
+// slots taken. It does not block.
+func (l *Limiter) TryAcquire(account string, n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	taken := 0
+	for ; taken < n && l.available(account) > 0; taken++ {
+		l.used[account]++
+		l.inUse++
+	}
+	return taken
+}
+
+// Release gives back n slots of the account
+func (l *Limiter) Release(account string, n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n > l.used[account] {
+		n = l.used[account]
+	}
+	l.used[account] -= n
+	l.inUse -= n
+	if l.used[account] == 0 {
+		delete(l.used, account)
+	}
+}
+
+// Available returns the number of slots the account can take
+func (l *Limiter) Available(account string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.available(account)
+}
+
+// available returns the unused guaranteed slots of the account plus the
+// shared slots which are not held back for the guarantees of other accounts
+func (l *Limiter) available(account string) int {
+	shared := l.capacity - l.inUse
+	own := 0
+	for a, g := range l.guaranteed {
+		if unused := g - l.used[a]; unused > 0 {
+			shared -= unused
+			if a == account {
+				own = unused
+			}
+		}
+	}
+	if shared < 0 {
+		shared = 0
+	}
+	return own + shared
+}
+
+// Usage is the slots used by an account
+type Usage struct {
+	Account    string `json:"account"`
+	Used       int    `json:"used"`
+	Guaranteed int    `json:"guaranteed,omitempty"`
+}
+
+// Usage returns the slots used per account, sorted by account
+func (l *Limiter) Usage() []Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seen := map[string]bool{}
+	var usage []Usage
+	for a, n := range l.used {
+		seen[a] = true
+		usage = append(usage, Usage{Account: a, Used: n, Guaranteed: l.guaranteed[a]})
+	}
+	for a, g := range l.guaranteed {
+		if !seen[a] {
+			usage = append(usage, Usage{Account: a, Guaranteed: g})
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Account < usage[j].Account })
+	return usage
+}
@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// Policy is the sampling policy of a class of log lines: the first First
+// lines of a period are logged, then every Thereafter-th line. If
+// Thereafter is zero, no other line is logged in the period.
+type Policy struct {
+	First      int
+	Thereafter int
+}
+
+// Sampler throttles repeated log lines, e.g. identical errors while the
+// manager is down. Lines are grouped in classes which can have their own policy.
+type Sampler struct {
+	// Default is the policy of the classes without their own policy. The
+	// lines of these classes are not sampled if it is zero.
+	Default  Policy
+	Policies map[string]Policy // per class, overrides Default
+	Period   time.Duration     // the counts are reset every period, defaults to a minute
+
+	mu     sync.Mutex
+	counts map[string]*sampleCount
+}
+
+type sampleCount struct {
+	start      time.Time
+	n          int
+	suppressed int
+}
+
+// NewSampler returns a sampler with the default policy
+func NewSampler(first, thereafter int, period time.Duration) *Sampler {
+	return &Sampler{
+		Default: Policy{First: first, Thereafter: thereafter},
+		Period:  period,
+	}
+}
+
+// Do calls fn if the line of the class should be logged. suppressed is the
+// number of lines of the class which were not logged since the last call of fn,
+// so that fn can summarize them. A nil sampler logs every line.
+func (s *Sampler) Do(class string, fn func(suppressed int)) {
+	if s == nil {
+		fn(0)
+		return
+	}
+	if ok, suppressed := s.allow(class, time.Now()); ok {
+		fn(suppressed)
+	}
+}
+
+func (s *Sampler) allow(class string, now time.Time) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts == nil {
+		s.counts = map[string]*sampleCount{}
+	}
+	period := s.Period
+	if period <= 0 {
+		period = time.Minute
+	}
+	c, ok := s.counts[class]
+	if !ok {
+		c = &sampleCount{start: now}
+		s.counts[class] = c
+	}
+	if now.Sub(c.start) >= period {
+		c.start = now
+		c.n = 0
+	}
+	c.n++
+	policy, ok := s.Policies[class]
+	if !ok {
+		policy = s.Default
+	}
+	if !ok && policy == (Policy{}) {
+		return true, 0
+	}
+	allowed := c.n <= policy.First ||
+		(policy.Thereafter > 0 && (c.n-policy.First)%policy.Thereafter == 0)
+	if !allowed {
+		c.suppressed++
+		return false, 0
+	}
+	suppressed := c.suppressed
+	c.suppressed = 0
+	return true, suppressed
+}
@@ -0,0 +1,87 @@
+// Package metadata carries the metadata of the task being executed in the
+// context handed to its handler, so that handlers and the libraries they call
+// can honor the task deadline and log consistently.
+package metadata
+
+import (
+	"context"
+	"time"
+)
+
+type key struct{}
+
+// Metadata describes the task being executed
+type Metadata struct {
+	TaskID        string
+	TaskType      string
+	AccountID     string
+	DelegateID    string
+	CorrelationID string
+	// Timeout is the time the task is allowed to run, zero if it is not limited
+	Timeout time.Duration
+	// Expiry is the time at which the task times out, zero if it does not
+	Expiry time.Time
+	// Attempt is the number of times the task was started. It is greater than 1
+	// if the task is executed again after a crash, so handlers which are not
+	// idempotent can check whether the previous attempt took effect.
+	Attempt int
+}
+
+// NewContext returns a copy of the context which carries the metadata
+func NewContext(ctx context.Context, m *Metadata) context.Context {
+	return context.WithValue(ctx, key{}, m)
+}
+
+// FromContext returns the metadata carried by the context, if any
+func FromContext(ctx context.Context) (*Metadata, bool) {
+	m, ok := ctx.Value(key{}).(*Metadata)
+	return m, ok
+}
+
+// TaskID returns the ID of the task carried by the context
+func TaskID(ctx context.Context) string {
+	if m, ok := FromContext(ctx); ok {
+		return m.TaskID
+	}
+	return ""
+}
+
+// AccountID returns the account of the task carried by the context
+func AccountID(ctx context.Context) string {
+	if m, ok := FromContext(ctx); ok {
+		return m.AccountID
+	}
+	return ""
+}
+
+// Expiry returns the time at which the task carried by the context times out
+func Expiry(ctx context.Context) (time.Time, bool) {
+	if m, ok := FromContext(ctx); ok && !m.Expiry.IsZero() {
+		return m.Expiry, true
+	}
+	return time.Time{}, false
+}
+
+// Redelivered reports whether the task carried by the context was already
+// started before, e.g. by a runner which crashed
+func Redelivered(ctx context.Context) bool {
+	m, ok := FromContext(ctx)
+	return ok && m.Attempt > 1
+}
+
+// Fields returns the metadata as log fields, e.g. for logrus.WithFields
+func Fields(ctx context.Context) map[string]interface{} {
+	m, ok := FromContext(ctx)
+	if !ok {
+		return map[string]interface{}{}
+	}
+	fields := map[string]interface{}{
+		"task_id":   m.TaskID,
+		"task_type": m.TaskType,
+		"account":   m.AccountID,
+	}
+	if m.CorrelationID != "" {
+		fields["correlation_id"] = m.CorrelationID
+	}
+	return fields
+}
@@ -0,0 +1,258 @@
+// Package metrics implements counters and gauges rendered in the Prometheus
+// text exposition format. Handlers emit custom metrics through the scope
+// carried by the context of their task, which is namespaced by task type.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric kinds
+const (
+	KindCounter = "counter"
+	KindGauge   = "gauge"
+)
+
+// Labels are the labels of a metric
+type Labels map[string]string
+
+// Registry holds the metrics
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	name, help, kind string
+	series           map[string]*value // by rendered labels
+}
+
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// Counter returns the counter with the name and labels, registering it on
+// first use. It returns nil, which discards the values, if the name is
+// invalid or already registered as a gauge.
+func (r *Registry) Counter(name, help string, labels Labels) *Counter {
+	v := r.value(name, help, KindCounter, labels)
+	if v == nil {
+		return nil
+	}
+	return &Counter{v: v}
+}
+
+// Gauge returns the gauge with the name and labels, registering it on first
+// use. It returns nil, which discards the values, if the name is invalid or
+// already registered as a counter.
+func (r *Registry) Gauge(name, help string, labels Labels) *Gauge {
+	v := r.value(name, help, KindGauge, labels)
+	if v == nil {
+		return nil
+	}
+	return &Gauge{v: v}
+}
+
+func (r *Registry) value(name, help, kind string, labels Labels) *value {
+	if r == nil || !validName(name) {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: kind, series: map[string]*value{}}
+		r.families[name] = f
+	}
+	if f.kind != kind {
+		return nil
+	}
+	key := renderLabels(labels)
+	v, ok := f.series[key]
+	if !ok {
+		v = &value{}
+		f.series[key] = v
+	}
+	return v
+}
+
+// WriteTo renders the metrics in the Prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		f := r.families[name]
+		if f.help != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		}
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := f.series[k]
+			v.mu.Lock()
+			fmt.Fprintf(&b, "%s%s %s\n", f.name, k, strconv.FormatFloat(v.v, 'g', -1, 64))
+			v.mu.Unlock()
+		}
+	}
+	r.mu.Unlock()
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Handler returns an http.Handler serving the metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.WriteTo(w)
+	})
+}
+
+// Counter is a value which only goes up
+type Counter struct {
+	v *value
+}
+
+// Inc increments the counter by 1
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds a non-negative delta to the counter
+func (c *Counter) Add(delta float64) {
+	if c == nil || delta < 0 {
+		return
+	}
+	c.v.mu.Lock()
+	c.v.v += delta
+	c.v.mu.Unlock()
+}
+
+// Gauge is a value which can go up and down
+type Gauge struct {
+	v *value
+}
+
+// Set sets the gauge
+func (g *Gauge) Set(v float64) {
+	if g == nil {
+		return
+	}
+	g.v.mu.Lock()
+	g.v.v = v
+	g.v.mu.Unlock()
+}
+
+// Add adds the delta to the gauge
+func (g *Gauge) Add(delta float64) {
+	if g == nil {
+		return
+	}
+	g.v.mu.Lock()
+	g.v.v += delta
+	g.v.mu.Unlock()
+}
+
+// Scope registers metrics with a common name prefix and labels
+type Scope struct {
+	registry *Registry
+	prefix   string
+	labels   Labels
+}
+
+// Scope returns a scope prefixing the metric names with prefix_
+func (r *Registry) Scope(prefix string, labels Labels) *Scope {
+	return &Scope{registry: r, prefix: Sanitize(prefix) + "_", labels: labels}
+}
+
+// Counter returns the counter with the name in the scope
+func (s *Scope) Counter(name, help string) *Counter {
+	if s == nil {
+		return nil
+	}
+	return s.registry.Counter(s.prefix+name, help, s.labels)
+}
+
+// Gauge returns the gauge with the name in the scope
+func (s *Scope) Gauge(name, help string) *Gauge {
+	if s == nil {
+		return nil
+	}
+	return s.registry.Gauge(s.prefix+name, help, s.labels)
+}
+
+type key struct{}
+
+// NewContext returns a copy of the context which carries the scope
+func NewContext(ctx context.Context, s *Scope) context.Context {
+	return context.WithValue(ctx, key{}, s)
+}
+
+// FromContext returns the scope carried by the context. Metrics of the nil
+// scope returned if there is none are discarded.
+func FromContext(ctx context.Context) *Scope {
+	s, _ := ctx.Value(key{}).(*Scope)
+	return s
+}
+
+// Sanitize replaces the characters which are not allowed in metric names
+func Sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(name))
+}
+
+func validName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	return Sanitize(name) == strings.ToLower(name)
+}
+
+func renderLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = Sanitize(k) + `="` + escapeLabel(labels[k]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
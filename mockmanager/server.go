@@ -0,0 +1,665 @@
+// Package mockmanager implements an in-process manager server which serves the
+// register, heartbeat, task events, acquire and status endpoints used by the
+// delegate client, optionally behind a gateway exchanging tokens. It allows end-to-end tests of dlite against a realistic
+// server with configurable latencies, error injection and task injection.
+package mockmanager
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/httphelper"
+)
+
+// Endpoints served by the mock manager
+const (
+	Register   = "register"
+	Heartbeat  = "heartbeat"
+	TaskEvents = "task-events"
+	Acquire    = "acquire"
+	// AcquireBatch is the batch acquire endpoint. It is served unless
+	// DisableBatchAcquire is called.
+	AcquireBatch = "acquire-batch"
+	Status       = "status"
+	// StatusBatch is the batched status endpoint. It is served unless
+	// DisableStatusBatch is called.
+	StatusBatch = "status-batch"
+	Upgrade     = "upgrade"
+	Reject      = "reject"
+	Lease       = "lease"
+	AckEvents   = "ack-events"
+	// TokenExchange is the gateway token exchange endpoint. It is served
+	// once EnableGateway is called.
+	TokenExchange = "token-exchange"
+)
+
+// gatewayExchangePath is the path of the gateway token exchange endpoint
+const gatewayExchangePath = "/gateway/api/agent/delegates/token-exchange"
+
+// fault is an injected error response
+type fault struct {
+	status int
+	times  int // number of requests to fail, 0 fails all requests
+	// lost makes the request take effect before the error is returned, like
+	// a response which is lost on its way to the runner
+	lost bool
+}
+
+// Server is a mock manager server
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	nextID        int
+	latency       map[string]time.Duration
+	faults        map[string]*fault
+	tasks         map[string]*client.Task
+	events        []client.TaskEvent
+	statuses      map[string][]*client.TaskResponse
+	registrations []*client.RegisterRequest
+	subscriptions map[string][]string // task types supported by each delegate
+	heartbeats    int
+	noBatch       bool
+	noStatusBatch bool
+	upgrade       string
+	rejections    map[string][]*client.RejectRequest
+	leases        map[string]int
+	waiters       map[string][]chan *client.TaskResponse
+	// idempotent holds the responses by idempotency key, which are replayed
+	// to retried requests
+	idempotent map[string]*recorded
+	replays    map[string]int
+	// gatewayTTL is the lifetime of the gateway sessions, the requests are
+	// authorized with delegate tokens if it is zero
+	gatewayTTL time.Duration
+	sessions   map[string]time.Time // expiry of the gateway sessions by token
+	exchanges  int
+	acks       []client.EventAck
+}
+
+// recorded is the response of an idempotent request
+type recorded struct {
+	status int
+	body   []byte
+}
+
+// New starts a mock manager server. It should be closed once it is no longer used.
+func New() *Server {
+	s := &Server{
+		latency:  map[string]time.Duration{},
+		faults:   map[string]*fault{},
+		tasks:    map[string]*client.Task{},
+		statuses: map[string][]*client.TaskResponse{},
+		waiters:  map[string][]chan *client.TaskResponse{},
+
+		subscriptions: map[string][]string{},
+
+		rejections: map[string][]*client.RejectRequest{},
+		leases:     map[string]int{},
+		idempotent: map[string]*recorded{},
+		replays:    map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// AddTask injects a task which is offered to the runners on their next poll
+func (s *Server) AddTask(t *client.Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[t.ID] = t
+	s.events = append(s.events, client.TaskEvent{TaskID: t.ID, TaskType: t.Type})
+}
+
+// ScheduleTask injects a task which must not run before the given time
+func (s *Server) ScheduleTask(t *client.Task, notBefore time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[t.ID] = t
+	s.events = append(s.events, client.TaskEvent{TaskID: t.ID, TaskType: t.Type, NotBefore: notBefore.UnixNano() / int64(time.Millisecond)})
+}
+
+// AddExpiringTask injects a task which expires at the given time
+func (s *Server) AddExpiringTask(t *client.Task, expiry time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[t.ID] = t
+	s.events = append(s.events, client.TaskEvent{TaskID: t.ID, TaskType: t.Type, Expiry: expiry.UnixNano() / int64(time.Millisecond)})
+}
+
+// AbortTask queues an abort event for the task
+func (s *Server) AbortTask(taskID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, client.TaskEvent{TaskID: taskID, Abort: true})
+}
+
+// SendControl queues a control message for the runners
+func (s *Server) SendControl(m *client.ControlMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, client.TaskEvent{Control: m})
+}
+
+// SetLatency delays every response of the endpoint by d
+func (s *Server) SetLatency(endpoint string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency[endpoint] = d
+}
+
+// InjectError makes the next n requests to the endpoint fail with the status
+// code. If n is 0 all requests fail until ClearErrors is called.
+func (s *Server) InjectError(endpoint string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[endpoint] = &fault{status: status, times: n}
+}
+
+// LoseResponses makes the next n requests to the endpoint take effect but
+// fail with the status code, as if the response was lost
+func (s *Server) LoseResponses(endpoint string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[endpoint] = &fault{status: status, times: n, lost: true}
+}
+
+// Replays returns the number of requests to the endpoint which were
+// recognized as retries by their idempotency key
+func (s *Server) Replays(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replays[endpoint]
+}
+
+// ClearErrors removes all injected errors
+func (s *Server) ClearErrors() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = map[string]*fault{}
+}
+
+// EnableGateway makes the server behave like a gateway in front of the
+// manager: the requests must be authorized with the session tokens issued
+// by the token exchange endpoint, which expire after ttl.
+func (s *Server) EnableGateway(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gatewayTTL = ttl
+	if s.sessions == nil {
+		s.sessions = map[string]time.Time{}
+	}
+}
+
+// RevokeSessions revokes all the gateway sessions issued so far
+func (s *Server) RevokeSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = map[string]time.Time{}
+}
+
+// Exchanges returns the number of gateway sessions issued
+func (s *Server) Exchanges() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exchanges
+}
+
+// DisableBatchAcquire makes the server respond to batch acquire requests
+// with 404 like a server which does not support them.
+func (s *Server) DisableBatchAcquire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noBatch = true
+}
+
+// DisableStatusBatch makes the server respond to batched status updates
+// with 404 like a server which does not support them.
+func (s *Server) DisableStatusBatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noStatusBatch = true
+}
+
+func (s *Server) statusBatchDisabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.noStatusBatch
+}
+
+func (s *Server) batchDisabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.noBatch
+}
+
+// RequireUpgrade makes the server ask runners which are not
+// running the version to upgrade to it.
+func (s *Server) RequireUpgrade(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upgrade = version
+}
+
+// Rejections returns the rejections received for a task
+func (s *Server) Rejections(taskID string) []*client.RejectRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*client.RejectRequest(nil), s.rejections[taskID]...)
+}
+
+// Acks returns the task event acknowledgments received
+func (s *Server) Acks() []client.EventAck {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]client.EventAck(nil), s.acks...)
+}
+
+// LeaseRenewals returns the number of lease renewals received for a task
+func (s *Server) LeaseRenewals(taskID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leases[taskID]
+}
+
+// Registrations returns the register requests received by the server
+func (s *Server) Registrations() []*client.RegisterRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*client.RegisterRequest(nil), s.registrations...)
+}
+
+// Heartbeats returns the number of heartbeats received by the server
+func (s *Server) Heartbeats() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.heartbeats
+}
+
+// Statuses returns all the statuses received for a task
+func (s *Server) Statuses(taskID string) []*client.TaskResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*client.TaskResponse(nil), s.statuses[taskID]...)
+}
+
+// WaitForStatus blocks until a status is received for the task or the context is done
+func (s *Server) WaitForStatus(ctx context.Context, taskID string) (*client.TaskResponse, error) {
+	s.mu.Lock()
+	if st := s.statuses[taskID]; len(st) > 0 {
+		s.mu.Unlock()
+		return st[len(st)-1], nil
+	}
+	ch := make(chan *client.TaskResponse, 1)
+	s.waiters[taskID] = append(s.waiters[taskID], ch)
+	s.mu.Unlock()
+	select {
+	case r := <-ch:
+		return r, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		httphelper.WriteJSON(w, map[string]string{"error": "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		body, err := gzip.NewReader(r.Body)
+		if err != nil {
+			httphelper.WriteBadRequest(w, err)
+			return
+		}
+		r.Body = body
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == "POST" && r.URL.Path == gatewayExchangePath && s.gateway():
+		s.handle(w, TokenExchange, func(w http.ResponseWriter) { s.exchange(w) })
+	case r.Method == "POST" && r.URL.Path == "/api/agent/delegates/register":
+		s.handle(w, Register, func(w http.ResponseWriter) { s.register(w, r) })
+	case r.Method == "POST" && r.URL.Path == "/api/agent/delegates/heartbeat-with-polling":
+		s.handle(w, Heartbeat, func(w http.ResponseWriter) { s.heartbeat(w, r) })
+	case r.Method == "GET" && match(parts, "api", "agent", "delegates", "*", "task-events"):
+		s.handle(w, TaskEvents, func(w http.ResponseWriter) { s.taskEvents(w, r, parts[3]) })
+	case r.Method == "GET" && match(parts, "api", "agent", "delegates", "*", "upgrade"):
+		s.handle(w, Upgrade, func(w http.ResponseWriter) { s.checkUpgrade(w, r) })
+	case r.Method == "POST" && match(parts, "api", "agent", "v2", "delegates", "*", "task-events", "ack"):
+		s.handle(w, AckEvents, func(w http.ResponseWriter) { s.ackEvents(w, r) })
+	case r.Method == "PUT" && match(parts, "api", "agent", "v2", "delegates", "*", "tasks", "acquire") && !s.batchDisabled():
+		s.handle(w, AcquireBatch, func(w http.ResponseWriter) { s.acquireBatch(w, r) })
+	case r.Method == "POST" && match(parts, "api", "agent", "v2", "delegates", "*", "tasks", "status") && !s.statusBatchDisabled():
+		s.handleIdempotent(w, r, StatusBatch, func(w http.ResponseWriter) { s.statusBatch(w, r) })
+	case r.Method == "PUT" && match(parts, "api", "agent", "v2", "delegates", "*", "tasks", "*", "acquire"):
+		s.handleIdempotent(w, r, Acquire, func(w http.ResponseWriter) { s.acquire(w, parts[6]) })
+	case r.Method == "POST" && match(parts, "api", "agent", "v2", "tasks", "*", "delegates", "*", "reject"):
+		s.handle(w, Reject, func(w http.ResponseWriter) { s.reject(w, r, parts[4]) })
+	case r.Method == "PUT" && match(parts, "api", "agent", "v2", "tasks", "*", "delegates", "*", "lease"):
+		s.handle(w, Lease, func(w http.ResponseWriter) { s.renewLease(w, parts[4]) })
+	case r.Method == "POST" && match(parts, "api", "agent", "v2", "tasks", "*", "delegates", "*"):
+		s.handleIdempotent(w, r, Status, func(w http.ResponseWriter) { s.status(w, r, parts[4]) })
+	default:
+		httphelper.WriteNotFound(w, fmt.Errorf("no such endpoint: %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// gateway reports whether the server behaves like a gateway
+func (s *Server) gateway() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gatewayTTL > 0
+}
+
+// authorized checks the delegate token of the request, or its gateway
+// session token if the server behaves like a gateway
+func (s *Server) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !s.gateway() || r.URL.Path == gatewayExchangePath {
+		return strings.HasPrefix(auth, "Delegate ")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiry, ok := s.sessions[strings.TrimPrefix(auth, "Bearer ")]
+	return ok && time.Now().Before(expiry)
+}
+
+// exchange issues a gateway session token
+func (s *Server) exchange(w http.ResponseWriter) {
+	s.mu.Lock()
+	s.exchanges++
+	token := fmt.Sprintf("session-%d", s.exchanges)
+	s.sessions[token] = time.Now().Add(s.gatewayTTL)
+	ttl := s.gatewayTTL
+	s.mu.Unlock()
+	httphelper.WriteJSON(w, &client.TokenExchangeResponse{Token: token, ExpiresIn: int64((ttl + time.Second - 1) / time.Second)}, http.StatusOK)
+}
+
+// handle applies the configured latency and injected errors for the endpoint
+func (s *Server) handle(w http.ResponseWriter, endpoint string, fn func(http.ResponseWriter)) {
+	s.mu.Lock()
+	d := s.latency[endpoint]
+	f := s.faults[endpoint]
+	status := 0
+	if f != nil {
+		status = f.status
+		if f.times > 0 {
+			f.times--
+			if f.times == 0 {
+				delete(s.faults, endpoint)
+			}
+		}
+	}
+	s.mu.Unlock()
+	time.Sleep(d)
+	if status != 0 {
+		if f.lost {
+			fn(httptest.NewRecorder())
+		}
+		w.WriteHeader(status)
+		return
+	}
+	fn(w)
+}
+
+// handleIdempotent is like handle but replays the recorded response to
+// requests whose idempotency key was seen before
+func (s *Server) handleIdempotent(w http.ResponseWriter, r *http.Request, endpoint string, fn func(http.ResponseWriter)) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		s.handle(w, endpoint, fn)
+		return
+	}
+	s.handle(w, endpoint, func(w http.ResponseWriter) {
+		s.mu.Lock()
+		rec, ok := s.idempotent[key]
+		if ok {
+			s.replays[endpoint]++
+		}
+		s.mu.Unlock()
+		if ok {
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(rec.status)
+			w.Write(rec.body)
+			return
+		}
+		rw := httptest.NewRecorder()
+		fn(rw)
+		if rw.Code < 300 {
+			s.mu.Lock()
+			s.idempotent[key] = &recorded{status: rw.Code, body: rw.Body.Bytes()}
+			s.mu.Unlock()
+		}
+		for k, v := range rw.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rw.Code)
+		w.Write(rw.Body.Bytes())
+	})
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	req := &client.RegisterRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		httphelper.WriteBadRequest(w, err)
+		return
+	}
+	s.mu.Lock()
+	s.nextID++
+	id := fmt.Sprintf("delegate-%d", s.nextID)
+	s.registrations = append(s.registrations, req)
+	s.subscriptions[id] = req.SupportedTaskTypes
+	s.mu.Unlock()
+	httphelper.WriteJSON(w, &client.RegisterResponse{Resource: client.RegistrationData{DelegateID: id}}, 200)
+}
+
+func (s *Server) heartbeat(w http.ResponseWriter, r *http.Request) {
+	req := &client.RegisterRequest{}
+	_ = json.NewDecoder(r.Body).Decode(req)
+	s.mu.Lock()
+	s.heartbeats++
+	// keep-alive packets do not carry the supported task types
+	if !req.KeepAlivePacket && req.ID != "" {
+		s.subscriptions[req.ID] = req.SupportedTaskTypes
+	}
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) checkUpgrade(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	version := s.upgrade
+	s.mu.Unlock()
+	current := r.URL.Query().Get("delegateVersion")
+	resp := &client.UpgradeResponse{Resource: client.UpgradeData{
+		Upgrade: version != "" && version != current,
+		Version: version,
+	}}
+	httphelper.WriteJSON(w, resp, 200)
+}
+
+// emptyEventsETag is the ETag of a response without events
+const emptyEventsETag = `"empty"`
+
+// taskEvents serves the queued events. Served events are removed from the queue,
+// so the page token only signals that more events are available. Responses without
+// events carry an ETag, so that polls of idle runners can be answered with 304.
+func (s *Server) taskEvents(w http.ResponseWriter, r *http.Request, delegateID string) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	resp := &client.TaskEventsResponse{}
+	s.mu.Lock()
+	var kept []client.TaskEvent
+	for _, ev := range s.events {
+		if (limit <= 0 || len(resp.TaskEvents) < limit) && s.subscribed(delegateID, ev) {
+			resp.TaskEvents = append(resp.TaskEvents, ev)
+		} else {
+			kept = append(kept, ev)
+		}
+	}
+	s.events = kept
+	if len(resp.TaskEvents) == 0 {
+		s.mu.Unlock()
+		w.Header().Set("ETag", emptyEventsETag)
+		if r.Header.Get("If-None-Match") == emptyEventsETag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		httphelper.WriteJSON(w, resp, 200)
+		return
+	}
+	if limit > 0 && len(resp.TaskEvents) == limit && len(s.events) > 0 {
+		resp.NextPageToken = "next"
+	}
+	s.mu.Unlock()
+	httphelper.WriteJSON(w, resp, 200)
+}
+
+// subscribed reports whether the event is offered to the delegate. Events of
+// tasks whose type is not supported by the delegate are left to other runners.
+func (s *Server) subscribed(delegateID string, ev client.TaskEvent) bool {
+	types, ok := s.subscriptions[delegateID]
+	t := s.tasks[ev.TaskID]
+	if !ok || ev.Control != nil || ev.Abort || t == nil {
+		return true
+	}
+	for _, typ := range types {
+		if typ == t.Type {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) acquire(w http.ResponseWriter, taskID string) {
+	s.mu.Lock()
+	t, ok := s.tasks[taskID]
+	delete(s.tasks, taskID)
+	s.mu.Unlock()
+	if !ok {
+		httphelper.WriteNotFound(w, fmt.Errorf("task %s is not available", taskID))
+		return
+	}
+	httphelper.WriteJSON(w, t, 200)
+}
+
+func (s *Server) acquireBatch(w http.ResponseWriter, r *http.Request) {
+	req := &client.AcquireBatchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		httphelper.WriteBadRequest(w, err)
+		return
+	}
+	resp := &client.AcquireBatchResponse{}
+	s.mu.Lock()
+	for _, id := range req.TaskIDs {
+		if t, ok := s.tasks[id]; ok {
+			delete(s.tasks, id)
+			resp.Tasks = append(resp.Tasks, t)
+		}
+	}
+	s.mu.Unlock()
+	httphelper.WriteJSON(w, resp, 200)
+}
+
+// reject records the rejection. The task is not offered again since
+// the runners of the mock server all share the same capabilities.
+func (s *Server) reject(w http.ResponseWriter, r *http.Request, taskID string) {
+	req := &client.RejectRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		httphelper.WriteBadRequest(w, err)
+		return
+	}
+	s.mu.Lock()
+	s.rejections[taskID] = append(s.rejections[taskID], req)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) renewLease(w http.ResponseWriter, taskID string) {
+	s.mu.Lock()
+	s.leases[taskID]++
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ackEvents records the acknowledgments and prunes the acknowledged events
+func (s *Server) ackEvents(w http.ResponseWriter, r *http.Request) {
+	req := &client.AckEventsRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		httphelper.WriteBadRequest(w, err)
+		return
+	}
+	s.mu.Lock()
+	s.acks = append(s.acks, req.Acks...)
+	acked := map[string]bool{}
+	for _, a := range req.Acks {
+		acked[a.TaskID] = true
+	}
+	events := s.events[:0]
+	for _, ev := range s.events {
+		if !acked[ev.TaskID] {
+			events = append(events, ev)
+		}
+	}
+	s.events = events
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request, taskID string) {
+	resp := &client.TaskResponse{}
+	if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+		httphelper.WriteBadRequest(w, err)
+		return
+	}
+	s.mu.Lock()
+	s.addStatus(taskID, resp)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) statusBatch(w http.ResponseWriter, r *http.Request) {
+	req := &client.StatusBatchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		httphelper.WriteBadRequest(w, err)
+		return
+	}
+	s.mu.Lock()
+	for _, resp := range req.Responses {
+		s.addStatus(resp.ID, resp)
+	}
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addStatus records the status and wakes up the waiters. s.mu must be held.
+func (s *Server) addStatus(taskID string, resp *client.TaskResponse) {
+	s.statuses[taskID] = append(s.statuses[taskID], resp)
+	for _, ch := range s.waiters[taskID] {
+		ch <- resp
+	}
+	delete(s.waiters, taskID)
+}
+
+// match reports whether the path segments match the pattern, where * matches any segment
+func match(parts []string, pattern ...string) bool {
+	if len(parts) != len(pattern) {
+		return false
+	}
+	for i := range parts {
+		if pattern[i] != "*" && pattern[i] != parts[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+// Package platform describes the platform of the runner host and matches it
+// against the platform requirements of tasks.
+package platform
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// MismatchCode is the rejection code of tasks whose platform requirements
+// are not met by the host
+const MismatchCode = "PLATFORM_MISMATCH"
+
+// sockets are the container engine sockets checked for the container capability
+var sockets = []string{"/var/run/docker.sock", "/run/podman/podman.sock"}
+
+// Host returns the platform of the runner host
+func Host() client.Platform {
+	return client.Platform{
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Container: containers(),
+	}
+}
+
+// containers reports whether the host can run containers
+func containers() bool {
+	for _, bin := range []string{"docker", "podman"} {
+		if _, err := exec.LookPath(bin); err == nil {
+			return true
+		}
+	}
+	for _, s := range sockets {
+		if _, err := os.Stat(s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Mismatch returns the requirements which are not met by the host, empty if
+// all of them are. Requirements which are not set match any host.
+func Mismatch(host client.Platform, req *client.Platform) []string {
+	if req == nil {
+		return nil
+	}
+	var unmet []string
+	if req.OS != "" && !strings.EqualFold(req.OS, host.OS) {
+		unmet = append(unmet, fmt.Sprintf("os %s, host is %s", req.OS, host.OS))
+	}
+	if req.Arch != "" && !strings.EqualFold(req.Arch, host.Arch) {
+		unmet = append(unmet, fmt.Sprintf("arch %s, host is %s", req.Arch, host.Arch))
+	}
+	if req.Container && !host.Container {
+		unmet = append(unmet, "container capability")
+	}
+	return unmet
+}
@@ -0,0 +1,289 @@
+// Package plugins runs task handlers in external binaries. A plugin is started
+// as a child process and serves its handlers over HTTP on a unix socket, so new
+// task types can be shipped without recompiling dlite and a crashing handler
+// does not take down the runner. Plugins are written with Serve.
+package plugins
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/task"
+)
+
+const (
+	// protocolVersion is the version of the handshake and of the HTTP protocol
+	protocolVersion = "1"
+	// magicEnv is set for plugin processes so that Serve can tell
+	// whether the binary was started by dlite.
+	magicEnv   = "DLITE_PLUGIN_MAGIC"
+	magicValue = "2a6e1f4f0b1c4d3c"
+	socketEnv  = "DLITE_PLUGIN_SOCKET"
+	// tasksPath is the path prefix of the task handlers served by a plugin
+	tasksPath = "/tasks/"
+)
+
+var (
+	defaultStartTimeout = 10 * time.Second
+	// restartGrace is the time to wait for a plugin which refuses connections to exit
+	restartGrace = time.Second
+)
+
+// Plugin is a plugin binary. The process is started on Load and restarted on the
+// next task if it exits.
+type Plugin struct {
+	Path string
+	Args []string
+	// StartTimeout is the time the plugin has to complete the handshake, defaults to 10 seconds
+	StartTimeout time.Duration
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	dir    string
+	types  []string
+	client *http.Client
+	exited chan struct{}
+	closed bool
+	logs   *io.PipeWriter // logs the output of the plugin across restarts
+}
+
+// Load starts the plugin binary and reads the task types it serves.
+func Load(path string, args ...string) (*Plugin, error) {
+	p := &Plugin{Path: path, Args: args}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.start(); err != nil {
+		if p.logs != nil {
+			p.logs.Close()
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// Types returns the task types served by the plugin
+func (p *Plugin) Types() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.types...)
+}
+
+// Handlers returns a handler for every task type served by the plugin
+func (p *Plugin) Handlers() map[string]task.Handler {
+	handlers := map[string]task.Handler{}
+	for _, t := range p.Types() {
+		handlers[t] = &handler{plugin: p, taskType: t}
+	}
+	return handlers
+}
+
+// Close stops the plugin process
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.stop()
+	if p.logs != nil {
+		p.logs.Close()
+	}
+	return nil
+}
+
+// start starts the plugin process and waits for the handshake. p.mu must be held.
+func (p *Plugin) start() error {
+	dir, err := os.MkdirTemp("", "dlite-plugin")
+	if err != nil {
+		return err
+	}
+	socket := filepath.Join(dir, "plugin.sock")
+	cmd := exec.Command(p.Path, p.Args...) //nolint:gosec
+	cmd.Env = append(os.Environ(), magicEnv+"="+magicValue, socketEnv+"="+socket)
+	cmd.Stderr = p.logWriter()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("could not start plugin %s: %w", p.Path, err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		logrus.WithError(err).WithField("plugin", p.Path).Warnln("plugin exited")
+		close(exited)
+	}()
+
+	types, err := p.handshake(stdout, exited)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		os.RemoveAll(dir)
+		return err
+	}
+	p.cmd, p.dir, p.types, p.exited = cmd, dir, types, exited
+	p.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	logrus.WithField("plugin", p.Path).WithField("types", types).Infoln("started plugin")
+	return nil
+}
+
+// handshake reads the first line written by the plugin, which is
+// <protocol version>|<comma separated task types>. Everything the
+// plugin writes to stdout afterwards is logged.
+func (p *Plugin) handshake(stdout io.Reader, exited <-chan struct{}) ([]string, error) {
+	timeout := p.StartTimeout
+	if timeout <= 0 {
+		timeout = defaultStartTimeout
+	}
+	lines := make(chan string, 1)
+	r := bufio.NewReader(stdout)
+	logs := p.logWriter()
+	go func() {
+		line, _ := r.ReadString('\n')
+		lines <- strings.TrimSpace(line)
+		_, _ = io.Copy(logs, r)
+	}()
+	var line string
+	select {
+	case line = <-lines:
+	case <-exited:
+		return nil, fmt.Errorf("plugin %s exited before completing the handshake", p.Path)
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("plugin %s did not complete the handshake within %s", p.Path, timeout)
+	}
+	version, types, ok := strings.Cut(line, "|")
+	if !ok {
+		return nil, fmt.Errorf("plugin %s sent an invalid handshake: %q", p.Path, line)
+	}
+	if version != protocolVersion {
+		return nil, fmt.Errorf("plugin %s uses protocol version %s, expected %s", p.Path, version, protocolVersion)
+	}
+	if types == "" {
+		return nil, fmt.Errorf("plugin %s does not serve any task types", p.Path)
+	}
+	return strings.Split(types, ","), nil
+}
+
+// stop kills the plugin process. p.mu must be held.
+func (p *Plugin) stop() {
+	if p.cmd == nil {
+		return
+	}
+	_ = p.cmd.Process.Kill()
+	<-p.exited
+	os.RemoveAll(p.dir)
+	p.cmd = nil
+}
+
+// awaitExit waits up to d for the plugin process to exit and reports whether it did
+func (p *Plugin) awaitExit(d time.Duration) bool {
+	p.mu.Lock()
+	exited := p.exited
+	p.mu.Unlock()
+	if exited == nil {
+		return false
+	}
+	select {
+	case <-exited:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// http returns the client of the running plugin, restarting it if it exited
+func (p *Plugin) http() (*http.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, errors.New("plugin is closed")
+	}
+	if p.cmd != nil {
+		select {
+		case <-p.exited:
+			os.RemoveAll(p.dir)
+			p.cmd = nil
+		default:
+			return p.client, nil
+		}
+	}
+	if err := p.start(); err != nil {
+		return nil, err
+	}
+	return p.client, nil
+}
+
+// logWriter returns the writer logging the output of the plugin. It is
+// created once, as every writer runs a goroutine until it is closed.
+// p.mu must be held.
+func (p *Plugin) logWriter() io.Writer {
+	if p.logs == nil {
+		p.logs = logrus.WithField("plugin", filepath.Base(p.Path)).WriterLevel(logrus.InfoLevel)
+	}
+	return p.logs
+}
+
+// handler forwards tasks of a type to the plugin
+type handler struct {
+	plugin   *Plugin
+	taskType string
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		task.WriteError(w, err)
+		return
+	}
+	res, err := h.forward(r, body)
+	// the plugin may have crashed while handling a previous task,
+	// in which case it is restarted and the task is sent again.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && h.plugin.awaitExit(restartGrace) {
+		res, err = h.forward(r, body)
+	}
+	if err != nil {
+		task.WriteError(w, task.NewError("PLUGIN_FAILED", client.CategoryInfrastructure, "task plugin failed", true, err))
+		return
+	}
+	defer res.Body.Close()
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	_, _ = io.Copy(w, res.Body)
+}
+
+func (h *handler) forward(r *http.Request, body []byte) (*http.Response, error) {
+	c, err := h.plugin.http()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(r.Context(), "POST", "http://plugin"+tasksPath+h.taskType, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	return c.Do(req)
+}
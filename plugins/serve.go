@@ -0,0 +1,40 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/wings-software/dlite/task"
+)
+
+// ErrNotPlugin is returned by Serve if the binary was not started by dlite
+var ErrNotPlugin = errors.New("this binary is a dlite plugin and is started by dlite")
+
+// Serve serves the task handlers of a plugin binary. It is called from the main
+// function of the plugin and blocks until the listener fails or dlite stops the plugin.
+func Serve(handlers map[string]task.Handler) error {
+	if os.Getenv(magicEnv) != magicValue {
+		return ErrNotPlugin
+	}
+	socket := os.Getenv(socketEnv)
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	mux := http.NewServeMux()
+	types := make([]string, 0, len(handlers))
+	for t, h := range handlers {
+		mux.Handle(tasksPath+t, h)
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	fmt.Fprintf(os.Stdout, "%s|%s\n", protocolVersion, strings.Join(types, ","))
+	return http.Serve(l, mux) //nolint:gosec
+}
@@ -0,0 +1,52 @@
+package poller
+
+import (
+	"context"
+	"sync"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// eventAcks collects the acknowledgments of the task events until they are
+// sent after the poll cycle
+type eventAcks struct {
+	mu   sync.Mutex
+	acks []client.EventAck
+}
+
+// ack queues the acknowledgment of the task event if it was handled or the
+// task was already claimed. The server drops acknowledged events, so skipped
+// and deferred events are not acknowledged, they are left to other runners
+// or to the next poll cycle.
+func (p *Poller) ack(ev client.TaskEvent, action, reason string) {
+	if !p.AckEvents || p.DryRun || ev.TaskID == "" {
+		return
+	}
+	a := client.EventAck{TaskID: ev.TaskID}
+	switch action {
+	case DecisionAcquired, DecisionAborted, DecisionRejected:
+		a.Handled = true
+	case DecisionDeduped:
+		a.Reason = reason
+	default:
+		return
+	}
+	p.acks.mu.Lock()
+	p.acks.acks = append(p.acks.acks, a)
+	p.acks.mu.Unlock()
+}
+
+// flushAcks sends the queued acknowledgments in a single call. The
+// acknowledgments of the executors are sent after the next poll cycle.
+func (p *Poller) flushAcks(ctx context.Context, delegateID string) {
+	p.acks.mu.Lock()
+	acks := p.acks.acks
+	p.acks.acks = nil
+	p.acks.mu.Unlock()
+	if len(acks) == 0 {
+		return
+	}
+	if err := p.Client.AckEvents(ctx, delegateID, acks); err != nil {
+		p.logError("ack", err, nil, "could not acknowledge %d task events", len(acks))
+	}
+}
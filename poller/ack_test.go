@@ -0,0 +1,149 @@
+package poller
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/client/clienttest"
+	"github.com/wings-software/dlite/router"
+	"github.com/wings-software/dlite/task"
+)
+
+// sentAcks returns the acknowledgments sent with the fake client
+func sentAcks(f *clienttest.Fake) [][]client.EventAck {
+	var out [][]client.EventAck
+	for _, c := range f.Calls() {
+		if c.Method == "AckEvents" {
+			out = append(out, c.Args[1].([]client.EventAck))
+		}
+	}
+	return out
+}
+
+func TestAckDecisions(t *testing.T) {
+	tests := []struct {
+		action  string
+		acked   bool
+		handled bool
+	}{
+		{action: DecisionAcquired, acked: true, handled: true},
+		{action: DecisionAborted, acked: true, handled: true},
+		{action: DecisionRejected, acked: true, handled: true},
+		{action: DecisionDeduped, acked: true},
+		{action: DecisionSkipped},
+		{action: DecisionDeferred},
+	}
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			f := clienttest.New()
+			p := NewWithOptions("account", "secret", f, nil, WithEventAcks())
+			p.decide(client.TaskEvent{TaskID: "t1"}, test.action, "reason")
+			p.flushAcks(context.Background(), "delegate")
+
+			sent := sentAcks(f)
+			if !test.acked {
+				if len(sent) != 0 {
+					t.Fatalf("expected no acknowledgments, got %v", sent)
+				}
+				return
+			}
+			if len(sent) != 1 || len(sent[0]) != 1 {
+				t.Fatalf("expected a single acknowledgment, got %v", sent)
+			}
+			if a := sent[0][0]; a.TaskID != "t1" || a.Handled != test.handled {
+				t.Errorf("unexpected acknowledgment %+v", a)
+			}
+		})
+	}
+}
+
+func TestAckDisabled(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"disabled": nil,
+		"dry run":  {WithEventAcks(), func(p *Poller) { p.DryRun = true }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := clienttest.New()
+			p := NewWithOptions("account", "secret", f, nil, opts...)
+			p.decide(client.TaskEvent{TaskID: "t1"}, DecisionAcquired, "")
+			p.flushAcks(context.Background(), "delegate")
+			if sent := sentAcks(f); len(sent) != 0 {
+				t.Errorf("expected no acknowledgments, got %v", sent)
+			}
+		})
+	}
+}
+
+func TestAckFlushBatches(t *testing.T) {
+	f := clienttest.New()
+	p := NewWithOptions("account", "secret", f, nil, WithEventAcks())
+	p.decideAll([]client.TaskEvent{{TaskID: "t1"}, {TaskID: "t2"}}, DecisionAcquired, "")
+	p.decide(client.TaskEvent{TaskID: "t3"}, DecisionDeduped, "the task was already claimed")
+	p.flushAcks(context.Background(), "delegate")
+	p.flushAcks(context.Background(), "delegate")
+
+	sent := sentAcks(f)
+	if len(sent) != 1 {
+		t.Fatalf("expected a single call, got %d", len(sent))
+	}
+	if len(sent[0]) != 3 {
+		t.Fatalf("expected 3 acknowledgments, got %v", sent[0])
+	}
+	if a := sent[0][2]; a.TaskID != "t3" || a.Handled || a.Reason == "" {
+		t.Errorf("unexpected acknowledgment %+v", a)
+	}
+}
+
+// The events which are left while all the executors are busy must stay
+// available, so that they are acquired once an executor is free.
+func TestAckBusyExecutorsDefer(t *testing.T) {
+	f := clienttest.New()
+	release := make(chan struct{})
+	var started int32
+	r := router.NewRouter(map[string]task.Handler{
+		"test": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&started, 1)
+			<-release
+			w.Write([]byte(`{}`))
+		}),
+	})
+	p := NewWithOptions("account", "secret", f, r, WithEventAcks())
+	f.AddTask(&client.Task{ID: "t1", Type: "test"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- p.Poll(ctx, 1, "delegate", 10*time.Millisecond) }()
+	for atomic.LoadInt32(&started) == 0 {
+		if ctx.Err() != nil {
+			t.Fatal("the first task was not started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	f.AddTask(&client.Task{ID: "t2", Type: "test"})
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	cancel()
+	<-done
+
+	for _, acks := range sentAcks(f) {
+		for _, a := range acks {
+			if a.TaskID == "t2" {
+				t.Errorf("the event of a task which was left while the executors were busy was acknowledged: %+v", a)
+			}
+		}
+	}
+	var acked bool
+	for _, acks := range sentAcks(f) {
+		for _, a := range acks {
+			acked = acked || (a.TaskID == "t1" && a.Handled)
+		}
+	}
+	if !acked {
+		t.Error("the acquired task was not acknowledged")
+	}
+}
@@ -0,0 +1,57 @@
+package poller
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/audit"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/events"
+)
+
+// newAuditRecord returns the audit record of a task which starts executing
+func (p *Poller) newAuditRecord(delegateID string, ev client.TaskEvent, t *client.Task) *audit.Record {
+	account := ev.AccountID
+	if account == "" {
+		account = p.AccountID
+	}
+	return &audit.Record{
+		TaskID:     t.ID,
+		TaskType:   t.Type,
+		AccountID:  account,
+		DelegateID: delegateID,
+		AcquiredAt: time.Now(),
+		Status:     audit.StatusError,
+	}
+}
+
+// writeAudit completes the record and writes it to the audit sink
+func (p *Poller) writeAudit(r *audit.Record, err error) {
+	if p.Audit == nil {
+		return
+	}
+	r.DurationMs = time.Since(r.AcquiredAt).Milliseconds()
+	if err != nil {
+		r.Status = audit.StatusError
+		r.Error = err.Error()
+	}
+	if werr := p.Audit.Write(r); werr != nil {
+		logrus.WithError(werr).WithField("task_id", r.TaskID).Errorln("could not write audit record")
+	}
+}
+
+// publishFinished publishes the outcome of the task described by the record
+func (p *Poller) publishFinished(r *audit.Record, err error) {
+	status := r.Status
+	if err != nil {
+		status = audit.StatusError
+	}
+	p.Events.Publish(events.Event{
+		Type:     events.TaskFinished,
+		TaskID:   r.TaskID,
+		TaskType: r.TaskType,
+		Status:   status,
+		Duration: time.Since(r.AcquiredAt),
+		Err:      err,
+	})
+}
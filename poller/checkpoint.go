@@ -0,0 +1,45 @@
+package poller
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/checkpoint"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/store"
+)
+
+// withCheckpoints returns a copy of the context which carries the checkpoints
+// of the task, if the store keeps checkpoints
+func (p *Poller) withCheckpoints(ctx context.Context, t *client.Task) (context.Context, *checkpoint.Checkpoints) {
+	s, ok := p.Store.(store.Checkpointer)
+	if !ok {
+		return ctx, nil
+	}
+	c, err := checkpoint.New(ctx, s, t.ID)
+	if err != nil {
+		logrus.WithError(err).WithField("task_id", t.ID).Warnln("could not load task checkpoint")
+	}
+	if cp, ok := c.Last(); ok {
+		logrus.WithField("task_id", t.ID).WithField("stage", cp.Stage).
+			WithField("sequence", cp.Sequence).Infoln("resuming task from checkpoint")
+	}
+	return checkpoint.NewContext(ctx, c), c
+}
+
+// resumeInfo returns the checkpoint the task resumed from, nil if it started
+// from the beginning
+func resumeInfo(c *checkpoint.Checkpoints, attempt int) *client.ResumeInfo {
+	cp, ok := c.Last()
+	if !ok {
+		return nil
+	}
+	return &client.ResumeInfo{Stage: cp.Stage, Sequence: cp.Sequence, CheckpointedAt: cp.SavedAt, Attempt: attempt}
+}
+
+// clearCheckpoints removes the checkpoints of a task once its final status was sent
+func clearCheckpoints(c *checkpoint.Checkpoints, taskID string) {
+	if err := c.Clear(context.Background()); err != nil {
+		logrus.WithError(err).WithField("task_id", taskID).Warnln("could not remove task checkpoint")
+	}
+}
@@ -0,0 +1,41 @@
+package poller
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+)
+
+// control applies a configuration change pushed by the server
+func (p *Poller) control(m *client.ControlMessage) {
+	logrus.Infoln("received control message from the server")
+	if m.Pause != nil {
+		var v int32
+		if *m.Pause {
+			v = 1
+		}
+		if atomic.SwapInt32(&p.suspend, v) != v {
+			logrus.WithField("paused", *m.Pause).Infoln("server changed the poller state")
+		}
+	}
+	if m.Parallelism > 0 {
+		p.SetParallelism(m.Parallelism)
+	}
+	if m.PollInterval > 0 {
+		p.SetPollInterval(time.Duration(m.PollInterval) * time.Millisecond)
+	}
+	if m.Tags != nil {
+		p.SetTags(m.Tags)
+	}
+	if p.OnControl != nil {
+		p.OnControl(m)
+	}
+}
+
+// suspended returns true if the server paused the poller. Unlike a paused
+// poller, a suspended poller keeps polling so that it can be resumed.
+func (p *Poller) suspended() bool {
+	return atomic.LoadInt32(&p.suspend) == 1
+}
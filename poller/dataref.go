@@ -0,0 +1,48 @@
+package poller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/wings-software/dlite/artifact"
+	"github.com/wings-software/dlite/client"
+)
+
+// errInvalidDataRef is returned when referenced task data is not JSON
+var errInvalidDataRef = errors.New("referenced task data is not valid JSON")
+
+// resolveDataRef downloads the data of a task which refers to it by URL, so
+// that the handler receives the data inline. The reference is removed.
+func (p *Poller) resolveDataRef(ctx context.Context, t *client.Task) error {
+	if t.DataRef == nil {
+		return nil
+	}
+	d := p.Downloader
+	if d == nil {
+		d = artifact.NewDownloader()
+	}
+	data, err := d.Get(ctx, t.DataRef.URL, t.DataRef.Size, t.DataRef.SHA256)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(data) {
+		return errInvalidDataRef
+	}
+	t.Data, t.DataRef = data, nil
+	return nil
+}
+
+// dataRefError is the error of tasks whose data could not be downloaded.
+// Data which is too large, corrupt or invalid fails on every runner.
+func dataRefError(err error) *client.TaskError {
+	var checksum *artifact.ChecksumError
+	permanent := errors.As(err, &checksum) || errors.Is(err, artifact.ErrTooLarge) || errors.Is(err, errInvalidDataRef)
+	return &client.TaskError{
+		Code:      "PAYLOAD_FETCH_FAILED",
+		Category:  client.CategoryInfrastructure,
+		Message:   fmt.Sprintf("could not download the task data: %s", err),
+		Retryable: !permanent,
+	}
+}
@@ -0,0 +1,157 @@
+package poller
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/metrics"
+)
+
+// defaultEstimateWeight is the weight of the latest execution time in the
+// moving average
+const defaultEstimateWeight = 0.2
+
+// queueWaitHalfLife is the time after which the average queue wait is halved
+// when no work waited for an executor, so that a past burst does not keep the
+// poller from acquiring tasks once the executors are free
+const queueWaitHalfLife = 30 * time.Second
+
+// Estimator estimates the execution time of tasks, so that the poller can
+// leave the tasks which would miss their expiry to other runners
+type Estimator interface {
+	// Estimate returns the expected execution time of the task of the
+	// event, zero if it is not known
+	Estimate(ev client.TaskEvent) time.Duration
+	// Observe records the execution time of a finished task of the type
+	Observe(taskType string, d time.Duration)
+}
+
+// MovingAverage estimates the execution time of a task as the exponentially
+// weighted moving average of the execution times of the tasks of its type.
+// The events which do not carry the task type are estimated with the average
+// of all the tasks. The estimate is zero until a matching task finished.
+type MovingAverage struct {
+	// Weight is the weight of the latest execution time, defaults to 0.2
+	Weight float64
+
+	mu  sync.Mutex
+	avg map[string]time.Duration
+	all time.Duration // average of the tasks of all types
+}
+
+// NewMovingAverage returns an estimator averaging the execution times by task type
+func NewMovingAverage() *MovingAverage {
+	return &MovingAverage{Weight: defaultEstimateWeight, avg: map[string]time.Duration{}}
+}
+
+// Estimate returns the average execution time of the tasks of the event type
+func (m *MovingAverage) Estimate(ev client.TaskEvent) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ev.TaskType == "" {
+		return m.all
+	}
+	return m.avg[ev.TaskType]
+}
+
+// Observe adds the execution time to the average of the task type
+func (m *MovingAverage) Observe(taskType string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.avg == nil {
+		m.avg = map[string]time.Duration{}
+	}
+	w := m.Weight
+	if w <= 0 || w > 1 {
+		w = defaultEstimateWeight
+	}
+	if m.all == 0 {
+		m.all = d
+	} else {
+		m.all = time.Duration(w*float64(d) + (1-w)*float64(m.all))
+	}
+	avg, ok := m.avg[taskType]
+	if !ok {
+		m.avg[taskType] = d
+		return
+	}
+	m.avg[taskType] = time.Duration(w*float64(d) + (1-w)*float64(avg))
+}
+
+// meetsDeadline returns false if the task of the event would not complete
+// before its expiry, after the current queue wait and its estimated
+// execution time
+func (p *Poller) meetsDeadline(ev client.TaskEvent) bool {
+	if p.Estimator == nil || ev.Expiry == 0 {
+		return true
+	}
+	wait, estimate := p.queueWait(), p.Estimator.Estimate(ev)
+	expiry := time.Unix(0, ev.Expiry*int64(time.Millisecond))
+	if !time.Now().Add(wait + estimate).After(expiry) {
+		return true
+	}
+	logrus.WithField("task_id", ev.TaskID).WithField("task_type", ev.TaskType).
+		Debugf("task would not complete before it expires at %s, queue wait %s, estimated execution time %s, leaving it to other runners",
+			expiry.Format(time.RFC3339), wait, estimate)
+	p.decide(ev, DecisionSkipped, fmt.Sprintf("would miss its expiry at %s, queue wait %s, estimated execution time %s",
+		expiry.Format(time.RFC3339), wait, estimate))
+	if p.Metrics != nil {
+		p.Metrics.Counter("dlite_task_events_skipped_total", "Task events left to other runners by reason.",
+			metrics.Labels{"reason": "deadline"}).Inc()
+	}
+	return false
+}
+
+// waitAverage is the moving average of the time work waits for an executor.
+// It decays while no work is observed.
+type waitAverage struct {
+	mu  sync.Mutex
+	avg time.Duration
+	at  time.Time // time of the last observation
+}
+
+// observe adds the wait to the average
+func (a *waitAverage) observe(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	a.avg = time.Duration(defaultEstimateWeight*float64(d) + (1-defaultEstimateWeight)*float64(a.decayed(now)))
+	a.at = now
+}
+
+// get returns the average, decayed since the last observation
+func (a *waitAverage) get() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.decayed(time.Now())
+}
+
+func (a *waitAverage) decayed(now time.Time) time.Duration {
+	if a.avg == 0 {
+		return 0
+	}
+	halves := float64(now.Sub(a.at)) / float64(queueWaitHalfLife)
+	return time.Duration(float64(a.avg) * math.Pow(0.5, halves))
+}
+
+// observeQueueWait adds the time acquired work waited for an executor to
+// the moving average of the queue wait
+func (p *Poller) observeQueueWait(d time.Duration) {
+	p.queueWaits.observe(d)
+}
+
+// queueWait returns the average time acquired work waits for an executor
+func (p *Poller) queueWait() time.Duration {
+	return p.queueWaits.get()
+}
+
+// observeExecution records the execution time of the finished task
+func (p *Poller) observeExecution(taskType string, acquired time.Time) {
+	if p.Estimator != nil {
+		p.Estimator.Observe(taskType, time.Since(acquired))
+	}
+}
@@ -0,0 +1,110 @@
+package poller
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/httphelper"
+)
+
+// defaultDecisionLogSize is the number of decisions kept by a DecisionLog
+const defaultDecisionLogSize = 500
+
+// Actions of the scheduling decisions about task events
+const (
+	DecisionAcquired = "acquired" // the task was acquired
+	DecisionSkipped  = "skipped"  // the event was left to other runners
+	DecisionDeferred = "deferred" // the event was left to the next poll cycle
+	DecisionDeduped  = "deduped"  // the task was already claimed by this runner or a replica
+	DecisionRejected = "rejected" // the task was acquired and rejected
+	DecisionAborted  = "aborted"  // the event aborted a running task
+)
+
+// Decision records what the poller did with a task event and why
+type Decision struct {
+	Time     time.Time `json:"time"`
+	TaskID   string    `json:"task_id"`
+	TaskType string    `json:"task_type,omitempty"`
+	Action   string    `json:"action"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// DecisionLog keeps the most recent scheduling decisions of the poller,
+// which are also logged as debug records
+type DecisionLog struct {
+	mu        sync.Mutex
+	decisions []Decision
+	next      int
+	size      int
+}
+
+// NewDecisionLog returns a log of the last size decisions, 500 if size is
+// not positive
+func NewDecisionLog(size int) *DecisionLog {
+	if size <= 0 {
+		size = defaultDecisionLogSize
+	}
+	return &DecisionLog{size: size}
+}
+
+func (l *DecisionLog) add(d Decision) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.decisions) < l.size {
+		l.decisions = append(l.decisions, d)
+		return
+	}
+	l.decisions[l.next] = d
+	l.next = (l.next + 1) % l.size
+}
+
+// Decisions returns the kept decisions, oldest first
+func (l *DecisionLog) Decisions() []Decision {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append(append([]Decision{}, l.decisions[l.next:]...), l.decisions[:l.next]...)
+}
+
+// Handler returns an http.Handler which renders the decisions as JSON
+func (l *DecisionLog) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httphelper.WriteJSON(w, l.Decisions(), http.StatusOK)
+	})
+}
+
+// decide records the decision about the task event if the decisions are
+// traced, and acknowledges the event if it is final
+func (p *Poller) decide(ev client.TaskEvent, action, reason string) {
+	p.ack(ev, action, reason)
+	if p.Decisions == nil {
+		return
+	}
+	d := Decision{Time: time.Now(), TaskID: ev.TaskID, TaskType: ev.TaskType, Action: action, Reason: reason}
+	p.Decisions.add(d)
+	e := logrus.WithFields(logrus.Fields{
+		"task_id":   d.TaskID,
+		"task_type": d.TaskType,
+		"decision":  d.Action,
+	})
+	if d.Reason == "" {
+		e.Debugf("task event %s %s", d.TaskID, d.Action)
+		return
+	}
+	e.WithField("reason", d.Reason).Debugf("task event %s %s: %s", d.TaskID, d.Action, d.Reason)
+}
+
+// decideAll records the same decision about all the task events
+func (p *Poller) decideAll(evs []client.TaskEvent, action, reason string) {
+	if p.Decisions == nil && !p.AckEvents {
+		return
+	}
+	for _, ev := range evs {
+		p.decide(ev, action, reason)
+	}
+}
@@ -0,0 +1,153 @@
+package poller
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// delayQueue holds acquired tasks whose events carry a not-before time
+// and hands them to the executors once they are due.
+type delayQueue struct {
+	mu     sync.Mutex
+	items  delayHeap
+	closed bool
+	wake   chan struct{}
+	done   chan struct{} // closed once the queue stopped
+}
+
+func newDelayQueue() *delayQueue {
+	return &delayQueue{
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+// notBefore returns the time before which the work must not run, or the zero time
+func notBefore(w work) time.Time {
+	if w.ev.NotBefore <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, w.ev.NotBefore*int64(time.Millisecond))
+}
+
+// hold queues the work until its not-before time. It returns false if the
+// work is already due or the queue stopped.
+func (q *delayQueue) hold(w work) bool {
+	at := notBefore(w)
+	if !at.After(time.Now()) {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	w.scheduled = true
+	heap.Push(&q.items, delayed{w: w, at: at})
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// len returns the number of held tasks
+func (q *delayQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// run hands the due work to out until the context is canceled. Once drain is
+// closed, it stops as soon as all the held work was handed out.
+func (q *delayQueue) run(ctx context.Context, out chan<- work, drain <-chan struct{}) {
+	defer close(q.done)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	draining := false
+	for {
+		q.mu.Lock()
+		due, next := q.due(time.Now())
+		if draining && len(q.items) == 0 && len(due) == 0 {
+			q.closed = true
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+		for _, w := range due {
+			select {
+			case out <- w:
+			case <-ctx.Done():
+				q.stop()
+				return
+			}
+		}
+		if len(due) > 0 {
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next)
+		select {
+		case <-ctx.Done():
+			q.stop()
+			return
+		case <-drain:
+			drain = nil
+			draining = true
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// due pops the work which is due and returns the time until the next one
+func (q *delayQueue) due(now time.Time) ([]work, time.Duration) {
+	var due []work
+	for len(q.items) > 0 {
+		if wait := q.items[0].at.Sub(now); wait > 0 {
+			return due, wait
+		}
+		due = append(due, heap.Pop(&q.items).(delayed).w)
+	}
+	return due, time.Hour
+}
+
+// stop drops the held work, the server reassigns the tasks once their leases expire
+func (q *delayQueue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	if len(q.items) > 0 {
+		logrus.Warnf("dropping %d scheduled tasks", len(q.items))
+	}
+	q.items = nil
+}
+
+type delayed struct {
+	w  work
+	at time.Time
+}
+
+// delayHeap orders the held work by not-before time
+type delayHeap []delayed
+
+func (h delayHeap) Len() int            { return len(h) }
+func (h delayHeap) Less(i, j int) bool  { return h[i].at.Before(h[j].at) }
+func (h delayHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *delayHeap) Push(x interface{}) { *h = append(*h, x.(delayed)) }
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,42 @@
+package poller
+
+import (
+	"context"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// fetchEvents polls the server for task events. If EventsPageSize or MaxEventsPerCycle
+// is set, the events are fetched page by page, up to MaxEventsPerCycle events per cycle.
+func (p *Poller) fetchEvents(ctx context.Context, id string) (*client.TaskEventsResponse, error) {
+	size := p.EventsPageSize
+	if size <= 0 {
+		size = p.MaxEventsPerCycle
+	}
+	if size <= 0 {
+		return p.Client.GetTaskEvents(ctx, id)
+	}
+	all := &client.TaskEventsResponse{}
+	token := ""
+	for {
+		limit := size
+		if p.MaxEventsPerCycle > 0 {
+			remaining := p.MaxEventsPerCycle - len(all.TaskEvents)
+			if remaining <= 0 {
+				return all, nil
+			}
+			if remaining < limit {
+				limit = remaining
+			}
+		}
+		page, err := p.Client.GetTaskEventsPage(ctx, id, token, limit)
+		if err != nil {
+			return all, err
+		}
+		all.TaskEvents = append(all.TaskEvents, page.TaskEvents...)
+		if page.NextPageToken == "" || len(page.TaskEvents) == 0 {
+			return all, nil
+		}
+		token = page.NextPageToken
+	}
+}
@@ -0,0 +1,99 @@
+package poller
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// Fairness orders the polled task events by weighted round-robin over their
+// task types, so that a backlog of one type does not starve the other types.
+// Every type gets its weight of consecutive turns, events of the same type
+// keep their order and events without a type are one type.
+type Fairness struct {
+	// Weights are the turns of the task types, defaults to 1
+	Weights map[string]int
+
+	mu     sync.Mutex
+	last   string // type acquired last
+	served int    // number of consecutive events of last acquired
+}
+
+// NewFairness returns a fair scheduler with the weights of the task types
+func NewFairness(weights map[string]int) *Fairness {
+	return &Fairness{Weights: weights}
+}
+
+// weight returns the turns of the task type
+func (f *Fairness) weight(taskType string) int {
+	if w := f.Weights[taskType]; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// order returns the events in the order they should be acquired, resuming
+// the round-robin where the previous acquisitions left it. A nil Fairness
+// keeps the order of the events.
+func (f *Fairness) order(evs []client.TaskEvent) []client.TaskEvent {
+	if f == nil || len(evs) < 2 {
+		return evs
+	}
+	groups := map[string][]client.TaskEvent{}
+	var types []string
+	for _, ev := range evs {
+		if _, ok := groups[ev.TaskType]; !ok {
+			types = append(types, ev.TaskType)
+		}
+		groups[ev.TaskType] = append(groups[ev.TaskType], ev)
+	}
+	if len(types) == 1 {
+		return evs
+	}
+	sort.Strings(types)
+
+	f.mu.Lock()
+	last, served := f.last, f.served
+	f.mu.Unlock()
+	// continue with the last type if it has turns left, otherwise with the next one
+	i := sort.SearchStrings(types, last)
+	turns := 0
+	switch {
+	case i < len(types) && types[i] == last && served < f.weight(last):
+		turns = f.weight(last) - served
+	case i < len(types) && types[i] == last:
+		i++
+	}
+	ordered := make([]client.TaskEvent, 0, len(evs))
+	for len(ordered) < len(evs) {
+		t := types[i%len(types)]
+		if turns == 0 {
+			turns = f.weight(t)
+		}
+		n := turns
+		if n > len(groups[t]) {
+			n = len(groups[t])
+		}
+		ordered = append(ordered, groups[t][:n]...)
+		groups[t] = groups[t][n:]
+		turns = 0
+		i++
+	}
+	return ordered
+}
+
+// acquired records that an event of the task type was acquired
+func (f *Fairness) acquired(taskType string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if taskType == f.last {
+		f.served++
+		return
+	}
+	f.last = taskType
+	f.served = 1
+}
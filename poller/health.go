@@ -0,0 +1,95 @@
+package poller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/events"
+)
+
+// Health is the state of the connection of the runner to the server,
+// derived from the outcome of the heartbeats.
+type Health string
+
+// Health states
+const (
+	// Healthy runners sent their last heartbeat successfully
+	Healthy Health = "HEALTHY"
+	// Degraded runners failed to send their last heartbeats
+	Degraded Health = "DEGRADED"
+	// Disconnected runners failed to send heartbeats for longer than DisconnectAfter
+	Disconnected Health = "DISCONNECTED"
+)
+
+var (
+	// defaultDisconnectAfter is the default time after which failing heartbeats disconnect the runner
+	defaultDisconnectAfter = time.Minute
+
+	// heartbeatMaxBackoff bounds the interval between failing heartbeats
+	heartbeatMaxBackoff = time.Minute
+)
+
+// health tracks the health state of the runner
+type health struct {
+	mu          sync.Mutex
+	state       Health
+	failures    int       // number of consecutive heartbeat failures
+	lastSuccess time.Time // time of the last successful heartbeat or registration
+}
+
+// Health returns the health state of the runner. It is empty until the runner registered.
+func (p *Poller) Health() Health {
+	h, _ := p.healthState()
+	return h
+}
+
+// healthy marks the runner as healthy, e.g. after it registered
+func (p *Poller) healthy() {
+	p.recordHeartbeat(nil)
+}
+
+// recordHeartbeat moves the runner to the health state following the
+// outcome of a heartbeat and calls OnHealthChange if the state changed.
+func (p *Poller) recordHeartbeat(err error) {
+	h := &p.health
+	h.mu.Lock()
+	from := h.state
+	if err == nil {
+		h.failures = 0
+		h.lastSuccess = time.Now()
+		h.state = Healthy
+	} else {
+		h.failures++
+		after := p.DisconnectAfter
+		if after <= 0 {
+			after = defaultDisconnectAfter
+		}
+		h.state = Degraded
+		if time.Since(h.lastSuccess) >= after {
+			h.state = Disconnected
+		}
+	}
+	to, failures := h.state, h.failures
+	h.mu.Unlock()
+	if from == to {
+		return
+	}
+	entry := logrus.WithField("from", from).WithField("to", to).WithField("failures", failures)
+	if to == Healthy {
+		entry.Infoln("runner health changed")
+	} else {
+		entry.Warnln("runner health changed")
+	}
+	p.Events.Publish(events.Event{Type: events.HealthChanged, Status: string(to)})
+	if p.OnHealthChange != nil {
+		p.OnHealthChange(from, to)
+	}
+}
+
+// healthState returns the health state and the number of consecutive heartbeat failures
+func (p *Poller) healthState() (Health, int) {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	return p.health.state, p.health.failures
+}
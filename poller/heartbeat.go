@@ -0,0 +1,54 @@
+package poller
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// heartbeats decides whether a heartbeat carries the full registration
+// payload or is a keep-alive packet.
+type heartbeats struct {
+	poller   *Poller
+	lastSum  [sha256.Size]byte
+	lastFull time.Time
+	full     bool // whether the last heartbeat was a full one
+	failed   bool // whether the last heartbeat failed
+}
+
+// next refreshes the registration payload and returns the heartbeat to send
+func (h *heartbeats) next(req *client.RegisterRequest) *client.RegisterRequest {
+	types := append([]string(nil), h.poller.Router.Routes()...)
+	sort.Strings(types)
+	req.SupportedTaskTypes = types
+	req.Tags = h.poller.tags()
+
+	b, _ := json.Marshal(req)
+	sum := sha256.Sum256(b)
+	every := h.poller.FullHeartbeatInterval
+	h.full = every <= 0 || h.failed || sum != h.lastSum || time.Since(h.lastFull) >= every
+	if h.full {
+		h.lastSum = sum
+		return req
+	}
+	return &client.RegisterRequest{
+		AccountID:       req.AccountID,
+		ID:              req.ID,
+		DelegateName:    req.DelegateName,
+		NG:              req.NG,
+		Polling:         req.Polling,
+		KeepAlivePacket: true,
+	}
+}
+
+// sent records the outcome of the heartbeat returned by next. A full
+// heartbeat is sent after a failure.
+func (h *heartbeats) sent(err error) {
+	h.failed = err != nil
+	if h.full && err == nil {
+		h.lastFull = time.Now()
+	}
+}
@@ -0,0 +1,55 @@
+package poller
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/scheduler"
+)
+
+// maxIdleCheckInterval is the maximum time between two idle checks
+const maxIdleCheckInterval = 10 * time.Second
+
+// touch records that the poller acquired a task
+func (p *Poller) touch() {
+	atomic.StoreInt64(&p.lastActivity, time.Now().UnixNano())
+}
+
+// idleFor returns the time since the poller last acquired a task
+func (p *Poller) idleFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&p.lastActivity)))
+}
+
+// idleCheckInterval returns the time between two idle checks
+func (p *Poller) idleCheckInterval() time.Duration {
+	every := p.IdleTimeout / 4
+	if every > maxIdleCheckInterval {
+		every = maxIdleCheckInterval
+	}
+	return every
+}
+
+// checkIdle drains the poller once no task has been acquired for IdleTimeout.
+// OnIdle can veto the drain, in which case the idle period starts over.
+func (p *Poller) checkIdle(context.Context) error {
+	if p.Draining() {
+		return scheduler.ErrStop
+	}
+	if atomic.LoadInt32(&p.inflight) > 0 || len(p.Daemons.Running()) > 0 {
+		p.touch()
+		return nil
+	}
+	idle := p.idleFor()
+	if idle < p.IdleTimeout {
+		return nil
+	}
+	if p.OnIdle != nil && !p.OnIdle(idle) {
+		p.touch()
+		return nil
+	}
+	logrus.WithField("idle", idle.Round(time.Second)).Infoln("no tasks acquired within the idle timeout")
+	p.Drain()
+	return scheduler.ErrStop
+}
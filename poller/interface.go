@@ -0,0 +1,36 @@
+package poller
+
+import (
+	"context"
+	"time"
+)
+
+var _ Interface = (*Poller)(nil)
+
+// Interface is implemented by Poller. Embedders can wrap, decorate or fully
+// replace the poller, e.g. with a poller consuming tasks from a message
+// queue. An Interface can be passed to lifecycle.New as its Drainer, and
+// the callbacks of a leader.Elector can call Promote and Standby.
+type Interface interface {
+	// Register registers the runner with the server
+	Register(ctx context.Context) (*DelegateInfo, error)
+
+	// Poll polls for tasks with n workers until the context is done
+	Poll(ctx context.Context, n int, id string, interval time.Duration) error
+
+	// Drain stops accepting tasks, so that the running tasks can complete
+	Drain()
+
+	// Pause and Resume stop and restart accepting tasks
+	Pause()
+	Resume()
+	Paused() bool
+
+	// Standby and Promote move the runner to and from warm standby
+	Standby()
+	Promote()
+	InStandby() bool
+
+	// Stats returns the stats of the poller
+	Stats() Stats
+}
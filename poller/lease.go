@@ -0,0 +1,21 @@
+package poller
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// renewLeases returns a job which renews the lease on every task which is being executed
+func (p *Poller) renewLeases(delegateID string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		p.leases.Range(func(k, _ interface{}) bool {
+			taskID := k.(string)
+			if err := p.Client.RenewLease(ctx, delegateID, taskID); err != nil {
+				logrus.WithError(err).WithField("task_id", taskID).Warnln("could not renew task lease")
+			}
+			return true
+		})
+		return nil
+	}
+}
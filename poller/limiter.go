@@ -0,0 +1,22 @@
+package poller
+
+// takeSlots takes up to n task slots from the shared limiter and returns the
+// number of slots taken
+func (p *Poller) takeSlots(n int) int {
+	if p.Limiter == nil {
+		return n
+	}
+	return p.Limiter.TryAcquire(p.AccountID, n)
+}
+
+// releaseSlots gives back task slots to the shared limiter
+func (p *Poller) releaseSlots(n int) {
+	if p.Limiter != nil {
+		p.Limiter.Release(p.AccountID, n)
+	}
+}
+
+// slotsAvailable returns true if the shared limiter has a task slot left
+func (p *Poller) slotsAvailable() bool {
+	return p.Limiter == nil || p.Limiter.Available(p.AccountID) > 0
+}
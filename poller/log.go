@@ -0,0 +1,17 @@
+package poller
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// logError logs the error unless the sampler suppresses it. The number of
+// suppressed errors of the class is added to the next logged one.
+func (p *Poller) logError(class string, err error, fields logrus.Fields, format string, args ...interface{}) {
+	p.LogSampler.Do(class, func(suppressed int) {
+		e := logrus.WithError(err).WithFields(fields)
+		if suppressed > 0 {
+			e = e.WithField("suppressed", suppressed)
+		}
+		e.Errorf(format, args...)
+	})
+}
@@ -0,0 +1,29 @@
+package poller
+
+import (
+	"context"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/metadata"
+)
+
+// withMetadata returns the context of the task handler. It carries the task
+// metadata and expires once the task timed out.
+func withMetadata(ctx context.Context, accountID, delegateID, correlationID string, t *client.Task, attempt int) (context.Context, context.CancelFunc) {
+	m := &metadata.Metadata{
+		TaskID:        t.ID,
+		TaskType:      t.Type,
+		AccountID:     accountID,
+		DelegateID:    delegateID,
+		CorrelationID: correlationID,
+		Timeout:       time.Duration(t.Timeout) * time.Millisecond,
+		Attempt:       attempt,
+	}
+	ctx = metadata.NewContext(ctx, m)
+	if m.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	m.Expiry = time.Now().Add(m.Timeout)
+	return context.WithDeadline(ctx, m.Expiry)
+}
@@ -0,0 +1,35 @@
+package poller
+
+import (
+	"context"
+	"time"
+
+	"github.com/wings-software/dlite/audit"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/metrics"
+)
+
+// withMetrics returns a copy of the context which carries the metrics scope
+// of the task type, through which the handler emits custom metrics
+func (p *Poller) withMetrics(ctx context.Context, t *client.Task) context.Context {
+	if p.Metrics == nil {
+		return ctx
+	}
+	return metrics.NewContext(ctx, p.Metrics.Scope("dlite_task_"+t.Type, nil))
+}
+
+// observeTask records the outcome and the duration of an executed task
+func (p *Poller) observeTask(r *audit.Record, err error) {
+	if p.Metrics == nil {
+		return
+	}
+	status := r.Status
+	if err != nil {
+		status = audit.StatusError
+	}
+	p.Metrics.Counter("dlite_tasks_total", "Tasks executed by type and status.",
+		metrics.Labels{"task_type": r.TaskType, "status": status}).Inc()
+	labels := metrics.Labels{"task_type": r.TaskType}
+	p.Metrics.Counter("dlite_task_duration_seconds_total", "Total time spent executing tasks by type.", labels).
+		Add(time.Since(r.AcquiredAt).Seconds())
+}
@@ -0,0 +1,206 @@
+package poller
+
+import (
+	"time"
+
+	"github.com/wings-software/dlite/admission"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/daemon"
+	"github.com/wings-software/dlite/limiter"
+	"github.com/wings-software/dlite/router"
+	"github.com/wings-software/dlite/spool"
+)
+
+// Option configures a Poller
+type Option func(*Poller)
+
+// NewWithOptions returns a poller configured by the options
+func NewWithOptions(accountID, accountSecret string, c client.Client, r router.Router, opts ...Option) *Poller {
+	// the client is switched on Restart
+	sw := client.NewSwitch(c)
+	p := &Poller{
+		AccountID:     accountID,
+		AccountSecret: accountSecret,
+		Client:        sw,
+		Router:        r,
+		Daemons:       daemon.NewManager(sw, daemonLeaseInterval),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// WithName sets the name of the runner
+func WithName(name string) Option {
+	return func(p *Poller) {
+		p.Name = name
+	}
+}
+
+// WithTags sets the tags the runner accepts
+func WithTags(tags ...string) Option {
+	return func(p *Poller) {
+		p.Tags = tags
+	}
+}
+
+// WithGroup sets the delegate group the runner belongs to
+func WithGroup(group string) Option {
+	return func(p *Poller) {
+		p.Group = group
+	}
+}
+
+// WithScope scopes the runner to an organization and optionally a project
+func WithScope(orgID, projectID string) Option {
+	return func(p *Poller) {
+		p.OrgID = orgID
+		p.ProjectID = projectID
+	}
+}
+
+// WithImmutable marks the runner as an immutable delegate
+func WithImmutable() Option {
+	return func(p *Poller) {
+		p.Immutable = true
+	}
+}
+
+// WithSpool stores the statuses which could not be sent
+func WithSpool(s *spool.Spool) Option {
+	return func(p *Poller) {
+		p.Spool = s
+	}
+}
+
+// WithMaxPollInterval lets the poller back off up to the interval while idle
+func WithMaxPollInterval(d time.Duration) Option {
+	return func(p *Poller) {
+		p.MaxPollInterval = d
+	}
+}
+
+// WithAcquireBatchSize acquires up to n tasks in a single call
+func WithAcquireBatchSize(n int) Option {
+	return func(p *Poller) {
+		p.AcquireBatchSize = n
+	}
+}
+
+// WithAdmission consults the controller before acquiring tasks
+func WithAdmission(c admission.Controller) Option {
+	return func(p *Poller) {
+		p.Admission = c
+	}
+}
+
+// WithUpgradeCheck asks the server for upgrades at the interval. If drain is
+// set, the poller is drained once an upgrade is required.
+func WithUpgradeCheck(interval time.Duration, drain bool) Option {
+	return func(p *Poller) {
+		p.UpgradeCheckInterval = interval
+		p.DrainOnUpgrade = drain
+	}
+}
+
+// WithIdleTimeout drains the poller after no task was acquired for the timeout
+func WithIdleTimeout(d time.Duration) Option {
+	return func(p *Poller) {
+		p.IdleTimeout = d
+	}
+}
+
+// WithLeaseRenewal renews the leases of the running tasks at the interval
+func WithLeaseRenewal(interval time.Duration) Option {
+	return func(p *Poller) {
+		p.LeaseRenewalInterval = interval
+	}
+}
+
+// WithStatusBatch batches the statuses sent within the window, up to size statuses
+func WithStatusBatch(window time.Duration, size int) Option {
+	return func(p *Poller) {
+		p.StatusBatchWindow = window
+		p.StatusBatchSize = size
+	}
+}
+
+// WithDryRun logs the task events without acquiring any task
+func WithDryRun() Option {
+	return func(p *Poller) {
+		p.DryRun = true
+	}
+}
+
+// WithFairness acquires the task events by weighted round-robin over their
+// task types. Types without a weight have a weight of 1.
+func WithFairness(weights map[string]int) Option {
+	return func(p *Poller) {
+		p.Fairness = NewFairness(weights)
+	}
+}
+
+// WithWatchdog fails the tasks whose handlers did not return within the grace
+// period after they were canceled, abandoning the handlers if restart is set
+func WithWatchdog(grace time.Duration, restart bool) Option {
+	return func(p *Poller) {
+		p.WatchdogGrace = grace
+		p.WatchdogRestart = restart
+	}
+}
+
+// WithResourceAccounting attaches the resources consumed by the task handlers
+// to the task responses
+func WithResourceAccounting() Option {
+	return func(p *Poller) {
+		p.ResourceAccounting = true
+	}
+}
+
+// WithJitter randomly delays the polls and heartbeats by up to the fraction of
+// their interval and the registration by up to maxStartDelay
+func WithJitter(fraction float64, maxStartDelay time.Duration) Option {
+	return func(p *Poller) {
+		p.Jitter = fraction
+		p.MaxStartDelay = maxStartDelay
+	}
+}
+
+// WithTruncation truncates task response data larger than maxSize with the
+// strategy, e.g. TruncateHeadTail, instead of failing the task
+func WithTruncation(strategy string, maxSize int) Option {
+	return func(p *Poller) {
+		p.Truncation = strategy
+		p.MaxResponseDataSize = maxSize
+	}
+}
+
+// WithLimiter draws a slot of the shared limiter for every executed task
+func WithLimiter(l *limiter.Limiter) Option {
+	return func(p *Poller) {
+		p.Limiter = l
+	}
+}
+
+// WithEstimator leaves the task events which would expire before the queue
+// wait and the estimated execution time of the task elapsed to other runners
+func WithEstimator(e Estimator) Option {
+	return func(p *Poller) {
+		p.Estimator = e
+	}
+}
+
+// WithDecisionLog traces why task events were acquired, skipped or deduped
+func WithDecisionLog(l *DecisionLog) Option {
+	return func(p *Poller) {
+		p.Decisions = l
+	}
+}
+
+// WithEventAcks acknowledges the handled and ignored task events after every poll cycle
+func WithEventAcks() Option {
+	return func(p *Poller) {
+		p.AckEvents = true
+	}
+}
@@ -0,0 +1,109 @@
+package poller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+)
+
+// defaultOutputFlushInterval is the default interval at which the incremental
+// output of a task is sent to the server
+var defaultOutputFlushInterval = 5 * time.Second
+
+// output buffers the incremental output of a task. The output is sent to the
+// server as RUNNING statuses when it is flushed, which happens periodically
+// once output was written.
+type output struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	offset   int64 // number of bytes sent before the buffered output
+	started  bool
+	stop     chan struct{}
+	done     chan struct{} // closed once run returned
+	interval time.Duration
+	send     func(chunk *client.OutputChunk) error
+}
+
+// newOutput returns the incremental output of the task
+func (p *Poller) newOutput(ctx context.Context, delegateID string, t *client.Task) *output {
+	interval := p.OutputFlushInterval
+	if interval <= 0 {
+		interval = defaultOutputFlushInterval
+	}
+	return &output{
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		interval: interval,
+		send: func(chunk *client.OutputChunk) error {
+			data, err := json.Marshal(chunk)
+			if err != nil {
+				return err
+			}
+			return p.Client.SendStatus(ctx, delegateID, t.ID, &client.TaskResponse{
+				ID:   t.ID,
+				Data: data,
+				Code: client.CodeRunning,
+				Type: t.Type,
+			})
+		},
+	}
+}
+
+func (o *output) Write(b []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.started {
+		o.started = true
+		go o.run()
+	}
+	return o.buf.Write(b)
+}
+
+func (o *output) run() {
+	defer close(o.done)
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.stop:
+			return
+		case <-ticker.C:
+			o.flush()
+		}
+	}
+}
+
+// flush sends the buffered output. Output which could not be sent is dropped.
+func (o *output) flush() {
+	o.mu.Lock()
+	if o.buf.Len() == 0 {
+		o.mu.Unlock()
+		return
+	}
+	chunk := &client.OutputChunk{Output: o.buf.String(), Offset: o.offset}
+	o.offset += int64(o.buf.Len())
+	o.buf.Reset()
+	o.mu.Unlock()
+	if err := o.send(chunk); err != nil {
+		logrus.WithError(err).Warnln("could not send task output")
+	}
+}
+
+// close stops the periodic flushes and sends the remaining output once a
+// running flush completed, so that the final chunk is sent last.
+func (o *output) close() {
+	o.mu.Lock()
+	started := o.started
+	o.started = true // no periodic flushes are started once closed
+	o.mu.Unlock()
+	close(o.stop)
+	if started {
+		<-o.done
+	}
+	o.flush()
+}
@@ -0,0 +1,24 @@
+package poller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/wings-software/dlite/client"
+)
+
+// taskBody returns the body of the request handed to the task handler. Tasks
+// which were streamed to a file are read from the file.
+func taskBody(t *client.Task) (io.ReadCloser, error) {
+	if t.Payload != nil {
+		f, err := t.Payload.Open()
+		return f, errors.Wrap(err, "failed to open task payload")
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(t); err != nil {
+		return nil, errors.Wrap(err, "failed to encode task")
+	}
+	return io.NopCloser(&buf), nil
+}
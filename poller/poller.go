@@ -1,29 +1,51 @@
 package poller
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/icrowley/fake"
+	"github.com/wings-software/dlite/admission"
+	"github.com/wings-software/dlite/artifact"
+	"github.com/wings-software/dlite/audit"
 	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/daemon"
+	"github.com/wings-software/dlite/events"
+	"github.com/wings-software/dlite/heartbeat"
+	"github.com/wings-software/dlite/limiter"
+	"github.com/wings-software/dlite/logger"
+	"github.com/wings-software/dlite/metadata"
+	"github.com/wings-software/dlite/metrics"
+	"github.com/wings-software/dlite/platform"
+	"github.com/wings-software/dlite/queue"
 	"github.com/wings-software/dlite/router"
+	"github.com/wings-software/dlite/scheduler"
+	"github.com/wings-software/dlite/spool"
+	"github.com/wings-software/dlite/store"
+	"github.com/wings-software/dlite/taskcache"
+	"github.com/wings-software/dlite/workspace"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"k8s.io/utils/strings/slices"
 )
 
 var (
 	// Time period between sending heartbeats to the server
 	hearbeatInterval = 10 * time.Second
+
+	// Time period between lease renewals of daemon tasks
+	daemonLeaseInterval = 30 * time.Second
+
+	// Time period between attempts to replay spooled task statuses
+	spoolReplayInterval = 30 * time.Second
 )
 
 type Poller struct {
@@ -31,13 +53,195 @@ type Poller struct {
 	AccountSecret string
 	Name          string   // name of the runner
 	Tags          []string // list of tags that the runner accepts
+	Group         string   // optional, name of the delegate group the runner belongs to
+	OrgID         string   // optional, scopes the runner to an organization
+	ProjectID     string   // optional, scopes the runner to a project of the organization
+	Immutable     bool     // marks the runner as an immutable delegate
 	Client        client.Client
 	Router        router.Router
+	Daemons       *daemon.Manager // tracks long-running daemon tasks
+	Spool         *spool.Spool    // optional, stores task statuses which could not be sent
+	// Store optionally keeps the task ledger and the task claims, and stores the task
+	// statuses which could not be sent if there is no Spool. Replicas sharing a store
+	// do not handle the same task twice.
+	Store store.Store
+	// Queue optionally persists the acquired tasks until their status was sent,
+	// so that tasks acquired before a crash are executed again on restart
+	Queue *queue.Queue
+	// Workspaces optionally allocates an isolated working directory per task,
+	// which is removed once the task completed
+	Workspaces *workspace.Manager
+	// QuotaCheckInterval is the interval at which the disk usage of a workspace
+	// is checked, defaults to 10 seconds
+	QuotaCheckInterval time.Duration
+	// Events optionally publishes the events of the runner, e.g. acquired
+	// and finished tasks, to independent subscribers
+	Events *events.Bus
+	// Metrics optionally records the executed tasks by type. Handlers emit
+	// custom metrics through metrics.FromContext, prefixed with dlite_task_<type>.
+	Metrics *metrics.Registry
+	// PayloadCache optionally caches the payloads of the acquired tasks, which
+	// handlers look up through taskcache.FromContext
+	PayloadCache *taskcache.Cache
+	// Downloader downloads the data of tasks which refer to it by URL,
+	// defaults to artifact.NewDownloader()
+	Downloader *artifact.Downloader
+	// Audit optionally records every executed task
+	Audit audit.Sink
+	// LogSampler throttles repeated error logs, e.g. while the manager is down.
+	// Every error is logged if it is nil.
+	LogSampler *logger.Sampler
+	// MaxPollInterval is the interval the poller backs off to while no tasks are available.
+	// If it is not greater than the poll interval, the poller polls at a fixed interval.
+	MaxPollInterval time.Duration
+	// AcquireBatchSize is the maximum number of tasks acquired in a single call.
+	// If it is not greater than 1, tasks are acquired one at a time.
+	AcquireBatchSize int
+	// Fairness optionally orders the polled task events by task type, so that
+	// tasks of one type do not starve the others. Events are acquired in the
+	// order they were received if it is nil.
+	Fairness *Fairness
+	// EventsPageSize is the number of task events fetched per request. If it is zero,
+	// all the pending events are fetched in a single request.
+	EventsPageSize int
+	// MaxEventsPerCycle bounds the number of task events fetched in a single poll cycle
+	MaxEventsPerCycle int
+	// UpgradeCheckInterval is the interval at which the poller asks the server whether
+	// the runner needs to be upgraded. Upgrade checks are disabled if it is zero.
+	UpgradeCheckInterval time.Duration
+	// OnUpgrade is called once the server reports that an upgrade is required
+	OnUpgrade func(*client.UpgradeData)
+	// DisconnectAfter is the time after which a runner whose heartbeats keep failing
+	// is considered disconnected, defaults to one minute. OnHealthChange is called
+	// whenever the health state changes.
+	DisconnectAfter time.Duration
+	OnHealthChange  func(from, to Health)
+	// WatchdogGrace enables the watchdog of the task handlers: a handler which did
+	// not return within the grace period after its task timed out or was
+	// canceled has its stack dumped and its task failed. The executor waits for
+	// the handler to return, unless WatchdogRestart is set, which abandons the
+	// handler so that the executor takes the next task.
+	WatchdogGrace   time.Duration
+	WatchdogRestart bool
+	// ResourceAccounting measures the wall time, CPU time and peak memory of
+	// every task handler and attaches them to the task response
+	ResourceAccounting bool
+	// Jitter randomly delays every poll and heartbeat by up to the fraction
+	// of their interval, e.g. 0.2, so that runners started together do not
+	// poll the server in lockstep
+	Jitter float64
+	// MaxStartDelay randomly delays the registration by up to the duration
+	MaxStartDelay time.Duration
+	// MaxResponseDataSize bounds the task response data accepted by the server,
+	// defaults to client.MaxDataSize. Larger data fails the task, unless it
+	// is truncated with the Truncation strategy, e.g. TruncateHeadTail.
+	MaxResponseDataSize int
+	Truncation          string
+	// Estimator enables deadline-aware acquisition: task events which expire
+	// before the current queue wait and the estimated execution time of the
+	// task elapsed are left to other runners
+	Estimator Estimator
+	// Decisions optionally traces why task events were acquired, skipped or
+	// deduped, as debug records and in a log of the recent decisions
+	Decisions *DecisionLog
+	// AckEvents acknowledges the task events which were handled or ignored
+	// in a single call after every poll cycle, so that the server prunes
+	// them instead of delivering them again
+	AckEvents bool
+	// Limiter optionally bounds the tasks executed concurrently by the pollers
+	// sharing it, e.g. the pollers of several accounts in one process
+	Limiter *limiter.Limiter
+	// OutputFlushInterval is the interval at which the incremental output of
+	// streaming handlers is sent to the server, defaults to 5 seconds
+	OutputFlushInterval time.Duration
+	// OnControl is called after a control message from the server was applied
+	OnControl func(*client.ControlMessage)
+	// DrainOnUpgrade drains the poller once an upgrade is required so that
+	// an external supervisor can replace the binary.
+	DrainOnUpgrade bool
+	// Admission is consulted before acquiring tasks. If it refuses, no tasks are
+	// acquired in that poll cycle and OnAdmissionDenied is called with the reason.
+	Admission         admission.Controller
+	OnAdmissionDenied func(reason string)
+	// IdleTimeout drains the poller after no task was acquired for the given duration.
+	// OnIdle is called before draining and can return false to keep the poller running.
+	IdleTimeout time.Duration
+	OnIdle      func(idle time.Duration) bool
+	// MaxTasksBeforeRecycle drains the poller after the given number of tasks have been
+	// acquired, which helps mitigating memory leaks in handlers of long-lived runners.
+	MaxTasksBeforeRecycle int
+	// LeaseRenewalInterval is the interval at which the poller renews its lease on the
+	// tasks being executed, so that long tasks are not reassigned. Disabled if zero.
+	LeaseRenewalInterval time.Duration
+	// DryRun makes the poller log the task events it receives without acquiring or
+	// executing any task, e.g. to validate connectivity in a new environment.
+	DryRun bool
+	// StatusBatchWindow batches the statuses of tasks which complete within the
+	// window into a single call of at most StatusBatchSize statuses. Statuses
+	// are sent one at a time if it is zero.
+	StatusBatchWindow time.Duration
+	StatusBatchSize   int
+	// FullHeartbeatInterval makes heartbeats carry the full registration payload only
+	// if it changed or the interval elapsed since it was last sent. Other heartbeats
+	// are lightweight keep-alive packets. Every heartbeat is a full one if it is zero.
+	FullHeartbeatInterval time.Duration
 	// The Harness manager allows two task acquire calls with the same delegate ID to go through (by design).
 	// We need to make sure two different threads do not acquire the same task.
 	// This map makes sure Acquire() is called only once per task ID. The mapping is removed once the status
 	// for the task has been sent.
 	m sync.Map
+	// statuses batches status updates if StatusBatchWindow is set
+	statuses *statusBatcher
+	// leases holds the IDs of the acquired tasks which are being executed
+	leases sync.Map
+	// lost holds the IDs of the tasks whose status could neither be sent nor spooled
+	lost sync.Map
+	// delays holds acquired tasks until their not-before time
+	delays *delayQueue
+	// jobs runs the periodic housekeeping jobs
+	jobs *scheduler.Scheduler
+	// beat is the *heartbeat.Heartbeat of the registered runner
+	beat atomic.Value
+	// mu guards the settings which can be changed while polling
+	mu           sync.RWMutex
+	executors    *pool
+	pollInterval int64 // in nanoseconds
+	parallelism  int32
+
+	// queueWaits averages the time work waits for an executor
+	queueWaits waitAverage
+
+	initOnce        sync.Once
+	startedAt       time.Time
+	drainOnce       sync.Once
+	drainCh         chan struct{}
+	wake            chan struct{} // signaled on Resume so that the poll loop polls immediately
+	upgradeRequired int32
+	paused          int32
+	standby         int32
+	suspend         int32 // set while the server paused the poller, which keeps polling for control messages
+	inflight        int32 // number of executors which are busy
+	stats           counters
+	health          health
+	lastActivity    int64 // unix time in nanoseconds at which a task was last acquired
+	acquired        int64 // number of tasks acquired (or reserved) counting towards MaxTasksBeforeRecycle
+	acks            eventAcks
+}
+
+// work is a unit of work handed from the poller to the executors
+type work struct {
+	ev   client.TaskEvent
+	task *client.Task // set if the task was already acquired
+	// scheduled is set once the task was held until its not-before time
+	scheduled bool
+	// recovered is set on tasks recovered from the durable queue. They were
+	// acquired on behalf of delegateID.
+	recovered  bool
+	delegateID string
+	// slot is set if a slot of the shared limiter was taken for the task
+	slot bool
+	// queued is the time the work was handed to the executors
+	queued time.Time
 }
 
 type DelegateInfo struct {
@@ -48,15 +252,7 @@ type DelegateInfo struct {
 }
 
 func New(accountID, accountSecret, name string, tags []string, c client.Client, r router.Router) *Poller {
-	return &Poller{
-		AccountID:     accountID,
-		AccountSecret: accountSecret,
-		Tags:          tags,
-		Name:          name,
-		Client:        c,
-		Router:        r,
-		m:             sync.Map{},
-	}
+	return NewWithOptions(accountID, accountSecret, c, r, WithName(name), WithTags(tags...))
 }
 
 // Register registers the runner with the server. The server generates a delegate ID
@@ -67,12 +263,23 @@ func (p *Poller) Register(ctx context.Context) (*DelegateInfo, error) {
 		return nil, errors.Wrap(err, "could not get host name")
 	}
 	host = "dlite-" + strings.ReplaceAll(host, " ", "-")
+	if d := scheduler.Random(p.MaxStartDelay); d > 0 {
+		logrus.Infof("delaying the registration of the runner by %s", d.Round(time.Millisecond))
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
 	ip := getOutboundIP()
 	id, err := p.register(ctx, hearbeatInterval, ip, host)
 	if err != nil {
 		logrus.WithField("ip", ip).WithField("host", host).WithError(err).Error("could not register runner")
 		return nil, err
 	}
+	p.Events.Publish(events.Event{Type: events.RunnerRegistered})
 	return &DelegateInfo{
 		ID:   id,
 		Host: host,
@@ -81,101 +288,694 @@ func (p *Poller) Register(ctx context.Context) (*DelegateInfo, error) {
 	}, nil
 }
 
+// init lazily initializes the internal state so that a Poller can
+// also be used when it was not created with New.
+func (p *Poller) init() {
+	p.initOnce.Do(func() {
+		p.startedAt = time.Now()
+		p.drainCh = make(chan struct{})
+		p.wake = make(chan struct{}, 1)
+		p.jobs = scheduler.New()
+	})
+}
+
+// Jobs returns the status of the periodic housekeeping jobs
+func (p *Poller) Jobs() []scheduler.Status {
+	p.init()
+	jobs := p.jobs.Jobs()
+	if beat := p.Heartbeat(); beat != nil {
+		jobs = append(jobs, beat.Status())
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	}
+	return jobs
+}
+
+// Drain stops the poller from acquiring new tasks. Poll returns once the
+// tasks which are being executed have completed.
+func (p *Poller) Drain() {
+	p.init()
+	p.drainOnce.Do(func() {
+		logrus.Infoln("draining poller")
+		close(p.drainCh)
+		p.Events.Publish(events.Event{Type: events.RunnerDraining})
+	})
+}
+
+// Draining returns true if the poller is being drained
+func (p *Poller) Draining() bool {
+	p.init()
+	select {
+	case <-p.drainCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// Pause stops the poller from acquiring new tasks. The runner stays registered,
+// keeps sending heartbeats and tasks which are being executed run to completion.
+func (p *Poller) Pause() {
+	if atomic.CompareAndSwapInt32(&p.paused, 0, 1) {
+		logrus.Infoln("pausing poller")
+	}
+}
+
+// Resume makes a paused poller acquire new tasks again
+func (p *Poller) Resume() {
+	if atomic.CompareAndSwapInt32(&p.paused, 1, 0) {
+		logrus.Infoln("resuming poller")
+		p.init()
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Paused returns true if the poller is paused
+func (p *Poller) Paused() bool {
+	return atomic.LoadInt32(&p.paused) == 1
+}
+
 // Poll continually asks the task server for tasks to execute. It executes the tasks by routing
 // them to the correct handler and updating the status of the task to the server.
 // id is the delegate instance ID. It's generated by the server on registration.
+// Poll returns once the context is canceled or the poller has been drained.
 func (p *Poller) Poll(ctx context.Context, n int, id string, interval time.Duration) error {
-	var wg sync.WaitGroup
-	events := make(chan client.TaskEvent, n)
+	p.init()
+	started := time.Now()
+	defer p.Events.Publish(events.Event{Type: events.RunnerStopped})
+	atomic.StoreInt64(&p.pollInterval, int64(interval))
+	atomic.StoreInt32(&p.parallelism, int32(n))
+	events := make(chan work, n)
+	// pollerDone is closed once the task event poller stops handing out work
+	pollerDone := make(chan struct{})
+	// completed is signaled by the executors after a task finishes so that
+	// an adaptive poller can re-poll immediately.
+	completed := make(chan struct{}, 1)
 	// Task event poller
 	go func() {
-		pollTimer := time.NewTimer(interval)
+		defer close(pollerDone)
+		next := p.interval()
+		pollTimer := time.NewTimer(p.jitter(next))
+		defer pollTimer.Stop()
 		for {
-			pollTimer.Reset(interval)
 			select {
 			case <-ctx.Done():
 				logrus.Error("context canceled")
 				return
-			case <-pollTimer.C:
-				tasks, err := p.Client.GetTaskEvents(ctx, id)
-				if err != nil {
-					logrus.WithError(err).Errorf("could not query for task events")
+			case <-p.drainCh:
+				return
+			case <-completed:
+				if !pollTimer.Stop() {
+					<-pollTimer.C
 				}
-				if len(tasks.TaskEvents) > 0 {
-					events <- tasks.TaskEvents[0]
+			case <-p.wake:
+				if !pollTimer.Stop() {
+					<-pollTimer.C
+				}
+			case <-pollTimer.C:
+			}
+			interval := p.interval()
+			if p.Paused() {
+				next = interval
+				pollTimer.Reset(p.jitter(next))
+				continue
+			}
+			tasks, err := p.fetchEvents(ctx, id)
+			if err != nil {
+				p.logError("task_events", err, nil, "could not query for task events")
+			}
+			if p.DryRun {
+				p.logDryRun(tasks, n)
+				pollTimer.Reset(p.jitter(next))
+				continue
+			}
+			n := p.parallel()
+			pending := p.Fairness.order(p.pending(tasks))
+			free := n - int(atomic.LoadInt32(&p.inflight)) - len(events)
+			switch {
+			case len(pending) == 0:
+			case free <= 0:
+				// leave the events for other runners instead of acquiring
+				// tasks which can not be started.
+				logrus.Debugf("all %d executors are busy, skipping %d task events", n, len(pending))
+				p.decideAll(pending, DecisionDeferred, fmt.Sprintf("at capacity, all %d executors are busy", n))
+			case p.suspended():
+				logrus.Debugf("poller was paused by the server, skipping %d task events", len(pending))
+				p.decideAll(pending, DecisionDeferred, "the poller was paused by the server")
+			case !p.admit(pending):
+			case !p.slotsAvailable():
+				logrus.Debugf("no task slots left in the shared limiter, skipping %d task events", len(pending))
+				p.decideAll(pending, DecisionDeferred, "no task slots left in the shared limiter")
+			case p.AcquireBatchSize > 1:
+				p.acquireBatch(ctx, id, pending, free, events)
+			default:
+				select {
+				case events <- work{ev: pending[0], queued: time.Now()}:
+					p.Fairness.acquired(pending[0].TaskType)
+					p.decideAll(pending[1:], DecisionDeferred, "one task is acquired per poll cycle")
+				case <-p.drainCh:
+					// the executors stop receiving events once the poller drains
+					p.decideAll(pending, DecisionDeferred, "the poller is draining")
+				case <-ctx.Done():
 				}
 			}
+			p.flushAcks(ctx, id)
+			next = p.nextInterval(next, interval, len(pending) > 0)
+			pollTimer.Reset(p.jitter(next))
 		}
 	}()
+	// the jobs stop once the poller returns
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	if p.Spool != nil {
+		p.jobs.Schedule(jobsCtx, scheduler.Job{Name: "spool-replay", Interval: spoolReplayInterval, Jitter: 0.1, Run: p.replaySpool})
+	} else if p.Store != nil {
+		p.jobs.Schedule(jobsCtx, scheduler.Job{Name: "store-replay", Interval: spoolReplayInterval, Jitter: 0.1, Run: p.replayStore})
+	}
+	if p.UpgradeCheckInterval > 0 {
+		p.jobs.Schedule(jobsCtx, scheduler.Job{Name: "upgrade-check", Interval: p.UpgradeCheckInterval, Jitter: 0.1, Run: p.checkUpgrade(id)})
+	}
+	if p.StatusBatchWindow > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		p.statuses = newStatusBatcher(p.Client, id, p.StatusBatchWindow, p.StatusBatchSize)
+		go p.statuses.run(ctx, stop)
+	}
+	p.delays = newDelayQueue()
+	go p.delays.run(ctx, events, p.drainCh)
+	go p.recoverTasks(ctx, events, started)
+	p.stats.poll.Store(&pollState{queue: events, delays: p.delays})
+	if p.LeaseRenewalInterval > 0 {
+		p.jobs.Schedule(jobsCtx, scheduler.Job{Name: "lease-renewal", Interval: p.LeaseRenewalInterval, Run: p.renewLeases(id)})
+	}
+	p.touch()
+	if p.IdleTimeout > 0 {
+		p.jobs.Schedule(jobsCtx, scheduler.Job{Name: "idle-check", Interval: p.idleCheckInterval(), Run: p.checkIdle})
+	}
 	// Task event executor
-	for i := 0; i < n; i++ {
-		wg.Add(1)
-		go func(i int) {
-			for {
-				select {
-				case <-ctx.Done():
-					wg.Done()
-					return
-				case task := <-events:
-					err := p.execute(ctx, id, task, i)
-					if err != nil {
-						logrus.WithError(err).WithField("task_id", task.TaskID).Errorf("[Thread %d]: could not perform task execution", i)
+	executors := newPool(ctx.Done(), func(i int, stop <-chan struct{}) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-p.drainCh:
+				// finish the tasks which were already acquired
+				<-pollerDone
+				p.awaitDelayed(ctx, id, events, i)
+				p.drainQueue(ctx, id, events, i)
+				return
+			case w := <-events:
+				atomic.AddInt32(&p.inflight, 1)
+				err := p.execute(ctx, id, w, i)
+				atomic.AddInt32(&p.inflight, -1)
+				if err != nil {
+					p.logError("execute", err, logrus.Fields{"task_id": w.ev.TaskID}, "[Thread %d]: could not perform task execution", i)
+				}
+				if p.adaptive(p.interval()) {
+					select {
+					case completed <- struct{}{}:
+					default:
 					}
 				}
 			}
-		}(i)
-	}
+		}
+	})
+	p.mu.Lock()
+	p.executors = executors
+	executors.resize(p.parallel())
+	p.mu.Unlock()
 	logrus.Infof("initialized %d threads successfully and starting polling for tasks", n)
-	wg.Wait()
+	executors.wait()
 	return nil
 }
 
-// execute tries to acquire the task and executes the handler for it
-func (p *Poller) execute(ctx context.Context, delegateID string, ev client.TaskEvent, i int) error {
-	taskID := ev.TaskID
-	if _, loaded := p.m.LoadOrStore(taskID, true); loaded {
+// admit asks the admission controller whether the pending tasks can be acquired
+func (p *Poller) admit(pending []client.TaskEvent) bool {
+	if p.Admission == nil {
+		return true
+	}
+	ok, reason := p.Admission.Admit()
+	if ok {
+		return true
+	}
+	logrus.WithField("reason", reason).Warnln("runner is resource constrained, not acquiring tasks")
+	p.decideAll(pending, DecisionDeferred, "admission denied: "+reason)
+	if p.OnAdmissionDenied != nil {
+		p.OnAdmissionDenied(reason)
+	}
+	return false
+}
+
+// drainQueue executes the queued work whose tasks were already acquired.
+// Queued events which were not acquired yet are dropped.
+func (p *Poller) drainQueue(ctx context.Context, id string, events <-chan work, i int) {
+	for {
+		select {
+		case w := <-events:
+			if w.task == nil {
+				continue
+			}
+			if err := p.execute(ctx, id, w, i); err != nil {
+				p.logError("execute", err, logrus.Fields{"task_id": w.ev.TaskID}, "[Thread %d]: could not perform task execution", i)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// awaitDelayed executes the acquired work until the delay queue handed out
+// all the scheduled tasks.
+func (p *Poller) awaitDelayed(ctx context.Context, id string, events <-chan work, i int) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.delays.done:
+			return
+		case w := <-events:
+			if w.task == nil {
+				continue
+			}
+			if err := p.execute(ctx, id, w, i); err != nil {
+				p.logError("execute", err, logrus.Fields{"task_id": w.ev.TaskID}, "[Thread %d]: could not perform task execution", i)
+			}
+		}
+	}
+}
+
+// adaptive returns true if the poll interval backs off while idle
+func (p *Poller) adaptive(interval time.Duration) bool {
+	return p.MaxPollInterval > interval
+}
+
+// nextInterval returns the time to wait before the next poll. While tasks are flowing the
+// poller polls at the minimum interval, when idle it backs off up to MaxPollInterval.
+func (p *Poller) nextInterval(current, min time.Duration, found bool) time.Duration {
+	if found || !p.adaptive(min) {
+		return min
+	}
+	next := current * 2
+	if next > p.MaxPollInterval {
+		next = p.MaxPollInterval
+	}
+	return next
+}
+
+// jitter randomly delays the poll interval by up to the Jitter fraction
+func (p *Poller) jitter(d time.Duration) time.Duration {
+	return scheduler.Jitter(d, p.Jitter)
+}
+
+// pending handles abort events and returns the events which need to be executed
+func (p *Poller) pending(tasks *client.TaskEventsResponse) []client.TaskEvent {
+	if tasks == nil {
 		return nil
 	}
-	defer p.m.Delete(taskID)
-	task, err := p.Client.Acquire(ctx, delegateID, taskID)
+	var events []client.TaskEvent
+	for _, ev := range tasks.TaskEvents {
+		if ev.Control != nil {
+			p.control(ev.Control)
+			continue
+		}
+		if ev.Abort {
+			p.decide(ev, DecisionAborted, "the server aborted the task")
+			p.Daemons.Abort(ev.TaskID)
+			p.PayloadCache.Invalidate(ev.TaskID)
+			continue
+		}
+		if !p.meetsDeadline(ev) {
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// logDryRun logs the task events which would have been handled
+func (p *Poller) logDryRun(tasks *client.TaskEventsResponse, n int) {
+	if tasks == nil {
+		return
+	}
+	for _, ev := range tasks.TaskEvents {
+		if ev.Control != nil {
+			logrus.Infoln("dry run: received control message")
+			continue
+		}
+		logrus.WithField("task_id", ev.TaskID).WithField("abort", ev.Abort).Infoln("dry run: received task event")
+		p.decide(ev, DecisionSkipped, "dry run")
+	}
+	if len(tasks.TaskEvents) > n {
+		logrus.Infof("dry run: received %d task events, more than the %d executors can run at once", len(tasks.TaskEvents), n)
+	}
+}
+
+// acquireBatch acquires up to AcquireBatchSize of the events in a single call and
+// hands the acquired tasks to the executors. At most free tasks are acquired.
+func (p *Poller) acquireBatch(ctx context.Context, delegateID string, evs []client.TaskEvent, free int, out chan<- work) {
+	max := p.AcquireBatchSize
+	if free < max {
+		max = free
+	}
+	max = p.reserveN(max)
+	if slots := p.takeSlots(max); slots < max {
+		p.release(max - slots)
+		max = slots
+	}
+	claimed := map[string]client.TaskEvent{}
+	var ids []string
+	for i, ev := range evs {
+		if len(ids) == max {
+			p.decideAll(evs[i:], DecisionDeferred, fmt.Sprintf("at capacity, %d tasks are acquired in this poll cycle", max))
+			break
+		}
+		if !p.claim(ctx, ev.TaskID) {
+			p.decide(ev, DecisionDeduped, "the task was already claimed")
+			continue
+		}
+		claimed[ev.TaskID] = ev
+		ids = append(ids, ev.TaskID)
+		p.Fairness.acquired(ev.TaskType)
+	}
+	if len(ids) == 0 {
+		p.release(max)
+		p.releaseSlots(max)
+		return
+	}
+	tasks, err := p.Client.AcquireBatch(ctx, delegateID, ids)
 	if err != nil {
-		return errors.Wrap(err, "failed to acquire task")
+		p.logError("acquire", err, nil, "could not acquire batch of %d tasks", len(ids))
+	}
+	p.release(max - len(tasks))
+	defer p.checkRecycle()
+	sent := 0
+	// the executors release the slots of the tasks which were handed out
+	defer func() { p.releaseSlots(max - sent) }()
+	for _, t := range tasks {
+		ev, ok := claimed[t.ID]
+		if !ok {
+			continue
+		}
+		delete(claimed, t.ID)
+		p.decide(ev, DecisionAcquired, "")
+		select {
+		case out <- work{ev: ev, task: t, slot: true, queued: time.Now()}:
+			sent++
+		case <-p.drainCh:
+			// the executors stop receiving events once the poller drains,
+			// the task is given back to be assigned to another runner
+			p.unclaim(t.ID)
+			p.release(1)
+			if err := p.reject(ctx, delegateID, t, &client.RejectRequest{Reason: "the runner is draining", Code: "RUNNER_DRAINING"}, 0); err != nil {
+				p.logError("reject", err, logrus.Fields{"task_id": t.ID}, "could not give back task %s", t.ID)
+			}
+			p.decide(ev, DecisionRejected, "the runner is draining")
+		case <-ctx.Done():
+			p.unclaim(t.ID)
+		}
+	}
+	// release the claims on tasks which were not acquired
+	for id, ev := range claimed {
+		p.unclaim(id)
+		p.decide(ev, DecisionSkipped, "the task was not acquired in the batch")
+	}
+}
+
+// execute tries to acquire the task (unless it was already acquired) and executes the handler for it
+func (p *Poller) execute(ctx context.Context, delegateID string, w work, i int) (err error) {
+	taskID := w.ev.TaskID
+	task := w.task
+	if !w.queued.IsZero() {
+		p.observeQueueWait(time.Since(w.queued))
+	}
+	if w.delegateID != "" {
+		delegateID = w.delegateID
+	}
+	if task == nil {
+		// events which were queued before the poller was paused are left for other runners
+		if p.Paused() {
+			p.decide(w.ev, DecisionDeferred, "the poller was paused")
+			return nil
+		}
+		if !p.claim(ctx, taskID) {
+			p.decide(w.ev, DecisionDeduped, "the task was already claimed")
+			return nil
+		}
+	}
+	held := false
+	defer func() {
+		if !held {
+			p.unclaim(taskID)
+		}
+	}()
+	if task == nil {
+		if p.takeSlots(1) == 0 {
+			p.decide(w.ev, DecisionDeferred, "no task slots left in the shared limiter")
+			return nil
+		}
+		w.slot = true
+		if !p.reserve() {
+			p.releaseSlots(1)
+			p.decide(w.ev, DecisionDeferred, "the runner reached the task limit before recycling")
+			return nil
+		}
+		task, err = p.Client.Acquire(ctx, delegateID, taskID)
+		if err != nil {
+			p.release(1)
+			p.releaseSlots(1)
+			p.decide(w.ev, DecisionDeferred, "the acquisition failed: "+err.Error())
+			return errors.Wrap(err, "failed to acquire task")
+		}
+		p.decide(w.ev, DecisionAcquired, "")
+		p.checkRecycle()
+		if task.Replayed {
+			logrus.WithField("task_id", taskID).Infof("[Thread %d]: task was already acquired by an earlier attempt of the request", i)
+		}
+	} else if !w.slot && p.takeSlots(1) == 1 {
+		// tasks which were acquired before, e.g. due scheduled tasks, run
+		// even if the shared limiter has no slot left
+		w.slot = true
+	}
+	// the slot is not held while a scheduled task waits until it is due
+	if w.slot {
+		defer p.releaseSlots(1)
+	}
+	p.touch()
+	p.leases.Store(taskID, struct{}{})
+	p.Events.Publish(events.Event{Type: events.TaskAcquired, TaskID: task.ID, TaskType: task.Type})
+	if !w.scheduled && !w.recovered {
+		p.recordAcquired(ctx, delegateID, task)
+		p.enqueue(delegateID, task)
+	}
+	// scheduled tasks are held until they are due, keeping the claim and the lease
+	if p.delays != nil && p.delays.hold(work{ev: w.ev, task: task}) {
+		held = true
+		logrus.WithField("task_id", taskID).Infof("[Thread %d]: scheduled task to run at %s", i, notBefore(w))
+		return nil
+	}
+	defer p.leases.Delete(taskID)
+	defer p.dequeue(task)
+	record := p.newAuditRecord(delegateID, w.ev, task)
+	defer func() {
+		p.writeAudit(record, err)
+		p.observeTask(record, err)
+		p.observeExecution(record.TaskType, record.AcquiredAt)
+		p.publishFinished(record, err)
+	}()
+	cid := task.CorrelationID
+	if cid == "" {
+		cid = task.ID
 	}
-	var buf bytes.Buffer
-	err = json.NewEncoder(&buf).Encode(task)
+	ctx = client.WithCorrelationID(ctx, cid)
+	if err := p.resolveDataRef(ctx, task); err != nil {
+		logrus.WithError(err).Errorf("[Thread %d]: could not download the data of taskID: %s", i, taskID)
+		e := dataRefError(err)
+		record.Status = taskCode(e)
+		return p.sendStatus(ctx, delegateID, &client.TaskResponse{
+			ID:    task.ID,
+			Code:  taskCode(e),
+			Type:  task.Type,
+			Error: e,
+		}, i)
+	}
+	body, err := taskBody(task)
 	if err != nil {
-		return errors.Wrap(err, "failed to encode task")
+		return err
 	}
+	defer body.Close()
 	logrus.Infof("[Thread %d]: successfully acquired taskID: %s of type: %s", i, taskID, task.Type)
-	if !slices.Contains(p.Router.Routes(), task.Type) { // should not happen
+	handler := p.Router.Route(task.Type)
+	if handler == nil { // should not happen
 		logrus.Errorf("[Thread %d]: Task ID of type: %s was never meant to reach this delegate", i, task.Type)
-		return fmt.Errorf("task type not supported by delegate")
+		p.decide(w.ev, DecisionRejected, "no handler for task type "+task.Type)
+		record.Status = audit.StatusRejected
+		return p.reject(ctx, delegateID, task, &client.RejectRequest{Reason: fmt.Sprintf("task type %s not supported by delegate", task.Type)}, i)
 	}
 
 	// TODO: Discuss possible better ways to forward the HTTP response to the task for processing
 	// For now, keeping the handler interface consistent with the HTTP handler to allow for possible
 	// extension in the future with CGI, etc.
-	req, err := http.NewRequestWithContext(ctx, "POST", "/", &buf)
+	attempt := p.started(taskID)
+	hctx, cancel := withMetadata(ctx, p.AccountID, delegateID, cid, task, attempt)
+	defer cancel()
+	hctx, checkpoints := p.withCheckpoints(hctx, task)
+	resume := resumeInfo(checkpoints, attempt)
+	hctx = p.withMetrics(hctx, task)
+	hctx = p.withPayloadCache(hctx, task)
+	hctx, ws, err := p.withWorkspace(hctx, cancel, task)
+	if err != nil {
+		logrus.WithError(err).Errorf("[Thread %d]: could not create workspace for taskID: %s", i, taskID)
+		record.Status = client.CodeFailed
+		return p.sendStatus(ctx, delegateID, &client.TaskResponse{
+			ID:    task.ID,
+			Code:  client.CodeFailed,
+			Type:  task.Type,
+			Error: workspaceError("WORKSPACE_UNAVAILABLE", "could not create task workspace", true),
+		}, i)
+	}
+	defer ws.release()
+	hctx, daemonFn := daemon.Attach(hctx)
+	req, err := http.NewRequestWithContext(hctx, "POST", "/", body)
 	if err != nil {
 		return err
 	}
 
 	writer := NewResponseWriter()
-	p.Router.Route(task.Type).ServeHTTP(writer, req)
+	writer.out = p.newOutput(ctx, delegateID, task)
+	meter := p.meterUsage()
+	err = p.serveWatched(hctx, handler, writer, req)
+	writer.out.close()
+	usage := meter.finish()
+	p.observeUsage(task.Type, usage)
+	if uerr, ok := err.(*UnresponsiveError); ok {
+		record.Status = client.CodeFailed
+		return p.unresponsive(ctx, delegateID, task, uerr, i)
+	}
+	var perr *PanicError
+	if errors.As(err, &perr) {
+		logrus.WithField("stack", string(perr.Stack)).Errorf("[Thread %d]: handler for taskID: %s of type: %s panicked: %v", i, taskID, task.Type, perr.Value)
+		record.Status = client.CodeFailed
+		return p.sendStatus(ctx, delegateID, &client.TaskResponse{
+			ID:    task.ID,
+			Data:  panicResponse(perr),
+			Code:  client.CodeFailed,
+			Type:  task.Type,
+			Error: perr.TaskError(),
+			Usage: usage,
+		}, i)
+	}
+	if err != nil {
+		logrus.WithError(err).Errorf("[Thread %d]: handler for taskID: %s of type: %s failed", i, taskID, task.Type)
+		record.Status = client.CodeFailed
+		return p.sendStatus(ctx, delegateID, &client.TaskResponse{
+			ID:   task.ID,
+			Code: client.CodeFailed,
+			Type: task.Type,
+			Error: &client.TaskError{
+				Code:     "HANDLER_FAILED",
+				Category: client.CategoryInternal,
+				Message:  err.Error(),
+			},
+			Usage: usage,
+		}, i)
+	}
+	if ws.quotaExceeded() {
+		logrus.Warnf("[Thread %d]: taskID: %s of type: %s exceeded its workspace quota", i, taskID, task.Type)
+		record.Status = client.CodeFailed
+		return p.sendStatus(ctx, delegateID, &client.TaskResponse{
+			ID:    task.ID,
+			Code:  client.CodeFailed,
+			Type:  task.Type,
+			Error: workspaceError("WORKSPACE_QUOTA_EXCEEDED", "task exceeded its workspace disk quota", false),
+		}, i)
+	}
+	if r, ok := rejection(writer); ok {
+		record.Status = audit.StatusRejected
+		return p.reject(ctx, delegateID, task, &client.RejectRequest{Reason: r.Reason, Code: r.Code}, i)
+	}
+	if fn := daemonFn(); fn != nil {
+		logrus.Infof("[Thread %d]: started daemon for taskID: %s of type: %s", i, taskID, task.Type)
+		// daemons are not bound by the task timeout but carry its metadata
+		md, _ := metadata.FromContext(hctx)
+		p.Daemons.Run(metadata.NewContext(ctx, md), delegateID, task, fn, writer.buf.Bytes())
+		record.Status = client.CodeRunning
+		return nil
+	}
+	// the checkpoints of the task are kept until its status was sent
+	defer func() {
+		if err == nil {
+			clearCheckpoints(checkpoints, task.ID)
+		}
+	}()
 	taskResponse := &client.TaskResponse{
 		ID:   task.ID,
 		Data: writer.buf.Bytes(),
-		Code: "OK",
+		Code: client.CodeOK,
 		Type: task.Type,
 	}
-	err = p.Client.SendStatus(ctx, delegateID, taskID, taskResponse)
-	if err != nil {
-		return errors.Wrap(err, "failed to send step status")
+	taskResponse.Resume = resume
+	taskResponse.Usage = usage
+	if e, ok := taskError(writer); ok {
+		taskResponse.Code = taskCode(e)
+		taskResponse.Error = e
+	}
+	record.Status = taskResponse.Code
+	if err := p.sendStatus(ctx, delegateID, taskResponse, i); err != nil {
+		return err
 	}
 	logrus.Infof("[Thread %d]: successfully completed task execution of taskID: %s of type: %s", i, taskID, task.Type)
 	return nil
 }
 
+// sendStatus sends the task response to the server, spooling it if it can not be sent
+func (p *Poller) sendStatus(ctx context.Context, delegateID string, r *client.TaskResponse, i int) error {
+	p.truncate(r)
+	verr := r.Validate()
+	if limit := p.maxResponseDataSize(); verr == nil && len(r.Data) > limit {
+		verr = fmt.Errorf("data is larger than %d bytes", limit)
+	}
+	if verr != nil {
+		if r.ID == "" {
+			return verr
+		}
+		logrus.WithError(verr).Errorf("[Thread %d]: invalid response for taskID: %s, failing the task", i, r.ID)
+		r = invalidResponse(r, verr)
+	}
+	var err error
+	if p.statuses != nil {
+		err = p.statuses.send(ctx, r)
+	} else {
+		err = p.Client.SendStatus(ctx, delegateID, r.ID, r)
+	}
+	if err == nil {
+		p.countStatus(r)
+		p.recordCompleted(ctx, r)
+		return nil
+	}
+	var serr error
+	switch e := (&spool.Entry{DelegateID: delegateID, TaskID: r.ID, Response: r}); {
+	case p.Spool != nil:
+		serr = p.Spool.Push(e)
+	case p.Store != nil:
+		serr = p.Store.PushStatus(ctx, e)
+	default:
+		p.lost.Store(r.ID, true)
+		return errors.Wrap(err, "failed to send step status")
+	}
+	if serr != nil {
+		p.lost.Store(r.ID, true)
+		return errors.Wrap(serr, "failed to send step status and could not spool it")
+	}
+	logrus.WithError(err).Warnf("[Thread %d]: could not send status for taskID: %s, spooled it for replay", i, r.ID)
+	p.countStatus(r)
+	p.recordCompleted(ctx, r)
+	return nil
+}
+
 // Register registers the runner and runs a background thread which keeps pinging the server
 // at a period of interval. It returns the delegate ID.
 func (p *Poller) register(ctx context.Context, interval time.Duration, ip, host string) (string, error) {
@@ -190,38 +990,69 @@ func (p *Poller) register(ctx context.Context, interval time.Duration, ip, host
 		HostName:           host,
 		IP:                 ip,
 		SupportedTaskTypes: p.Router.Routes(),
-		Tags:               p.Tags,
+		Tags:               p.tags(),
+		DelegateGroupName:  p.Group,
+		OrgIdentifier:      p.OrgID,
+		ProjectIdentifier:  p.ProjectID,
+		Immutable:          p.Immutable,
 	}
+	plat := platform.Host()
+	req.Platform = &plat
 	resp, err := p.Client.Register(ctx, req)
 	if err != nil {
 		return "", errors.Wrap(err, "could not register the runner")
 	}
 	req.ID = resp.Resource.DelegateID
+	p.stats.delegateID.Store(req.ID)
+	p.healthy()
 	logrus.WithField("id", req.ID).WithField("host", req.HostName).
 		WithField("ip", req.IP).Info("registered delegate successfully")
 	p.heartbeat(ctx, req, interval)
 	return resp.Resource.DelegateID, nil
 }
 
-// heartbeat starts a periodic thread in the background which continually pings the server
+// heartbeat starts the heartbeats which continually ping the server
 func (p *Poller) heartbeat(ctx context.Context, req *client.RegisterRequest, interval time.Duration) {
-	go func() {
-		msgDelayTimer := time.NewTimer(interval)
-		defer msgDelayTimer.Stop()
-		for {
-			msgDelayTimer.Reset(interval)
-			select {
-			case <-ctx.Done():
-				logrus.Error("context canceled")
-				return
-			case <-msgDelayTimer.C:
-				err := p.Client.Heartbeat(ctx, req)
-				if err != nil {
-					logrus.WithError(err).Errorf("could not send heartbeat")
-				}
-			}
-		}
-	}()
+	p.init()
+	hb := &heartbeats{poller: p}
+	beat := heartbeat.New(p.Client, func(context.Context) (*client.RegisterRequest, error) {
+		return hb.next(req), nil
+	}, interval)
+	beat.Jitter = p.Jitter
+	beat.MaxBackoff = heartbeatMaxBackoff
+	beat.Events = p.Events
+	beat.OnSuccess = func(*client.RegisterRequest) {
+		hb.sent(nil)
+		p.recordHeartbeat(nil)
+		atomic.StoreInt64(&p.stats.lastHeartbeat, time.Now().UnixNano())
+	}
+	beat.OnFailure = func(err error, _ int) {
+		hb.sent(err)
+		p.recordHeartbeat(err)
+		logrus.WithError(err).Warnln("could not send heartbeat")
+	}
+	p.beat.Store(beat)
+	beat.Start(ctx) //nolint:errcheck
+}
+
+// Heartbeat returns the heartbeat of the registered runner, e.g. to change
+// its interval, or nil if the runner is not registered
+func (p *Poller) Heartbeat() *heartbeat.Heartbeat {
+	beat, _ := p.beat.Load().(*heartbeat.Heartbeat)
+	return beat
+}
+
+// replaySpool tries to send the spooled task statuses to the server
+func (p *Poller) replaySpool(ctx context.Context) error {
+	if p.Spool.Len() == 0 {
+		return nil
+	}
+	n, err := p.Spool.Replay(ctx, p.Client)
+	if err != nil {
+		return errors.Wrapf(err, "could not replay spooled task statuses, %d sent", n)
+	}
+	logrus.Infof("replayed %d spooled task statuses", n)
+	return nil
 }
 
 // Get preferred outbound ip of this machine. It returns a fake IP in case of errors.
@@ -0,0 +1,55 @@
+package poller
+
+import "sync"
+
+// pool runs the executors and resizes them while polling. Executors
+// which are removed finish their current task before they stop.
+type pool struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	done    <-chan struct{} // no executors are started once it is closed
+	running map[int]chan struct{}
+	run     func(i int, stop <-chan struct{})
+}
+
+func newPool(done <-chan struct{}, run func(i int, stop <-chan struct{})) *pool {
+	return &pool{
+		done:    done,
+		running: map[int]chan struct{}{},
+		run:     run,
+	}
+}
+
+// resize starts or stops executors so that n of them are running
+func (e *pool) resize(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	select {
+	case <-e.done:
+		return
+	default:
+	}
+	for i, stop := range e.running {
+		if i >= n {
+			close(stop)
+			delete(e.running, i)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if _, ok := e.running[i]; ok {
+			continue
+		}
+		stop := make(chan struct{})
+		e.running[i] = stop
+		e.wg.Add(1)
+		go func(i int) {
+			defer e.wg.Done()
+			e.run(i, stop)
+		}(i)
+	}
+}
+
+// wait blocks until all the executors stopped
+func (e *pool) wait() {
+	e.wg.Wait()
+}
@@ -0,0 +1,121 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/queue"
+)
+
+// maxQueueAttempts is the number of times the handler of a queued task is
+// started before the task is failed on recovery
+const maxQueueAttempts = 3
+
+// enqueue adds an acquired task to the durable queue
+func (p *Poller) enqueue(delegateID string, t *client.Task) {
+	if p.Queue == nil {
+		return
+	}
+	if err := p.Queue.Push(&queue.Entry{DelegateID: delegateID, Task: t}); err != nil {
+		logrus.WithError(err).WithField("task_id", t.ID).Warnln("could not add task to the durable queue")
+	}
+}
+
+// started records that the handler of the task is started and returns the
+// number of times it was started. It is greater than 1 for tasks which are
+// executed again after a crash.
+func (p *Poller) started(taskID string) int {
+	if p.Queue == nil {
+		return 1
+	}
+	n, err := p.Queue.Started(taskID)
+	if err != nil {
+		logrus.WithError(err).WithField("task_id", taskID).Warnln("could not record task start in the durable queue")
+		return 1
+	}
+	return n
+}
+
+// dequeue removes a task once it was executed. Tasks whose final status
+// could neither be sent nor spooled stay in the queue and are executed again
+// after a restart. Tasks which failed otherwise, e.g. whose rejection could
+// not be sent, are removed as executing them again would not help.
+func (p *Poller) dequeue(t *client.Task) {
+	if p.Queue != nil {
+		if _, lost := p.lost.Load(t.ID); lost {
+			logrus.WithField("task_id", t.ID).Warnln("task stays in the durable queue")
+			return
+		}
+		if err := p.Queue.Remove(t.ID); err != nil {
+			logrus.WithError(err).WithField("task_id", t.ID).Warnln("could not remove task from the durable queue")
+		}
+	}
+	if t.Payload != nil {
+		t.Payload.Remove()
+	}
+}
+
+// recoverTasks recovers the tasks left by a previous run. The durable queue
+// is read once, before any recovered task is executed, so that the tasks
+// which are executed again are never failed by recoverLedger.
+func (p *Poller) recoverTasks(ctx context.Context, out chan<- work, since time.Time) {
+	var entries []*queue.Entry
+	if p.Queue != nil {
+		var err error
+		if entries, err = p.Queue.List(); err != nil {
+			logrus.WithError(err).Errorln("could not read the durable queue")
+			return
+		}
+	}
+	queued := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		queued[e.Task.ID] = true
+	}
+	go p.recoverQueue(ctx, out, entries)
+	p.recoverLedger(ctx, since, queued)
+}
+
+// recoverQueue hands the tasks left in the durable queue by a previous run
+// to the executors. The tasks whose handler was started maxQueueAttempts
+// times already, e.g. because it crashes the runner, are failed instead.
+func (p *Poller) recoverQueue(ctx context.Context, out chan<- work, entries []*queue.Entry) {
+	for _, e := range entries {
+		if e.Attempts >= maxQueueAttempts {
+			p.failRecovered(ctx, e)
+			continue
+		}
+		logrus.WithField("task_id", e.Task.ID).WithField("attempts", e.Attempts).
+			Infoln("executing task recovered from the durable queue")
+		w := work{
+			ev:         client.TaskEvent{AccountID: p.AccountID, TaskID: e.Task.ID},
+			task:       e.Task,
+			delegateID: e.DelegateID,
+			recovered:  true,
+		}
+		select {
+		case out <- w:
+		case <-ctx.Done():
+			return
+		case <-p.drainCh:
+			return
+		}
+	}
+}
+
+// failRecovered fails a task of the durable queue which is not executed again
+func (p *Poller) failRecovered(ctx context.Context, e *queue.Entry) {
+	logrus.WithField("task_id", e.Task.ID).WithField("attempts", e.Attempts).
+		Errorln("failing task recovered from the durable queue, its handler was started too many times")
+	te := &client.TaskError{
+		Code:     "TASK_ATTEMPTS_EXCEEDED",
+		Category: client.CategoryInfrastructure,
+		Message:  fmt.Sprintf("the handler of the task was started %d times without completing", e.Attempts),
+	}
+	if err := p.sendStatus(ctx, e.DelegateID, &client.TaskResponse{ID: e.Task.ID, Code: taskCode(te), Type: e.Task.Type, Error: te}, 0); err != nil {
+		logrus.WithError(err).WithField("task_id", e.Task.ID).Errorln("could not fail task recovered from the durable queue")
+	}
+	p.dequeue(e.Task)
+}
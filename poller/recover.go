@@ -0,0 +1,65 @@
+package poller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/task"
+)
+
+// PanicError is returned when a task handler panics
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task handler panicked: %v", e.Value)
+}
+
+// Serve runs the handler and recovers from any panic so that a misbehaving
+// handler can not take down the poller. A panic is returned as a *PanicError.
+func Serve(h task.Handler, w http.ResponseWriter, r *http.Request) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	h.ServeHTTP(w, r)
+	return nil
+}
+
+// TaskError returns the task error reported for a panicking handler
+func (e *PanicError) TaskError() *client.TaskError {
+	return &client.TaskError{
+		Code:     "HANDLER_PANIC",
+		Category: client.CategoryInternal,
+		Message:  e.Error(),
+	}
+}
+
+// panicResponse returns the task response data reported for a panicking handler
+func panicResponse(e *PanicError) json.RawMessage {
+	b, _ := json.Marshal(map[string]string{
+		"error": e.Error(),
+		"stack": string(e.Stack),
+	})
+	return b
+}
+
+// invalidResponse is sent instead of a response which failed validation
+func invalidResponse(r *client.TaskResponse, err error) *client.TaskResponse {
+	return &client.TaskResponse{
+		ID:   r.ID,
+		Type: r.Type,
+		Code: client.CodeFailed,
+		Error: &client.TaskError{
+			Code:     "INVALID_RESPONSE",
+			Category: client.CategoryInternal,
+			Message:  err.Error(),
+		},
+	}
+}
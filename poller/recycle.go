@@ -0,0 +1,61 @@
+package poller
+
+import (
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// remaining returns the number of tasks which can still be acquired before the
+// poller is recycled, or -1 if there is no limit.
+func (p *Poller) remaining() int {
+	if p.MaxTasksBeforeRecycle <= 0 {
+		return -1
+	}
+	n := p.MaxTasksBeforeRecycle - int(atomic.LoadInt64(&p.acquired))
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// reserve reserves one task out of the recycle limit. It returns false
+// if the limit has been reached.
+func (p *Poller) reserve() bool {
+	return p.reserveN(1) == 1
+}
+
+// reserveN reserves up to n tasks out of the recycle limit and returns the number reserved
+func (p *Poller) reserveN(n int) int {
+	if p.MaxTasksBeforeRecycle <= 0 {
+		return n
+	}
+	for {
+		cur := atomic.LoadInt64(&p.acquired)
+		left := int64(p.MaxTasksBeforeRecycle) - cur
+		if left <= 0 {
+			return 0
+		}
+		if int64(n) > left {
+			n = int(left)
+		}
+		if atomic.CompareAndSwapInt64(&p.acquired, cur, cur+int64(n)) {
+			return n
+		}
+	}
+}
+
+// release gives back reservations for tasks which were not acquired
+func (p *Poller) release(n int) {
+	if p.MaxTasksBeforeRecycle > 0 && n > 0 {
+		atomic.AddInt64(&p.acquired, -int64(n))
+	}
+}
+
+// checkRecycle drains the poller once the recycle limit has been reached
+func (p *Poller) checkRecycle() {
+	if p.remaining() == 0 {
+		logrus.Infof("acquired %d tasks, recycling the runner", p.MaxTasksBeforeRecycle)
+		p.Drain()
+	}
+}
@@ -0,0 +1,18 @@
+package poller
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+)
+
+// reject gives the task back to the server so it can be assigned to another runner
+func (p *Poller) reject(ctx context.Context, delegateID string, t *client.Task, r *client.RejectRequest, i int) error {
+	logrus.Warnf("[Thread %d]: rejecting taskID: %s of type: %s: %s", i, t.ID, t.Type, r.Reason)
+	if err := p.Client.Reject(ctx, delegateID, t.ID, r); err != nil {
+		return errors.Wrap(err, "failed to reject task")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package poller
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetTags changes the tags of the runner. They are sent to the
+// server with the next heartbeat.
+func (p *Poller) SetTags(tags []string) {
+	p.mu.Lock()
+	p.Tags = tags
+	p.mu.Unlock()
+}
+
+func (p *Poller) tags() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.Tags
+}
+
+// SetPollInterval changes the interval between two polls for task events
+// of a running poller. It takes effect after the current poll cycle.
+func (p *Poller) SetPollInterval(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	atomic.StoreInt64(&p.pollInterval, int64(d))
+}
+
+func (p *Poller) interval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.pollInterval))
+}
+
+// SetParallelism changes the number of executors of a running poller without
+// interrupting the tasks which are being executed.
+func (p *Poller) SetParallelism(n int) {
+	if n < 1 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old := atomic.SwapInt32(&p.parallelism, int32(n)); old != int32(n) && p.executors != nil && !p.Draining() {
+		logrus.Infof("changing the number of executors from %d to %d", old, n)
+		p.executors.resize(n)
+	}
+}
+
+func (p *Poller) parallel() int {
+	return int(atomic.LoadInt32(&p.parallelism))
+}
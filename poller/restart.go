@@ -0,0 +1,26 @@
+package poller
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+)
+
+// ErrNotRestartable is returned by Restart if the poller was not created with New
+var ErrNotRestartable = errors.New("poller was not created with New and can not be restarted")
+
+// Restart replaces the client of the poller, e.g. after the credentials were
+// rotated or the manager endpoint changed. The runner stays registered, tasks
+// which are being executed keep running and report their status through the
+// new client.
+func (p *Poller) Restart(c client.Client) error {
+	sw, ok := p.Client.(*client.Switch)
+	if !ok {
+		return ErrNotRestartable
+	}
+	sw.Set(c)
+	logrus.WithField("in_flight", atomic.LoadInt32(&p.inflight)).Infoln("restarted poller with a new client")
+	return nil
+}
@@ -0,0 +1,74 @@
+package poller
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ShutdownReport summarizes the work of the poller once it stopped, so that
+// the orchestration recycling runners can verify that no task was dropped
+type ShutdownReport struct {
+	DelegateID string    `json:"delegate_id,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	StoppedAt  time.Time `json:"stopped_at"`
+	Uptime     float64   `json:"uptime_seconds"`
+	Drained    bool      `json:"drained"`
+	Completed  int64     `json:"completed"`
+	Failed     int64     `json:"failed"`
+	// Abandoned are the IDs of the acquired tasks whose final status was not
+	// sent, e.g. tasks which were still queued or daemons which were running
+	Abandoned []string `json:"abandoned"`
+	// Lost are the IDs of the tasks whose status could neither be sent nor
+	// kept in the spool or the store
+	Lost []string `json:"lost"`
+	// UnsentStatuses is the number of statuses kept in the spool or the store,
+	// which are sent once a runner using them is started again
+	UnsentStatuses int `json:"unsent_statuses"`
+	// Queued is the number of tasks kept in the durable queue, which are
+	// executed once a runner using it is started again
+	Queued int `json:"queued"`
+}
+
+// ShutdownReport returns the summary of the work of the poller. It should be
+// called once Poll returned.
+func (p *Poller) ShutdownReport(ctx context.Context) *ShutdownReport {
+	p.init()
+	now := time.Now()
+	r := &ShutdownReport{
+		StartedAt: p.startedAt,
+		StoppedAt: now,
+		Uptime:    now.Sub(p.startedAt).Seconds(),
+		Drained:   p.Draining(),
+		Completed: atomic.LoadInt64(&p.stats.completed),
+		Failed:    atomic.LoadInt64(&p.stats.failed),
+		Abandoned: []string{},
+		Lost:      []string{},
+	}
+	if id, ok := p.stats.delegateID.Load().(string); ok {
+		r.DelegateID = id
+	}
+	p.m.Range(func(k, _ interface{}) bool {
+		r.Abandoned = append(r.Abandoned, k.(string))
+		return true
+	})
+	p.lost.Range(func(k, _ interface{}) bool {
+		r.Lost = append(r.Lost, k.(string))
+		return true
+	})
+	sort.Strings(r.Abandoned)
+	sort.Strings(r.Lost)
+	switch {
+	case p.Spool != nil:
+		r.UnsentStatuses = p.Spool.Len()
+	case p.Store != nil:
+		if entries, err := p.Store.ListStatuses(ctx); err == nil {
+			r.UnsentStatuses = len(entries)
+		}
+	}
+	if p.Queue != nil {
+		r.Queued = p.Queue.Len()
+	}
+	return r
+}
@@ -0,0 +1,52 @@
+package poller
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/httphelper"
+)
+
+// Standby makes the poller a warm standby: the runner stays registered and
+// keeps sending heartbeats, but does not acquire tasks until it is promoted.
+// A standby runner takes over within a poll interval of its promotion as it
+// does not need to register first.
+func (p *Poller) Standby() {
+	if atomic.CompareAndSwapInt32(&p.standby, 0, 1) {
+		logrus.Infoln("runner is in standby")
+	}
+	p.Pause()
+}
+
+// Promote makes a standby poller active, it polls for tasks immediately
+func (p *Poller) Promote() {
+	if atomic.CompareAndSwapInt32(&p.standby, 1, 0) {
+		logrus.Infoln("promoting standby runner to active")
+	}
+	p.Resume()
+}
+
+// InStandby returns true if the poller is a warm standby
+func (p *Poller) InStandby() bool {
+	return atomic.LoadInt32(&p.standby) == 1
+}
+
+// PromoteHandler returns an http.Handler which promotes the poller on POST
+// and moves it to standby on DELETE. It renders the stats. Requests must be
+// authorized with the bearer token, all of them are rejected if it is empty.
+func (p *Poller) PromoteHandler(token string) http.Handler {
+	return httphelper.RequireToken(token, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			p.Promote()
+		case http.MethodDelete:
+			p.Standby()
+		case http.MethodGet:
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		httphelper.WriteJSON(w, p.Stats(), http.StatusOK)
+	}))
+}
@@ -0,0 +1,103 @@
+package poller
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/httphelper"
+	"github.com/wings-software/dlite/support"
+)
+
+// Stats is a snapshot of the state of the poller
+type Stats struct {
+	Registered    bool       `json:"registered"`
+	DelegateID    string     `json:"delegate_id,omitempty"`
+	LastHeartbeat *time.Time `json:"last_heartbeat,omitempty"`
+	InFlight      int        `json:"in_flight"`   // tasks being executed
+	Completed     int64      `json:"completed"`   // tasks completed successfully
+	Failed        int64      `json:"failed"`      // tasks which failed
+	QueueDepth    int        `json:"queue_depth"` // task events waiting for an executor
+	Scheduled     int        `json:"scheduled"`   // tasks held until their not-before time
+	Daemons       int        `json:"daemons"`
+	Paused        bool       `json:"paused"`
+	Standby       bool       `json:"standby"`
+	Draining      bool       `json:"draining"`
+
+	// Health is the state of the connection to the server and
+	// HeartbeatFailures the number of consecutive heartbeat failures
+	Health            Health `json:"health,omitempty"`
+	HeartbeatFailures int    `json:"heartbeat_failures"`
+}
+
+// pollState is the state of a running Poll call
+type pollState struct {
+	queue  chan work
+	delays *delayQueue
+}
+
+// counters tracks the statistics of the poller
+type counters struct {
+	delegateID    atomic.Value // string
+	lastHeartbeat int64        // unix time in nanoseconds
+	completed     int64
+	failed        int64
+	poll          atomic.Value // *pollState
+}
+
+// Stats returns a snapshot of the state of the poller
+func (p *Poller) Stats() Stats {
+	s := Stats{
+		InFlight:  int(atomic.LoadInt32(&p.inflight)),
+		Completed: atomic.LoadInt64(&p.stats.completed),
+		Failed:    atomic.LoadInt64(&p.stats.failed),
+		Daemons:   len(p.Daemons.Running()),
+		Paused:    p.Paused() || p.suspended(),
+		Standby:   p.InStandby(),
+		Draining:  p.Draining(),
+	}
+	s.Health, s.HeartbeatFailures = p.healthState()
+	if id, ok := p.stats.delegateID.Load().(string); ok {
+		s.Registered = true
+		s.DelegateID = id
+	}
+	if t := atomic.LoadInt64(&p.stats.lastHeartbeat); t > 0 {
+		hb := time.Unix(0, t)
+		s.LastHeartbeat = &hb
+	}
+	if ps, ok := p.stats.poll.Load().(*pollState); ok {
+		s.QueueDepth = len(ps.queue)
+		s.Scheduled = ps.delays.len()
+	}
+	return s
+}
+
+// SupportBundle returns a support bundle with the stats and the jobs of the
+// poller and a dump of the goroutines. The config, the logs and the traces
+// of the requests are added by the caller.
+func (p *Poller) SupportBundle() *support.Bundle {
+	b := &support.Bundle{Stats: p.Stats(), Jobs: p.Jobs(), Goroutines: true}
+	if p.Decisions != nil {
+		b.Decisions = p.Decisions.Decisions()
+	}
+	return b
+}
+
+// StatsHandler returns an http.Handler which renders the stats as JSON
+func (p *Poller) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httphelper.WriteJSON(w, p.Stats(), http.StatusOK)
+	})
+}
+
+// countStatus counts the task status sent to the server
+func (p *Poller) countStatus(r *client.TaskResponse) {
+	switch r.Code {
+	case client.CodeFailed:
+		atomic.AddInt64(&p.stats.failed, 1)
+	case client.CodeRunning:
+	default:
+		atomic.AddInt64(&p.stats.completed, 1)
+	}
+}
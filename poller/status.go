@@ -0,0 +1,99 @@
+package poller
+
+import (
+	"context"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// defaultStatusBatchSize is the maximum number of statuses sent in a single call
+const defaultStatusBatchSize = 50
+
+// statusRequest is a status waiting to be sent by the batcher
+type statusRequest struct {
+	resp *client.TaskResponse
+	done chan error
+}
+
+// statusBatcher collects the statuses of tasks which complete within a short
+// window and sends them in a single call.
+type statusBatcher struct {
+	client     client.Client
+	delegateID string
+	window     time.Duration
+	size       int
+	reqs       chan *statusRequest
+	stopped    chan struct{}
+}
+
+func newStatusBatcher(c client.Client, delegateID string, window time.Duration, size int) *statusBatcher {
+	if size <= 0 {
+		size = defaultStatusBatchSize
+	}
+	return &statusBatcher{
+		client:     c,
+		delegateID: delegateID,
+		window:     window,
+		size:       size,
+		reqs:       make(chan *statusRequest),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// send queues the status and waits until the batch it is part of was sent. Once
+// the batcher is stopped, statuses are sent directly.
+func (b *statusBatcher) send(ctx context.Context, r *client.TaskResponse) error {
+	req := &statusRequest{resp: r, done: make(chan error, 1)}
+	select {
+	case b.reqs <- req:
+	case <-b.stopped:
+		return b.client.SendStatus(ctx, b.delegateID, r.ID, r)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.done
+}
+
+// run sends the queued statuses until stop is closed
+func (b *statusBatcher) run(ctx context.Context, stop <-chan struct{}) {
+	defer close(b.stopped)
+	for {
+		var batch []*statusRequest
+		select {
+		case req := <-b.reqs:
+			batch = append(batch, req)
+		case <-stop:
+			return
+		}
+		timer := time.NewTimer(b.window)
+	collect:
+		for len(batch) < b.size {
+			select {
+			case req := <-b.reqs:
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		b.flush(ctx, batch)
+	}
+}
+
+func (b *statusBatcher) flush(ctx context.Context, batch []*statusRequest) {
+	var err error
+	if len(batch) == 1 {
+		r := batch[0].resp
+		err = b.client.SendStatus(ctx, b.delegateID, r.ID, r)
+	} else {
+		responses := make([]*client.TaskResponse, len(batch))
+		for i, req := range batch {
+			responses[i] = req.resp
+		}
+		err = b.client.SendStatusBatch(ctx, b.delegateID, responses)
+	}
+	for _, req := range batch {
+		req.done <- err
+	}
+}
@@ -0,0 +1,146 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/store"
+)
+
+// claimTTL bounds the time a task stays claimed in the store, so that the tasks
+// claimed by a runner which crashed can be handled by its replicas.
+var claimTTL = 30 * time.Minute
+
+// claim claims the task so that it is handled only once. Tasks are claimed in
+// the store too, if any. If the store fails, the local claim is used.
+func (p *Poller) claim(ctx context.Context, taskID string) bool {
+	if _, loaded := p.m.LoadOrStore(taskID, true); loaded {
+		return false
+	}
+	if p.Store == nil {
+		return true
+	}
+	ok, err := p.Store.Claim(ctx, taskID, claimTTL)
+	if err != nil {
+		logrus.WithError(err).WithField("task_id", taskID).Warnln("could not claim task in the store")
+		return true
+	}
+	if !ok {
+		p.m.Delete(taskID)
+	}
+	return ok
+}
+
+// unclaim releases the claim on the task
+func (p *Poller) unclaim(taskID string) {
+	p.m.Delete(taskID)
+	if p.Store == nil {
+		return
+	}
+	if err := p.Store.Unclaim(context.Background(), taskID); err != nil {
+		logrus.WithError(err).WithField("task_id", taskID).Warnln("could not release task claim in the store")
+	}
+}
+
+// recordAcquired adds the task to the ledger of the store
+func (p *Poller) recordAcquired(ctx context.Context, delegateID string, t *client.Task) {
+	if p.Store == nil {
+		return
+	}
+	err := p.Store.PutTask(ctx, &store.TaskRecord{
+		ID:         t.ID,
+		Type:       t.Type,
+		DelegateID: delegateID,
+		State:      store.StateRunning,
+		AcquiredAt: time.Now(),
+		Runner:     p.Name,
+		Task:       t,
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("task_id", t.ID).Warnln("could not record task in the store")
+	}
+}
+
+// recordCompleted marks the task as completed in the ledger of the store
+func (p *Poller) recordCompleted(ctx context.Context, r *client.TaskResponse) {
+	if p.Store == nil {
+		return
+	}
+	rec, err := p.Store.GetTask(ctx, r.ID)
+	if err == store.ErrNotFound {
+		rec, err = &store.TaskRecord{ID: r.ID, Type: r.Type}, nil
+	}
+	if err == nil {
+		rec.State = store.StateCompleted
+		rec.Code = r.Code
+		rec.CompletedAt = time.Now()
+		rec.Task = nil
+		err = p.Store.PutTask(ctx, rec)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("task_id", r.ID).Warnln("could not record task completion in the store")
+	}
+}
+
+// recoverLedger fails the tasks which the runner left running in the ledger
+// before it was restarted, unless they are queued to be executed again from
+// the durable queue. The ledger keeps the acquired task, so the failure is
+// reported with the type and the correlation ID of the task.
+func (p *Poller) recoverLedger(ctx context.Context, since time.Time, queued map[string]bool) {
+	if p.Store == nil || p.Name == "" {
+		return
+	}
+	records, err := p.Store.ListTasks(ctx)
+	if err != nil {
+		logrus.WithError(err).Errorln("could not read the task ledger")
+		return
+	}
+	for _, rec := range records {
+		if rec.State != store.StateRunning || rec.Runner != p.Name || rec.Task == nil ||
+			!rec.AcquiredAt.Before(since) || queued[rec.ID] {
+			continue
+		}
+		// the task may have completed since the ledger was listed
+		if cur, err := p.Store.GetTask(ctx, rec.ID); err != nil || cur.State != store.StateRunning {
+			continue
+		}
+		t := rec.Task
+		logrus.WithField("task_id", t.ID).WithField("task_type", t.Type).WithField("correlation_id", t.CorrelationID).
+			WithField("acquired_at", rec.AcquiredAt).Warnln("failing task which was interrupted by a restart of the runner")
+		e := &client.TaskError{
+			Code:      "TASK_INTERRUPTED",
+			Category:  client.CategoryInfrastructure,
+			Message:   fmt.Sprintf("the runner was restarted while the task was running, it was acquired at %s", rec.AcquiredAt.Format(time.RFC3339)),
+			Retryable: true,
+		}
+		if err := p.sendStatus(ctx, rec.DelegateID, &client.TaskResponse{ID: t.ID, Code: taskCode(e), Type: t.Type, Error: e}, 0); err != nil {
+			logrus.WithError(err).WithField("task_id", t.ID).Errorln("could not fail task which was interrupted by a restart")
+			continue
+		}
+		p.unclaim(t.ID)
+	}
+}
+
+// replayStore tries to send the task statuses kept in the store to the server
+func (p *Poller) replayStore(ctx context.Context) error {
+	entries, err := p.Store.ListStatuses(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not list the stored task statuses")
+	}
+	for i, e := range entries {
+		if err := p.Client.SendStatus(ctx, e.DelegateID, e.TaskID, e.Response); err != nil {
+			return errors.Wrapf(err, "could not replay stored task statuses, %d sent", i)
+		}
+		if err := p.Store.DeleteStatus(ctx, e.TaskID); err != nil {
+			return errors.Wrap(err, "could not delete replayed task status")
+		}
+	}
+	if len(entries) > 0 {
+		logrus.Infof("replayed %d stored task statuses", len(entries))
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package poller
+
+import (
+	"context"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/taskcache"
+)
+
+// withPayloadCache caches the payload of the acquired task and returns a copy
+// of the context which carries the cache, through which handlers look up
+// the payloads of tasks they process again
+func (p *Poller) withPayloadCache(ctx context.Context, t *client.Task) context.Context {
+	if p.PayloadCache == nil {
+		return ctx
+	}
+	if len(t.Data) > 0 {
+		p.PayloadCache.Put(t.ID, t.Data)
+	}
+	return taskcache.NewContext(ctx, p.PayloadCache)
+}
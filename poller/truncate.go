@@ -0,0 +1,95 @@
+package poller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/metrics"
+)
+
+// Strategies of truncating task response data which is too large
+const (
+	TruncateHeadTail = "head_tail" // keeps the head and the tail of the data
+	TruncateHead     = "head"      // keeps the head of the data
+)
+
+// truncatedData replaces task response data which is too large. The kept
+// parts are strings, so that the truncated data is valid JSON.
+type truncatedData struct {
+	Truncated    bool   `json:"dlite_truncated"`
+	OriginalSize int    `json:"original_size"`
+	SHA256       string `json:"sha256"` // of the original data
+	Head         string `json:"head"`
+	Marker       string `json:"marker"`
+	Tail         string `json:"tail,omitempty"`
+}
+
+// maxResponseDataSize returns the maximum size of the task response data
+func (p *Poller) maxResponseDataSize() int {
+	if p.MaxResponseDataSize <= 0 || p.MaxResponseDataSize > client.MaxDataSize {
+		return client.MaxDataSize
+	}
+	return p.MaxResponseDataSize
+}
+
+// truncate replaces the data of the response with its truncation if it is
+// larger than the maximum size and a truncation strategy is set
+func (p *Poller) truncate(r *client.TaskResponse) {
+	limit := p.maxResponseDataSize()
+	if p.Truncation == "" || len(r.Data) <= limit {
+		return
+	}
+	sum := sha256.Sum256(r.Data)
+	d := &truncatedData{Truncated: true, OriginalSize: len(r.Data), SHA256: hex.EncodeToString(sum[:])}
+	d.Marker = fmt.Sprintf("[truncated %d of %d bytes]", len(r.Data), len(r.Data))
+	envelope, _ := json.Marshal(d)
+	// the encoding escapes characters, so the kept size shrinks until
+	// the truncation fits
+	keep := limit - len(envelope)
+	for keep > 0 {
+		head, tail := keep, 0
+		if p.Truncation == TruncateHeadTail {
+			head, tail = keep/2, keep-keep/2
+		}
+		d.Head = string(r.Data[:runeStart(r.Data, head)])
+		d.Tail = string(r.Data[runeStart(r.Data, len(r.Data)-tail):])
+		d.Marker = fmt.Sprintf("[truncated %d of %d bytes]", len(r.Data)-len(d.Head)-len(d.Tail), len(r.Data))
+		b, err := json.Marshal(d)
+		if err != nil {
+			break
+		}
+		if len(b) <= limit {
+			logrus.WithField("task_id", r.ID).WithField("size", len(r.Data)).WithField("limit", limit).
+				Warnln("truncating task response data which is too large")
+			p.observeTruncation(r, len(r.Data)-len(b))
+			r.Data = b
+			return
+		}
+		keep -= len(b) - limit + 16
+	}
+}
+
+// runeStart returns the start of the rune at or before i, so that the
+// data is not cut in the middle of a character
+func runeStart(b []byte, i int) int {
+	for i > 0 && i < len(b) && !utf8.RuneStart(b[i]) {
+		i--
+	}
+	return i
+}
+
+// observeTruncation records a truncated task response
+func (p *Poller) observeTruncation(r *client.TaskResponse, removed int) {
+	if p.Metrics == nil {
+		return
+	}
+	labels := metrics.Labels{"task_type": r.Type}
+	p.Metrics.Counter("dlite_task_responses_truncated_total", "Task responses whose data was truncated by type.", labels).Inc()
+	p.Metrics.Counter("dlite_task_response_truncated_bytes_total", "Bytes removed from truncated task responses by type.", labels).
+		Add(float64(removed))
+}
@@ -0,0 +1,41 @@
+package poller
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/scheduler"
+	"github.com/wings-software/dlite/version"
+)
+
+// UpgradeRequired returns true once the server has reported that
+// the runner needs to be upgraded.
+func (p *Poller) UpgradeRequired() bool {
+	return atomic.LoadInt32(&p.upgradeRequired) == 1
+}
+
+// checkUpgrade returns a job which asks the server whether the runner needs to be
+// upgraded. The job stops once an upgrade is required.
+func (p *Poller) checkUpgrade(id string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		resp, err := p.Client.CheckUpgrade(ctx, id, version.Version)
+		if err != nil {
+			return errors.Wrap(err, "could not check for upgrades")
+		}
+		if !resp.Resource.Upgrade {
+			return nil
+		}
+		logrus.WithField("current", version.Version).WithField("version", resp.Resource.Version).
+			Warnln("runner needs to be upgraded")
+		atomic.StoreInt32(&p.upgradeRequired, 1)
+		if p.OnUpgrade != nil {
+			p.OnUpgrade(&resp.Resource)
+		}
+		if p.DrainOnUpgrade {
+			p.Drain()
+		}
+		return scheduler.ErrStop
+	}
+}
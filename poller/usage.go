@@ -0,0 +1,106 @@
+package poller
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/metrics"
+)
+
+// usageSampleInterval is the interval at which the memory of the process is
+// sampled while a task handler runs
+var usageSampleInterval = 100 * time.Millisecond
+
+// usageMeter measures the resources consumed while a task handler runs
+type usageMeter struct {
+	p        *Poller
+	reader   usageReader
+	start    time.Time
+	startCPU time.Duration
+	cpuOK    bool
+	startRSS int64
+	rssOK    bool
+
+	mu     sync.Mutex
+	peak   int64
+	shared bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// meterUsage starts measuring the resources of a task handler, it returns
+// nil unless resource accounting is enabled
+func (p *Poller) meterUsage() *usageMeter {
+	if !p.ResourceAccounting {
+		return nil
+	}
+	r := newUsageReader()
+	m := &usageMeter{p: p, reader: r, start: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+	m.startCPU, m.cpuOK = r.cpuTime()
+	m.startRSS, m.rssOK = r.rss()
+	m.peak = m.startRSS
+	go m.sample()
+	return m
+}
+
+// sample tracks the peak memory and whether other tasks ran concurrently
+func (m *usageMeter) sample() {
+	defer close(m.done)
+	t := time.NewTicker(usageSampleInterval)
+	defer t.Stop()
+	for {
+		m.observe()
+		select {
+		case <-m.stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (m *usageMeter) observe() {
+	rss, ok := m.reader.rss()
+	shared := atomic.LoadInt32(&m.p.inflight) > 1
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ok && rss > m.peak {
+		m.peak = rss
+	}
+	m.shared = m.shared || shared
+}
+
+// finish stops measuring and returns the usage, nil for a nil meter
+func (m *usageMeter) finish() *client.ResourceUsage {
+	if m == nil {
+		return nil
+	}
+	close(m.stop)
+	<-m.done
+	m.observe()
+	u := &client.ResourceUsage{
+		WallTimeMs: time.Since(m.start).Milliseconds(),
+		Source:     m.reader.source(),
+		Shared:     m.shared,
+	}
+	if cpu, ok := m.reader.cpuTime(); ok && m.cpuOK {
+		u.CPUTimeMs = (cpu - m.startCPU).Milliseconds()
+	}
+	if m.rssOK {
+		u.PeakRSSDeltaBytes = m.peak - m.startRSS
+	}
+	return u
+}
+
+// observeUsage records the resources consumed by a task
+func (p *Poller) observeUsage(taskType string, u *client.ResourceUsage) {
+	if p.Metrics == nil || u == nil {
+		return
+	}
+	labels := metrics.Labels{"task_type": taskType}
+	p.Metrics.Counter("dlite_task_cpu_seconds_total", "Total CPU time consumed while executing tasks by type.", labels).
+		Add(float64(u.CPUTimeMs) / 1000)
+	p.Metrics.Gauge("dlite_task_peak_rss_delta_bytes", "Peak resident memory above the start of the last task by type.", labels).
+		Set(float64(u.PeakRSSDeltaBytes))
+}
@@ -0,0 +1,86 @@
+package poller
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cgroupDir is the cgroup v2 mount. The root cgroup has no memory.current,
+// so the cgroup is only used if the runner was placed in a cgroup of its
+// own, e.g. in a container.
+const cgroupDir = "/sys/fs/cgroup"
+
+// usageReader reads the resource usage of the process or its cgroup
+type usageReader struct {
+	cgroup bool
+}
+
+func newUsageReader() usageReader {
+	_, err := os.Stat(cgroupDir + "/memory.current")
+	return usageReader{cgroup: err == nil}
+}
+
+func (r usageReader) source() string {
+	if r.cgroup {
+		return "cgroup"
+	}
+	return "process"
+}
+
+// cpuTime returns the CPU time consumed so far
+func (r usageReader) cpuTime() (time.Duration, bool) {
+	if r.cgroup {
+		b, err := os.ReadFile(cgroupDir + "/cpu.stat")
+		if err != nil {
+			return 0, false
+		}
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for s.Scan() {
+			if k, v, ok := strings.Cut(s.Text(), " "); ok && k == "usage_usec" {
+				n, err := strconv.ParseInt(v, 10, 64)
+				return time.Duration(n) * time.Microsecond, err == nil
+			}
+		}
+		return 0, false
+	}
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, false
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
+
+// rss returns the resident memory in bytes
+func (r usageReader) rss() (int64, bool) {
+	if r.cgroup {
+		b, err := os.ReadFile(cgroupDir + "/memory.current")
+		if err != nil {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		return n, err == nil
+	}
+	b, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0, false
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), ":")
+		if !ok || k != "VmRSS" {
+			continue
+		}
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(fields[0], 10, 64)
+		return n * 1024, err == nil
+	}
+	return 0, false
+}
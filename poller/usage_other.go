@@ -0,0 +1,16 @@
+//go:build !linux
+
+package poller
+
+import "time"
+
+// usageReader only measures the wall time on platforms without procfs
+type usageReader struct{}
+
+func newUsageReader() usageReader { return usageReader{} }
+
+func (usageReader) source() string { return "process" }
+
+func (usageReader) cpuTime() (time.Duration, bool) { return 0, false }
+
+func (usageReader) rss() (int64, bool) { return 0, false }
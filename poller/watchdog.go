@@ -0,0 +1,115 @@
+package poller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/task"
+)
+
+// UnresponsiveError is returned when a task handler did not return within
+// the watchdog grace period after its context was done
+type UnresponsiveError struct {
+	Grace time.Duration
+	Stack []byte        // stack of the goroutine running the handler
+	done  chan struct{} // closed once the handler returned
+}
+
+func (e *UnresponsiveError) Error() string {
+	return fmt.Sprintf("task handler did not return within %s after it was canceled", e.Grace)
+}
+
+// TaskError returns the task error reported for an unresponsive handler
+func (e *UnresponsiveError) TaskError() *client.TaskError {
+	return &client.TaskError{
+		Code:     "HANDLER_UNRESPONSIVE",
+		Category: client.CategoryInternal,
+		Message:  e.Error(),
+	}
+}
+
+// serveWatched runs the handler like Serve. If WatchdogGrace is set and the
+// handler does not return within the grace period once its context is done,
+// e.g. because the task timed out, the stack of the handler is dumped and an
+// UnresponsiveError is returned while the handler keeps running.
+func (p *Poller) serveWatched(ctx context.Context, h task.Handler, w http.ResponseWriter, r *http.Request) error {
+	if p.WatchdogGrace <= 0 {
+		return Serve(h, w, r)
+	}
+	var (
+		result = make(chan error, 1)
+		done   = make(chan struct{})
+		gid    = make(chan int64, 1)
+	)
+	go func() {
+		defer close(done)
+		gid <- goroutineID()
+		result <- Serve(h, w, r)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+	}
+	timer := time.NewTimer(p.WatchdogGrace)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+	}
+	return &UnresponsiveError{Grace: p.WatchdogGrace, Stack: goroutineStack(<-gid), done: done}
+}
+
+// unresponsive fails the task of an unresponsive handler. Unless
+// WatchdogRestart is set, the executor waits for the handler to return
+// before it takes the next task.
+func (p *Poller) unresponsive(ctx context.Context, delegateID string, t *client.Task, uerr *UnresponsiveError, i int) error {
+	logrus.WithField("stack", string(uerr.Stack)).Errorf("[Thread %d]: handler for taskID: %s of type: %s is unresponsive", i, t.ID, t.Type)
+	err := p.sendStatus(ctx, delegateID, &client.TaskResponse{
+		ID:    t.ID,
+		Code:  client.CodeFailed,
+		Type:  t.Type,
+		Error: uerr.TaskError(),
+	}, i)
+	if p.WatchdogRestart {
+		logrus.Warnf("[Thread %d]: abandoning the handler for taskID: %s and restarting the executor", i, t.ID)
+		return err
+	}
+	<-uerr.done
+	return err
+}
+
+// goroutineID returns the ID of the calling goroutine
+func goroutineID() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// goroutine 123 [running]:
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		id, _ := strconv.ParseInt(string(buf[:i]), 10, 64)
+		return id
+	}
+	return 0
+}
+
+// goroutineStack returns the stack of the goroutine, all the stacks if it
+// can not be found
+func goroutineStack(id int64) []byte {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	prefix := []byte(fmt.Sprintf("goroutine %d [", id))
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, prefix) {
+			return stack
+		}
+	}
+	return buf
+}
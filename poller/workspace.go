@@ -0,0 +1,88 @@
+package poller
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/workspace"
+)
+
+// defaultQuotaCheckInterval is the default interval at which the disk usage
+// of a workspace is checked against its quota
+var defaultQuotaCheckInterval = 10 * time.Second
+
+// taskWorkspace is the workspace of a running task
+type taskWorkspace struct {
+	ws       *workspace.Workspace
+	stop     chan struct{}
+	exceeded int32
+}
+
+// withWorkspace allocates the workspace of the task and returns a copy of the
+// context which carries it. The context is canceled once the workspace exceeds
+// its quota. Tasks have no workspace if the poller has no workspace manager.
+func (p *Poller) withWorkspace(ctx context.Context, cancel context.CancelFunc, t *client.Task) (context.Context, *taskWorkspace, error) {
+	if p.Workspaces == nil {
+		return ctx, nil, nil
+	}
+	ws, err := p.Workspaces.Create(t.ID)
+	if err != nil {
+		return ctx, nil, err
+	}
+	w := &taskWorkspace{ws: ws, stop: make(chan struct{})}
+	if ws.Quota > 0 {
+		interval := p.QuotaCheckInterval
+		if interval <= 0 {
+			interval = defaultQuotaCheckInterval
+		}
+		go w.watch(interval, cancel)
+	}
+	return workspace.NewContext(ctx, ws), w, nil
+}
+
+// watch cancels the task once its workspace exceeds the quota
+func (w *taskWorkspace) watch(interval time.Duration, cancel context.CancelFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if w.ws.Exceeded() {
+				atomic.StoreInt32(&w.exceeded, 1)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// quotaExceeded reports whether the task was canceled for exceeding the quota
+func (w *taskWorkspace) quotaExceeded() bool {
+	return w != nil && (atomic.LoadInt32(&w.exceeded) == 1 || w.ws.Exceeded())
+}
+
+// release stops watching the workspace and removes it
+func (w *taskWorkspace) release() {
+	if w == nil {
+		return
+	}
+	close(w.stop)
+	if err := w.ws.Remove(); err != nil {
+		logrus.WithError(err).WithField("path", w.ws.Path).Warnln("could not remove task workspace")
+	}
+}
+
+// workspaceError is the error of tasks which could not run in their workspace
+func workspaceError(code, message string, retryable bool) *client.TaskError {
+	return &client.TaskError{
+		Code:      code,
+		Category:  client.CategoryInfrastructure,
+		Message:   message,
+		Retryable: retryable,
+	}
+}
@@ -2,14 +2,19 @@ package poller
 
 import (
 	"bytes"
+	"io"
 	"net/http"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/task"
 )
 
-// response implements http.ResponseWriter
+// response implements http.ResponseWriter and task.StreamWriter
 type response struct {
 	buf    bytes.Buffer
 	header http.Header
 	status int
+	out    *output // incremental output, discarded if nil
 }
 
 func (r *response) Header() http.Header {
@@ -24,6 +29,36 @@ func (r *response) Write(p []byte) (n int, err error) {
 	return r.buf.Write(p)
 }
 
+// Output returns the writer of the incremental output of the task
+func (r *response) Output() io.Writer {
+	if r.out == nil {
+		return io.Discard
+	}
+	return r.out
+}
+
+// Flush sends the pending incremental output
+func (r *response) Flush() {
+	if r.out != nil {
+		r.out.flush()
+	}
+}
+
 func NewResponseWriter() *response { //nolint:revive
 	return &response{header: map[string][]string{}, buf: bytes.Buffer{}}
 }
+
+// rejection returns the rejection written by the handler, if any
+func rejection(w *response) (*task.RejectTask, bool) {
+	return task.Rejection(w.header, w.buf.Bytes())
+}
+
+// taskError returns the structured error written by the handler, if any
+func taskError(w *response) (*client.TaskError, bool) {
+	return task.ErrorFrom(w.header, w.buf.Bytes())
+}
+
+// taskCode returns the response code for a failed task
+func taskCode(e *client.TaskError) string {
+	return task.ResponseCode(e)
+}
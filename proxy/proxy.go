@@ -0,0 +1,71 @@
+// Package proxy provides a task handler which forwards tasks to an HTTP
+// service, so that task types can be implemented by services not written in Go.
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/task"
+)
+
+// Handler forwards the task payload to the URL with a POST request and relays the
+// response of the service as the task response. Headers set by the service, e.g.
+// the task error or rejection headers, are relayed as well.
+type Handler struct {
+	URL       *url.URL
+	Timeout   time.Duration // optional, bounds the time the service has to respond
+	Transport http.RoundTripper
+
+	once  sync.Once
+	proxy *httputil.ReverseProxy
+}
+
+// New returns a handler which forwards tasks to the URL.
+func New(rawURL string, timeout time.Duration) (*Handler, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{URL: u, Timeout: timeout}, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.once.Do(func() {
+		h.proxy = &httputil.ReverseProxy{
+			Director:     h.direct,
+			Transport:    h.Transport,
+			ErrorHandler: h.error,
+		}
+	})
+	if h.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	h.proxy.ServeHTTP(w, r)
+}
+
+func (h *Handler) direct(r *http.Request) {
+	r.Method = "POST"
+	r.URL.Scheme = h.URL.Scheme
+	r.URL.Host = h.URL.Host
+	r.URL.Path = h.URL.Path
+	r.URL.RawPath = h.URL.RawPath
+	r.URL.RawQuery = h.URL.RawQuery
+	r.Host = h.URL.Host
+	r.Header.Set("Content-Type", "application/json")
+}
+
+func (h *Handler) error(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() == context.DeadlineExceeded {
+		task.WriteError(w, task.NewError("PROXY_TIMEOUT", client.CategoryTimeout, "task service did not respond in time", true, err))
+		return
+	}
+	task.WriteError(w, task.NewError("PROXY_UNAVAILABLE", client.CategoryInfrastructure, "task service is not available", true, err))
+}
@@ -0,0 +1,164 @@
+// Package queue implements a durable on-disk queue of acquired tasks. Tasks
+// are added once they were acquired and removed once their status was sent,
+// so that tasks acquired before a crash are executed again after a restart.
+package queue
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/fsname"
+	"github.com/wings-software/dlite/sealed"
+)
+
+const ext = ".json"
+
+// corruptExt is appended to the names of unreadable entries, e.g. sealed
+// with another key, which are kept for recovery but no longer listed
+const corruptExt = ".corrupt"
+
+// Entry is a queued task
+type Entry struct {
+	DelegateID string          `json:"delegate_id"`
+	Task       *client.Task    `json:"task"`
+	Payload    *client.Payload `json:"payload,omitempty"` // the file of a streamed task
+	Acquired   time.Time       `json:"acquired"`
+	// Attempts is the number of times the handler of the task was started
+	Attempts int `json:"attempts"`
+}
+
+// Queue stores entries as individual files in a directory
+type Queue struct {
+	Dir string
+	// Sealer optionally encrypts the entries
+	Sealer sealed.Sealer
+
+	mu sync.Mutex
+}
+
+// New returns a queue which stores its entries in dir
+func New(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Queue{Dir: dir}, nil
+}
+
+// Push adds a task to the queue
+func (q *Queue) Push(e *Entry) error {
+	if e.Acquired.IsZero() {
+		e.Acquired = time.Now()
+	}
+	e.Payload = e.Task.Payload
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.write(e)
+}
+
+// Started records that the handler of the task is started and returns
+// the number of times it was started, including this one.
+func (q *Queue) Started(taskID string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, err := read(q.path(taskID), q.Sealer)
+	if err != nil {
+		return 0, err
+	}
+	e.Attempts++
+	return e.Attempts, q.write(e)
+}
+
+// Remove removes the task from the queue
+func (q *Queue) Remove(taskID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err := os.Remove(q.path(taskID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List returns the queued tasks in order of acquisition. Unreadable
+// entries are renamed with the .corrupt extension and skipped.
+func (q *Queue) List() ([]*Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	files, err := os.ReadDir(q.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || !strings.HasSuffix(f.Name(), ext) {
+			continue
+		}
+		path := filepath.Join(q.Dir, f.Name())
+		e, err := read(path, q.Sealer)
+		if err != nil || e.Task == nil {
+			logrus.WithError(err).WithField("file", path).Errorln("queue: moving unreadable entry aside")
+			quarantine(path)
+			continue
+		}
+		if err := fsname.Migrate(q.Dir, f.Name(), e.Task.ID, ext); err != nil {
+			logrus.WithError(err).WithField("file", path).Warnln("queue: could not rename entry")
+		}
+		e.Task.Payload = e.Payload
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Acquired.Before(entries[j].Acquired) })
+	return entries, nil
+}
+
+// Len returns the number of queued tasks
+func (q *Queue) Len() int {
+	entries, _ := q.List()
+	return len(entries)
+}
+
+func (q *Queue) write(e *Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if b, err = sealed.Seal(q.Sealer, b); err != nil {
+		return err
+	}
+	name := fsname.Encode(e.Task.ID) + ext
+	tmp := filepath.Join(q.Dir, "."+name)
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(q.Dir, name))
+}
+
+func (q *Queue) path(taskID string) string {
+	return filepath.Join(q.Dir, fsname.Encode(taskID)+ext)
+}
+
+func read(path string, sealer sealed.Sealer) (*Entry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = sealed.Open(sealer, b); err != nil {
+		return nil, err
+	}
+	e := &Entry{}
+	return e, json.Unmarshal(b, e)
+}
+
+// quarantine moves an unreadable entry aside instead of deleting it, so
+// that it can be recovered, e.g. once the key it was sealed with is restored
+func quarantine(path string) {
+	if err := os.Rename(path, path+corruptExt); err != nil {
+		logrus.WithError(err).WithField("file", path).Errorln("queue: could not move unreadable entry aside")
+	}
+}
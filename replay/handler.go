@@ -0,0 +1,66 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/router"
+)
+
+// maxTaskSize is the maximum size of an injected task
+const maxTaskSize = 16 << 20
+
+// Handler returns a handler which injects tasks directly into the router,
+// bypassing the manager, so task handlers can be exercised locally.
+//
+//	GET  /routes  lists the routed task types
+//	POST /tasks   routes the JSON encoded client.Task in the body and
+//	              responds with the Result
+//
+// Injected tasks without an ID are given a sequential local ID.
+func Handler(rt router.Router) http.Handler {
+	var seq int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/routes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, rt.Routes())
+	})
+	mux.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		t := &client.Task{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTaskSize)).Decode(t); err != nil {
+			http.Error(w, fmt.Sprintf("could not decode task: %s", err), http.StatusBadRequest)
+			return
+		}
+		if t.Type == "" {
+			http.Error(w, "the task type is required", http.StatusBadRequest)
+			return
+		}
+		if t.ID == "" {
+			t.ID = fmt.Sprintf("local-%d", atomic.AddInt64(&seq, 1))
+		}
+		res := Task(r.Context(), rt, t)
+		status := http.StatusOK
+		if res.Error != "" {
+			status = http.StatusUnprocessableEntity
+		}
+		writeJSON(w, status, res)
+	})
+	return mux
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
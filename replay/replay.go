@@ -0,0 +1,96 @@
+// Package replay feeds recorded tasks into the task handlers without a manager
+// connection, so handler bugs seen in production can be reproduced deterministically.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/poller"
+	"github.com/wings-software/dlite/router"
+	"github.com/wings-software/dlite/task"
+)
+
+// maxLineSize is the maximum size of a recorded task
+const maxLineSize = 16 << 20
+
+// Result is the outcome of a replayed task
+type Result struct {
+	TaskID   string               `json:"task_id"`
+	Type     string               `json:"type"`
+	Response *client.TaskResponse `json:"response,omitempty"`
+	Rejected string               `json:"rejected,omitempty"` // reason if the handler rejected the task
+	Error    string               `json:"error,omitempty"`    // set if the task could not be routed or the handler panicked
+}
+
+// Replay reads recorded tasks, one JSON encoded client.Task per line, routes each
+// of them to its handler in order and calls fn with the result. Empty lines are skipped.
+func Replay(ctx context.Context, r io.Reader, rt router.Router, fn func(*Result)) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	line := 0
+	for s.Scan() {
+		line++
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b := bytes.TrimSpace(s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		t := &client.Task{}
+		if err := json.Unmarshal(b, t); err != nil {
+			return fmt.Errorf("line %d: could not decode task: %w", line, err)
+		}
+		fn(Task(ctx, rt, t))
+	}
+	return s.Err()
+}
+
+// Task routes a single task to its handler and returns the result
+func Task(ctx context.Context, rt router.Router, t *client.Task) *Result {
+	res := &Result{TaskID: t.ID, Type: t.Type}
+	h := rt.Route(t.Type)
+	if h == nil {
+		res.Error = fmt.Sprintf("task type %s is not supported", t.Type)
+		return res
+	}
+	body, err := json.Marshal(t)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	req, err := http.NewRequestWithContext(client.WithCorrelationID(ctx, t.ID), "POST", "/", bytes.NewReader(body))
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	w := httptest.NewRecorder()
+	if err := poller.Serve(h, w, req); err != nil {
+		res.Error = err.Error()
+		var perr *poller.PanicError
+		if errors.As(err, &perr) {
+			res.Error = fmt.Sprintf("%s\n%s", perr, perr.Stack)
+		}
+		return res
+	}
+	data := w.Body.Bytes()
+	if r, ok := task.Rejection(w.Header(), data); ok {
+		res.Rejected = r.Reason
+		return res
+	}
+	res.Response = &client.TaskResponse{ID: t.ID, Type: t.Type, Data: data, Code: client.CodeOK}
+	if e, ok := task.ErrorFrom(w.Header(), data); ok {
+		res.Response.Code = task.ResponseCode(e)
+		res.Response.Error = e
+	}
+	return res
+}
@@ -0,0 +1,163 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wings-software/dlite/httphelper"
+	"github.com/wings-software/dlite/task"
+)
+
+// Inspector is implemented by routers which describe their routes
+type Inspector interface {
+	Inspect() *Inspection
+}
+
+var _ Inspector = (*router)(nil)
+
+// Inspection describes the routes of a router
+type Inspection struct {
+	Routes     []RouteInfo `json:"routes"`
+	Middleware []string    `json:"middleware,omitempty"` // applied to every route, outermost first
+	Fallback   string      `json:"fallback,omitempty"`
+	// Unrouted counts the tasks of types without a route, by type
+	Unrouted map[string]int64 `json:"unrouted,omitempty"`
+}
+
+// RouteInfo describes the route of a task type
+type RouteInfo struct {
+	TaskType string     `json:"task_type"`
+	Handler  string     `json:"handler"`
+	Stats    RouteStats `json:"stats"`
+}
+
+// RouteStats are the stats of the tasks routed to a handler
+type RouteStats struct {
+	Routed     int64      `json:"routed"`
+	InFlight   int64      `json:"in_flight"`
+	Failed     int64      `json:"failed"` // the handler responded with a task error
+	LastRouted *time.Time `json:"last_routed,omitempty"`
+}
+
+// routeStats are updated by the handlers returned by Route
+type routeStats struct {
+	routed     int64
+	inFlight   int64
+	failed     int64
+	lastRouted int64 // unix nanoseconds
+}
+
+func (s *routeStats) snapshot() RouteStats {
+	st := RouteStats{
+		Routed:   atomic.LoadInt64(&s.routed),
+		InFlight: atomic.LoadInt64(&s.inFlight),
+		Failed:   atomic.LoadInt64(&s.failed),
+	}
+	if t := atomic.LoadInt64(&s.lastRouted); t > 0 {
+		last := time.Unix(0, t)
+		st.LastRouted = &last
+	}
+	return st
+}
+
+// counted records the stats of the tasks handled by the handler
+func counted(s *routeStats, h task.Handler) task.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.routed, 1)
+		atomic.StoreInt64(&s.lastRouted, time.Now().UnixNano())
+		atomic.AddInt64(&s.inFlight, 1)
+		defer atomic.AddInt64(&s.inFlight, -1)
+		h.ServeHTTP(w, r)
+		if w.Header().Get(task.ErrorHeader) != "" {
+			atomic.AddInt64(&s.failed, 1)
+		}
+	})
+}
+
+// Inspect describes the routes of the router, sorted by task type
+func (r *router) Inspect() *Inspection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	in := &Inspection{Unrouted: map[string]int64{}}
+	for t, h := range r.routes {
+		info := RouteInfo{TaskType: t, Handler: funcName(h)}
+		if s, ok := r.stats[t]; ok {
+			info.Stats = s.snapshot()
+		}
+		in.Routes = append(in.Routes, info)
+	}
+	sort.Slice(in.Routes, func(i, j int) bool { return in.Routes[i].TaskType < in.Routes[j].TaskType })
+	for _, m := range r.middleware {
+		in.Middleware = append(in.Middleware, funcName(m))
+	}
+	if r.fallback != nil {
+		in.Fallback = funcName(r.fallback)
+	}
+	for t, s := range r.stats {
+		if _, ok := r.routes[t]; !ok {
+			in.Unrouted[t] = atomic.LoadInt64(&s.routed)
+		}
+	}
+	return in
+}
+
+// InspectHandler returns a debug handler rendering the routes of the router
+// as JSON, or as a table with ?format=text
+func InspectHandler(i Inspector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		in := i.Inspect()
+		if r.URL.Query().Get("format") != "text" {
+			httphelper.WriteJSON(w, in, http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TASK TYPE\tHANDLER\tROUTED\tIN FLIGHT\tFAILED\tLAST ROUTED")
+		for _, rt := range in.Routes {
+			last := "-"
+			if rt.Stats.LastRouted != nil {
+				last = rt.Stats.LastRouted.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", rt.TaskType, rt.Handler,
+				rt.Stats.Routed, rt.Stats.InFlight, rt.Stats.Failed, last)
+		}
+		tw.Flush()
+		if len(in.Middleware) > 0 {
+			fmt.Fprintf(w, "\nmiddleware: %s\n", strings.Join(in.Middleware, " -> "))
+		}
+		if in.Fallback != "" {
+			fmt.Fprintf(w, "fallback: %s\n", in.Fallback)
+		}
+		if len(in.Unrouted) > 0 {
+			var types []string
+			for t, n := range in.Unrouted {
+				types = append(types, fmt.Sprintf("%s (%d)", t, n))
+			}
+			sort.Strings(types)
+			fmt.Fprintf(w, "task types without a route: %s\n", strings.Join(types, ", "))
+		}
+	})
+}
+
+// funcName returns the name of the function or the type of v
+func funcName(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Func {
+		if f := runtime.FuncForPC(rv.Pointer()); f != nil {
+			name := f.Name()
+			// closures are named after the function which returned them
+			if i := strings.Index(name, ".func"); i > 0 {
+				name = name[:i]
+			}
+			return name[strings.LastIndex(name, "/")+1:]
+		}
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,39 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/platform"
+	"github.com/wings-software/dlite/task"
+)
+
+// RequirePlatform returns middleware which rejects tasks whose platform
+// requirements are not met by the host with a PLATFORM_MISMATCH code, so
+// that the manager can assign them to another runner.
+func RequirePlatform(host client.Platform) Middleware {
+	return func(next task.Handler) task.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				task.WriteError(w, err)
+				return
+			}
+			t := &client.Task{}
+			if err := json.Unmarshal(body, t); err == nil {
+				if unmet := platform.Mismatch(host, t.Platform); len(unmet) > 0 {
+					task.RejectWithCode(w, platform.MismatchCode, "task requires "+strings.Join(unmet, ", "))
+					return
+				}
+			}
+			r2 := r.Clone(r.Context())
+			r2.Body = io.NopCloser(bytes.NewReader(body))
+			r2.ContentLength = int64(len(body))
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
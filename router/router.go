@@ -1,9 +1,19 @@
 package router
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wings-software/dlite/client"
 	"github.com/wings-software/dlite/task"
 )
 
+// Router returns the handlers of task types. It is implemented by the router
+// returned by NewRouter; embedders can wrap or replace it.
 type Router interface {
 	// Routes returns a list of routes which have been defined in the router
 	Routes() []string
@@ -12,9 +22,35 @@ type Router interface {
 	Route(string) task.Handler
 }
 
+// Registry is a Router whose routes can be changed at runtime
+type Registry interface {
+	Router
+
+	// Register adds a route for the task type
+	Register(taskType string, h task.Handler)
+
+	// Deregister removes the route of the task type
+	Deregister(taskType string)
+
+	// Use appends middleware which is applied to every routed handler
+	Use(m ...Middleware)
+
+	// Fallback sets the handler of task types without a route
+	Fallback(h task.Handler)
+}
+
+var _ Registry = (*router)(nil)
+
+// Middleware wraps a task handler with additional behaviour
+type Middleware func(task.Handler) task.Handler
+
 // Router stores route mappings from task types to their handlers
 type router struct {
-	routes map[string]task.Handler
+	mu         sync.RWMutex
+	routes     map[string]task.Handler
+	fallback   task.Handler
+	middleware []Middleware
+	stats      map[string]*routeStats // by task type, including types without a route
 }
 
 // NewRouter returns a new instance of a router
@@ -22,16 +58,121 @@ func NewRouter(routes map[string]task.Handler) *router { //nolint:revive
 	return &router{routes: routes}
 }
 
+// Handle registers a handler for the task type whose data is decoded into
+// a payload of type T and validated before fn is called.
+func Handle[T any](r Registry, taskType string, fn task.TypedFunc[T]) {
+	r.Register(taskType, task.Typed(fn))
+}
+
+// Register adds a route for the task type. Routes registered at runtime are
+// advertised to the server with the next heartbeat.
+func (r *router) Register(taskType string, h task.Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.routes == nil {
+		r.routes = map[string]task.Handler{}
+	}
+	r.routes[taskType] = h
+}
+
+// Deregister removes the route of the task type, so that the server stops
+// offering tasks of the type to the runner.
+func (r *router) Deregister(taskType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.routes, taskType)
+}
+
+// Use appends middleware which is applied to every handler returned by Route.
+// Middleware is applied in the order it is registered.
+func (r *router) Use(m ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, m...)
+}
+
+// Fallback sets the handler which is used for task types without a route.
+// It is not included in Routes.
+func (r *router) Fallback(h task.Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = h
+}
+
 // Route routes the incoming call to the appropriate handler
 func (r *router) Route(taskType string) task.Handler {
-	return r.routes[taskType]
+	r.mu.RLock()
+	h, ok := r.routes[taskType]
+	s := r.stats[taskType]
+	fallback, middleware := r.fallback, r.middleware
+	r.mu.RUnlock()
+	if s == nil {
+		r.mu.Lock()
+		if s = r.stats[taskType]; s == nil {
+			if r.stats == nil {
+				r.stats = map[string]*routeStats{}
+			}
+			s = &routeStats{}
+			r.stats[taskType] = s
+		}
+		r.mu.Unlock()
+	}
+	if !ok {
+		if fallback == nil {
+			atomic.AddInt64(&s.routed, 1)
+			return nil
+		}
+		h = fallback
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return counted(s, h)
 }
 
-// Routes returns all the supported task types by this runner version
+// Routes returns all the supported task types by this runner version in
+// sorted order. They are sent to the server, which only offers tasks of
+// these types to the runner.
 func (r *router) Routes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	var routes []string
 	for k := range r.routes {
 		routes = append(routes, k)
 	}
+	sort.Strings(routes)
 	return routes
 }
+
+// Wrap returns a router which applies the middleware to every handler
+// returned by r. It decorates routers which do not support Use.
+func Wrap(r Router, m ...Middleware) Router {
+	return &wrapped{Router: r, middleware: m}
+}
+
+type wrapped struct {
+	Router
+	middleware []Middleware
+}
+
+func (w *wrapped) Route(taskType string) task.Handler {
+	h := w.Router.Route(taskType)
+	if h == nil {
+		return nil
+	}
+	for i := len(w.middleware) - 1; i >= 0; i-- {
+		h = w.middleware[i](h)
+	}
+	return h
+}
+
+// Unsupported returns a handler which fails every task with an
+// UNSUPPORTED_TASK_TYPE error. It can be used as the fallback handler.
+func Unsupported() task.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t := &client.Task{}
+		_ = json.NewDecoder(req.Body).Decode(t)
+		task.WriteError(w, task.NewError("UNSUPPORTED_TASK_TYPE", client.CategoryInternal,
+			fmt.Sprintf("task type %s is not supported by this runner", t.Type), false, nil))
+	})
+}
@@ -0,0 +1,89 @@
+package sandbox
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// removeTimeout bounds the time to remove the container of a cancelled task
+var removeTimeout = 30 * time.Second
+
+// invalidName matches the characters not allowed in container names
+var invalidName = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// Container runs tasks in a container without network access, capabilities
+// or a writable root file system
+type Container struct {
+	Runtime string // container CLI, defaults to docker, podman is compatible
+	Image   string
+	Command []string // overrides the command of the image
+	Env     []string // KEY=VALUE
+	Network string   // defaults to none
+	Limits  Limits
+	// MaxOutput bounds the standard output, defaults to 16MB
+	MaxOutput int64
+}
+
+// Execute runs the task in a new container, which is removed when the
+// task completes or the context is cancelled
+func (c *Container) Execute(ctx context.Context, taskID string, payload []byte) ([]byte, error) {
+	name := "dlite-" + uuid.New().String()
+	if taskID != "" {
+		name = "dlite-" + invalidName.ReplaceAllString(taskID, "_") + "-" + uuid.New().String()[:8]
+	}
+	out, err := run(ctx, c.runtime(), c.args(name), payload, c.MaxOutput)
+	if ctx.Err() != nil {
+		// killing the CLI does not stop the container
+		rctx, cancel := context.WithTimeout(context.Background(), removeTimeout)
+		defer cancel()
+		if _, rerr := run(rctx, c.runtime(), []string{"rm", "-f", name}, nil, 0); rerr != nil {
+			logrus.WithError(rerr).WithField("container", name).Warnln("could not remove the container of a cancelled task")
+		}
+	}
+	return out, err
+}
+
+// args returns the arguments of the run command
+func (c *Container) args(name string) []string {
+	network := c.Network
+	if network == "" {
+		network = "none"
+	}
+	args := []string{
+		"run", "--rm", "-i",
+		"--name", name,
+		"--network", network,
+		"--read-only",
+		"--tmpfs", "/tmp",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+	}
+	if c.Limits.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(c.Limits.CPUs, 'f', -1, 64))
+	}
+	if c.Limits.Memory > 0 {
+		// the swap limit includes the memory, so the container can not swap
+		mem := strconv.FormatInt(c.Limits.Memory, 10)
+		args = append(args, "--memory", mem, "--memory-swap", mem)
+	}
+	if c.Limits.PIDs > 0 {
+		args = append(args, "--pids-limit", strconv.FormatInt(c.Limits.PIDs, 10))
+	}
+	for _, e := range c.Env {
+		args = append(args, "--env", e)
+	}
+	args = append(args, c.Image)
+	return append(args, c.Command...)
+}
+
+func (c *Container) runtime() string {
+	if c.Runtime == "" {
+		return "docker"
+	}
+	return c.Runtime
+}
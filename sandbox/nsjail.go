@@ -0,0 +1,52 @@
+package sandbox
+
+import (
+	"context"
+	"strconv"
+)
+
+// Nsjail runs tasks with nsjail in new namespaces without network access and
+// with a read-only view of the chroot
+type Nsjail struct {
+	Path    string // nsjail binary, defaults to nsjail
+	Chroot  string // defaults to /
+	Command []string
+	Env     []string // KEY=VALUE
+	Args    []string // additional nsjail arguments
+	Limits  Limits
+	// MaxOutput bounds the standard output, defaults to 16MB
+	MaxOutput int64
+}
+
+// Execute runs the task in a new jail, which is killed if the context is cancelled
+func (n *Nsjail) Execute(ctx context.Context, _ string, payload []byte) ([]byte, error) {
+	path := n.Path
+	if path == "" {
+		path = "nsjail"
+	}
+	return run(ctx, path, n.args(), payload, n.MaxOutput)
+}
+
+// args returns the nsjail arguments
+func (n *Nsjail) args() []string {
+	chroot := n.Chroot
+	if chroot == "" {
+		chroot = "/"
+	}
+	args := []string{"--mode", "o", "--quiet", "--chroot", chroot, "--time_limit", "0"}
+	if n.Limits.CPUs > 0 {
+		args = append(args, "--cgroup_cpu_ms_per_sec", strconv.FormatInt(int64(n.Limits.CPUs*1000), 10))
+	}
+	if n.Limits.Memory > 0 {
+		args = append(args, "--cgroup_mem_max", strconv.FormatInt(n.Limits.Memory, 10))
+	}
+	if n.Limits.PIDs > 0 {
+		args = append(args, "--cgroup_pids_max", strconv.FormatInt(n.Limits.PIDs, 10))
+	}
+	for _, e := range n.Env {
+		args = append(args, "--env", e)
+	}
+	args = append(args, n.Args...)
+	args = append(args, "--")
+	return append(args, n.Command...)
+}
@@ -0,0 +1,144 @@
+// Package sandbox runs the work of tasks isolated from the runner host, in a
+// container or an nsjail, with CPU, memory and process limits, so that
+// untrusted task payloads can not compromise the runner.
+//
+// A sandboxed command reads the task, the JSON encoded client.Task, from its
+// standard input and writes the task response data to its standard output.
+// A non-zero exit status fails the task with the tail of the standard error.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/tail"
+	"github.com/wings-software/dlite/task"
+)
+
+const (
+	// defaultMaxOutput bounds the standard output of a sandboxed command
+	defaultMaxOutput = 16 << 20
+	// stderrTail is the number of trailing standard error bytes kept
+	stderrTail = 4 << 10
+	// maxPayloadSize bounds the task payload passed to the command
+	maxPayloadSize = 64 << 20
+)
+
+// ErrOutputTooLarge is returned when a command writes more than the maximum output
+var ErrOutputTooLarge = errors.New("sandbox: output too large")
+
+// ErrPayloadTooLarge fails the tasks whose payload exceeds the maximum size
+var ErrPayloadTooLarge = errors.New("sandbox: payload too large")
+
+// Executor runs the work of a task in isolation
+type Executor interface {
+	// Execute runs the task whose payload is passed on standard input and
+	// returns the standard output. A non-zero exit is returned as an *ExitError.
+	Execute(ctx context.Context, taskID string, payload []byte) ([]byte, error)
+}
+
+// Limits bounds the resources of a sandboxed task. Zero values are unlimited.
+type Limits struct {
+	CPUs   float64 // number of CPUs, e.g. 0.5
+	Memory int64   // bytes
+	PIDs   int64   // number of processes
+}
+
+// ExitError is returned when a sandboxed command exited with a non-zero status
+type ExitError struct {
+	Code   int
+	Stderr string // tail of the standard error
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("sandbox: command exited with status %d", e.Code)
+	}
+	return fmt.Sprintf("sandbox: command exited with status %d: %s", e.Code, e.Stderr)
+}
+
+// Handler returns a task handler which executes the tasks with the executor
+func Handler(e Executor) task.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize+1))
+		if err != nil {
+			task.WriteError(w, err)
+			return
+		}
+		if len(payload) > maxPayloadSize {
+			task.WriteError(w, task.NewError("SANDBOX_PAYLOAD_TOO_LARGE", client.CategoryUser,
+				fmt.Sprintf("the task payload is larger than %d bytes", maxPayloadSize), false, ErrPayloadTooLarge))
+			return
+		}
+		t := &client.Task{}
+		_ = json.Unmarshal(payload, t)
+		out, err := e.Execute(r.Context(), t.ID, payload)
+		var exit *ExitError
+		switch {
+		case errors.As(err, &exit):
+			task.WriteError(w, task.NewError("SANDBOX_EXIT", client.CategoryInternal, exit.Error(), false, err))
+		case err != nil:
+			task.WriteError(w, task.NewError("SANDBOX_UNAVAILABLE", client.CategoryInternal,
+				"could not run the task in the sandbox", true, err))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(out)
+		}
+	})
+}
+
+// run runs the command with the payload on standard input
+func run(ctx context.Context, name string, args []string, payload []byte, maxOutput int64) ([]byte, error) {
+	if maxOutput <= 0 {
+		maxOutput = defaultMaxOutput
+	}
+	stdout := &limitedBuffer{max: maxOutput}
+	stderr := tail.New(stderrTail)
+	cmd := exec.CommandContext(ctx, name, args...) //nolint:gosec
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if stdout.exceeded {
+		return nil, ErrOutputTooLarge
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return nil, &ExitError{Code: exit.ExitCode(), Stderr: strings.TrimSpace(stderr.String())}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// limitedBuffer fails writes once more than max bytes were written. The
+// buffer is not embedded, so that io.Copy does not bypass Write through ReadFrom.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int64
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if int64(b.buf.Len()+len(p)) > b.max {
+		b.exceeded = true
+		return 0, ErrOutputTooLarge
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
@@ -0,0 +1,194 @@
+// Package scheduler runs periodic housekeeping jobs of a runner such as
+// heartbeats, lease renewals or spool replays. Every job runs in its own
+// goroutine, a failing or panicking job does not affect the others.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrStop is returned by a job which does not need to run again
+var ErrStop = errors.New("stop job")
+
+// Job is a periodic job
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Jitter randomly delays every run by up to the given fraction of the
+	// interval, e.g. 0.1 for 10%, so that runners do not act in lockstep.
+	Jitter float64
+	// MaxBackoff makes a failing job back off exponentially, doubling the
+	// interval after every consecutive failure up to MaxBackoff. The interval
+	// is reset after a successful run. Disabled if zero.
+	MaxBackoff time.Duration
+	Run        func(ctx context.Context) error
+}
+
+// Status reports the runs of a job
+type Status struct {
+	Name      string
+	Runs      int
+	Failures  int
+	LastRun   time.Time
+	LastError string
+	Stopped   bool
+}
+
+// Scheduler runs jobs periodically
+type Scheduler struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	stop   chan struct{}
+	closed bool
+	status map[string]*Status
+}
+
+// New returns a scheduler
+func New() *Scheduler {
+	return &Scheduler{
+		stop:   make(chan struct{}),
+		status: map[string]*Status{},
+	}
+}
+
+// Schedule runs the job every interval, the first run happens after one
+// interval. The job runs until the context is canceled, the scheduler is
+// stopped or it returns ErrStop. Errors are logged and do not stop the job.
+func (s *Scheduler) Schedule(ctx context.Context, j Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.status[j.Name] = &Status{Name: j.Name}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.loop(ctx, j)
+	}()
+}
+
+// Stop stops all the jobs and waits for the running ones to return
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Jobs returns the status of the scheduled jobs sorted by name
+func (s *Scheduler) Jobs() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Status, 0, len(s.status))
+	for _, st := range s.status {
+		jobs = append(jobs, *st)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+func (s *Scheduler) loop(ctx context.Context, j Job) {
+	defer s.update(j.Name, func(st *Status) { st.Stopped = true })
+	timer := time.NewTimer(delay(j, 0))
+	defer timer.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		case <-timer.C:
+		}
+		err := run(ctx, j)
+		s.update(j.Name, func(st *Status) {
+			st.Runs++
+			st.LastRun = time.Now()
+			st.LastError = ""
+			if err != nil && err != ErrStop {
+				st.Failures++
+				st.LastError = err.Error()
+			}
+		})
+		switch {
+		case err == ErrStop:
+			return
+		case err != nil:
+			failures++
+			logrus.WithError(err).WithField("job", j.Name).Warnln("scheduled job failed")
+		default:
+			failures = 0
+		}
+		timer.Reset(delay(j, failures))
+	}
+}
+
+func (s *Scheduler) update(name string, fn func(*Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.status[name]; ok {
+		fn(st)
+	}
+}
+
+// run runs the job once, turning a panic into an error
+func run(ctx context.Context, j Job) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			logrus.WithField("job", j.Name).WithField("stack", string(debug.Stack())).Errorln("scheduled job panicked")
+			err = fmt.Errorf("job panicked: %v", v)
+		}
+	}()
+	return j.Run(ctx)
+}
+
+// delay returns the time until the next run of the job after the
+// given number of consecutive failures
+func delay(j Job, failures int) time.Duration {
+	d := j.Interval
+	for i := 0; i < failures && d < j.MaxBackoff; i++ {
+		d *= 2
+		if d > j.MaxBackoff {
+			d = j.MaxBackoff
+		}
+	}
+	return Jitter(d, j.Jitter)
+}
+
+// rnd draws the random delays. It is seeded per process, so that runners
+// started at the same time do not draw the same delays.
+var (
+	rndMu sync.Mutex
+	rnd   = rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec
+)
+
+// Jitter returns d randomly increased by up to the given fraction of d
+func Jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	return d + Random(time.Duration(float64(d)*fraction))
+}
+
+// Random returns a random duration between zero and d
+func Random(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	rndMu.Lock()
+	defer rndMu.Unlock()
+	return time.Duration(rnd.Int63n(int64(d)))
+}
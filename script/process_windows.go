@@ -0,0 +1,10 @@
+package script
+
+import "os/exec"
+
+func setProcessGroup(*exec.Cmd) {}
+
+// killProcessGroup kills the command. The processes it started are not killed.
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
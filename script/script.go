@@ -0,0 +1,248 @@
+// Package script implements a handler of tasks which run a command on the
+// runner host. Only the commands of an allow-list are run, with a sanitized
+// environment which does not inherit the environment of the runner, within
+// a timeout. The output of the command is captured and truncated.
+package script
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/tail"
+	"github.com/wings-software/dlite/task"
+	"github.com/wings-software/dlite/workspace"
+)
+
+const (
+	// defaultTimeout bounds the run time of a command
+	defaultTimeout = 10 * time.Minute
+	// defaultMaxOutput bounds the captured standard output and error
+	defaultMaxOutput = 1 << 20
+)
+
+// validName matches the names of environment variables
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// deniedEnv are the environment variables which tasks can not set, as they
+// change how the command or the programs it starts are loaded
+var deniedEnv = map[string]bool{
+	"PATH":            true,
+	"IFS":             true,
+	"ENV":             true,
+	"BASH_ENV":        true,
+	"SHELLOPTS":       true,
+	"BASHOPTS":        true,
+	"PS4":             true,
+	"LD_PRELOAD":      true,
+	"LD_LIBRARY_PATH": true,
+	"LD_AUDIT":        true,
+	"NODE_OPTIONS":    true,
+	"PYTHONSTARTUP":   true,
+	"PYTHONPATH":      true,
+	"PERL5OPT":        true,
+	"RUBYOPT":         true,
+}
+
+// Payload is the data of a script task
+type Payload struct {
+	Command string            `json:"command"` // name of an allowed command
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Stdin   string            `json:"stdin,omitempty"`
+	// TimeoutSeconds bounds the run time below the timeout of the runner
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// Validate validates the payload
+func (p *Payload) Validate() error {
+	if p.Command == "" {
+		return errors.New("command is required")
+	}
+	if p.TimeoutSeconds < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	for k, v := range p.Env {
+		if !validName.MatchString(k) {
+			return fmt.Errorf("invalid environment variable name %q", k)
+		}
+		if deniedEnv[strings.ToUpper(k)] || strings.HasPrefix(strings.ToUpper(k), "DYLD_") {
+			return fmt.Errorf("environment variable %s can not be set", k)
+		}
+		if strings.ContainsRune(v, 0) {
+			return fmt.Errorf("environment variable %s contains a NUL character", k)
+		}
+	}
+	return nil
+}
+
+// Result is the response of a script task
+type Result struct {
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	Truncated  bool   `json:"truncated,omitempty"` // the output exceeded the maximum
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Runner runs the commands of script tasks
+type Runner struct {
+	// Commands maps the names of the allowed commands to their executables
+	Commands map[string]string
+	// Env is set for every command, KEY=VALUE. The environment of the runner
+	// is not inherited.
+	Env []string
+	// Dir is the working directory of the commands. The workspace of the
+	// task is used if it is empty.
+	Dir string
+	// Timeout bounds the run time of a command, defaults to 10 minutes
+	Timeout time.Duration
+	// MaxOutput bounds the captured standard output and error, defaults
+	// to 1MB each. The head of the output and the tail of the error are kept.
+	MaxOutput int
+	// SuccessExitCodes are the exit codes of successful commands in addition to 0
+	SuccessExitCodes []int
+	// RetryableExitCodes are the exit codes of failures which can be retried
+	RetryableExitCodes []int
+}
+
+// Handler returns a task handler which runs the commands of script tasks
+func (r *Runner) Handler() task.Handler {
+	return task.Typed(r.Run)
+}
+
+// Run runs the command of the task. Commands exiting with a code which is not
+// a success code fail the task with a SCRIPT_FAILED error.
+func (r *Runner) Run(ctx context.Context, t *client.Task, p *Payload) (interface{}, error) {
+	path, ok := r.Commands[p.Command]
+	if !ok {
+		return nil, task.NewError("SCRIPT_NOT_ALLOWED", client.CategoryUser,
+			fmt.Sprintf("command %s is not allowed", p.Command), false, nil)
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if d := time.Duration(p.TimeoutSeconds) * time.Second; d > 0 && d < timeout {
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	limit := r.MaxOutput
+	if limit <= 0 {
+		limit = defaultMaxOutput
+	}
+	stdout := &headBuffer{max: limit}
+	stderr := tail.New(limit)
+	cmd := exec.Command(path, p.Args...) //nolint:gosec
+	cmd.Env = r.env(p)
+	cmd.Dir = r.Dir
+	if cmd.Dir == "" {
+		if w, ok := workspace.FromContext(ctx); ok {
+			cmd.Dir = w.Path
+		}
+	}
+	cmd.Stdin = strings.NewReader(p.Stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, task.NewError("SCRIPT_START_FAILED", client.CategoryInfrastructure,
+			fmt.Sprintf("could not start command %s", p.Command), true, err)
+	}
+	// the command and the processes it started are killed once the
+	// context is done
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+
+	res := &Result{
+		ExitCode:   cmd.ProcessState.ExitCode(),
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+		Truncated:  stdout.truncated || stderr.Truncated,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	var exit *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, task.NewError("SCRIPT_TIMEOUT", client.CategoryTimeout,
+			fmt.Sprintf("command %s did not complete within %s", p.Command, timeout), false, ctx.Err())
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case err != nil && !errors.As(err, &exit):
+		return nil, task.NewError("SCRIPT_START_FAILED", client.CategoryInfrastructure,
+			fmt.Sprintf("could not run command %s", p.Command), true, err)
+	case res.ExitCode == 0 || contains(r.SuccessExitCodes, res.ExitCode):
+		return res, nil
+	}
+	msg := fmt.Sprintf("command %s exited with status %d", p.Command, res.ExitCode)
+	if tail := lastLine(res.Stderr); tail != "" {
+		msg += ": " + tail
+	}
+	return nil, task.NewError("SCRIPT_FAILED", client.CategoryUser, msg, contains(r.RetryableExitCodes, res.ExitCode), err)
+}
+
+// env returns the environment of the command
+func (r *Runner) env(p *Payload) []string {
+	env := append([]string{}, r.Env...)
+	for k, v := range p.Env {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+func contains(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(s)
+}
+
+// headBuffer keeps the first max bytes written. The buffer is not embedded,
+// so that io.Copy does not bypass Write through ReadFrom.
+type headBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if n := b.max - b.buf.Len(); len(p) > n {
+		b.truncated = true
+		b.buf.Write(p[:n])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *headBuffer) String() string {
+	return b.buf.String()
+}
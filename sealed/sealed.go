@@ -0,0 +1,104 @@
+// Package sealed encrypts the state files written by the runner, e.g. spooled
+// statuses and queued tasks, which can contain sensitive task data.
+package sealed
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/wings-software/dlite/secrets"
+)
+
+// magic prefixes sealed data, data without it was written unencrypted
+var magic = []byte("dlite-sealed-v1:")
+
+// ErrCorrupt is returned when sealed data can not be decrypted, e.g. because
+// it was sealed with another key
+var ErrCorrupt = errors.New("sealed: data can not be decrypted")
+
+// Sealer encrypts and decrypts data written to disk
+type Sealer interface {
+	Seal(plaintext []byte) ([]byte, error)
+	Open(data []byte) ([]byte, error)
+}
+
+// AESGCM seals data with AES-256-GCM
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCM returns a sealer using a key derived from the secret
+func NewAESGCM(secret []byte) (*AESGCM, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("sealed: empty key")
+	}
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCM{aead: aead}, nil
+}
+
+// FromSource returns a sealer using the key read from the secret source
+func FromSource(ctx context.Context, src secrets.Source) (*AESGCM, error) {
+	key, err := src.Secret(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewAESGCM([]byte(key))
+}
+
+// Seal encrypts the plaintext
+func (s *AESGCM) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := append(append([]byte{}, magic...), nonce...)
+	return s.aead.Seal(out, nonce, plaintext, magic), nil
+}
+
+// Open decrypts sealed data. Data without the sealed prefix is returned
+// as is, so that files written before encryption was enabled can be read.
+func (s *AESGCM) Open(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, magic) {
+		return data, nil
+	}
+	data = data[len(magic):]
+	if len(data) < s.aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, magic)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plaintext, nil
+}
+
+// Seal encrypts the plaintext with the sealer, if any
+func Seal(s Sealer, plaintext []byte) ([]byte, error) {
+	if s == nil {
+		return plaintext, nil
+	}
+	return s.Seal(plaintext)
+}
+
+// Open decrypts the data with the sealer, if any
+func Open(s Sealer, data []byte) ([]byte, error) {
+	if s == nil {
+		return data, nil
+	}
+	return s.Open(data)
+}
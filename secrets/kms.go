@@ -0,0 +1,34 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// KMSAPI is implemented by cloud key management service clients
+// (AWS KMS, GCP KMS, Azure Key Vault). It is kept minimal so that
+// dlite does not need to depend on any cloud SDK.
+type KMSAPI interface {
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// KMS decrypts secrets using a key management service
+type KMS struct {
+	API KMSAPI
+}
+
+// NewKMS returns a decryptor backed by the given key management service
+func NewKMS(api KMSAPI) *KMS {
+	return &KMS{API: api}
+}
+
+// Decrypt decrypts the base64 encoded ciphertext of the secret
+func (k *KMS) Decrypt(ctx context.Context, s *client.Secret) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(s.Encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return k.API.Decrypt(ctx, s.KeyID, data)
+}
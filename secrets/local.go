@@ -0,0 +1,45 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+
+	"github.com/wings-software/dlite/client"
+)
+
+// Local decrypts secrets which were encrypted with a shared AES key by the
+// built-in secret manager. The encrypted value is the base64 encoding of the
+// GCM nonce followed by the sealed data.
+type Local struct {
+	aead cipher.AEAD
+}
+
+// NewLocal returns a decryptor for the built-in secret manager. The key must
+// be 16, 24 or 32 bytes long.
+func NewLocal(key []byte) (*Local, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{aead: aead}, nil
+}
+
+// Decrypt decrypts the secret with the shared key
+func (l *Local) Decrypt(_ context.Context, s *client.Secret) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(s.Encrypted)
+	if err != nil {
+		return nil, err
+	}
+	n := l.aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("encrypted value is too short")
+	}
+	return l.aead.Open(nil, data[:n], data[n:], nil)
+}
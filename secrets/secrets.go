@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/router"
+	"github.com/wings-software/dlite/task"
+)
+
+// Supported secret managers
+const (
+	ManagerLocal = "local"
+	ManagerVault = "vault"
+	ManagerKMS   = "kms"
+)
+
+// Decryptor decrypts a secret which was sent encrypted as part of a task
+type Decryptor interface {
+	Decrypt(ctx context.Context, s *client.Secret) ([]byte, error)
+}
+
+// Mux dispatches decryption to a decryptor based on the secret manager
+// of the secret.
+type Mux map[string]Decryptor
+
+// Decrypt decrypts the secret using the decryptor registered for its manager
+func (m Mux) Decrypt(ctx context.Context, s *client.Secret) ([]byte, error) {
+	d, ok := m[s.Manager]
+	if !ok {
+		return nil, fmt.Errorf("no decryptor registered for secret manager: %s", s.Manager)
+	}
+	return d.Decrypt(ctx, s)
+}
+
+// Middleware returns router middleware which decrypts the secrets of a task
+// before it is handed to the task handler. Decrypted values are set on the
+// Value field of the secret and the encrypted values are cleared.
+func Middleware(d Decryptor) router.Middleware {
+	return func(next task.Handler) task.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t := &client.Task{}
+			if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+				task.WriteError(w, task.NewError("INVALID_TASK", client.CategoryUser, "could not decode task", false, err))
+				return
+			}
+			for i := range t.Secrets {
+				s := &t.Secrets[i]
+				if s.Encrypted == "" {
+					continue
+				}
+				plain, err := d.Decrypt(r.Context(), s)
+				if err != nil {
+					task.WriteError(w, task.NewError("SECRET_DECRYPTION_FAILED", client.CategoryInfrastructure,
+						fmt.Sprintf("could not decrypt secret %s", s.Name), true, err))
+					return
+				}
+				s.Value = string(plain)
+				s.Encrypted = ""
+			}
+			var buf bytes.Buffer
+			if err := json.NewEncoder(&buf).Encode(t); err != nil {
+				task.WriteError(w, err)
+				return
+			}
+			r2 := r.Clone(r.Context())
+			r2.Body = io.NopCloser(&buf)
+			r2.ContentLength = int64(buf.Len())
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Source provides the account secret of the runner, so that it does not
+// have to be passed through the environment or flags.
+type Source interface {
+	Secret(ctx context.Context) (string, error)
+}
+
+// Static is a secret source returning a fixed secret
+type Static string
+
+// Secret returns the secret
+func (s Static) Secret(context.Context) (string, error) {
+	return string(s), nil
+}
+
+// File reads the secret from a file. The file is read again once it was
+// modified, e.g. when the secret was rotated.
+type File struct {
+	Path string
+
+	mu     sync.Mutex
+	mod    time.Time
+	secret string
+}
+
+// NewFile returns a source which reads the secret from the file at path
+func NewFile(path string) *File {
+	return &File{Path: path}
+}
+
+// Secret returns the content of the file without surrounding whitespace
+func (f *File) Secret(context.Context) (string, error) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.secret != "" && info.ModTime().Equal(f.mod) {
+		return f.secret, nil
+	}
+	b, err := os.ReadFile(f.Path)
+	if err != nil {
+		return "", err
+	}
+	f.secret = strings.TrimSpace(string(b))
+	f.mod = info.ModTime()
+	return f.secret, nil
+}
+
+const defaultKVMount = "secret"
+
+// VaultKV reads the secret from the KV version 2 secrets engine of HashiCorp Vault
+type VaultKV struct {
+	Address string
+	Token   string
+	Mount   string // defaults to secret
+	Path    string // path of the secret in the engine
+	Field   string // field of the secret holding the account secret
+	Client  *http.Client
+}
+
+// NewVaultKV returns a source which reads the field of the secret at path
+func NewVaultKV(address, token, path, field string) *VaultKV {
+	return &VaultKV{
+		Address: strings.TrimSuffix(address, "/"),
+		Token:   token,
+		Mount:   defaultKVMount,
+		Path:    path,
+		Field:   field,
+		Client:  http.DefaultClient,
+	}
+}
+
+// Secret reads the latest version of the secret
+func (v *VaultKV) Secret(ctx context.Context) (string, error) {
+	mount := v.Mount
+	if mount == "" {
+		mount = defaultKVMount
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s", v.Address, mount, strings.TrimPrefix(v.Path, "/"))
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	res, err := v.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return "", fmt.Errorf("vault: %s: %s", res.Status, body)
+	}
+	out := struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	secret, ok := out.Data.Data[v.Field]
+	if !ok {
+		return "", fmt.Errorf("vault: field %s not found in secret %s", v.Field, v.Path)
+	}
+	return secret, nil
+}
+
+// SecretsManagerAPI is implemented by AWS Secrets Manager clients. It is kept
+// minimal so that dlite does not need to depend on the AWS SDK.
+type SecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, secretID string) (string, error)
+}
+
+// AWSSecretsManager reads the secret from AWS Secrets Manager
+type AWSSecretsManager struct {
+	API      SecretsManagerAPI
+	SecretID string
+}
+
+// Secret returns the value of the secret
+func (a *AWSSecretsManager) Secret(ctx context.Context) (string, error) {
+	return a.API.GetSecretValue(ctx, a.SecretID)
+}
+
+// SecretManagerAPI is implemented by GCP Secret Manager clients. It is kept
+// minimal so that dlite does not need to depend on the GCP SDK.
+type SecretManagerAPI interface {
+	AccessSecretVersion(ctx context.Context, name string) ([]byte, error)
+}
+
+// GCPSecretManager reads the secret from GCP Secret Manager. Name is the
+// resource name of the version, e.g. projects/p/secrets/s/versions/latest.
+type GCPSecretManager struct {
+	API  SecretManagerAPI
+	Name string
+}
+
+// Secret returns the payload of the secret version
+func (g *GCPSecretManager) Secret(ctx context.Context) (string, error) {
+	b, err := g.API.AccessSecretVersion(ctx, g.Name)
+	if err != nil {
+		return "", err
+	}
+	if len(b) == 0 {
+		return "", errors.New("gcp: secret version is empty")
+	}
+	return string(b), nil
+}
@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/wings-software/dlite/client"
+)
+
+const defaultTransitMount = "transit"
+
+// Vault decrypts secrets using the transit secrets engine of HashiCorp Vault.
+// The KeyID of the secret is the name of the transit key.
+type Vault struct {
+	Address string
+	Token   string
+	Mount   string // defaults to transit
+	Client  *http.Client
+}
+
+// NewVault returns a decryptor which talks to the Vault server at address
+func NewVault(address, token string) *Vault {
+	return &Vault{
+		Address: strings.TrimSuffix(address, "/"),
+		Token:   token,
+		Mount:   defaultTransitMount,
+		Client:  http.DefaultClient,
+	}
+}
+
+// Decrypt decrypts the secret using the transit decrypt endpoint
+func (v *Vault) Decrypt(ctx context.Context, s *client.Secret) ([]byte, error) {
+	in, err := json.Marshal(map[string]string{"ciphertext": s.Encrypted})
+	if err != nil {
+		return nil, err
+	}
+	mount := v.Mount
+	if mount == "" {
+		mount = defaultTransitMount
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/decrypt/%s", v.Address, mount, s.KeyID)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := v.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return nil, fmt.Errorf("vault: %s: %s", res.Status, body)
+	}
+	out := struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Data.Plaintext)
+}
@@ -0,0 +1,205 @@
+// Package spool implements a durable on-disk queue of task statuses which
+// could not be delivered to the manager. Spooled statuses are replayed once
+// connectivity returns.
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/fsname"
+	"github.com/wings-software/dlite/sealed"
+)
+
+const ext = ".json"
+
+// corruptExt is appended to the names of unreadable entries, e.g. sealed
+// with another key, which are kept for recovery but no longer listed
+const corruptExt = ".corrupt"
+
+// ErrFull is returned when an entry can not be spooled because
+// the spool has reached its size limits.
+var ErrFull = errors.New("spool is full")
+
+// Entry is a spooled task status
+type Entry struct {
+	DelegateID string               `json:"delegate_id"`
+	TaskID     string               `json:"task_id"`
+	Response   *client.TaskResponse `json:"response"`
+	Created    time.Time            `json:"created"`
+}
+
+// Spool stores entries as individual files in a directory
+type Spool struct {
+	Dir        string
+	MaxEntries int           // maximum number of spooled entries, 0 means no limit
+	MaxBytes   int64         // maximum total size of spooled entries, 0 means no limit
+	TTL        time.Duration // entries older than this are dropped, 0 means they never expire
+	// Sealer optionally encrypts the entries
+	Sealer sealed.Sealer
+
+	mu     sync.Mutex
+	replay sync.Mutex // held while the entries are replayed
+}
+
+// New returns a spool which stores its entries in dir
+func New(dir string, maxEntries int, maxBytes int64, ttl time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Spool{
+		Dir:        dir,
+		MaxEntries: maxEntries,
+		MaxBytes:   maxBytes,
+		TTL:        ttl,
+	}, nil
+}
+
+// Push adds an entry to the spool
+func (s *Spool) Push(e *Entry) error {
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if b, err = sealed.Seal(s.Sealer, b); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, size, err := s.list()
+	if err != nil {
+		return err
+	}
+	if s.MaxEntries > 0 && len(files) >= s.MaxEntries {
+		return ErrFull
+	}
+	if s.MaxBytes > 0 && size+int64(len(b)) > s.MaxBytes {
+		return ErrFull
+	}
+	name := fmt.Sprintf("%020d-%s%s", e.Created.UnixNano(), fsname.Encode(e.TaskID), ext)
+	tmp := filepath.Join(s.Dir, "."+name)
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.Dir, name))
+}
+
+// Len returns the number of spooled entries
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, _, _ := s.list()
+	return len(files)
+}
+
+// Replay sends the spooled entries to the manager, oldest first. Expired
+// entries are dropped, unreadable entries are renamed with the .corrupt
+// extension and skipped. It stops at the first entry which can not be sent
+// and returns the number of entries which were delivered. Entries can be
+// pushed while they are sent.
+func (s *Spool) Replay(ctx context.Context, c client.Client) (int, error) {
+	s.replay.Lock()
+	defer s.replay.Unlock()
+	entries, err := s.pending()
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, p := range entries {
+		if err := c.SendStatus(ctx, p.entry.DelegateID, p.entry.TaskID, p.entry.Response); err != nil {
+			return sent, err
+		}
+		os.Remove(p.path)
+		sent++
+	}
+	return sent, nil
+}
+
+// pendingEntry is a spooled entry and the file it is stored in
+type pendingEntry struct {
+	path  string
+	entry *Entry
+}
+
+// pending reads the entries to replay, oldest first
+func (s *Spool) pending() ([]pendingEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, _, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	var entries []pendingEntry
+	for _, f := range files {
+		path := filepath.Join(s.Dir, f)
+		e, err := read(path, s.Sealer)
+		if err != nil {
+			logrus.WithError(err).WithField("file", path).Errorln("spool: moving unreadable entry aside")
+			quarantine(path)
+			continue
+		}
+		if s.TTL > 0 && time.Since(e.Created) > s.TTL {
+			logrus.WithField("task_id", e.TaskID).Warnln("spool: dropping expired task status")
+			os.Remove(path)
+			continue
+		}
+		entries = append(entries, pendingEntry{path: path, entry: e})
+	}
+	return entries, nil
+}
+
+// list returns the entry file names in order of creation and their total size
+func (s *Spool) list() ([]string, int64, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	var (
+		files []string
+		size  int64
+	)
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || !strings.HasSuffix(e.Name(), ext) {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			size += info.Size()
+		}
+		files = append(files, e.Name())
+	}
+	sort.Strings(files)
+	return files, size, nil
+}
+
+func read(path string, sealer sealed.Sealer) (*Entry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = sealed.Open(sealer, b); err != nil {
+		return nil, err
+	}
+	e := &Entry{}
+	return e, json.Unmarshal(b, e)
+}
+
+// quarantine moves an unreadable entry aside instead of deleting it, so
+// that it can be recovered, e.g. once the key it was sealed with is restored
+func quarantine(path string) {
+	if err := os.Rename(path, path+corruptExt); err != nil {
+		logrus.WithError(err).WithField("file", path).Errorln("spool: could not move unreadable entry aside")
+	}
+}
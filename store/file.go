@@ -0,0 +1,233 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wings-software/dlite/fsname"
+	"github.com/wings-software/dlite/sealed"
+	"github.com/wings-software/dlite/spool"
+)
+
+const ext = ".json"
+
+// File is a store which keeps the state as files in a directory. Replicas on
+// the same host, or sharing the directory over a network file system with
+// atomic exclusive creates, can share it.
+type File struct {
+	Dir string
+	// Sealer optionally encrypts the task records and statuses
+	Sealer sealed.Sealer
+}
+
+// NewFile returns a store which keeps its state in dir
+func NewFile(dir string) (*File, error) {
+	for _, sub := range []string{"tasks", "statuses", "claims", "checkpoints"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &File{Dir: dir}, nil
+}
+
+func (f *File) PutTask(_ context.Context, r *TaskRecord) error {
+	return f.writeJSON(f.path("tasks", r.ID), r)
+}
+
+func (f *File) GetTask(_ context.Context, id string) (*TaskRecord, error) {
+	r := &TaskRecord{}
+	if err := f.readJSON(f.path("tasks", id), r); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+func (f *File) ListTasks(_ context.Context) ([]*TaskRecord, error) {
+	names, err := list(filepath.Join(f.Dir, "tasks"))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*TaskRecord, 0, len(names))
+	for _, name := range names {
+		r := &TaskRecord{}
+		if err := f.readJSON(filepath.Join(f.Dir, "tasks", name), r); err != nil {
+			continue // removed concurrently or being written
+		}
+		_ = fsname.Migrate(filepath.Join(f.Dir, "tasks"), name, r.ID, ext)
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].AcquiredAt.Before(records[j].AcquiredAt) })
+	return records, nil
+}
+
+func (f *File) PushStatus(_ context.Context, e *spool.Entry) error {
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
+	return f.writeJSON(f.path("statuses", e.TaskID), e)
+}
+
+func (f *File) ListStatuses(_ context.Context) ([]*spool.Entry, error) {
+	names, err := list(filepath.Join(f.Dir, "statuses"))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*spool.Entry, 0, len(names))
+	for _, name := range names {
+		e := &spool.Entry{}
+		if err := f.readJSON(filepath.Join(f.Dir, "statuses", name), e); err != nil {
+			continue
+		}
+		_ = fsname.Migrate(filepath.Join(f.Dir, "statuses"), name, e.TaskID, ext)
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Created.Before(entries[j].Created) })
+	return entries, nil
+}
+
+func (f *File) DeleteStatus(_ context.Context, taskID string) error {
+	return remove(f.path("statuses", taskID))
+}
+
+// Claim links a file holding the expiry of the claim to the claim file, so
+// that the claim is created exclusively and complete. An expired claim is
+// taken over by the one runner which creates the takeover marker named by
+// its expiry, replicas which read the same expired claim lose to it.
+func (f *File) Claim(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	path := f.path("claims", key)
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%d-%s", time.Now().UnixNano(), filepath.Base(path)))
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(time.Now().Add(ttl).UnixNano(), 10)), 0o600); err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp)
+	for attempt := 0; attempt < 2; attempt++ {
+		err := os.Link(tmp, path)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+		b, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // unclaimed concurrently
+		}
+		if err != nil {
+			return false, err
+		}
+		exp, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil || time.Now().UnixNano() < exp {
+			return false, nil
+		}
+		marker, err := os.OpenFile(takeoverMarker(path, exp), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		marker.Close()
+		if err := os.Rename(tmp, path); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (f *File) Unclaim(_ context.Context, key string) error {
+	path := f.path("claims", key)
+	markers, _ := filepath.Glob(strings.TrimSuffix(path, ext) + ".*.takeover")
+	for _, m := range markers {
+		_ = remove(m)
+	}
+	return remove(path)
+}
+
+// takeoverMarker returns the path of the marker of the takeover of the
+// claim which expired at exp
+func takeoverMarker(path string, exp int64) string {
+	return fmt.Sprintf("%s.%d.takeover", strings.TrimSuffix(path, ext), exp)
+}
+
+func (f *File) PutCheckpoint(_ context.Context, c *Checkpoint) error {
+	return f.writeJSON(f.path("checkpoints", c.TaskID), c)
+}
+
+func (f *File) GetCheckpoint(_ context.Context, taskID string) (*Checkpoint, error) {
+	c := &Checkpoint{}
+	if err := f.readJSON(f.path("checkpoints", taskID), c); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (f *File) DeleteCheckpoint(_ context.Context, taskID string) error {
+	return remove(f.path("checkpoints", taskID))
+}
+
+func (f *File) path(kind, id string) string {
+	return filepath.Join(f.Dir, kind, fsname.Encode(id)+ext)
+}
+
+func list(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ext) && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// writeJSON atomically writes v to path
+func (f *File) writeJSON(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if b, err = sealed.Seal(f.Sealer, b); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%d-%s", time.Now().UnixNano(), filepath.Base(path)))
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (f *File) readJSON(path string, v interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if b, err = sealed.Open(f.Sealer, b); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
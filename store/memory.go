@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wings-software/dlite/spool"
+)
+
+// Memory is a store which keeps the state in memory. It can not be shared
+// between processes.
+type Memory struct {
+	mu       sync.Mutex
+	tasks    map[string]*TaskRecord
+	statuses []*spool.Entry
+	claims   map[string]time.Time // expiry of the claims
+
+	checkpoints map[string]*Checkpoint
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		tasks:  map[string]*TaskRecord{},
+		claims: map[string]time.Time{},
+
+		checkpoints: map[string]*Checkpoint{},
+	}
+}
+
+func (m *Memory) PutTask(_ context.Context, r *TaskRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *r
+	m.tasks[r.ID] = &c
+	return nil
+}
+
+func (m *Memory) GetTask(_ context.Context, id string) (*TaskRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.tasks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *r
+	return &c, nil
+}
+
+func (m *Memory) ListTasks(_ context.Context) ([]*TaskRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	records := make([]*TaskRecord, 0, len(m.tasks))
+	for _, r := range m.tasks {
+		c := *r
+		records = append(records, &c)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].AcquiredAt.Before(records[j].AcquiredAt) })
+	return records, nil
+}
+
+func (m *Memory) PushStatus(_ context.Context, e *spool.Entry) error {
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses = append(m.statuses, e)
+	return nil
+}
+
+func (m *Memory) ListStatuses(_ context.Context) ([]*spool.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*spool.Entry(nil), m.statuses...), nil
+}
+
+func (m *Memory) DeleteStatus(_ context.Context, taskID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, e := range m.statuses {
+		if e.TaskID == taskID {
+			m.statuses = append(m.statuses[:i], m.statuses[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Claim(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if exp, ok := m.claims[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	m.claims[key] = now.Add(ttl)
+	return true, nil
+}
+
+func (m *Memory) Unclaim(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.claims, key)
+	return nil
+}
+
+func (m *Memory) PutCheckpoint(_ context.Context, c *Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *c
+	m.checkpoints[c.TaskID] = &cp
+	return nil
+}
+
+func (m *Memory) GetCheckpoint(_ context.Context, taskID string) (*Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.checkpoints[taskID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (m *Memory) DeleteCheckpoint(_ context.Context, taskID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.checkpoints, taskID)
+	return nil
+}
@@ -0,0 +1,84 @@
+// Package store defines the storage of the runner state: the ledger of the
+// executed tasks, the task statuses which could not be delivered and the
+// claims which prevent a task from being handled twice. Replicas of a runner
+// can share their state by using the same store.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/spool"
+)
+
+// ErrNotFound is returned when a task is not in the ledger
+var ErrNotFound = errors.New("store: not found")
+
+// Task states recorded in the ledger
+const (
+	StateRunning   = "running"
+	StateCompleted = "completed"
+)
+
+// TaskRecord is the ledger record of a task
+type TaskRecord struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	DelegateID  string    `json:"delegate_id"`
+	State       string    `json:"state"`
+	Code        string    `json:"code,omitempty"` // status code of a completed task
+	AcquiredAt  time.Time `json:"acquired_at"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+
+	// Runner is the name of the runner which acquired the task
+	Runner string `json:"runner,omitempty"`
+	// Task is the acquired task. It is kept while the task is running, so
+	// that a runner restarted after a crash knows the full task.
+	Task *client.Task `json:"task,omitempty"`
+}
+
+// Store stores the runner state. Implementations must be safe for concurrent use.
+type Store interface {
+	// PutTask creates or replaces the ledger record of a task
+	PutTask(ctx context.Context, r *TaskRecord) error
+	// GetTask returns the ledger record of a task or ErrNotFound
+	GetTask(ctx context.Context, id string) (*TaskRecord, error)
+	// ListTasks returns the ledger records
+	ListTasks(ctx context.Context) ([]*TaskRecord, error)
+
+	// PushStatus stores a task status which could not be sent
+	PushStatus(ctx context.Context, e *spool.Entry) error
+	// ListStatuses returns the stored statuses, oldest first
+	ListStatuses(ctx context.Context) ([]*spool.Entry, error)
+	// DeleteStatus removes the stored status of a task
+	DeleteStatus(ctx context.Context, taskID string) error
+
+	// Claim claims the key for ttl. It returns false if the key is
+	// already claimed and the claim did not expire.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Unclaim releases the claim on the key
+	Unclaim(ctx context.Context, key string) error
+}
+
+// Checkpoint is the last checkpoint saved by the handler of a multi-stage
+// task, from which the task resumes after a restart
+type Checkpoint struct {
+	TaskID   string          `json:"task_id"`
+	Stage    string          `json:"stage"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Sequence int             `json:"sequence"` // number of checkpoints saved for the task
+	SavedAt  time.Time       `json:"saved_at"`
+}
+
+// Checkpointer is implemented by stores which keep the checkpoints of tasks
+type Checkpointer interface {
+	// PutCheckpoint replaces the checkpoint of the task
+	PutCheckpoint(ctx context.Context, c *Checkpoint) error
+	// GetCheckpoint returns the checkpoint of the task or ErrNotFound
+	GetCheckpoint(ctx context.Context, taskID string) (*Checkpoint, error)
+	// DeleteCheckpoint removes the checkpoint of the task
+	DeleteCheckpoint(ctx context.Context, taskID string) error
+}
@@ -0,0 +1,149 @@
+// Package support generates support bundles: a gzipped tar archive of the
+// state of a runner to attach to support tickets. A bundle holds the redacted
+// config, the stats and jobs of the poller, the recent logs and requests to
+// the manager, the scheduling decisions and a dump of the goroutines.
+package support
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/wings-software/dlite/delegate"
+	"github.com/wings-software/dlite/version"
+)
+
+// Manifest describes the bundle and the runner it was generated on
+type Manifest struct {
+	Version    string    `json:"version"`
+	Commit     string    `json:"commit"`
+	Created    time.Time `json:"created"`
+	Hostname   string    `json:"hostname"`
+	OS         string    `json:"os"`
+	Arch       string    `json:"arch"`
+	GoVersion  string    `json:"go_version"`
+	Goroutines int       `json:"goroutines"`
+	Files      []string  `json:"files"`
+	// Errors are the parts of the bundle which could not be generated
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Bundle is the content of a support bundle. Empty parts are left out.
+type Bundle struct {
+	// Config is the config of the runner, which must be redacted
+	Config interface{}
+	Stats  interface{}
+	Jobs   interface{}
+	Logs   *LogBuffer
+	Traces []delegate.Trace
+	// Decisions are the recent scheduling decisions of the poller
+	Decisions interface{}
+	// Goroutines adds a dump of the stacks of all goroutines
+	Goroutines bool
+	// Notes are added to the manifest errors, e.g. why a part is missing
+	Notes []string
+}
+
+// Write writes the bundle to w as a gzipped tar archive
+func (b *Bundle) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	m := &Manifest{
+		Version:    version.Version,
+		Commit:     version.Commit,
+		Created:    time.Now().UTC(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+		Errors:     append([]string{}, b.Notes...),
+	}
+	m.Hostname, _ = os.Hostname()
+	files := map[string][]byte{}
+	var names []string
+	add := func(name string, data []byte) {
+		files[name] = data
+		names = append(names, name)
+	}
+	addJSON := func(name string, v interface{}) {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			m.Errors = append(m.Errors, fmt.Sprintf("%s: %s", name, err))
+			return
+		}
+		add(name, data)
+	}
+	if b.Config != nil {
+		addJSON("config.json", b.Config)
+	}
+	if b.Stats != nil {
+		addJSON("stats.json", b.Stats)
+	}
+	if b.Jobs != nil {
+		addJSON("jobs.json", b.Jobs)
+	}
+	if b.Logs != nil {
+		add("logs.txt", []byte(strings.Join(b.Logs.Lines(), "")))
+	}
+	if b.Traces != nil {
+		addJSON("traces.json", b.Traces)
+	}
+	if b.Decisions != nil {
+		addJSON("decisions.json", b.Decisions)
+	}
+	if b.Goroutines {
+		var buf strings.Builder
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+			m.Errors = append(m.Errors, fmt.Sprintf("goroutines.txt: %s", err))
+		} else {
+			add("goroutines.txt", []byte(buf.String()))
+		}
+	}
+	m.Files = names
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(tw, "manifest.json", manifest, m.Created); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := writeFile(tw, name, files[name], m.Created); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, mod time.Time) error {
+	hdr := &tar.Header{Name: "dlite-support/" + name, Mode: 0o600, Size: int64(len(data)), ModTime: mod}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Handler serves the bundle returned by fn as an attachment
+func Handler(fn func() *Bundle) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := fmt.Sprintf("dlite-support-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		if err := fn().Write(w); err != nil {
+			// the archive is incomplete, the error can not be reported with the status
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package support
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultLogLines is the number of log lines kept by a LogBuffer
+const defaultLogLines = 1000
+
+// LogBuffer is a logrus hook keeping the most recent log lines
+type LogBuffer struct {
+	mu        sync.Mutex
+	lines     []string
+	next      int
+	size      int
+	formatter logrus.Formatter
+}
+
+// NewLogBuffer returns a buffer of the last size log lines, 1000 if size is
+// not positive. It is added to the standard logger with logrus.AddHook.
+func NewLogBuffer(size int) *LogBuffer {
+	if size <= 0 {
+		size = defaultLogLines
+	}
+	return &LogBuffer{
+		size:      size,
+		formatter: &logrus.TextFormatter{DisableColors: true, FullTimestamp: true},
+	}
+}
+
+// Levels returns the levels of the kept lines, all of them
+func (b *LogBuffer) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire keeps the log entry
+func (b *LogBuffer) Fire(e *logrus.Entry) error {
+	line, err := b.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.lines) < b.size {
+		b.lines = append(b.lines, string(line))
+		return nil
+	}
+	b.lines[b.next] = string(line)
+	b.next = (b.next + 1) % b.size
+	return nil
+}
+
+// Lines returns the kept log lines, oldest first
+func (b *LogBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append(append([]string{}, b.lines[b.next:]...), b.lines[:b.next]...)
+}
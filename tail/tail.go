@@ -0,0 +1,30 @@
+// Package tail implements a buffer which keeps the end of the output of a
+// command, e.g. its standard error.
+package tail
+
+// Buffer keeps the last Max bytes written to it
+type Buffer struct {
+	Max int
+	// Truncated is set once bytes were dropped from the start of the buffer
+	Truncated bool
+
+	buf []byte
+}
+
+// New returns a buffer which keeps the last size bytes written to it
+func New(size int) *Buffer {
+	return &Buffer{Max: size}
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.Max {
+		b.Truncated = true
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.Max:]...)
+	}
+	return len(p), nil
+}
+
+func (b *Buffer) String() string {
+	return string(b.buf)
+}
@@ -0,0 +1,80 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/httphelper"
+)
+
+// ErrorHeader is set on the response of a handler which failed with a task error
+const ErrorHeader = "X-Dlite-Task-Error"
+
+// Error is returned by handlers to report a structured failure of the task
+type Error struct {
+	client.TaskError
+	Err error // underlying cause, not sent to the manager
+}
+
+// NewError returns a task error with the given code, category and user facing message
+func NewError(code, category, message string, retryable bool, cause error) *Error {
+	return &Error{
+		TaskError: client.TaskError{
+			Code:      code,
+			Category:  category,
+			Message:   message,
+			Retryable: retryable,
+		},
+		Err: cause,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WriteError writes the error to the response. Errors which are not task errors are
+// reported as internal errors.
+func WriteError(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = NewError("INTERNAL_ERROR", client.CategoryInternal, err.Error(), false, err)
+	}
+	status := http.StatusInternalServerError
+	if e.Category == client.CategoryUser {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set(ErrorHeader, "true")
+	httphelper.WriteJSON(w, &e.TaskError, status)
+}
+
+// ErrorFrom returns the task error written by a handler, if any
+func ErrorFrom(header http.Header, body []byte) (*client.TaskError, bool) {
+	if header.Get(ErrorHeader) == "" {
+		return nil, false
+	}
+	e := &client.TaskError{}
+	if err := json.Unmarshal(body, e); err != nil {
+		e.Code = "INTERNAL_ERROR"
+		e.Category = client.CategoryInternal
+		e.Message = "could not decode task error"
+	}
+	return e, true
+}
+
+// ResponseCode returns the task response code for a task error
+func ResponseCode(e *client.TaskError) string {
+	if e.Retryable {
+		return client.CodeRetry
+	}
+	return client.CodeFailed
+}
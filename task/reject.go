@@ -0,0 +1,71 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wings-software/dlite/httphelper"
+)
+
+// RejectHeader is set on the response of a handler which rejects its task
+const RejectHeader = "X-Dlite-Reject"
+
+// RejectTask is returned by a handler which can not execute its task
+// (missing binary, wrong platform). The task is given back to the manager
+// so that it can be assigned to another runner.
+type RejectTask struct {
+	Reason string `json:"reason"`
+	Code   string `json:"code,omitempty"` // machine readable reason, optional
+}
+
+func (e *RejectTask) Error() string {
+	return "task rejected: " + e.Reason
+}
+
+// Reject writes a rejection of the task to the response
+func Reject(w http.ResponseWriter, reason string) {
+	writeRejection(w, &RejectTask{Reason: reason})
+}
+
+// RejectWithCode writes a rejection of the task with a machine readable code
+// to the response
+func RejectWithCode(w http.ResponseWriter, code, reason string) {
+	writeRejection(w, &RejectTask{Reason: reason, Code: code})
+}
+
+func writeRejection(w http.ResponseWriter, r *RejectTask) {
+	w.Header().Set(RejectHeader, "true")
+	httphelper.WriteJSON(w, r, http.StatusConflict)
+}
+
+// Rejection returns the rejection written by a handler, if any
+func Rejection(header http.Header, body []byte) (*RejectTask, bool) {
+	if header.Get(RejectHeader) == "" {
+		return nil, false
+	}
+	r := &RejectTask{}
+	if err := json.Unmarshal(body, r); err != nil {
+		r.Reason = "unknown"
+	}
+	return r, true
+}
+
+// HandlerFunc is an adapter which allows a function returning an error to be used
+// as a task handler. A RejectTask error rejects the task, any other error is
+// written as a task error.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP calls f(w, r) and writes the returned error
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := f(w, r)
+	if err == nil {
+		return
+	}
+	var reject *RejectTask
+	if errors.As(err, &reject) {
+		writeRejection(w, reject)
+		return
+	}
+	WriteError(w, err)
+}
@@ -0,0 +1,51 @@
+package task
+
+import (
+	"io"
+	"net/http"
+)
+
+// StreamWriter is the response writer of a streaming handler. Output written
+// to it is sent to the manager incrementally while the task runs, the response
+// body is sent once the task completed.
+type StreamWriter interface {
+	http.ResponseWriter
+	// Flush sends the pending output immediately
+	http.Flusher
+	// Output returns the writer of the incremental output
+	Output() io.Writer
+}
+
+// StreamHandler is a task handler which writes incremental output,
+// e.g. the log lines of a long-running step.
+type StreamHandler interface {
+	ServeStream(w StreamWriter, r *http.Request)
+}
+
+// StreamHandlerFunc adapts a function to a StreamHandler
+type StreamHandlerFunc func(w StreamWriter, r *http.Request)
+
+// ServeStream calls f(w, r)
+func (f StreamHandlerFunc) ServeStream(w StreamWriter, r *http.Request) {
+	f(w, r)
+}
+
+// Streaming returns a handler serving the stream handler. If the response
+// writer does not support streaming, the output is discarded.
+func Streaming(h StreamHandler) Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw, ok := w.(StreamWriter)
+		if !ok {
+			sw = discardOutput{w}
+		}
+		h.ServeStream(sw, r)
+	})
+}
+
+type discardOutput struct {
+	http.ResponseWriter
+}
+
+func (discardOutput) Flush() {}
+
+func (discardOutput) Output() io.Writer { return io.Discard }
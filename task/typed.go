@@ -0,0 +1,49 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/wings-software/dlite/client"
+	"github.com/wings-software/dlite/httphelper"
+)
+
+// Validator is implemented by payloads which validate themselves
+type Validator interface {
+	Validate() error
+}
+
+// TypedFunc handles a task whose data was decoded into a payload of type T.
+// The returned value is written as the task response.
+type TypedFunc[T any] func(ctx context.Context, t *client.Task, payload *T) (interface{}, error)
+
+// Typed returns a handler which decodes the task data into a T and validates it
+// before calling fn. Unknown fields in the task data are refused, so that
+// payloads which do not match the struct fail loudly.
+func Typed[T any](fn TypedFunc[T]) Handler {
+	return HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		t := &client.Task{}
+		if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+			return NewError("INVALID_TASK", client.CategoryUser, "could not decode the task", false, err)
+		}
+		payload := new(T)
+		dec := json.NewDecoder(bytes.NewReader(t.Data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(payload); err != nil {
+			return NewError("INVALID_PAYLOAD", client.CategoryUser, "could not decode the task data: "+err.Error(), false, err)
+		}
+		if v, ok := interface{}(payload).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return NewError("INVALID_PAYLOAD", client.CategoryUser, "invalid task data: "+err.Error(), false, err)
+			}
+		}
+		out, err := fn(r.Context(), t, payload)
+		if err != nil {
+			return err
+		}
+		httphelper.WriteJSON(w, out, http.StatusOK)
+		return nil
+	})
+}
@@ -0,0 +1,165 @@
+// Package taskcache caches task payloads in memory by task ID, so that
+// handlers which process the same task again, e.g. on a retry or in a later
+// step of a multi-step flow, do not fetch its data again. The cache is
+// bounded by the number of entries and their total size and evicts the
+// least recently used entries first.
+package taskcache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/wings-software/dlite/metrics"
+)
+
+// Stats are the counters of a cache
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// Cache is a bounded LRU cache of task payloads
+type Cache struct {
+	// MaxEntries bounds the number of cached payloads, unbounded if zero
+	MaxEntries int
+	// MaxBytes bounds the total size of the cached payloads, unbounded if zero
+	MaxBytes int64
+	// Metrics optionally records the hits, misses and evictions
+	Metrics *metrics.Registry
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	stats Stats
+}
+
+type entry struct {
+	taskID string
+	data   []byte
+}
+
+// New returns a cache bounded by the number of entries and bytes
+func New(maxEntries int, maxBytes int64) *Cache {
+	return &Cache{MaxEntries: maxEntries, MaxBytes: maxBytes}
+}
+
+// Get returns the cached payload of the task. The payload must not be modified.
+func (c *Cache) Get(taskID string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[taskID]; ok {
+		c.ll.MoveToFront(e)
+		c.stats.Hits++
+		c.count("dlite_payload_cache_hits_total", "Payload cache lookups which found the task.", 1)
+		return e.Value.(*entry).data, true
+	}
+	c.stats.Misses++
+	c.count("dlite_payload_cache_misses_total", "Payload cache lookups which did not find the task.", 1)
+	return nil, false
+}
+
+// Put caches the payload of the task, replacing a cached one. Payloads
+// larger than MaxBytes are not cached.
+func (c *Cache) Put(taskID string, data []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(taskID)
+	if c.MaxBytes > 0 && int64(len(data)) > c.MaxBytes {
+		c.observe()
+		return
+	}
+	if c.items == nil {
+		c.ll = list.New()
+		c.items = map[string]*list.Element{}
+	}
+	c.items[taskID] = c.ll.PushFront(&entry{taskID: taskID, data: data})
+	c.stats.Bytes += int64(len(data))
+	var evicted int
+	for (c.MaxEntries > 0 && c.ll.Len() > c.MaxEntries) || (c.MaxBytes > 0 && c.stats.Bytes > c.MaxBytes) {
+		c.remove(c.ll.Back().Value.(*entry).taskID)
+		evicted++
+	}
+	c.stats.Evictions += int64(evicted)
+	c.count("dlite_payload_cache_evictions_total", "Payloads evicted from the payload cache.", evicted)
+	c.observe()
+}
+
+// Invalidate removes the cached payload of the task
+func (c *Cache) Invalidate(taskID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(taskID)
+	c.observe()
+}
+
+// Purge removes all the cached payloads
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll, c.items = nil, nil
+	c.stats.Bytes = 0
+	c.observe()
+}
+
+// Stats returns the counters of the cache
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = len(c.items)
+	return s
+}
+
+// remove removes the entry of the task, if any
+func (c *Cache) remove(taskID string) {
+	e, ok := c.items[taskID]
+	if !ok {
+		return
+	}
+	c.ll.Remove(e)
+	delete(c.items, taskID)
+	c.stats.Bytes -= int64(len(e.Value.(*entry).data))
+}
+
+// count adds n to the counter if Metrics is set
+func (c *Cache) count(name, help string, n int) {
+	if c.Metrics != nil && n > 0 {
+		c.Metrics.Counter(name, help, nil).Add(float64(n))
+	}
+}
+
+// observe records the size of the cache if Metrics is set
+func (c *Cache) observe() {
+	if c.Metrics == nil {
+		return
+	}
+	c.Metrics.Gauge("dlite_payload_cache_entries", "Payloads in the payload cache.", nil).Set(float64(len(c.items)))
+	c.Metrics.Gauge("dlite_payload_cache_bytes", "Size of the payloads in the payload cache.", nil).Set(float64(c.stats.Bytes))
+}
+
+type key struct{}
+
+// NewContext returns a copy of the context which carries the cache
+func NewContext(ctx context.Context, c *Cache) context.Context {
+	return context.WithValue(ctx, key{}, c)
+}
+
+// FromContext returns the cache carried by the context. Lookups of the nil
+// cache returned if there is none always miss.
+func FromContext(ctx context.Context) *Cache {
+	c, _ := ctx.Value(key{}).(*Cache)
+	return c
+}
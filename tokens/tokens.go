@@ -0,0 +1,201 @@
+// Package tokens mints and validates the encrypted JWTs which authenticate
+// delegates with the Harness manager, so that other tools can create tokens
+// for an account without a delegate client.
+package tokens
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Algorithm is the content encryption algorithm of a token. Tokens are
+// encrypted directly with the hex decoded account secret, whose length
+// must match the key size of the algorithm.
+type Algorithm string
+
+// Supported algorithms
+const (
+	A128GCM      Algorithm = "A128GCM" // the algorithm used by the manager, 16 byte secret
+	A192GCM      Algorithm = "A192GCM" // 24 byte secret
+	A256GCM      Algorithm = "A256GCM" // 32 byte secret
+	A128CBCHS256 Algorithm = "A128CBC-HS256"
+	A256CBCHS512 Algorithm = "A256CBC-HS512"
+)
+
+// keySizes are the secret sizes in bytes of the algorithms
+var keySizes = map[Algorithm]int{
+	A128GCM:      16,
+	A192GCM:      24,
+	A256GCM:      32,
+	A128CBCHS256: 32,
+	A256CBCHS512: 64,
+}
+
+// Defaults of the token options
+const (
+	DefaultAudience = "audience"
+	DefaultIssuer   = "issuer"
+	DefaultTTL      = 10 * time.Minute
+)
+
+// ErrInvalid is returned when a token fails validation
+var ErrInvalid = errors.New("tokens: invalid token")
+
+// Options configures the tokens. Zero values are replaced by the defaults.
+type Options struct {
+	Audience  string
+	Issuer    string
+	TTL       time.Duration
+	Algorithm Algorithm // defaults to A128GCM
+
+	// IssuedAt is the issue time of minted tokens and the time at which
+	// tokens are validated, defaults to now
+	IssuedAt time.Time
+	// Leeway is the clock skew tolerated when validating tokens
+	Leeway time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Audience == "" {
+		o.Audience = DefaultAudience
+	}
+	if o.Issuer == "" {
+		o.Issuer = DefaultIssuer
+	}
+	if o.TTL <= 0 {
+		o.TTL = DefaultTTL
+	}
+	if o.Algorithm == "" {
+		o.Algorithm = A128GCM
+	}
+	if o.IssuedAt.IsZero() {
+		o.IssuedAt = time.Now()
+	}
+	return o
+}
+
+// Claims are the claims of a token
+type Claims struct {
+	ID       string    `json:"id"`
+	Subject  string    `json:"subject"` // the account ID
+	Issuer   string    `json:"issuer"`
+	Audience []string  `json:"audience"`
+	IssuedAt time.Time `json:"issuedAt"`
+	Expiry   time.Time `json:"expiry"`
+}
+
+// Mint creates a token for the subject, usually the account ID, encrypted
+// with the hex encoded secret
+func Mint(subject, secret string, opts Options) (string, error) {
+	o := opts.withDefaults()
+	key, err := decodeKey(secret, o.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	enc, err := jose.NewEncrypter(
+		jose.ContentEncryption(o.Algorithm),
+		jose.Recipient{Algorithm: jose.DIRECT, Key: key},
+		(&jose.EncrypterOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return "", err
+	}
+	cl := jwt.Claims{
+		Subject:  subject,
+		Issuer:   o.Issuer,
+		Audience: []string{o.Audience},
+		Expiry:   jwt.NewNumericDate(o.IssuedAt.Add(o.TTL)),
+		IssuedAt: jwt.NewNumericDate(o.IssuedAt),
+		ID:       uuid.New().String(),
+	}
+	return jwt.Encrypted(enc).Claims(cl).CompactSerialize()
+}
+
+// Validate decrypts the token and checks that it is neither expired nor
+// issued in the future and that its audience and issuer match the options.
+// Errors other than a malformed token or a wrong secret wrap ErrInvalid.
+func Validate(token, secret string, opts Options) (*Claims, error) {
+	o := opts.withDefaults()
+	cl, err := decrypt(token, secret, o.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	expected := jwt.Expected{Issuer: o.Issuer, Audience: jwt.Audience{o.Audience}, Time: o.IssuedAt}
+	if err := cl.ValidateWithLeeway(expected, o.Leeway); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	if cl.IssuedAt != nil && cl.IssuedAt.Time().After(o.IssuedAt.Add(o.Leeway)) {
+		return nil, fmt.Errorf("%w: token issued in the future", ErrInvalid)
+	}
+	return claims(cl), nil
+}
+
+// Inspect decrypts the token and returns its claims without validating them
+func Inspect(token, secret string) (*Claims, error) {
+	tok, err := jwt.ParseEncrypted(token)
+	if err != nil {
+		return nil, err
+	}
+	alg := A128GCM
+	if len(tok.Headers) > 0 {
+		if enc, ok := tok.Headers[0].ExtraHeaders["enc"].(string); ok {
+			alg = Algorithm(enc)
+		}
+	}
+	cl, err := decrypt(token, secret, alg)
+	if err != nil {
+		return nil, err
+	}
+	return claims(cl), nil
+}
+
+// decrypt decrypts the claims of the token
+func decrypt(token, secret string, alg Algorithm) (*jwt.Claims, error) {
+	key, err := decodeKey(secret, alg)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := jwt.ParseEncrypted(token)
+	if err != nil {
+		return nil, err
+	}
+	cl := &jwt.Claims{}
+	if err := tok.Claims(key, cl); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
+// decodeKey decodes the hex encoded secret and checks its size
+func decodeKey(secret string, alg Algorithm) ([]byte, error) {
+	size, ok := keySizes[alg]
+	if !ok {
+		return nil, fmt.Errorf("tokens: unsupported algorithm %s", alg)
+	}
+	key, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != size {
+		return nil, fmt.Errorf("tokens: %s requires a %d byte secret, got %d bytes", alg, size, len(key))
+	}
+	return key, nil
+}
+
+// claims converts the JWT claims
+func claims(cl *jwt.Claims) *Claims {
+	c := &Claims{ID: cl.ID, Subject: cl.Subject, Issuer: cl.Issuer, Audience: cl.Audience}
+	if cl.IssuedAt != nil {
+		c.IssuedAt = cl.IssuedAt.Time()
+	}
+	if cl.Expiry != nil {
+		c.Expiry = cl.Expiry.Time()
+	}
+	return c
+}
@@ -0,0 +1,22 @@
+// Package version holds build metadata which is set at link time, e.g.
+//
+//	go build -ldflags "-X github.com/wings-software/dlite/version.Version=1.0.0"
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+var (
+	// Version is the released version of dlite
+	Version = "dev"
+
+	// Commit is the git commit dlite was built from
+	Commit = "none"
+)
+
+// UserAgent returns the User-Agent sent to the manager, e.g. dlite/1.0.0 (linux/amd64)
+func UserAgent() string {
+	return fmt.Sprintf("dlite/%s (%s/%s)", Version, runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,123 @@
+// Package workspace allocates an isolated working directory per task. The
+// directory is handed to the task handler through the context and removed
+// once the task completed, so that handlers do not leak files on the host.
+package workspace
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/wings-software/dlite/fsname"
+)
+
+type key struct{}
+
+// Manager allocates the workspaces of tasks below a root directory
+type Manager struct {
+	Root string
+	// Quota bounds the disk usage of a workspace in bytes, unlimited if zero
+	Quota int64
+}
+
+// New returns a manager which allocates workspaces below root
+func New(root string, quota int64) (*Manager, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	return &Manager{Root: root, Quota: quota}, nil
+}
+
+// Create allocates an empty workspace for the task. A workspace left
+// behind by a previous attempt of the task is removed.
+func (m *Manager) Create(taskID string) (*Workspace, error) {
+	path := filepath.Join(m.Root, fsname.Encode(taskID))
+	if err := os.RemoveAll(path); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(path, 0o700); err != nil {
+		return nil, err
+	}
+	return &Workspace{Path: path, Quota: m.Quota}, nil
+}
+
+// Clean removes all workspaces, e.g. those of tasks aborted by a crash
+func (m *Manager) Clean() error {
+	entries, err := os.ReadDir(m.Root)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(m.Root, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Workspace is the working directory of a task
+type Workspace struct {
+	Path  string
+	Quota int64
+}
+
+// Size returns the disk usage of the workspace in bytes
+func (w *Workspace) Size() (int64, error) {
+	var size int64
+	err := filepath.WalkDir(w.Path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// files may be removed by the handler while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Exceeded reports whether the workspace uses more disk than its quota
+func (w *Workspace) Exceeded() bool {
+	if w.Quota <= 0 {
+		return false
+	}
+	size, err := w.Size()
+	return err == nil && size > w.Quota
+}
+
+// Remove removes the workspace and its content
+func (w *Workspace) Remove() error {
+	return os.RemoveAll(w.Path)
+}
+
+// NewContext returns a copy of the context which carries the workspace
+func NewContext(ctx context.Context, w *Workspace) context.Context {
+	return context.WithValue(ctx, key{}, w)
+}
+
+// FromContext returns the workspace carried by the context, if any
+func FromContext(ctx context.Context) (*Workspace, bool) {
+	w, ok := ctx.Value(key{}).(*Workspace)
+	return w, ok
+}
+
+// Path returns the path of the workspace carried by the context. It falls
+// back to the temp directory if the task has no workspace.
+func Path(ctx context.Context) string {
+	if w, ok := FromContext(ctx); ok {
+		return w.Path
+	}
+	return os.TempDir()
+}